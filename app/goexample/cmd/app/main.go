@@ -3,268 +3,411 @@ package main
 import (
 	"context"
 	"errors"
-	"fmt"
+	"flag"
+	"goexample/pkg/annotations"
+	"goexample/pkg/app"
+	"goexample/pkg/chaos"
+	"goexample/pkg/clock"
+	"goexample/pkg/errfmt"
 	"goexample/pkg/kafkapkg"
+	"goexample/pkg/objectstore"
+	"goexample/pkg/scheduler"
+	"goexample/pkg/server"
+	"goexample/pkg/telemetry"
+	"goexample/pkg/warmup"
+	"goexample/pkg/watchdog"
 	"io"
 	"log"
-	"math/rand"
-	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	kafka "github.com/segmentio/kafka-go"
 	"github.com/sirupsen/logrus"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
-	"go.opentelemetry.io/otel/trace"
 )
 
-var (
-	kafkaWriter *kafka.Writer
-	logger      *logrus.Logger
-	rng         *rand.Rand
-
-	// Prometheus metrics
-	httpRequestsTotal = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests",
-		},
-		[]string{"method", "endpoint", "status"},
-	)
+var logger *logrus.Logger
 
-	httpRequestDuration = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "HTTP request duration in seconds",
-			Buckets: prometheus.DefBuckets, // Default buckets: 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10
-		},
-		[]string{"method", "endpoint", "status"},
-	)
+const (
+	// Time the startup waits for Kafka to be reachable
+	kafkaConnectTimeout = 5 * time.Second
+	// Time the startup waits for the object storage to check or create the bucket
+	objectStoreConnectTimeout = 5 * time.Second
+	// Time in-flight requests get to complete on shutdown
+	shutdownTimeout = 10 * time.Second
 )
 
-func init() {
-	// Register Prometheus metrics
-	prometheus.MustRegister(httpRequestsTotal)
-	prometheus.MustRegister(httpRequestDuration)
-}
-
-// responseWriter wraps http.ResponseWriter to capture status code
-type responseWriter struct {
-	http.ResponseWriter
-	statusCode int
-}
-
-func newResponseWriter(w http.ResponseWriter) *responseWriter {
-	return &responseWriter{w, http.StatusOK}
-}
-
-func (rw *responseWriter) WriteHeader(code int) {
-	rw.statusCode = code
-	rw.ResponseWriter.WriteHeader(code)
+func main() {
+	os.Exit(run())
 }
 
-// metricsMiddleware wraps an HTTP handler with Prometheus metrics
-func metricsMiddleware(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		rw := newResponseWriter(w)
-
-		// Call the actual handler
-		handler(rw, r)
+// run serves until shutdown, or runs the verify subcommand, and returns the exit code.
+// Returning rather than exiting runs the deferred flushes of the log hooks.
+func run() int {
+	flag.Parse()
+	if otlpEndpoint == "" && !*standalone && *otlpReceiverAddr == "" {
+		log.Fatalln("You MUST set OTLP_ENDPOINT env variable!")
+	}
 
-		duration := time.Since(start).Seconds()
-		statusCode := strconv.Itoa(rw.statusCode)
+	ctx := context.Background()
+	// Startup phases become the spans of a service.start trace once the tracer provider exists
+	starting := telemetry.NewLifecycle(telemetry.LifecycleStart)
+	endPhase := starting.Phase("telemetry")
 
-		// Record metrics
-		httpRequestsTotal.WithLabelValues(r.Method, endpoint, statusCode).Inc()
-		httpRequestDuration.WithLabelValues(r.Method, endpoint, statusCode).Observe(duration)
+	// Initialize Logrus logger
+	logger = logrus.New()
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetLevel(logrus.InfoLevel)
+	logger.AddHook(telemetry.FieldsHook{Fields: telemetry.DeploymentFromEnv().LogFields()})
+	logger.AddHook(telemetry.ExperimentHook{})
+	errfmt.SetLogger(logger)
+
+	// Optionally ship logs through OTLP as well, stdout stays the primary output
+	if otlpLogsEndpoint := os.Getenv("OTLP_LOGS_ENDPOINT"); otlpLogsEndpoint != "" {
+		logHook, err := telemetry.NewLogHook(ctx, otlpLogsEndpoint, "goexample")
+		if err != nil {
+			logger.WithField("error", err).Fatal("failed to initialize log exporter")
+		}
+		defer func() { _ = logHook.Shutdown(ctx) }()
+		logger.AddHook(logHook)
 	}
-}
 
-// logWithTrace returns a logrus.Entry with trace_id and span_id from context
-func logWithTrace(ctx context.Context) *logrus.Entry {
-	span := trace.SpanFromContext(ctx)
-	if span.SpanContext().IsValid() {
-		return logger.WithFields(logrus.Fields{
-			"trace_id": span.SpanContext().TraceID().String(),
-			"span_id":  span.SpanContext().SpanID().String(),
-		})
+	// Or push them straight to Loki, LOG_STDOUT=false leaves it the only shipping path
+	if lokiCfg, err := telemetry.LokiConfigFromEnv(); err != nil {
+		logger.WithField("error", err).Fatal("invalid Loki push configuration")
+	} else if lokiCfg.URL != "" {
+		lokiHook := telemetry.NewLokiHook(lokiCfg, "goexample", telemetry.DeploymentFromEnv())
+		defer func() { _ = lokiHook.Shutdown(ctx) }()
+		logger.AddHook(lokiHook)
+	}
+	if os.Getenv("LOG_STDOUT") == "false" {
+		logger.SetOutput(io.Discard)
 	}
-	return logger.WithFields(logrus.Fields{})
-}
 
-func hello(w http.ResponseWriter, req *http.Request) {
-	ctx, span := tracer.Start(req.Context(), "Start hello handler")
-	defer span.End()
+	// Laptop demos without a collector export to the embedded receiver
+	if *otlpReceiverAddr != "" {
+		endpoint := startOTLPReceiver(*otlpReceiverAddr)
+		if otlpEndpoint == "" {
+			otlpEndpoint = endpoint
+		}
+	}
 
-	logWithTrace(ctx).WithFields(logrus.Fields{
-		"method": req.Method,
-		"path":   req.URL.Path,
-	}).Info("Handling hello request")
+	logger.WithFields(logrus.Fields{
+		"service": "goexample",
+		"port":    "8080",
+	}).Info("Starting goexample service")
 
-	// Randomly return 500 error (30% chance)
-	if rng.Float32() < 0.3 {
-		span.RecordError(errors.New("random internal server error"))
-		logWithTrace(ctx).WithFields(logrus.Fields{
-			"method": req.Method,
-			"path":   req.URL.Path,
-		}).Error("Random internal server error")
+	// Standalone runs print traces to the console unless an OTLP endpoint is set
+	var (
+		exp sdktrace.SpanExporter
+		err error
+	)
+	if otlpEndpoint == "" {
+		exp, err = newConsoleExporter()
+	} else {
+		exp, err = newOTLPExporter(ctx)
+	}
 
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "Internal Server Error\n")
-		return
+	if err != nil {
+		logger.WithField("error", err).Fatal("failed to initialize exporter")
 	}
 
-	// send http request to goexample1:8080
-	appreq, _ := http.NewRequest("GET", "http://goexample1:8080/hello", nil)
-	// Use the propagators from the global Propagation to inject the current context into req.
-	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(appreq.Header))
+	// "app verify" checks dependencies and exits instead of serving
+	if flag.Arg(0) == "verify" {
+		return runVerify(ctx, exp)
+	}
 
-	res, err := http.DefaultClient.Do(appreq)
+	// Root spans are sampled with the strategy of a Jaeger remote sampling endpoint when one is set
+	samplingCfg, err := telemetry.RemoteSamplingFromEnv()
 	if err != nil {
-		logWithTrace(ctx).WithFields(logrus.Fields{
-			"error":   err,
-			"service": "goexample1",
-		}).Error("Failed to send request")
+		logger.WithField("error", err).Fatal("invalid remote sampling configuration")
+	}
+	var remoteSampler *telemetry.RemoteSampler
+	rootSampler := sdktrace.AlwaysSample()
+	if samplingCfg.Endpoint != "" {
+		if remoteSampler, err = telemetry.NewRemoteSampler("goexample", samplingCfg); err != nil {
+			logger.WithField("error", err).Fatal("invalid remote sampling configuration")
+		}
+		rootSampler = remoteSampler
 	}
 
-	// print response body ouput
-	bodyB, _ := io.ReadAll(res.Body)
-	span.SetAttributes(attribute.String("response", string(bodyB)))
-
-	subHello(ctx)
-	sendHelloKafkaMsg(ctx)
+	// The last sampling decisions are listed on /admin/sampling
+	samplingLogSize, err := telemetry.SamplingLogSizeFromEnv()
+	if err != nil {
+		logger.WithField("error", err).Fatal("invalid sampling log configuration")
+	}
+	var samplingLog *telemetry.SamplingLog
+	sampler := sdktrace.ParentBased(rootSampler)
+	if samplingLogSize > 0 {
+		samplingLog = telemetry.NewSamplingLog(samplingLogSize)
+		sampler = samplingLog.Sampler(rootSampler)
+	}
 
-	fmt.Fprintf(w, "hello\n")
-}
+	// Create a new tracer provider with a batch span processor and the given exporter.
+	tp := newTraceProvider(exp, sampler)
 
-func sendHelloKafkaMsg(ctx context.Context) (err error) {
-	_, span := tracer.Start(ctx, "Sending hello message to kafka")
-	defer span.End()
+	// Handle shutdown properly so nothing leaks.
+	defer func() { _ = tp.Shutdown(ctx) }()
 
-	// Create a map carrier to hold the propagated context
-	carrier := propagation.MapCarrier{}
+	// Development mode: report spans that never end and goroutines piling up
+	var leakDetector *telemetry.LeakDetector
+	if os.Getenv("LEAK_DETECTION") == "true" {
+		leakDetector = telemetry.NewLeakDetector(logger, time.Minute)
+		tp.RegisterSpanProcessor(leakDetector)
+	}
 
-	// Inject the tracing context into the carrier
-	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
 
-	// Convert the carrier to Kafka headers
-	headers := make([]kafka.Header, 0, len(carrier))
-	for key, value := range carrier {
-		headers = append(headers, kafka.Header{
-			Key:   key,
-			Value: []byte(value),
-		})
+	// Optionally push the metrics with their trace exemplars through OTLP as well, /metrics stays available
+	otlpMetrics, err := telemetry.OTLPMetricsFromEnv()
+	if err != nil {
+		logger.WithField("error", err).Fatal("invalid OTLP metrics configuration")
 	}
-
-	msg := kafka.Message{
-		Key:     []byte("test-message-goexample"),
-		Value:   []byte("hello from goexample"),
-		Headers: headers,
+	if otlpMetrics.Endpoint != "" {
+		mp, err := telemetry.NewMeterProvider(ctx, otlpMetrics, "goexample", prometheus.DefaultGatherer)
+		if err != nil {
+			logger.WithField("error", err).Fatal("failed to initialize metric exporter")
+		}
+		defer func() { _ = mp.Shutdown(ctx) }()
+		otel.SetMeterProvider(mp)
 	}
-	err = kafkaWriter.WriteMessages(ctx, msg)
+	lifecycleTracer := telemetry.Tracer(tp, "goexample", telemetry.ScopeBusiness)
+	endPhase(nil)
+
+	endPhase = starting.Phase("config")
+	cfg, err := app.ConfigFromEnv()
 	if err != nil {
-		logWithTrace(ctx).WithFields(logrus.Fields{
-			"error":       err,
-			"topic":       "trace",
-			"message_key": "test-message-goexample",
-		}).Error("Error sending message to kafka")
+		logger.WithField("error", err).Fatal("failed to load configuration")
 	}
-	return
-}
-
-func subHello(ctx context.Context) {
-	_, span := tracer.Start(ctx, "Start subHello handler")
-	defer span.End()
-
-	// Simulate long processing time
-	time.Sleep(100 * time.Millisecond)
-}
-
-func headers(w http.ResponseWriter, req *http.Request) {
-	for name, headers := range req.Header {
-		for _, h := range headers {
-			fmt.Fprintf(w, "%v: %v\n", name, h)
+	endPhase(nil)
+
+	// Kafka may still be starting, the writers connect on their first message either way
+	if !*standalone {
+		endPhase = starting.Phase("kafka")
+		connectCtx, cancel := context.WithTimeout(ctx, kafkaConnectTimeout)
+		err := verifyKafka(connectCtx)
+		cancel()
+		if err != nil {
+			logger.WithField("error", err).Warn("Kafka is not reachable yet")
 		}
+		endPhase(err)
 	}
-}
 
-func main() {
-	ctx := context.Background()
-	rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	// Uploads and order archives go to MinIO or another S3 compatible storage when one is configured
+	if err := objectstore.Register(prometheus.DefaultRegisterer); err != nil {
+		logger.WithField("error", err).Fatal("failed to register object storage metrics")
+	}
+	var objects *objectstore.Store
+	if objectStoreCfg := objectstore.ConfigFromEnv(); objectStoreCfg.Enabled() && !*standalone {
+		endPhase = starting.Phase("object_store")
+		if objects, err = objectstore.New(objectStoreCfg, lifecycleTracer); err != nil {
+			logger.WithField("error", err).Fatal("invalid object storage configuration")
+		}
+		bucketCtx, cancel := context.WithTimeout(ctx, objectStoreConnectTimeout)
+		err := objects.EnsureBucket(bucketCtx)
+		cancel()
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"bucket": objectStoreCfg.Bucket,
+				"error":  err,
+			}).Warn("Object storage is not reachable yet")
+		}
+		endPhase(err)
+	}
 
-	// Initialize Logrus logger
-	logger = logrus.New()
-	logger.SetFormatter(&logrus.JSONFormatter{})
-	logger.SetLevel(logrus.InfoLevel)
+	endPhase = starting.Phase("service")
 
-	logger.WithFields(logrus.Fields{
-		"service": "goexample",
-		"port":    "8080",
-	}).Info("Starting goexample service")
+	// Deploys, chaos scenarios and config changes become annotations on the Grafana dashboards
+	var annotator annotations.Emitter = annotations.Nop{}
+	annotationsCfg := annotations.ConfigFromEnv()
+	if annotationsCfg.Enabled() {
+		var writer kafkapkg.Writer
+		if annotationsCfg.Topic != "" && !*standalone {
+			writer = kafkapkg.NewRetryingWriter(kafkapkg.GetKafkaWriter(annotationsCfg.Topic), cfg.KafkaRetryPolicies)
+		}
+		annotationsClient := annotations.New(annotationsCfg, "goexample", writer, logger)
+		defer annotationsClient.Close()
+		annotator = annotationsClient
+	}
 
-	// For testing to print out traces to the console
-	// exp, err := newConsoleExporter()
-	exp, err := newOTLPExporter(ctx)
+	deps := app.Deps{
+		Logger:         logger,
+		TracerProvider: tp,
+		HelloWriter:    kafkapkg.GetKafkaWriter(app.HelloTopic),
+		OrderWriter:    kafkapkg.GetKafkaWriter(app.OrdersTopic),
+		TaskWriter:     kafkapkg.GetKafkaWriter(app.TasksTopic),
+		SamplingLog:    samplingLog,
+		Annotations:    annotator,
+		ObjectStore:    objects,
+	}
+	if *standalone {
+		standaloneDeps(&deps)
+	} else {
+		// Every instance reads all results, in a shared group it would miss those of its own tasks
+		hostname, _ := os.Hostname()
+		taskResults := kafkapkg.GetKafkaReader(app.TaskResultsTopic, "goexample-task-results-"+hostname)
+		defer taskResults.Close()
+		deps.TaskResults = taskResults
+	}
 
+	service, err := app.New(cfg, deps)
 	if err != nil {
-		logger.WithField("error", err).Fatal("failed to initialize exporter")
+		logger.WithField("error", err).Fatal("failed to create service")
 	}
 
-	// Create a new tracer provider with a batch span processor and the given exporter.
-	tp := newTraceProvider(exp)
+	if leakDetector != nil {
+		leakDetector.Rebase()
+		go leakDetector.Run(ctx, 30*time.Second)
+	}
 
-	// Handle shutdown properly so nothing leaks.
-	defer func() { _ = tp.Shutdown(ctx) }()
+	// Background jobs and chaos scenario stop with the service on SIGINT or SIGTERM
+	runCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := scheduler.Register(prometheus.DefaultRegisterer); err != nil {
+		logger.WithField("error", err).Fatal("failed to register scheduler metrics")
+	}
+	jobs := scheduler.New(logger, clock.Real{}, lifecycleTracer)
 
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	// Periodic summary of request rate, errors, latency, Kafka and exporter health
+	reportInterval := time.Minute
+	if v := os.Getenv("SELF_REPORT_INTERVAL"); v != "" {
+		if reportInterval, err = time.ParseDuration(v); err != nil {
+			logger.WithField("error", err).Fatal("invalid SELF_REPORT_INTERVAL")
+		}
+	}
+	if reportInterval > 0 {
+		jobs.Every("self_report", reportInterval, telemetry.NewReporter(prometheus.DefaultGatherer, logger).Report)
+	}
 
-	// Finally, set the tracer that can be used for this package.
-	tracer = tp.Tracer("goexample")
+	// Early warnings on heap, goroutine and GC CPU thresholds, optionally published to Kafka
+	watchdogCfg, err := watchdog.ConfigFromEnv()
+	if err != nil {
+		logger.WithField("error", err).Fatal("invalid watchdog configuration")
+	}
+	if err := watchdog.Register(prometheus.DefaultRegisterer); err != nil {
+		logger.WithField("error", err).Fatal("failed to register watchdog metrics")
+	}
+	if watchdogCfg.Enabled() {
+		var alerts kafkapkg.Writer
+		if watchdogCfg.AlertTopic != "" && !*standalone {
+			alerts = kafkapkg.NewRetryingWriter(kafkapkg.GetKafkaWriter(watchdogCfg.AlertTopic), cfg.KafkaRetryPolicies)
+		}
+		jobs.Every("watchdog", 10*time.Second, watchdog.New("goexample", watchdogCfg, logger, alerts).Check)
+	}
+	if remoteSampler != nil {
+		jobs.Every("sampling_strategy", samplingCfg.RefreshInterval, remoteSampler.Refresh)
+		go func() {
+			if err := remoteSampler.Refresh(ctx); err != nil {
+				logger.WithField("error", err).Warn("Sampling with the initial rate until the strategy can be fetched")
+			}
+		}()
+	}
+	// Cron or interval schedules replacing the defaults (JOB_SCHEDULES="self_report=*/5 * * * *")
+	if spec := os.Getenv("JOB_SCHEDULES"); spec != "" {
+		schedules, err := scheduler.ParseSchedules(spec)
+		if err == nil {
+			err = jobs.Reschedule(schedules)
+		}
+		if err != nil {
+			logger.WithField("error", err).Fatal("invalid JOB_SCHEDULES")
+		}
+	}
+	jobs.Start(runCtx)
 
-	// Kafka writer
-	kafkaWriter = kafkapkg.GetKafkaWriter("trace")
+	// Timeline of injected faults, e.g. CHAOS_SCENARIO=scenarios/kafka-degradation.yaml
+	if path := os.Getenv("CHAOS_SCENARIO"); path != "" {
+		scenario, err := chaos.LoadScenario(path)
+		if err != nil {
+			logger.WithField("error", err).Fatal("failed to load chaos scenario")
+		}
+		go chaos.Run(runCtx, clock.Real{}, logger, service.Chaos(), scenario, annotator)
+	}
+	endPhase(nil)
 
-	// routes
-	http.HandleFunc("/hello", metricsMiddleware("/hello", hello))
-	http.HandleFunc("/headers", metricsMiddleware("/headers", headers))
+	// Kafka and goexample1 connections opened before the first request instead of by it, compare
+	// http_cold_start_request_duration_seconds between starts with and without (service_warmed_up)
+	warmupCfg, err := warmup.ConfigFromEnv()
+	if err != nil {
+		logger.WithField("error", err).Fatal("invalid warm-up configuration")
+	}
+	if err := warmup.Register(prometheus.DefaultRegisterer); err != nil {
+		logger.WithField("error", err).Fatal("failed to register warm-up metrics")
+	}
+	if warmupCfg.Enabled && !*standalone {
+		endPhase = starting.Phase("warmup")
+		targets := []warmup.Target{{Name: "goexample1", Warm: service.WarmDownstream}}
+		for _, writer := range []kafkapkg.Writer{deps.HelloWriter, deps.OrderWriter, deps.TaskWriter} {
+			if w, ok := writer.(*kafka.Writer); ok {
+				targets = append(targets, warmup.Target{
+					Name: "kafka:" + w.Topic,
+					Warm: func(ctx context.Context) error { return kafkapkg.WarmWriter(ctx, w) },
+				})
+			}
+		}
+		var err error
+		if !warmup.Run(ctx, warmupCfg, logger, lifecycleTracer, targets) {
+			err = errors.New("part of the dependencies were not warmed up")
+		}
+		endPhase(err)
+	}
 
-	// Prometheus metrics endpoint
-	http.Handle("/metrics", promhttp.Handler())
+	// Plain HTTP, TLS and Unix socket listeners share the handler and its telemetry
+	endPhase = starting.Phase("listeners")
+	listeners, err := server.ListenersFromEnv()
+	if err != nil {
+		logger.WithField("error", err).Fatal("invalid listener configuration")
+	}
+	servers, err := server.Start(logger, listeners, service.Handler())
+	if err != nil {
+		logger.WithField("error", err).Fatal("failed to start listeners")
+	}
+	endPhase(nil)
+	starting.End(ctx, lifecycleTracer)
+	annotator.Emit(ctx, "goexample started, variant "+cfg.Deployment.Variant, annotations.TagDeploy)
 
 	logger.Info("Server is ready to handle requests")
-	http.ListenAndServe(":8080", nil)
+	select {
+	case err := <-servers.Errors():
+		logger.WithField("error", err).Fatal("server failed")
+	case <-runCtx.Done():
+	}
+
+	// Shutdown phases end up in a service.stop trace, flushed with the remaining spans
+	logger.Info("Shutting down")
+	annotator.Emit(ctx, "goexample stopping, variant "+cfg.Deployment.Variant, annotations.TagDeploy)
+	stopping := telemetry.NewLifecycle(telemetry.LifecycleStop)
+	endPhase = stopping.Phase("listeners")
+	shutdownCtx, cancel := context.WithTimeout(ctx, shutdownTimeout)
+	defer cancel()
+	endPhase(servers.Shutdown(shutdownCtx))
+	endPhase = stopping.Phase("service")
+	service.Close()
+	endPhase(nil)
+	stopping.End(ctx, lifecycleTracer)
+	return 0
 }
 
-var (
-	tracer       trace.Tracer
-	otlpEndpoint string
-)
+var otlpEndpoint string
 
 func init() {
 	otlpEndpoint = os.Getenv("OTLP_ENDPOINT")
-	if otlpEndpoint == "" {
-		log.Fatalln("You MUST set OTLP_ENDPOINT env variable!")
-	}
 }
 
 // List of supported exporters
 // https://opentelemetry.io/docs/instrumentation/go/exporters/
 
-// Console Exporter, only for testing
-// func newConsoleExporter() (sdktrace.SpanExporter, error) {
-// 	return stdouttrace.New()
-// }
+// Console Exporter, for testing and standalone runs
+func newConsoleExporter() (sdktrace.SpanExporter, error) {
+	return stdouttrace.New()
+}
 
 // OTLP Exporter
 func newOTLPExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
@@ -274,27 +417,37 @@ func newOTLPExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
 	// Update default OTLP reciver endpoint
 	endpointOpt := otlptracehttp.WithEndpoint(otlpEndpoint)
 
-	return otlptracehttp.New(ctx, insecureOpt, endpointOpt)
+	// OTLP_COMPRESSION=gzip compresses the payloads, their size is recorded either way
+	compression, err := telemetry.OTLPCompressionFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	compressionOpt := otlptracehttp.WithCompression(otlptracehttp.NoCompression)
+	if compression == telemetry.CompressionGzip {
+		compressionOpt = otlptracehttp.WithCompression(otlptracehttp.GzipCompression)
+	}
+	clientOpt := otlptracehttp.WithHTTPClient(telemetry.ExportClient("traces"))
+
+	return otlptracehttp.New(ctx, insecureOpt, endpointOpt, compressionOpt, clientOpt)
 }
 
 // TracerProvider is an OpenTelemetry TracerProvider.
 // It provides Tracers to instrumentation so it can trace operational flow through a system.
-func newTraceProvider(exp sdktrace.SpanExporter) *sdktrace.TracerProvider {
-	// Ensure default SDK resources and the required service name are set.
-	r, err := resource.Merge(
-		resource.Default(),
-		resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceName("goexample"),
-		),
-	)
-
+// Spans are sampled by sampler.
+func newTraceProvider(exp sdktrace.SpanExporter, sampler sdktrace.Sampler) *sdktrace.TracerProvider {
+	// Service name plus deployment environment, region and zone
+	r, err := telemetry.Resource("goexample")
 	if err != nil {
 		panic(err)
 	}
 
 	return sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exp),
+		sdktrace.WithSpanProcessor(telemetry.NewBatchSpanProcessor(exp)),
 		sdktrace.WithResource(r),
+		sdktrace.WithRawSpanLimits(telemetry.SpanLimits()),
+		sdktrace.WithSpanProcessor(telemetry.LimitsProcessor{}),
+		sdktrace.WithSpanProcessor(telemetry.ExperimentProcessor{}),
+		// Requests enter the stack here, their tracestate carries the edge's deployment downstream
+		sdktrace.WithSampler(telemetry.TraceStateSampler(sampler, telemetry.DeploymentFromEnv().TraceState())),
 	)
 }
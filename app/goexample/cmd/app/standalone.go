@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"goexample/pkg/app"
+	"goexample/pkg/app/stub"
+	"goexample/pkg/kafkapkg"
+	"goexample/pkg/objectstore"
+	"goexample/pkg/otlpreceiver"
+	"goexample/pkg/telemetry"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// -standalone runs the service without Kafka and goexample1, using in-memory fakes instead
+	standalone = flag.Bool("standalone", false, "replace Kafka and downstream services with in-memory fakes")
+	// -otlp-receiver=:4318 runs an embedded OTLP receiver, the trace exporter uses it unless OTLP_ENDPOINT is set
+	otlpReceiverAddr = flag.String("otlp-receiver", "", "address of an embedded OTLP/HTTP receiver printing received traces and metrics, e.g. :4318")
+)
+
+// standaloneDeps swaps the Kafka writers and the downstream client for in-memory fakes.
+// The fakes create the same spans, logs and metrics as the real dependencies would.
+func standaloneDeps(deps *app.Deps) {
+	helloQueue := kafkapkg.NewMemoryWriter(app.HelloTopic)
+	orderQueue := kafkapkg.NewMemoryWriter(app.OrdersTopic)
+	deps.HelloWriter, deps.OrderWriter = helloQueue, orderQueue
+
+	kafkaTracer := telemetry.Tracer(deps.TracerProvider, "goexample", telemetry.ScopeKafka)
+	go consumeMemoryQueue(helloQueue, kafkaTracer)
+	go consumeMemoryQueue(orderQueue, kafkaTracer)
+
+	taskQueue := kafkapkg.NewMemoryWriter(app.TasksTopic)
+	resultQueue := kafkapkg.NewMemoryWriter(app.TaskResultsTopic)
+	deps.TaskWriter, deps.TaskResults = taskQueue, resultQueue
+	go processMemoryTasks(taskQueue, resultQueue, kafkaTracer)
+
+	httpTracer := telemetry.Tracer(deps.TracerProvider, "goexample", telemetry.ScopeHTTPServer)
+	deps.HTTPClient = stub.NewDownstreamClient(httpTracer)
+
+	// A configured object storage is faked as well, uploads go to the stub store without one
+	if objectstore.ConfigFromEnv().Enabled() {
+		deps.ObjectStore = objectstore.NewDiscard(telemetry.Tracer(deps.TracerProvider, "goexample", telemetry.ScopeBusiness))
+	}
+
+	logger.Warn("Running standalone, Kafka and downstream services are in-memory fakes")
+}
+
+// startOTLPReceiver serves the embedded OTLP receiver on addr and returns its endpoint for the exporters
+func startOTLPReceiver(addr string) string {
+	receiver := otlpreceiver.New(os.Stdout)
+	go func() {
+		if err := http.ListenAndServe(addr, receiver.Handler()); err != nil {
+			logger.WithField("error", err).Fatal("OTLP receiver failed")
+		}
+	}()
+
+	endpoint := addr
+	if strings.HasPrefix(endpoint, ":") {
+		endpoint = "localhost" + endpoint
+	}
+	logger.WithFields(logrus.Fields{
+		"address": addr,
+		"view":    "http://" + endpoint,
+	}).Warn("Embedded OTLP receiver started")
+	return endpoint
+}
+
+// consumeMemoryQueue plays the goexample1 consumer for an in-memory topic
+func consumeMemoryQueue(queue *kafkapkg.MemoryWriter, kafkaTracer trace.Tracer) {
+	for m := range queue.Messages() {
+		// Order events may be in a CloudEvents envelope, see KAFKA_CLOUDEVENTS
+		event, mode, err := kafkapkg.DecodeEvent(m)
+		ctx := event.Context(context.Background())
+
+		ctx, span := kafkaTracer.Start(ctx, "Processing kafka message",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(attribute.String("messaging.destination.name", m.Topic)),
+			trace.WithAttributes(event.Attributes()...),
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		telemetry.WithTrace(logger, ctx).WithFields(logrus.Fields{
+			"topic":      m.Topic,
+			"key":        string(m.Key),
+			"value":      string(event.Data),
+			"cloudevent": mode,
+		}).Info("Received kafka message")
+		span.End()
+	}
+}
+
+// processMemoryTasks plays the goexample1 task worker for the in-memory tasks topic: each task is
+// processed in a new trace linked to its enqueue span, the result continues that trace
+func processMemoryTasks(tasks, results *kafkapkg.MemoryWriter, kafkaTracer trace.Tracer) {
+	for m := range tasks.Messages() {
+		carrier := propagation.MapCarrier{}
+		for _, header := range m.Headers {
+			carrier[header.Key] = string(header.Value)
+		}
+		enqueued := trace.SpanContextFromContext(otel.GetTextMapPropagator().Extract(context.Background(), carrier))
+
+		ctx, span := kafkaTracer.Start(context.Background(), "Process task",
+			trace.WithNewRoot(),
+			trace.WithLinks(trace.Link{SpanContext: enqueued}),
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(attribute.String("messaging.destination.name", m.Topic)),
+		)
+		var t struct {
+			ID     string `json:"task_id"`
+			Kind   string `json:"kind"`
+			WorkMS int    `json:"work_ms"`
+			Fail   bool   `json:"fail"`
+		}
+		_ = json.Unmarshal(m.Value, &t)
+		span.SetAttributes(attribute.String("task.id", t.ID), attribute.String("task.kind", t.Kind))
+		time.Sleep(time.Duration(t.WorkMS) * time.Millisecond)
+
+		result := map[string]string{"task_id": t.ID, "status": "succeeded", "output": t.Kind + " ready"}
+		if t.Fail {
+			result = map[string]string{"task_id": t.ID, "status": "failed", "error": "injected failure"}
+		}
+		value, _ := json.Marshal(result)
+		headers := propagation.MapCarrier{}
+		otel.GetTextMapPropagator().Inject(ctx, headers)
+		msg := kafka.Message{Key: m.Key, Value: value}
+		for key, value := range headers {
+			msg.Headers = append(msg.Headers, kafka.Header{Key: key, Value: []byte(value)})
+		}
+		_ = results.WriteMessages(ctx, msg)
+		span.End()
+	}
+}
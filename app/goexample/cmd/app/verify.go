@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goexample/pkg/kafkapkg"
+	"goexample/pkg/telemetry"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const verifyTimeout = 30 * time.Second
+
+// verifyCheck is a single dependency check run by the verify subcommand
+type verifyCheck struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// runVerify checks the service dependencies, emits a synthetic trace and metric,
+// and returns the process exit code. Usage: app verify
+func runVerify(ctx context.Context, exp sdktrace.SpanExporter) int {
+	ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+
+	// Spans are recorded in memory and exported explicitly so export errors can be reported
+	recorder := tracetest.NewSpanRecorder()
+	r, err := telemetry.Resource("goexample")
+	if err != nil {
+		logger.WithField("error", err).Error("failed to create resource")
+		return 1
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(recorder),
+		sdktrace.WithResource(r),
+	)
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	tracer := telemetry.Tracer(tp, "goexample", telemetry.ScopeBusiness)
+
+	checks := []verifyCheck{
+		{name: "kafka", run: verifyKafka},
+		{name: "downstream", run: verifyDownstream},
+	}
+
+	ctx, root := tracer.Start(ctx, "verify")
+	failed := 0
+	for _, check := range checks {
+		if err := runVerifyCheck(ctx, tracer, check); err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		root.SetStatus(codes.Error, fmt.Sprintf("%d checks failed", failed))
+	}
+	root.End()
+
+	// The synthetic trace doubles as the OTLP reachability check
+	if err := exp.ExportSpans(ctx, recorder.Ended()); err != nil {
+		failed++
+		logger.WithFields(logrus.Fields{"check": "otlp", "error": err}).Error("Verify check failed")
+	} else {
+		telemetry.WithTrace(logger, ctx).WithField("check", "otlp").Info("Verify check passed")
+	}
+
+	// Synthetic metric, pushed to Prometheus when a remote write URL is configured
+	if url := os.Getenv("PROMETHEUS_REMOTE_WRITE_URL"); url != "" {
+		err := telemetry.PushSample(ctx, url, "verify_last_run_failed_checks",
+			map[string]string{"job": "goexample-verify"}, float64(failed), time.Now())
+		if err != nil {
+			failed++
+			logger.WithFields(logrus.Fields{"check": "prometheus", "error": err}).Error("Verify check failed")
+		} else {
+			logger.WithField("check", "prometheus").Info("Verify check passed")
+		}
+	}
+
+	if failed > 0 {
+		telemetry.WithTrace(logger, ctx).WithField("failed", failed).Error("Verification failed")
+		return 1
+	}
+	telemetry.WithTrace(logger, ctx).Info("Verification succeeded")
+	return 0
+}
+
+func runVerifyCheck(ctx context.Context, tracer trace.Tracer, check verifyCheck) error {
+	ctx, span := tracer.Start(ctx, "verify "+check.name)
+	defer span.End()
+
+	err := check.run(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		telemetry.WithTrace(logger, ctx).WithFields(logrus.Fields{"check": check.name, "error": err}).Error("Verify check failed")
+		return err
+	}
+	telemetry.WithTrace(logger, ctx).WithField("check", check.name).Info("Verify check passed")
+	return nil
+}
+
+func verifyKafka(ctx context.Context) error {
+	clusters, err := kafkapkg.LoadClusters()
+	if err != nil {
+		return err
+	}
+	cluster := clusters.Default()
+	if len(cluster.Brokers) == 0 {
+		return errors.New("KAFKA_ENDPOINT is not set")
+	}
+
+	// Connects with the TLS and SASL settings of the cluster so wrong credentials fail the check
+	conn, err := cluster.Dialer().DialContext(ctx, "tcp", cluster.Brokers[0])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Brokers()
+	return err
+}
+
+func verifyDownstream(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(telemetry.WithClientTrace(ctx), http.MethodGet, "http://goexample1:8080/headers", nil)
+	if err != nil {
+		return err
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("goexample1 returned %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+// loadgen sends a steady request rate to goexample. With -burn it shapes the error ratio
+// of POST /order over time to exercise multi-window error budget burn rate alerts.
+//
+// Usage: go run ./cmd/loadgen [-rps 20] [-burn "2%:1h,20%:10m"]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"goexample/pkg/client"
+	"goexample/pkg/telemetry"
+	"math"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	baseURL  = flag.String("url", "http://localhost:18080", "base URL of goexample")
+	rps      = rateFlag("rps", 10, "requests per second")
+	duration = flag.Duration("duration", 0, "stop after this long, 0 runs until interrupted or the burn schedule ends")
+	burn     = flag.String("burn", "", `error ratio schedule of POST /order as ratio:duration steps, e.g. "2%:1h,20%:10m"`)
+	pushURL  = flag.String("prometheus", "http://localhost:19090/api/v1/write", "remote write URL the intended schedule is pushed to, empty disables it")
+)
+
+// How often the intended error ratio is pushed to Prometheus
+const pushInterval = 5 * time.Second
+
+// rate is a flag value of requests per second, rejecting rates that would never send a request
+type rate float64
+
+// rateFlag defines a rate flag, a rate that is not positive fails the flag parsing
+func rateFlag(name string, value float64, usage string) *rate {
+	r := rate(value)
+	flag.Var(&r, name, usage)
+	return &r
+}
+
+func (r *rate) String() string {
+	return strconv.FormatFloat(float64(*r), 'g', -1, 64)
+}
+
+func (r *rate) Set(s string) error {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return errors.New("parse error")
+	}
+	if !(v > 0) || math.IsInf(v, 1) {
+		return errors.New("must be a positive number")
+	}
+	*r = rate(v)
+	return nil
+}
+
+// phase is one step of a burn schedule
+type phase struct {
+	errorRatio float64
+	duration   time.Duration
+}
+
+func main() {
+	flag.Parse()
+
+	schedule, err := parseSchedule(*burn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "loadgen:", err)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	c, err := client.New(client.Config{
+		BaseURL:   *baseURL,
+		Service:   "goexample",
+		Caller:    "loadgen",
+		UserAgent: "loadgen/1.0",
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "loadgen:", err)
+		os.Exit(2)
+	}
+
+	if len(schedule) == 0 {
+		run(ctx, helloCall(c), "steady")
+		return
+	}
+	for i, p := range schedule {
+		if ctx.Err() != nil {
+			return
+		}
+		name := fmt.Sprintf("%d/%d", i+1, len(schedule))
+		fmt.Printf("phase %s: %.1f%% errors for %s\n", name, p.errorRatio*100, p.duration)
+
+		phaseCtx, cancel := context.WithTimeout(ctx, p.duration)
+		go pushSchedule(phaseCtx, name, p.errorRatio)
+		run(phaseCtx, orderCall(c, p.errorRatio), name)
+		cancel()
+	}
+}
+
+// parseSchedule parses the -burn steps, percentages ("2%") or ratios ("0.02")
+func parseSchedule(spec string) ([]phase, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var schedule []phase
+	for _, step := range strings.Split(spec, ",") {
+		ratio, length, ok := strings.Cut(strings.TrimSpace(step), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid burn step %q, want ratio:duration", step)
+		}
+		var p phase
+		var err error
+		if percent, isPercent := strings.CutSuffix(ratio, "%"); isPercent {
+			p.errorRatio, err = strconv.ParseFloat(percent, 64)
+			p.errorRatio /= 100
+		} else {
+			p.errorRatio, err = strconv.ParseFloat(ratio, 64)
+		}
+		if err != nil || p.errorRatio < 0 || p.errorRatio > 1 {
+			return nil, fmt.Errorf("invalid error ratio in burn step %q", step)
+		}
+		if p.duration, err = time.ParseDuration(length); err != nil || p.duration <= 0 {
+			return nil, fmt.Errorf("invalid duration in burn step %q", step)
+		}
+		schedule = append(schedule, p)
+	}
+	return schedule, nil
+}
+
+// helloCall is the request of the steady mode
+func helloCall(c *client.Client) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := c.Hello(ctx)
+		return err
+	}
+}
+
+// orderCall places orders of which errorRatio fail on purpose at the publish step (500)
+func orderCall(c *client.Client, errorRatio float64) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var req client.OrderRequest
+		if rand.Float64() < errorRatio {
+			req.FailAt = "publish"
+		}
+		_, err := c.Order(ctx, req)
+		return err
+	}
+}
+
+// failed reports whether err counts against the service, rejected requests (4xx) do not
+func failed(err error) bool {
+	var statusErr *client.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= 500
+	}
+	return err != nil
+}
+
+// run sends requests at -rps until ctx is done and prints the outcome
+func run(ctx context.Context, call func(ctx context.Context) error, name string) {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / float64(*rps)))
+	defer ticker.Stop()
+
+	var sent, failures atomic.Int64
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		if n := sent.Load(); n > 0 {
+			fmt.Printf("phase %s: %d requests, %.1f%% errors\n", name, n, float64(failures.Load())/float64(n)*100)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sent.Add(1)
+			// Detached so requests in flight at the end of a phase still complete
+			if failed(call(context.WithoutCancel(ctx))) {
+				failures.Add(1)
+			}
+		}()
+	}
+}
+
+// pushSchedule pushes the intended error ratio of the phase until ctx is done, for dashboards
+// comparing it with the measured SLI (loadgen_burn_schedule_info and loadgen_target_error_ratio)
+func pushSchedule(ctx context.Context, name string, errorRatio float64) {
+	if *pushURL == "" {
+		return
+	}
+	ticker := time.NewTicker(pushInterval)
+	defer ticker.Stop()
+
+	ratio := strconv.FormatFloat(errorRatio, 'f', -1, 64)
+	for {
+		now := time.Now()
+		err := telemetry.PushSample(ctx, *pushURL, "loadgen_burn_schedule_info",
+			map[string]string{"job": "loadgen", "phase": name, "target_error_ratio": ratio}, 1, now)
+		if err == nil {
+			err = telemetry.PushSample(ctx, *pushURL, "loadgen_target_error_ratio",
+				map[string]string{"job": "loadgen"}, errorRatio, now)
+		}
+		if err != nil && ctx.Err() == nil {
+			fmt.Fprintln(os.Stderr, "loadgen: pushing schedule:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
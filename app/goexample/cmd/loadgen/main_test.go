@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestRateFlag(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		ok    bool
+	}{
+		{"20", true},
+		{"0.5", true},
+		{"0", false},
+		{"-5", false},
+		{"NaN", false},
+		{"+Inf", false},
+		{"fast", false},
+	} {
+		t.Run(tt.value, func(t *testing.T) {
+			var r rate
+			if err := r.Set(tt.value); (err == nil) != tt.ok {
+				t.Errorf("Set(%q) = %v, want ok %t", tt.value, err, tt.ok)
+			}
+		})
+	}
+}
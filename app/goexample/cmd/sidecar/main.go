@@ -0,0 +1,158 @@
+// sidecar is a minimal local proxy standing in for a service mesh sidecar. It forwards the
+// connections it accepts on a Unix socket or TCP address to their original destination, read
+// from the PROXY protocol header (v1 or v2) when there is one, else to -upstream. -delay adds
+// latency to each connection, so mesh and direct calls can be compared.
+//
+// Usage: go run ./cmd/sidecar -listen unix:///tmp/sidecar.sock -upstream localhost:8081
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	listen   = flag.String("listen", "unix:///tmp/sidecar.sock", "unix:///path or host:port to accept connections on")
+	upstream = flag.String("upstream", "", "destination of connections without a PROXY header")
+	delay    = flag.Duration("delay", 0, "latency added to each connection")
+)
+
+// Signature starting a PROXY protocol v2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+func main() {
+	flag.Parse()
+
+	network, address := "tcp", *listen
+	if path, ok := strings.CutPrefix(*listen, "unix://"); ok {
+		network, address = "unix", path
+		_ = os.Remove(path)
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		log.Fatalf("sidecar: %v", err)
+	}
+	log.Printf("sidecar listening on %s", *listen)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Fatalf("sidecar: %v", err)
+		}
+		go forward(conn)
+	}
+}
+
+// forward copies conn to its destination and back
+func forward(conn net.Conn) {
+	defer conn.Close()
+	start := time.Now()
+
+	r := bufio.NewReader(conn)
+	source, destination, err := readProxyHeader(r)
+	if err != nil {
+		log.Printf("sidecar: invalid PROXY header: %v", err)
+		return
+	}
+	if source == "" {
+		source = conn.RemoteAddr().String()
+	}
+	if destination == "" {
+		destination = *upstream
+	}
+	if destination == "" {
+		log.Printf("sidecar: no destination for connection from %s", conn.RemoteAddr())
+		return
+	}
+
+	time.Sleep(*delay)
+	up, err := net.Dial("tcp", destination)
+	if err != nil {
+		log.Printf("sidecar: %v", err)
+		return
+	}
+	defer up.Close()
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(up, r)
+		closeWrite(up)
+		close(done)
+	}()
+	_, _ = io.Copy(conn, up)
+	closeWrite(conn)
+	<-done
+	log.Printf("sidecar: %s -> %s closed after %s", source, destination, time.Since(start).Round(time.Millisecond))
+}
+
+// readProxyHeader reads the PROXY header starting r if any, returning the source and
+// destination addresses it carries, empty when unknown
+func readProxyHeader(r *bufio.Reader) (string, string, error) {
+	start, err := r.Peek(len(proxyV2Signature))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", "", err
+	}
+
+	switch {
+	case bytes.Equal(start, proxyV2Signature):
+		header := make([]byte, 16)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return "", "", err
+		}
+		addrs := make([]byte, binary.BigEndian.Uint16(header[14:]))
+		if _, err := io.ReadFull(r, addrs); err != nil {
+			return "", "", err
+		}
+		switch header[13] >> 4 {
+		case 1: // IPv4
+			if len(addrs) < 12 {
+				return "", "", fmt.Errorf("short IPv4 addresses")
+			}
+			return hostPort(addrs[0:4], addrs[8:10]), hostPort(addrs[4:8], addrs[10:12]), nil
+		case 2: // IPv6
+			if len(addrs) < 36 {
+				return "", "", fmt.Errorf("short IPv6 addresses")
+			}
+			return hostPort(addrs[0:16], addrs[32:34]), hostPort(addrs[16:32], addrs[34:36]), nil
+		}
+		return "", "", nil
+
+	case bytes.HasPrefix(start, []byte("PROXY ")):
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", "", err
+		}
+		// PROXY TCP4 <source> <destination> <source port> <destination port>
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+			return "", "", nil
+		}
+		if len(fields) != 6 {
+			return "", "", fmt.Errorf("malformed line %q", strings.TrimSpace(line))
+		}
+		return net.JoinHostPort(fields[2], fields[4]), net.JoinHostPort(fields[3], fields[5]), nil
+	}
+	return "", "", nil
+}
+
+// closeWrite signals the end of the data sent on conn, its peer reads EOF
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = c.CloseWrite()
+	}
+}
+
+func hostPort(ip, port []byte) string {
+	return net.JoinHostPort(net.IP(ip).String(), strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+}
@@ -0,0 +1,129 @@
+// tracectl sends one traced request to an example service and prints the trace ID,
+// the propagated headers and Grafana links to the trace and its logs.
+//
+// Usage: go run ./cmd/tracectl [-X POST] [-d '{"quantity":2}'] /order
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	baseURL    = flag.String("url", "http://localhost:18080", "base URL of the service")
+	method     = flag.String("X", http.MethodGet, "request method")
+	data       = flag.String("d", "", "request body, sent as JSON")
+	grafanaURL = flag.String("grafana", "http://localhost:13000", "base URL of Grafana")
+	timeout    = flag.Duration("timeout", 10*time.Second, "request timeout")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: tracectl [flags] <path>\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	path := "/hello"
+	if flag.NArg() > 0 {
+		path = flag.Arg(0)
+	}
+
+	if err := run(path); err != nil {
+		fmt.Fprintln(os.Stderr, "tracectl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	// Nothing is exported, the provider only creates the sampled span context the service continues
+	tp := sdktrace.NewTracerProvider()
+	ctx, span := tp.Tracer("tracectl").Start(ctx, *method+" "+path, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	var body io.Reader
+	if *data != "" {
+		body = strings.NewReader(*data)
+	}
+	req, err := http.NewRequestWithContext(ctx, *method, strings.TrimSuffix(*baseURL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	if *data != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Client-Service", "tracectl")
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	// The service continues our trace, error responses also name it in X-Trace-Id
+	traceID := span.SpanContext().TraceID().String()
+	if id := res.Header.Get("X-Trace-Id"); id != "" {
+		traceID = id
+	}
+
+	fmt.Printf("%s %s\n", req.Method, req.URL)
+	fmt.Printf("Status:   %s\n", res.Status)
+	fmt.Printf("Trace ID: %s\n\n", traceID)
+
+	fmt.Println("Propagated headers:")
+	for _, name := range []string{"Traceparent", "Tracestate", "X-Client-Service"} {
+		if value := req.Header.Get(name); value != "" {
+			fmt.Printf("  %s: %s\n", name, value)
+		}
+	}
+
+	fmt.Println("\nLinks:")
+	fmt.Printf("  Trace: %s\n", exploreURL("tempo", "tempo", traceID))
+	fmt.Printf("  Logs:  %s\n", exploreURL("loki", "loki", fmt.Sprintf(`{app=~".+"} |= %q`, traceID)))
+	return nil
+}
+
+// exploreURL links to Grafana Explore running query against the data source with uid
+func exploreURL(dsType, uid, query string) string {
+	pane := map[string]any{
+		"datasource": uid,
+		"queries": []map[string]any{{
+			"refId":      "A",
+			"datasource": map[string]string{"type": dsType, "uid": uid},
+			"queryType":  queryType(dsType),
+			"query":      query,
+			"expr":       query,
+		}},
+		"range": map[string]string{"from": "now-1h", "to": "now"},
+	}
+	panes, _ := json.Marshal(map[string]any{"a": pane})
+
+	v := url.Values{}
+	v.Set("schemaVersion", "1")
+	v.Set("panes", string(panes))
+	v.Set("orgId", "1")
+	return strings.TrimSuffix(*grafanaURL, "/") + "/explore?" + v.Encode()
+}
+
+func queryType(dsType string) string {
+	if dsType == "tempo" {
+		return "traceql"
+	}
+	return "range"
+}
@@ -0,0 +1,185 @@
+package annotations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goexample/pkg/kafkapkg"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Tags of the annotated events, dashboards filter annotations by them
+const (
+	TagDeploy = "deploy"
+	TagChaos  = "chaos"
+	TagConfig = "config"
+)
+
+// Time an annotation may take to be delivered
+const sendTimeout = 5 * time.Second
+
+var annotationsSentTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "annotations_sent_total",
+		Help: "Total number of event annotations sent, target is grafana or kafka",
+	},
+	[]string{"target", "result"},
+)
+
+// Register registers the metrics of the package with reg, e.g. prometheus.DefaultRegisterer
+func Register(reg prometheus.Registerer) error {
+	return reg.Register(annotationsSentTotal)
+}
+
+// Annotation marks an event on the dashboards, e.g. a chaos scenario starting
+type Annotation struct {
+	// Unix time in milliseconds, the Grafana API format
+	Time int64    `json:"time"`
+	Text string   `json:"text"`
+	Tags []string `json:"tags"`
+}
+
+// Emitter sends annotations for notable events of the service. Emit does not block, delivery
+// failures are logged and counted.
+type Emitter interface {
+	Emit(ctx context.Context, text string, tags ...string)
+}
+
+// Nop discards the annotations, used when no target is configured
+type Nop struct{}
+
+// Emit implements Emitter
+func (Nop) Emit(context.Context, string, ...string) {}
+
+// Config of the annotation targets, annotations go to every configured target
+type Config struct {
+	// Grafana base URL, e.g. http://grafana:3000, and the service account token of the HTTP API
+	GrafanaURL   string
+	GrafanaToken string
+	// Kafka topic annotations are published to for other tooling to pick up
+	Topic string
+}
+
+// ConfigFromEnv reads GRAFANA_URL, GRAFANA_API_TOKEN and ANNOTATIONS_TOPIC
+func ConfigFromEnv() Config {
+	return Config{
+		GrafanaURL:   strings.TrimSuffix(os.Getenv("GRAFANA_URL"), "/"),
+		GrafanaToken: os.Getenv("GRAFANA_API_TOKEN"),
+		Topic:        os.Getenv("ANNOTATIONS_TOPIC"),
+	}
+}
+
+// Enabled tells whether annotations have a target
+func (c Config) Enabled() bool {
+	return c.GrafanaURL != "" || c.Topic != ""
+}
+
+// Client sends annotations tagged with the service name to the Grafana HTTP API and/or a Kafka topic
+type Client struct {
+	cfg     Config
+	service string
+	http    *http.Client
+	writer  kafkapkg.Writer
+	logger  *logrus.Logger
+	// Annotations still being sent
+	pending sync.WaitGroup
+}
+
+// New creates a Client for cfg, writer publishes to cfg.Topic and may be nil without a topic
+func New(cfg Config, service string, writer kafkapkg.Writer, logger *logrus.Logger) *Client {
+	return &Client{
+		cfg:     cfg,
+		service: service,
+		http:    &http.Client{Timeout: sendTimeout},
+		writer:  writer,
+		logger:  logger,
+	}
+}
+
+// Emit implements Emitter, the annotation is sent in the background
+func (c *Client) Emit(ctx context.Context, text string, tags ...string) {
+	a := Annotation{
+		Time: time.Now().UnixMilli(),
+		Text: text,
+		Tags: append([]string{"service:" + c.service}, tags...),
+	}
+	ctx = context.WithoutCancel(ctx)
+	c.pending.Add(1)
+	go func() {
+		defer c.pending.Done()
+		ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+		defer cancel()
+		_ = c.Send(ctx, a)
+	}()
+}
+
+// Close waits for the annotations still being sent, e.g. the one of the shutdown
+func (c *Client) Close() {
+	c.pending.Wait()
+}
+
+// Send delivers a to every target and returns the errors joined
+func (c *Client) Send(ctx context.Context, a Annotation) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	if c.cfg.GrafanaURL != "" {
+		errs = append(errs, c.record("grafana", a, c.postGrafana(ctx, body)))
+	}
+	if c.cfg.Topic != "" && c.writer != nil {
+		errs = append(errs, c.record("kafka", a, c.writer.WriteMessages(ctx, kafka.Message{
+			Key:   []byte(c.service),
+			Value: body,
+		})))
+	}
+	return errors.Join(errs...)
+}
+
+// postGrafana creates the annotation with POST /api/annotations
+func (c *Client) postGrafana(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.GrafanaURL+"/api/annotations", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.GrafanaToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.GrafanaToken)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("grafana returned %d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+	return nil
+}
+
+// record counts and logs the outcome of sending a to target
+func (c *Client) record(target string, a Annotation, err error) error {
+	if err != nil {
+		annotationsSentTotal.WithLabelValues(target, "error").Inc()
+		c.logger.WithFields(logrus.Fields{
+			"target": target,
+			"text":   a.Text,
+			"error":  err,
+		}).Warn("Failed to send annotation")
+		return err
+	}
+	annotationsSentTotal.WithLabelValues(target, "success").Inc()
+	return nil
+}
@@ -0,0 +1,276 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"goexample/pkg/clock"
+	"goexample/pkg/telemetry"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Algorithms of the adaptive concurrency limit
+const (
+	// Additive increase while latency stays under the target, multiplicative decrease above it
+	AdaptiveAIMD = "aimd"
+	// Estimates the queue from the latency over the lowest latency seen, grows while it is short
+	AdaptiveVegas = "vegas"
+)
+
+// Routes left out of the adaptive concurrency limit: their requests last as long as the client
+// streams, so their latency and disconnects say nothing about the load of the service
+var adaptiveExcludedRoutes = map[string]bool{
+	"/stream": true,
+	"/upload": true,
+}
+
+// Samples after which Vegas forgets its lowest latency, so a slower baseline after a deploy is picked up
+const vegasProbeInterval = 1000
+
+// adaptiveMetrics are the metrics of the adaptive concurrency limiter
+type adaptiveMetrics struct {
+	adaptiveLimit           prometheus.Gauge
+	adaptiveInFlight        prometheus.Gauge
+	adaptiveRejectedTotal   *prometheus.CounterVec
+	adaptiveLatencyBaseline prometheus.Gauge
+}
+
+func newAdaptiveMetrics() adaptiveMetrics {
+	return adaptiveMetrics{
+		adaptiveLimit: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "adaptive_concurrency_limit",
+				Help: "Current limit of concurrent requests set by the adaptive concurrency limiter",
+			},
+		),
+
+		adaptiveInFlight: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "adaptive_concurrency_in_flight",
+				Help: "Number of requests currently admitted by the adaptive concurrency limiter",
+			},
+		),
+
+		adaptiveRejectedTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "adaptive_concurrency_rejected_total",
+				Help: "Total number of requests rejected with 503 because the adaptive concurrency limit was reached",
+			},
+			[]string{"endpoint"},
+		),
+
+		adaptiveLatencyBaseline: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "adaptive_concurrency_latency_baseline_seconds",
+				Help: "Latency the limiter compares requests against: the target with aimd, the lowest recent latency with vegas",
+			},
+		),
+	}
+}
+
+// AdaptiveLimitConfig sets the adaptive concurrency limiter, which is disabled without an algorithm
+type AdaptiveLimitConfig struct {
+	Algorithm string
+	// Limit at start and its bounds
+	Initial int
+	Min     int
+	Max     int
+	// AIMD decreases the limit when a request is slower than Target, multiplying it by Backoff
+	Target  time.Duration
+	Backoff float64
+}
+
+// DefaultAdaptiveLimit returns the settings completed by ADAPTIVE_CONCURRENCY
+func DefaultAdaptiveLimit() AdaptiveLimitConfig {
+	return AdaptiveLimitConfig{Initial: 20, Min: 4, Max: 200, Target: 250 * time.Millisecond, Backoff: 0.9}
+}
+
+// parseAdaptiveLimit parses "algorithm=vegas,initial=20,min=4,max=200", AIMD also takes target and backoff
+func parseAdaptiveLimit(spec string) (AdaptiveLimitConfig, error) {
+	c := DefaultAdaptiveLimit()
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return c, fmt.Errorf("invalid adaptive concurrency setting %q", pair)
+		}
+		var err error
+		switch key {
+		case "algorithm":
+			c.Algorithm = value
+			if value != AdaptiveAIMD && value != AdaptiveVegas {
+				err = errors.New("unknown algorithm")
+			}
+		case "initial":
+			c.Initial, err = strconv.Atoi(value)
+		case "min":
+			c.Min, err = strconv.Atoi(value)
+		case "max":
+			c.Max, err = strconv.Atoi(value)
+		case "target":
+			c.Target, err = time.ParseDuration(value)
+			if err == nil && c.Target <= 0 {
+				err = errors.New("not positive")
+			}
+		case "backoff":
+			c.Backoff, err = strconv.ParseFloat(value, 64)
+			if err == nil && (c.Backoff <= 0 || c.Backoff >= 1) {
+				err = errors.New("not between 0 and 1")
+			}
+		default:
+			return c, fmt.Errorf("unknown adaptive concurrency setting %q", key)
+		}
+		if err != nil {
+			return c, fmt.Errorf("invalid adaptive concurrency setting %s: %q", key, value)
+		}
+	}
+	if c.Algorithm == "" {
+		return c, errors.New("adaptive concurrency needs an algorithm, aimd or vegas")
+	}
+	if c.Min < 1 || c.Min > c.Initial || c.Initial > c.Max {
+		return c, fmt.Errorf("adaptive concurrency limits must satisfy 1 <= min <= initial <= max, got %d, %d and %d", c.Min, c.Initial, c.Max)
+	}
+	return c, nil
+}
+
+func (c AdaptiveLimitConfig) String() string {
+	if c.Algorithm == "" {
+		return "disabled"
+	}
+	s := fmt.Sprintf("algorithm=%s,initial=%d,min=%d,max=%d", c.Algorithm, c.Initial, c.Min, c.Max)
+	if c.Algorithm == AdaptiveAIMD {
+		s += fmt.Sprintf(",target=%s,backoff=%g", c.Target, c.Backoff)
+	}
+	return s
+}
+
+// adaptiveLimiter rejects requests beyond a concurrency limit it adjusts from their latency, so the
+// service sheds load before queueing drives latency up instead of after. Unlike inFlightLimiter it
+// does not queue: a request over the limit is rejected at once.
+type adaptiveLimiter struct {
+	cfg     AdaptiveLimitConfig
+	clock   clock.Clock
+	metrics *metrics
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	// Vegas: lowest latency since the last probe and the samples since
+	minLatency time.Duration
+	samples    int
+}
+
+// newAdaptiveLimiter returns nil, which disables the limiter, without an algorithm
+func newAdaptiveLimiter(cfg AdaptiveLimitConfig, c clock.Clock, m *metrics) *adaptiveLimiter {
+	if cfg.Algorithm == "" {
+		return nil
+	}
+	m.adaptiveLimit.Set(float64(cfg.Initial))
+	if cfg.Algorithm == AdaptiveAIMD {
+		m.adaptiveLatencyBaseline.Set(cfg.Target.Seconds())
+	}
+	return &adaptiveLimiter{cfg: cfg, clock: c, metrics: m, limit: float64(cfg.Initial)}
+}
+
+// middleware admits the request under the limit and feeds its latency back into the limit, except on
+// the long-lived routes of adaptiveExcludedRoutes
+func (l *adaptiveLimiter) middleware(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	if l == nil || adaptiveExcludedRoutes[endpoint] {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, inFlight, ok := l.acquire()
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.Int("concurrency.limit", limit))
+		if !ok {
+			l.metrics.adaptiveRejectedTotal.WithLabelValues(endpoint).Inc()
+			telemetry.Canonical(r.Context()).Set("concurrency_limited", true)
+			w.Header().Set("Retry-After", "1")
+			writeError(r.Context(), w, http.StatusServiceUnavailable, "Service Unavailable")
+			return
+		}
+
+		start := l.clock.Now()
+		defer func() {
+			// A request cancelled or timed out on the way counts as slow whatever its latency
+			l.release(inFlight, clock.Since(l.clock, start), r.Context().Err() != nil)
+		}()
+		handler(w, r)
+	}
+}
+
+// acquire takes a slot when one is free and returns the limit and the requests in flight with this one
+func (l *adaptiveLimiter) acquire() (int, int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit := int(l.limit)
+	if l.inFlight >= limit {
+		return limit, l.inFlight, false
+	}
+	l.inFlight++
+	l.metrics.adaptiveInFlight.Set(float64(l.inFlight))
+	return limit, l.inFlight, true
+}
+
+// release frees the slot and updates the limit from the latency of the request, inFlight being the
+// concurrency it ran at. The limit only grows when it was actually used, so an idle service does
+// not drift to the maximum.
+func (l *adaptiveLimiter) release(inFlight int, latency time.Duration, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.metrics.adaptiveInFlight.Set(float64(l.inFlight))
+
+	saturated := float64(inFlight)*2 >= l.limit
+	switch l.cfg.Algorithm {
+	case AdaptiveAIMD:
+		if dropped || latency > l.cfg.Target {
+			l.limit *= l.cfg.Backoff
+		} else if saturated {
+			l.limit++
+		}
+	case AdaptiveVegas:
+		l.vegas(latency, dropped, saturated)
+	}
+	l.limit = math.Max(float64(l.cfg.Min), math.Min(float64(l.cfg.Max), l.limit))
+	l.metrics.adaptiveLimit.Set(math.Floor(l.limit))
+}
+
+// vegas adjusts the limit from the estimated queue, limit * (1 - minLatency/latency), keeping it
+// between alpha and beta which grow with the log of the limit as in Netflix's concurrency-limits
+func (l *adaptiveLimiter) vegas(latency time.Duration, dropped, saturated bool) {
+	l.samples++
+	if l.samples >= vegasProbeInterval {
+		l.samples, l.minLatency = 0, 0
+	}
+	if latency <= 0 {
+		return
+	}
+	if l.minLatency == 0 || latency < l.minLatency {
+		l.minLatency = latency
+		l.metrics.adaptiveLatencyBaseline.Set(latency.Seconds())
+	}
+
+	step := math.Max(1, math.Log10(l.limit))
+	if dropped {
+		l.limit -= step
+		return
+	}
+	queue := math.Ceil(l.limit * (1 - float64(l.minLatency)/float64(latency)))
+	alpha, beta := 3*step, 6*step
+	switch {
+	case queue <= step && saturated:
+		l.limit += beta
+	case queue < alpha && saturated:
+		l.limit += step
+	case queue > beta:
+		l.limit -= step
+	}
+}
@@ -0,0 +1,322 @@
+package app
+
+import (
+	"context"
+	"goexample/pkg/adminauth"
+	"goexample/pkg/annotations"
+	"goexample/pkg/chaos"
+	"goexample/pkg/client"
+	"goexample/pkg/clock"
+	"goexample/pkg/kafkapkg"
+	"goexample/pkg/objectstore"
+	"goexample/pkg/telemetry"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// Name of the service in spans, tracer scopes and logs
+const serviceName = "goexample"
+
+// Kafka topics this service publishes to
+const (
+	HelloTopic  = "trace"
+	OrdersTopic = "orders"
+	TasksTopic  = "tasks"
+	// Results of the tasks, published by goexample1
+	TaskResultsTopic = "task-results"
+)
+
+// Async hello publishing: background writers, queued messages and messages per write
+const (
+	asyncPublishWorkers   = 4
+	asyncPublishQueueSize = 1000
+	asyncPublishBatchSize = 100
+)
+
+// HTTPClient sends requests to downstream services, implemented by *http.Client
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Downstream is the goexample1 API the service calls, implemented by *client.Client and by
+// *client.Simulator
+type Downstream interface {
+	Hello(ctx context.Context) (string, error)
+	Virtual(ctx context.Context, service string) error
+	ReserveInventory(ctx context.Context, r client.Reservation) error
+	ReleaseInventory(ctx context.Context, r client.Reservation) error
+}
+
+// Deps are the external dependencies of the service, replaceable by fakes
+type Deps struct {
+	Logger         *logrus.Logger
+	TracerProvider trace.TracerProvider
+	// Writers of the hello and orders topics
+	HelloWriter kafkapkg.Writer
+	OrderWriter kafkapkg.Writer
+	// Writer of the tasks topic and reader of the task-results topic, the /tasks routes are missing
+	// without a writer
+	TaskWriter  kafkapkg.Writer
+	TaskResults kafkapkg.Reader
+	// goexample1, a client.Client sending its requests through HTTPClient when nil
+	Downstream Downstream
+	// Sends the requests to goexample1 and the shadow target, a client going through the
+	// downstream proxy when nil
+	HTTPClient HTTPClient
+	// Time source of the middlewares and simulated latency, the wall clock when nil
+	Clock clock.Clock
+	// Marks chaos and config changes on the dashboards, nothing is sent when nil
+	Annotations annotations.Emitter
+	// Object storage uploads and order archives are written to, uploads go to the throttled stub
+	// and orders are not archived when nil
+	ObjectStore *objectstore.Store
+	// Recent sampling decisions listed on /admin/sampling, the route is missing when nil
+	SamplingLog *telemetry.SamplingLog
+	// Registry the metrics are registered with and served from on /metrics, the default
+	// registry when nil. A fresh registry per instance lets tests assert on its metrics.
+	Registry *prometheus.Registry
+}
+
+// App is the goexample HTTP service
+type App struct {
+	cfg    Config
+	logger *logrus.Logger
+	// Collectors of the App, registered with Deps.Registry
+	metrics *metrics
+
+	// Spans of the business logic, the HTTP server and the Kafka producer
+	tracer      trace.Tracer
+	httpTracer  trace.Tracer
+	kafkaTracer trace.Tracer
+
+	helloWriter kafkapkg.Writer
+	orderWriter kafkapkg.Writer
+	// Set when hello messages are published asynchronously
+	helloProducer *kafkapkg.AsyncProducer
+	// Set while a produce burst runs, only one runs at a time
+	bursting   atomic.Bool
+	taskWriter kafkapkg.Writer
+	// Async tasks and their results for polling, the results are consumed until stopTaskResults
+	tasks           *taskStore
+	stopTaskResults context.CancelFunc
+
+	downstreamGroup singleflight.Group
+	// Calls goexample1
+	goexample1 Downstream
+	// Sends the requests to goexample1 and the shadow target
+	httpClient HTTPClient
+	clock      clock.Clock
+	// Injected faults, starting at the configured error rate
+	chaos *chaos.State
+	// Dashboard annotations of produce bursts and profiling changes
+	annotations annotations.Emitter
+	// Uploads and order archives, nil without object storage
+	objects *objectstore.Store
+	// Last requests, listed on the status page
+	recent recentRequests
+	// What a good request is per route
+	slis map[string]SLI
+	// Start of the service and the requests seen since, the first ColdStartRequests are cold
+	started      time.Time
+	coldRequests atomic.Int64
+
+	// Priority class limits, the server wide in-flight limit and the adaptive concurrency limit,
+	// the last two nil when disabled
+	limiter      *priorityLimiter
+	backpressure *inFlightLimiter
+	adaptive     *adaptiveLimiter
+	// Mirrored requests in flight, one element per request
+	shadowSlots chan struct{}
+	// Routes served through instrument and the current snapshot of their overrides, changed one
+	// writer at a time
+	routes      map[string]bool
+	overrides   atomic.Pointer[routeOverrides]
+	overridesMu sync.Mutex
+
+	mux *http.ServeMux
+}
+
+// New wires the handlers, middlewares and telemetry of the service
+func New(cfg Config, deps Deps) (*App, error) {
+	m := newMetrics()
+	a := &App{
+		cfg:          cfg,
+		logger:       deps.Logger,
+		tracer:       telemetry.Tracer(deps.TracerProvider, serviceName, telemetry.ScopeBusiness),
+		httpTracer:   telemetry.Tracer(deps.TracerProvider, serviceName, telemetry.ScopeHTTPServer),
+		kafkaTracer:  telemetry.Tracer(deps.TracerProvider, serviceName, telemetry.ScopeKafka),
+		helloWriter:  kafkapkg.NewRetryingWriter(deps.HelloWriter, cfg.KafkaRetryPolicies),
+		orderWriter:  kafkapkg.NewRetryingWriter(deps.OrderWriter, cfg.KafkaRetryPolicies),
+		goexample1:   deps.Downstream,
+		httpClient:   deps.HTTPClient,
+		annotations:  deps.Annotations,
+		objects:      deps.ObjectStore,
+		clock:        deps.Clock,
+		chaos:        chaos.NewState(chaos.Settings{ErrorRate: cfg.ErrorRate}),
+		metrics:      m,
+		backpressure: newInFlightLimiter(cfg.MaxInFlight, cfg.MaxQueueDepth, m),
+		slis:         make(map[string]SLI),
+		shadowSlots:  make(chan struct{}, maxShadowInFlight),
+		tasks:        newTaskStore(cfg.TaskResultTTL, m),
+		routes:       make(map[string]bool),
+		mux:          http.NewServeMux(),
+	}
+	if a.clock == nil {
+		a.clock = clock.Real{}
+	}
+	if a.httpClient == nil {
+		a.httpClient = &http.Client{Transport: client.NewTransport(cfg.DownstreamProxy)}
+	}
+	if a.annotations == nil {
+		a.annotations = annotations.Nop{}
+	}
+	a.started = a.clock.Now()
+	a.overrides.Store(&routeOverrides{})
+	a.limiter = newPriorityLimiter(cfg.PriorityLimits, cfg.PriorityQueueTimeout, a.clock, m)
+	a.adaptive = newAdaptiveLimiter(cfg.AdaptiveLimit, a.clock, m)
+	m.coldStartRemaining.Set(float64(cfg.ColdStartRequests))
+	// Simulated goexample1 for latency demos without the network
+	if a.goexample1 == nil && cfg.DownstreamLatency != nil {
+		a.goexample1 = client.NewSimulator(client.SimulatorConfig{
+			BaseURL: goexample1URL,
+			Model:   cfg.DownstreamLatency,
+			Timeout: cfg.Timeouts[dependencyGoexample1],
+			Seed:    time.Now().UnixNano(),
+			Tracer:  a.tracer,
+			Clock:   a.clock,
+		})
+	}
+	if a.goexample1 == nil {
+		goexample1, err := client.New(client.Config{
+			BaseURL:    goexample1URL,
+			Caller:     serviceName,
+			HTTPClient: a.httpClient,
+			Tracer:     a.tracer,
+			Timeout:    cfg.Timeouts[dependencyGoexample1],
+			Retry:      cfg.DownstreamRetry,
+			Clock:      a.clock,
+		})
+		if err != nil {
+			return nil, err
+		}
+		a.goexample1 = goexample1
+	}
+
+	var (
+		registerer prometheus.Registerer = prometheus.DefaultRegisterer
+		gatherer   prometheus.Gatherer   = prometheus.DefaultGatherer
+	)
+	if deps.Registry != nil {
+		registerer, gatherer = deps.Registry, deps.Registry
+	}
+	if err := m.register(registerer); err != nil {
+		return nil, err
+	}
+	if cfg.AsyncPublish {
+		a.helloProducer = kafkapkg.NewAsyncProducer(a.helloWriter, HelloTopic, a.kafkaTracer, asyncPublishWorkers, asyncPublishQueueSize, asyncPublishBatchSize)
+	}
+
+	// SLIs of the routes, feeding sli_good_total / sli_valid_total
+	a.registerSLI("/hello", SLI{Good: []string{"2xx"}, Latency: 250 * time.Millisecond, Ignore: []string{"4xx"}})
+	a.registerSLI("/order", SLI{Good: []string{"2xx"}, Latency: 500 * time.Millisecond, Ignore: []string{"4xx"}})
+	a.registerSLI("/quote", SLI{Good: []string{"2xx", "4xx"}, Latency: 50 * time.Millisecond})
+
+	// routes
+	a.mux.HandleFunc("GET /{$}", a.instrument("/", a.status))
+	a.mux.HandleFunc("/hello", a.instrument("/hello", a.hello))
+	a.mux.HandleFunc("/headers", a.instrument("/headers", headers))
+	a.mux.HandleFunc("/stream", a.instrument("/stream", a.stream))
+	a.mux.HandleFunc("POST /order", a.instrument("/order", a.placeOrder))
+	Handle(a, "POST /quote", quote)
+	Handle(a, "POST /bench/serialize", a.benchSerialize)
+	a.mux.HandleFunc("POST /upload", a.instrument("/upload", a.upload))
+	// Async tasks processed by goexample1, polled for their result
+	if deps.TaskWriter != nil {
+		a.taskWriter = kafkapkg.NewRetryingWriter(deps.TaskWriter, cfg.KafkaRetryPolicies)
+		a.mux.HandleFunc("POST /tasks", a.instrument("/tasks", a.enqueueTask))
+		a.mux.HandleFunc("GET /tasks/{id}", a.instrument("/tasks/{id}", a.pollTask))
+	}
+	if deps.TaskResults != nil {
+		var ctx context.Context
+		ctx, a.stopTaskResults = context.WithCancel(context.Background())
+		go a.consumeTaskResults(ctx, deps.TaskResults)
+	}
+
+	// Connect / gRPC-Web variant of the hello API for browser clients
+	connectPath, connectHandler, err := a.newConnectHelloHandler()
+	if err != nil {
+		return nil, err
+	}
+	a.mux.Handle(connectPath, corsMiddleware(a.metricsMiddleware(connectPath, a.adaptive.middleware(connectPath, a.backpressure.middleware(a.limiter.middleware(connectHandler.ServeHTTP))))))
+
+	// Prometheus metrics endpoint
+	// Deployment environment, region, zone and variant are added to every metric as constant labels,
+	// experiment_id while an experiment runs
+	// Scrape duration and size are always measured, ScrapeTracing adds a span per scrape
+	// OpenMetrics scrapes also get the trace exemplars of the request metrics
+	var scrapeTracer trace.Tracer
+	if cfg.ScrapeTracing {
+		scrapeTracer = a.httpTracer
+	}
+	a.mux.Handle("/metrics", adminauth.Protect(cfg.AdminAuth, "/metrics", telemetry.InstrumentScrape(promhttp.HandlerFor(
+		telemetry.WithConstLabels(telemetry.WithExperimentLabel(gatherer), cfg.Deployment.Labels()),
+		promhttp.HandlerOpts{EnableOpenMetrics: true},
+	), scrapeTracer)))
+
+	a.mux.Handle("GET /admin/config", adminauth.Protect(cfg.AdminAuth, "/admin/config", http.HandlerFunc(a.getConfig)))
+	if deps.SamplingLog != nil {
+		a.mux.Handle("GET /admin/sampling", adminauth.Protect(cfg.AdminAuth, "/admin/sampling", samplingDecisions(deps.SamplingLog)))
+	}
+
+	// Contention profiling toggles and the resulting profiles (go tool pprof http://.../debug/pprof/mutex)
+	a.mux.Handle("GET /admin/profiling", adminauth.Protect(cfg.AdminAuth, "/admin/profiling", http.HandlerFunc(getProfiling)))
+	a.mux.Handle("POST /admin/profiling/{profile}", adminauth.Protect(cfg.AdminAuth, "/admin/profiling", http.HandlerFunc(a.setProfiling)))
+	a.mux.Handle("GET /debug/pprof/{profile}", adminauth.Protect(cfg.AdminAuth, "/debug/pprof", http.HandlerFunc(a.pprofProfile)))
+
+	// Chaos, timeout and rate limit settings of single routes
+	a.mux.Handle("GET /admin/overrides", adminauth.Protect(cfg.AdminAuth, "/admin/overrides", http.HandlerFunc(a.getOverrides)))
+	a.mux.Handle("PUT /admin/overrides", adminauth.Protect(cfg.AdminAuth, "/admin/overrides", http.HandlerFunc(a.putOverride)))
+	a.mux.Handle("DELETE /admin/overrides", adminauth.Protect(cfg.AdminAuth, "/admin/overrides", http.HandlerFunc(a.deleteOverride)))
+
+	// Produce bursts to demonstrate consumer lag on goexample1
+	a.mux.Handle("POST /admin/kafka/burst", adminauth.Protect(cfg.AdminAuth, "/admin/kafka/burst", http.HandlerFunc(a.startBurst)))
+
+	return a, nil
+}
+
+// instrument wraps handler in the middleware chain shared by the routes: tracing, traffic mirroring,
+// canonical log line, cold start tagging, latency budget, metrics, SLI, route overrides, response cache, adaptive
+// concurrency limit, backpressure, priority limits, cost sampling
+func (a *App) instrument(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	a.routes[endpoint] = true
+	return a.traceMiddleware(endpoint, a.shadowMiddleware(endpoint, a.canonicalMiddleware(endpoint, a.coldStartMiddleware(endpoint, a.budgetMiddleware(endpoint, a.metricsMiddleware(endpoint,
+		a.sliMiddleware(endpoint, a.overrideMiddleware(endpoint, a.cacheMiddleware(endpoint, a.adaptive.middleware(endpoint, a.backpressure.middleware(a.limiter.middleware(a.costMiddleware(endpoint, handler)))))))))))))
+}
+
+// Handler returns the routes of the service
+func (a *App) Handler() http.Handler {
+	return a.mux
+}
+
+// Close flushes the messages still queued for asynchronous publishing and stops consuming task results
+func (a *App) Close() {
+	if a.helloProducer != nil {
+		a.helloProducer.Close()
+	}
+	if a.stopTaskResults != nil {
+		a.stopTaskResults()
+	}
+}
+
+// logWithTrace returns a logrus.Entry with trace_id and span_id from context
+func (a *App) logWithTrace(ctx context.Context) *logrus.Entry {
+	return telemetry.WithTrace(a.logger, ctx)
+}
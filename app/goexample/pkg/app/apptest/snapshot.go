@@ -0,0 +1,87 @@
+// Package apptest holds the snapshot helpers of the tests, it is not linked into the binaries
+package apptest
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Metric families of the Go client itself, left out of metric snapshots
+var runtimeMetricPrefixes = []string{"go_", "process_", "promhttp_"}
+
+// SnapshotSpans renders the stable parts of spans: name, kind, status, parent name,
+// attribute keys, event names and link count. IDs, timestamps and attribute values
+// differ between runs and are left out.
+func SnapshotSpans(spans []sdktrace.ReadOnlySpan) string {
+	names := make(map[string]string, len(spans))
+	for _, s := range spans {
+		names[s.SpanContext().SpanID().String()] = s.Name()
+	}
+
+	var b strings.Builder
+	for _, s := range spans {
+		parent := "-"
+		if name, ok := names[s.Parent().SpanID().String()]; ok && s.Parent().IsValid() {
+			parent = name
+		}
+		fmt.Fprintf(&b, "span %q kind=%s status=%s parent=%q links=%d\n",
+			s.Name(), s.SpanKind(), s.Status().Code, parent, len(s.Links()))
+
+		keys := make([]string, 0, len(s.Attributes()))
+		for _, kv := range s.Attributes() {
+			keys = append(keys, string(kv.Key))
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&b, "  attr %s\n", key)
+		}
+		for _, e := range s.Events() {
+			fmt.Fprintf(&b, "  event %q\n", e.Name)
+		}
+	}
+	return b.String()
+}
+
+// SnapshotMetrics renders the name, type and label names of every metric family
+// gathered, skipping the Go runtime and process collectors
+func SnapshotMetrics(gatherer prometheus.Gatherer) (string, error) {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, mf := range families {
+		if hasAnyPrefix(mf.GetName(), runtimeMetricPrefixes) {
+			continue
+		}
+
+		labels := make(map[string]bool)
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = true
+			}
+		}
+		names := make([]string, 0, len(labels))
+		for name := range labels {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		fmt.Fprintf(&b, "%s %s {%s}\n", mf.GetName(), strings.ToLower(mf.GetType().String()), strings.Join(names, ","))
+	}
+	return b.String(), nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
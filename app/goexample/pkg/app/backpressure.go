@@ -0,0 +1,100 @@
+package app
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// backpressureMetrics are the metrics of the server wide in-flight limit
+type backpressureMetrics struct {
+	inFlightRequests  prometheus.Gauge
+	queuedRequests    prometheus.Gauge
+	shedRequestsTotal prometheus.Counter
+}
+
+func newBackpressureMetrics() backpressureMetrics {
+	return backpressureMetrics{
+		inFlightRequests: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "http_in_flight_requests",
+				Help: "Number of requests currently being handled by the server",
+			},
+		),
+
+		queuedRequests: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "http_queued_requests",
+				Help: "Number of requests waiting for an in-flight slot",
+			},
+		),
+
+		shedRequestsTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "http_shed_requests_total",
+				Help: "Total number of requests rejected with 503 because the server queue was full",
+			},
+		),
+	}
+}
+
+// inFlightLimiter caps the requests handled at once across all routes. Requests beyond the
+// limit wait in a bounded queue, once the queue is full they are shed with 503.
+type inFlightLimiter struct {
+	slots    chan struct{}
+	maxQueue int64
+	queued   atomic.Int64
+	metrics  *metrics
+}
+
+// newInFlightLimiter returns nil, which disables the limiter, when maxInFlight is 0
+func newInFlightLimiter(maxInFlight, maxQueue int, m *metrics) *inFlightLimiter {
+	if maxInFlight == 0 {
+		return nil
+	}
+
+	return &inFlightLimiter{
+		slots:    make(chan struct{}, maxInFlight),
+		maxQueue: int64(maxQueue),
+		metrics:  m,
+	}
+}
+
+// middleware admits the request when a slot is free, queues it while the queue has room and sheds it otherwise
+func (l *inFlightLimiter) middleware(handler http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			if l.queued.Add(1) > l.maxQueue {
+				l.queued.Add(-1)
+				l.metrics.shedRequestsTotal.Inc()
+				w.Header().Set("Retry-After", "1")
+				writeError(r.Context(), w, http.StatusServiceUnavailable, "Service Unavailable")
+				return
+			}
+			l.metrics.queuedRequests.Inc()
+
+			select {
+			case l.slots <- struct{}{}:
+				l.queued.Add(-1)
+				l.metrics.queuedRequests.Dec()
+			case <-r.Context().Done():
+				l.queued.Add(-1)
+				l.metrics.queuedRequests.Dec()
+				return
+			}
+		}
+		defer func() { <-l.slots }()
+
+		l.metrics.inFlightRequests.Inc()
+		defer l.metrics.inFlightRequests.Dec()
+
+		handler(w, r)
+	}
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"goexample/pkg/app/benchpb"
+	"strconv"
+	"time"
+)
+
+//go:generate msgp -unexported -io=false -tests=false
+
+// benchPayload is the sample encoded by the benchmark, an order like message
+type benchPayload struct {
+	ID        string      `json:"id" msg:"id"`
+	CreatedAt int64       `json:"created_at" msg:"created_at"`
+	Tags      []string    `json:"tags" msg:"tags"`
+	Items     []benchItem `json:"items" msg:"items"`
+}
+
+type benchItem struct {
+	SKU      string  `json:"sku" msg:"sku"`
+	Quantity int64   `json:"quantity" msg:"quantity"`
+	Price    float64 `json:"price" msg:"price"`
+}
+
+// newBenchPayload returns a payload of n items
+func newBenchPayload(n int) benchPayload {
+	p := benchPayload{
+		ID:        "bench-order-1",
+		CreatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano(),
+		Tags:      []string{"bench", "serialize"},
+		Items:     make([]benchItem, n),
+	}
+	for i := range p.Items {
+		p.Items[i] = benchItem{SKU: "sku-" + strconv.Itoa(i), Quantity: int64(i%5 + 1), Price: 2.5 + float64(i%7)}
+	}
+	return p
+}
+
+// proto returns p as the message of benchpb
+func (p benchPayload) proto() *benchpb.Payload {
+	m := &benchpb.Payload{
+		Id:        p.ID,
+		CreatedAt: p.CreatedAt,
+		Tags:      p.Tags,
+		Items:     make([]*benchpb.Item, len(p.Items)),
+	}
+	for i, it := range p.Items {
+		m.Items[i] = &benchpb.Item{Sku: it.SKU, Quantity: it.Quantity, Price: it.Price}
+	}
+	return m
+}
@@ -0,0 +1,219 @@
+// Payload encoded by POST /bench/serialize, the protobuf counterpart of its JSON and MessagePack encodings
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: pkg/app/benchpb/bench.proto
+
+package benchpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// An order like message
+type Payload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	CreatedAt     int64                  `protobuf:"varint,2,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	Tags          []string               `protobuf:"bytes,3,rep,name=tags,proto3" json:"tags,omitempty"`
+	Items         []*Item                `protobuf:"bytes,4,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Payload) Reset() {
+	*x = Payload{}
+	mi := &file_pkg_app_benchpb_bench_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Payload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Payload) ProtoMessage() {}
+
+func (x *Payload) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_app_benchpb_bench_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Payload.ProtoReflect.Descriptor instead.
+func (*Payload) Descriptor() ([]byte, []int) {
+	return file_pkg_app_benchpb_bench_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Payload) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Payload) GetCreatedAt() int64 {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return 0
+}
+
+func (x *Payload) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *Payload) GetItems() []*Item {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type Item struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sku           string                 `protobuf:"bytes,1,opt,name=sku,proto3" json:"sku,omitempty"`
+	Quantity      int64                  `protobuf:"varint,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	Price         float64                `protobuf:"fixed64,3,opt,name=price,proto3" json:"price,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Item) Reset() {
+	*x = Item{}
+	mi := &file_pkg_app_benchpb_bench_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Item) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Item) ProtoMessage() {}
+
+func (x *Item) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_app_benchpb_bench_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Item.ProtoReflect.Descriptor instead.
+func (*Item) Descriptor() ([]byte, []int) {
+	return file_pkg_app_benchpb_bench_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Item) GetSku() string {
+	if x != nil {
+		return x.Sku
+	}
+	return ""
+}
+
+func (x *Item) GetQuantity() int64 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *Item) GetPrice() float64 {
+	if x != nil {
+		return x.Price
+	}
+	return 0
+}
+
+var File_pkg_app_benchpb_bench_proto protoreflect.FileDescriptor
+
+const file_pkg_app_benchpb_bench_proto_rawDesc = "" +
+	"\n" +
+	"\x1bpkg/app/benchpb/bench.proto\x12\bbench.v1\"r\n" +
+	"\aPayload\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\x02 \x01(\x03R\tcreatedAt\x12\x12\n" +
+	"\x04tags\x18\x03 \x03(\tR\x04tags\x12$\n" +
+	"\x05items\x18\x04 \x03(\v2\x0e.bench.v1.ItemR\x05items\"J\n" +
+	"\x04Item\x12\x10\n" +
+	"\x03sku\x18\x01 \x01(\tR\x03sku\x12\x1a\n" +
+	"\bquantity\x18\x02 \x01(\x03R\bquantity\x12\x14\n" +
+	"\x05price\x18\x03 \x01(\x01R\x05priceB\x1bZ\x19goexample/pkg/app/benchpbb\x06proto3"
+
+var (
+	file_pkg_app_benchpb_bench_proto_rawDescOnce sync.Once
+	file_pkg_app_benchpb_bench_proto_rawDescData []byte
+)
+
+func file_pkg_app_benchpb_bench_proto_rawDescGZIP() []byte {
+	file_pkg_app_benchpb_bench_proto_rawDescOnce.Do(func() {
+		file_pkg_app_benchpb_bench_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pkg_app_benchpb_bench_proto_rawDesc), len(file_pkg_app_benchpb_bench_proto_rawDesc)))
+	})
+	return file_pkg_app_benchpb_bench_proto_rawDescData
+}
+
+var file_pkg_app_benchpb_bench_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_pkg_app_benchpb_bench_proto_goTypes = []any{
+	(*Payload)(nil), // 0: bench.v1.Payload
+	(*Item)(nil),    // 1: bench.v1.Item
+}
+var file_pkg_app_benchpb_bench_proto_depIdxs = []int32{
+	1, // 0: bench.v1.Payload.items:type_name -> bench.v1.Item
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_pkg_app_benchpb_bench_proto_init() }
+func file_pkg_app_benchpb_bench_proto_init() {
+	if File_pkg_app_benchpb_bench_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pkg_app_benchpb_bench_proto_rawDesc), len(file_pkg_app_benchpb_bench_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_pkg_app_benchpb_bench_proto_goTypes,
+		DependencyIndexes: file_pkg_app_benchpb_bench_proto_depIdxs,
+		MessageInfos:      file_pkg_app_benchpb_bench_proto_msgTypes,
+	}.Build()
+	File_pkg_app_benchpb_bench_proto = out.File
+	file_pkg_app_benchpb_bench_proto_goTypes = nil
+	file_pkg_app_benchpb_bench_proto_depIdxs = nil
+}
@@ -0,0 +1,4 @@
+// Package benchpb holds the protobuf messages of the serialization benchmark
+package benchpb
+
+//go:generate protoc -I ../../.. --go_out=../../.. --go_opt=paths=source_relative pkg/app/benchpb/bench.proto
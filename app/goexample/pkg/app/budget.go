@@ -0,0 +1,60 @@
+package app
+
+import (
+	"goexample/pkg/clock"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Expected latency per endpoint, endpoints without a budget (e.g. /stream) are not checked
+var latencyBudgets = map[string]time.Duration{
+	"/hello":   250 * time.Millisecond,
+	"/headers": 50 * time.Millisecond,
+	"/order":   500 * time.Millisecond,
+}
+
+// budgetMetrics are the metrics of the latency budgets
+type budgetMetrics struct {
+	overBudgetTotal *prometheus.CounterVec
+}
+
+func newBudgetMetrics() budgetMetrics {
+	return budgetMetrics{
+		overBudgetTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "http_requests_over_budget_total",
+				Help: "Total number of HTTP requests taking longer than their endpoint's latency budget",
+			},
+			[]string{"endpoint"},
+		),
+	}
+}
+
+// budgetMiddleware compares the request duration with the endpoint's latency budget and
+// records budget, actual duration and whether it was exceeded on the server span
+func (a *App) budgetMiddleware(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	budget, ok := latencyBudgets[endpoint]
+	if !ok {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := a.clock.Now()
+		handler(w, r)
+		actual := clock.Since(a.clock, start)
+
+		over := actual > budget
+		trace.SpanFromContext(r.Context()).SetAttributes(
+			attribute.Int64("latency.budget_ms", budget.Milliseconds()),
+			attribute.Int64("latency.actual_ms", actual.Milliseconds()),
+			attribute.Bool("latency.over_budget", over),
+		)
+		if over {
+			a.metrics.overBudgetTotal.WithLabelValues(endpoint).Inc()
+		}
+	}
+}
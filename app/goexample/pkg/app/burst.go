@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"goexample/pkg/annotations"
+	"goexample/pkg/errfmt"
+	"goexample/pkg/kafkapkg"
+	"goexample/pkg/telemetry"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	maxBurstMessages = 100000
+	maxBurstRate     = 10000
+	// Messages of a burst are written in batches at this interval
+	burstTick = 100 * time.Millisecond
+)
+
+// burstMetrics are the metrics of the produce bursts
+type burstMetrics struct {
+	burstActive        prometheus.Gauge
+	burstStartTime     prometheus.Gauge
+	burstMessagesTotal *prometheus.CounterVec
+}
+
+func newBurstMetrics() burstMetrics {
+	return burstMetrics{
+		// Marks bursts on dashboards, e.g. as Grafana annotations on kafka_produce_burst_active == 1
+		burstActive: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "kafka_produce_burst_active",
+				Help: "Set to 1 while a produce burst started through the admin API is running",
+			},
+		),
+
+		burstStartTime: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "kafka_produce_burst_start_timestamp_seconds",
+				Help: "Unix time the last produce burst started",
+			},
+		),
+
+		burstMessagesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kafka_produce_burst_messages_total",
+				Help: "Total number of messages published by produce bursts",
+			},
+			[]string{"topic", "result"},
+		),
+	}
+}
+
+// startBurst handles POST /admin/kafka/burst?messages=N&rate=R, publishing N hello messages
+// at R messages per second in the background so consumer lag builds up on goexample1
+func (a *App) startBurst(w http.ResponseWriter, req *http.Request) {
+	messages, err := strconv.Atoi(req.URL.Query().Get("messages"))
+	if err != nil || messages <= 0 || messages > maxBurstMessages {
+		http.Error(w, "messages must be between 1 and "+strconv.Itoa(maxBurstMessages), http.StatusBadRequest)
+		return
+	}
+	rate, err := strconv.Atoi(req.URL.Query().Get("rate"))
+	if err != nil || rate <= 0 || rate > maxBurstRate {
+		http.Error(w, "rate must be between 1 and "+strconv.Itoa(maxBurstRate), http.StatusBadRequest)
+		return
+	}
+	if !a.bursting.CompareAndSwap(false, true) {
+		http.Error(w, "a burst is already running", http.StatusConflict)
+		return
+	}
+
+	// The burst outlives the request, its span is a new trace linked to the request
+	ctx, span, cancel := telemetry.Detach(req.Context(), a.kafkaTracer, "Kafka produce burst", 0)
+	span.SetAttributes(
+		attribute.Int("burst.messages", messages),
+		attribute.Int("burst.rate", rate),
+	)
+	traceID := span.SpanContext().TraceID().String()
+	go func() {
+		defer a.bursting.Store(false)
+		defer cancel()
+		defer span.End()
+		a.burst(ctx, messages, rate)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"messages": messages,
+		"rate":     rate,
+		"trace_id": traceID,
+	})
+}
+
+// burst writes messages to the hello topic in batches, one batch per burstTick
+func (a *App) burst(ctx context.Context, messages, rate int) {
+	perTick := max(1, rate*int(burstTick)/int(time.Second))
+	start := a.clock.Now()
+
+	a.metrics.burstActive.Set(1)
+	defer a.metrics.burstActive.Set(0)
+	a.metrics.burstStartTime.Set(float64(start.Unix()))
+
+	log := a.logWithTrace(ctx).WithFields(logrus.Fields{
+		"topic":    HelloTopic,
+		"messages": messages,
+		"rate":     rate,
+	})
+	log.Warn("Kafka produce burst started")
+	a.annotations.Emit(ctx, fmt.Sprintf("Kafka produce burst started: %d messages at %d/s", messages, rate), annotations.TagChaos)
+
+	// Consumer spans of the burst messages become children of the burst span
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	ticker := a.clock.NewTicker(burstTick)
+	defer ticker.Stop()
+
+	sent, failed := 0, 0
+	for sent+failed < messages {
+		batch := make([]kafka.Message, 0, perTick)
+		for i := 0; i < perTick && sent+failed+len(batch) < messages; i++ {
+			headers := make([]kafka.Header, 0, len(carrier)+1)
+			for key, value := range carrier {
+				headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+			}
+			headers = append(headers, kafka.Header{Key: kafkapkg.MessageIDHeader, Value: []byte(uuid.NewString())})
+			batch = append(batch, kafka.Message{
+				Key:     []byte("burst-message-goexample"),
+				Value:   []byte("burst from goexample"),
+				Headers: headers,
+			})
+		}
+
+		if err := a.helloWriter.WriteMessages(ctx, batch...); err != nil {
+			failed += len(batch)
+			a.metrics.burstMessagesTotal.WithLabelValues(HelloTopic, "error").Add(float64(len(batch)))
+			errfmt.Wrap(ctx, err, "Failed to write burst batch", "topic", HelloTopic, "batch_size", len(batch))
+		} else {
+			sent += len(batch)
+			a.metrics.burstMessagesTotal.WithLabelValues(HelloTopic, "success").Add(float64(len(batch)))
+		}
+
+		if sent+failed < messages {
+			<-ticker.C()
+		}
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("burst.sent", sent),
+		attribute.Int("burst.failed", failed),
+	)
+	log.WithFields(logrus.Fields{
+		"sent":     sent,
+		"failed":   failed,
+		"duration": a.clock.Now().Sub(start).String(),
+	}).Warn("Kafka produce burst finished")
+	a.annotations.Emit(ctx, fmt.Sprintf("Kafka produce burst finished: %d sent, %d failed", sent, failed), annotations.TagChaos)
+}
@@ -0,0 +1,309 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"goexample/pkg/telemetry"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Cache states, recorded as cache.state on the server span and as label of http_cache_requests_total
+const (
+	cacheHit          = "hit"
+	cacheMiss         = "miss"
+	cacheStale        = "stale"
+	cacheRevalidating = "revalidating"
+)
+
+const (
+	// Responses kept per route, storing another one evicts the expired entries or the oldest one
+	maxCacheEntries = 1000
+	// Upper bound for a background revalidation
+	revalidateTimeout = 10 * time.Second
+)
+
+// cacheMetrics are the metrics of the response cache
+type cacheMetrics struct {
+	cacheRequestsTotal      *prometheus.CounterVec
+	cacheRevalidationsTotal *prometheus.CounterVec
+	cacheEntries            *prometheus.GaugeVec
+}
+
+func newCacheMetrics() cacheMetrics {
+	return cacheMetrics{
+		cacheRequestsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "http_cache_requests_total",
+				Help: "Total number of requests to cached routes by cache state, the hit ratio is (hit+stale+revalidating)/total",
+			},
+			[]string{"endpoint", "state"},
+		),
+
+		cacheRevalidationsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "http_cache_revalidations_total",
+				Help: "Total number of background revalidations of stale responses",
+			},
+			[]string{"endpoint", "result"},
+		),
+
+		cacheEntries: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "http_cache_entries",
+				Help: "Number of responses cached per route",
+			},
+			[]string{"endpoint"},
+		),
+	}
+}
+
+// CachePolicy is how long responses of a route are fresh, and how long after that
+// they are still served while being revalidated in the background
+type CachePolicy struct {
+	TTL   time.Duration
+	Stale time.Duration
+}
+
+// parseCachePolicies parses HTTP_CACHE ("/hello=5s/30s"), route=ttl/stale-while-revalidate pairs
+func parseCachePolicies(spec string) (map[string]CachePolicy, error) {
+	policies := make(map[string]CachePolicy)
+	for _, pair := range strings.Split(spec, ",") {
+		route, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid cache policy %q", pair)
+		}
+		ttl, stale, _ := strings.Cut(value, "/")
+		var p CachePolicy
+		var err error
+		if p.TTL, err = time.ParseDuration(ttl); err != nil || p.TTL <= 0 {
+			return nil, fmt.Errorf("invalid cache ttl for %s: %q", route, ttl)
+		}
+		if stale != "" {
+			if p.Stale, err = time.ParseDuration(stale); err != nil || p.Stale < 0 {
+				return nil, fmt.Errorf("invalid stale-while-revalidate for %s: %q", route, stale)
+			}
+		}
+		policies[route] = p
+	}
+	return policies, nil
+}
+
+// cachedResponse is a stored 2xx response
+type cachedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+	stored time.Time
+	// Set while a background request refreshes the entry
+	revalidating bool
+}
+
+// responseCache holds the responses of one route
+type responseCache struct {
+	policy CachePolicy
+
+	mu      sync.Mutex
+	entries map[string]*cachedResponse
+}
+
+// cacheMiddleware serves GET requests of endpoint from a cache when the route has a CachePolicy.
+// Fresh responses are hits, stale ones are served while a single background request revalidates
+// them (stale-while-revalidate), and everything else is a miss running handler.
+func (a *App) cacheMiddleware(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	policy, ok := a.cfg.CachePolicies[endpoint]
+	if !ok {
+		return handler
+	}
+	cache := &responseCache{policy: policy, entries: make(map[string]*cachedResponse)}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			handler(w, r)
+			return
+		}
+		key := r.URL.RequestURI()
+		now := a.clock.Now()
+
+		state, entry := cache.lookup(key, now)
+		span := trace.SpanFromContext(r.Context())
+		span.SetAttributes(attribute.String("cache.state", state))
+		a.metrics.cacheRequestsTotal.WithLabelValues(endpoint, state).Inc()
+		telemetry.Canonical(r.Context()).Set("cache", state)
+
+		if entry == nil {
+			w.Header().Set("X-Cache", "MISS")
+			rec := newCacheRecorder(w)
+			handler(rec, r)
+			cache.store(key, rec, a.clock.Now())
+			a.metrics.cacheEntries.WithLabelValues(endpoint).Set(float64(cache.len()))
+			return
+		}
+
+		age := now.Sub(entry.stored)
+		span.SetAttributes(attribute.Int64("cache.age_ms", age.Milliseconds()))
+		if state == cacheRevalidating {
+			a.revalidate(r, endpoint, key, cache, handler)
+		}
+
+		for name, values := range entry.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
+		w.Header().Set("X-Cache", strings.ToUpper(state))
+		w.WriteHeader(entry.status)
+		_, _ = w.Write(entry.body)
+	}
+}
+
+// revalidate refreshes the entry of key in the background, in a new trace linked to the request
+func (a *App) revalidate(r *http.Request, endpoint, key string, cache *responseCache, handler http.HandlerFunc) {
+	telemetry.Go(r.Context(), a.httpTracer, "Revalidate "+endpoint, revalidateTimeout, func(ctx context.Context) {
+		req := r.Clone(ctx)
+		rec := newCacheRecorder(nil)
+		handler(rec, req)
+
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", rec.status))
+		result := "success"
+		if !cache.store(key, rec, a.clock.Now()) {
+			result = "error"
+		}
+		cache.revalidated(key)
+		a.metrics.cacheRevalidationsTotal.WithLabelValues(endpoint, result).Inc()
+	})
+}
+
+// lookup returns the cache state of key and the entry to serve, nil on a miss.
+// The first request finding an entry stale marks it as revalidating.
+func (c *responseCache) lookup(key string, now time.Time) (string, *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return cacheMiss, nil
+	}
+	age := now.Sub(e.stored)
+	switch {
+	case age < c.policy.TTL:
+		return cacheHit, e
+	case age < c.policy.TTL+c.policy.Stale:
+		if e.revalidating {
+			return cacheStale, e
+		}
+		e.revalidating = true
+		return cacheRevalidating, e
+	default:
+		delete(c.entries, key)
+		return cacheMiss, nil
+	}
+}
+
+// store keeps a 2xx response and reports whether it did. A full cache makes room by dropping
+// the expired entries, or the oldest one when none expired.
+func (c *responseCache) store(key string, rec *cacheRecorder, now time.Time) bool {
+	if rec.status/100 != 2 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxCacheEntries {
+		c.evict(now)
+	}
+	c.entries[key] = &cachedResponse{
+		status: rec.status,
+		header: cachedHeader(rec.Header()),
+		body:   rec.body.Bytes(),
+		stored: now,
+	}
+	return true
+}
+
+// evict drops the entries past their stale period, or else the oldest entry
+func (c *responseCache) evict(now time.Time) {
+	var oldest string
+	for key, e := range c.entries {
+		if now.Sub(e.stored) >= c.policy.TTL+c.policy.Stale {
+			delete(c.entries, key)
+			continue
+		}
+		if oldest == "" || e.stored.Before(c.entries[oldest].stored) {
+			oldest = key
+		}
+	}
+	if len(c.entries) >= maxCacheEntries {
+		delete(c.entries, oldest)
+	}
+}
+
+// cachedHeader copies the response headers worth storing, X-Cache is set per request
+func cachedHeader(h http.Header) http.Header {
+	h = h.Clone()
+	h.Del("X-Cache")
+	return h
+}
+
+// revalidated allows the next stale request of key to revalidate again, e.g. after a failure
+func (c *responseCache) revalidated(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.revalidating = false
+	}
+}
+
+func (c *responseCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// cacheRecorder captures a response while passing it through to w, or only captures it when w is nil
+type cacheRecorder struct {
+	w      http.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newCacheRecorder(w http.ResponseWriter) *cacheRecorder {
+	rec := &cacheRecorder{w: w, status: http.StatusOK}
+	if w != nil {
+		rec.header = w.Header()
+	} else {
+		rec.header = make(http.Header)
+	}
+	return rec
+}
+
+func (rec *cacheRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *cacheRecorder) WriteHeader(code int) {
+	rec.status = code
+	if rec.w != nil {
+		rec.w.WriteHeader(code)
+	}
+}
+
+// Unwrap lets http.ResponseController flush the responses of streaming routes, nil when only capturing
+func (rec *cacheRecorder) Unwrap() http.ResponseWriter {
+	return rec.w
+}
+
+func (rec *cacheRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	if rec.w != nil {
+		return rec.w.Write(b)
+	}
+	return len(b), nil
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestResponseCacheEvictsWhenFull(t *testing.T) {
+	cache := &responseCache{policy: CachePolicy{TTL: time.Second, Stale: time.Second}, entries: make(map[string]*cachedResponse)}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rec := newCacheRecorder(nil)
+	for i := range maxCacheEntries {
+		cache.store("/old/"+strconv.Itoa(i), rec, start)
+	}
+
+	// The expired entries make room for the new ones
+	later := start.Add(time.Minute)
+	if !cache.store("/new/0", rec, later) {
+		t.Fatal("store() into a cache full of expired entries = false")
+	}
+	if got := cache.len(); got != 1 {
+		t.Errorf("%d entries after storing into a cache of expired ones, want 1", got)
+	}
+
+	// Without expired entries the oldest one goes
+	for i := 1; i < maxCacheEntries; i++ {
+		cache.store("/new/"+strconv.Itoa(i), rec, later.Add(time.Duration(i)*time.Microsecond))
+	}
+	if !cache.store("/newest", rec, later.Add(time.Millisecond)) {
+		t.Fatal("store() into a full cache = false")
+	}
+	if state, _ := cache.lookup("/new/0", later.Add(time.Millisecond)); state != cacheMiss {
+		t.Errorf("oldest entry %s, want it evicted", state)
+	}
+	if state, _ := cache.lookup("/newest", later.Add(time.Millisecond)); state != cacheHit {
+		t.Errorf("stored entry %s, want a hit", state)
+	}
+}
+
+func TestCacheRecorderFlushes(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := newCacheRecorder(w)
+	if err := http.NewResponseController(rec).Flush(); err != nil {
+		t.Fatalf("Flush() = %v", err)
+	}
+	if !w.Flushed {
+		t.Error("the underlying writer was not flushed")
+	}
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"goexample/pkg/clock"
+	"goexample/pkg/telemetry"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// canonicalMiddleware writes one "canonical" log line per request when it completes,
+// with the route, status, duration and trace ID plus the fields handlers accumulated
+// in telemetry.Canonical: downstream call durations, coalesced calls, Kafka publishes.
+// The request is also added to the recent requests of the status page.
+func (a *App) canonicalMiddleware(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := a.clock.Now()
+		ctx, line := telemetry.WithCanonicalLine(r.Context())
+		rw := newResponseWriter(w)
+
+		handler(rw, r.WithContext(ctx))
+
+		elapsed := clock.Since(a.clock, start)
+		a.recent.add(requestRecord{
+			Time:     start,
+			Method:   r.Method,
+			Route:    endpoint,
+			Status:   rw.statusCode,
+			Duration: elapsed,
+			TraceID:  trace.SpanContextFromContext(ctx).TraceID().String(),
+		})
+
+		line.Set("canonical", true)
+		line.Set("method", r.Method)
+		line.Set("route", endpoint)
+		line.Set("status", rw.statusCode)
+		line.Set("duration_ms", float64(elapsed.Microseconds())/1000)
+		line.Set("client_service", a.clientServiceName(r))
+		a.logWithTrace(ctx).WithFields(line.Fields()).Info("canonical-log-line")
+	}
+}
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"goexample/pkg/chaos"
+	"goexample/pkg/clock"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// defaultErrorRate is the probability of /hello failing with a random 500 unless configured
+const defaultErrorRate = 0.3
+
+// loadErrorRate reads ERROR_RATE, overridden for a variant by ERROR_RATE_<VARIANT> (e.g. ERROR_RATE_CANARY)
+func loadErrorRate(variant string) (float64, error) {
+	rate := defaultErrorRate
+	for _, key := range []string{"ERROR_RATE", "ERROR_RATE_" + strings.ToUpper(variant)} {
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		r, err := strconv.ParseFloat(value, 64)
+		if err != nil || r < 0 || r > 1 {
+			return 0, fmt.Errorf("%s must be a number between 0 and 1, got %q", key, value)
+		}
+		rate = r
+	}
+	return rate, nil
+}
+
+// Chaos returns the injected faults, changed at runtime by chaos scenarios
+func (a *App) Chaos() *chaos.State {
+	return a.chaos
+}
+
+// injectKafkaLatency delays a Kafka publish by the current chaos latency, or until ctx is done
+func (a *App) injectKafkaLatency(ctx context.Context) error {
+	latency := a.chaos.Current().KafkaLatency
+	if latency <= 0 {
+		return nil
+	}
+	chaos.Inject(ctx, chaos.RuleKafkaLatency, attribute.Int64("chaos.latency_ms", latency.Milliseconds()))
+	return clock.SleepContext(ctx, a.clock, latency)
+}
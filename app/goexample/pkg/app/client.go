@@ -0,0 +1,88 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Header callers set to identify themselves, e.g. "X-Client-Service: loadgen"
+const clientServiceHeader = "X-Client-Service"
+
+// Client classes derived from the User-Agent header
+const (
+	clientLoadgen = "loadgen"
+	clientBrowser = "browser"
+	clientCurl    = "curl"
+	clientService = "service"
+	clientOther   = "other"
+)
+
+var (
+	loadgenAgents = []string{"k6/", "hey/", "vegeta", "wrk", "locust", "apachebench", "loadgen"}
+	curlAgents    = []string{"curl/", "wget/", "httpie/"}
+	serviceAgents = []string{"go-http-client", "python-requests", "okhttp", "java/", "reqwest", "axios", "node-fetch", "connect-go"}
+)
+
+// parseClientServices parses CLIENT_SERVICES, a comma separated list of service names
+
+func parseClientServices(value string) map[string]bool {
+	if value == "" {
+		value = "goexample,goexample1,rustexample,loadgen,tracectl"
+	}
+	services := make(map[string]bool)
+	for _, s := range strings.Split(value, ",") {
+		services[strings.TrimSpace(s)] = true
+	}
+	return services
+}
+
+// classifyClient maps the User-Agent header to a bounded client class
+func classifyClient(req *http.Request) string {
+	ua := strings.ToLower(req.UserAgent())
+	switch {
+	case containsAny(ua, loadgenAgents):
+		return clientLoadgen
+	case containsAny(ua, curlAgents):
+		return clientCurl
+	case strings.HasPrefix(ua, "mozilla/"):
+		return clientBrowser
+	case containsAny(ua, serviceAgents) || req.Header.Get(clientServiceHeader) != "":
+		return clientService
+	default:
+		return clientOther
+	}
+}
+
+// clientServiceName returns the bounded calling service name from the X-Client-Service header
+func (a *App) clientServiceName(req *http.Request) string {
+	name := req.Header.Get(clientServiceHeader)
+	switch {
+	case name == "":
+		return "none"
+	case a.cfg.ClientServices[name]:
+		return name
+	default:
+		return "other"
+	}
+}
+
+// annotateClient records the client classification on the request span
+func annotateClient(req *http.Request, class, service string) {
+	trace.SpanFromContext(req.Context()).SetAttributes(
+		attribute.String("user_agent.original", req.UserAgent()),
+		attribute.String("client.class", class),
+		attribute.String("client.service", service),
+	)
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"fmt"
+	"goexample/pkg/annotations"
+	"goexample/pkg/clock"
+	"goexample/pkg/telemetry"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Requests after start counted as cold by default
+const defaultColdStartRequests = 50
+
+// coldStartMetrics are the metrics of the requests served right after start
+type coldStartMetrics struct {
+	coldStartRequestDuration *prometheus.HistogramVec
+	coldStartRemaining       prometheus.Gauge
+}
+
+func newColdStartMetrics() coldStartMetrics {
+	return coldStartMetrics{
+		coldStartRequestDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "http_cold_start_request_duration_seconds",
+				Help:    "HTTP request duration in seconds, cold_start is true for the first COLD_START_REQUESTS requests after start",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"endpoint", "cold_start"},
+		),
+
+		coldStartRemaining: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "cold_start_requests_remaining",
+				Help: "Number of requests still counted as cold start, 0 once the service is warm",
+			},
+		),
+	}
+}
+
+// coldStartMiddleware tags the first ColdStartRequests requests after start with cold_start=true on
+// their span, canonical log line, latency histogram and the exemplars of the request metrics, so
+// the warmup of connection pools and caches can be told apart from the warm path. The end of the
+// warmup is annotated on the dashboards, requests running concurrently at that point are counted
+// in arrival order.
+func (a *App) coldStartMiddleware(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	if a.cfg.ColdStartRequests <= 0 {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := a.coldRequests.Add(1)
+		cold := n <= int64(a.cfg.ColdStartRequests)
+		if cold {
+			a.metrics.coldStartRemaining.Set(float64(int64(a.cfg.ColdStartRequests) - n))
+			telemetry.Canonical(r.Context()).Set("cold_start", true)
+			r = r.WithContext(telemetry.WithExemplarLabel(r.Context(), "cold_start", "true"))
+		}
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.Bool("cold_start", cold))
+		if n == int64(a.cfg.ColdStartRequests) {
+			elapsed := clock.Since(a.clock, a.started).Round(time.Millisecond)
+			a.logger.WithFields(logrus.Fields{
+				"requests": n,
+				"elapsed":  elapsed.String(),
+			}).Info("Cold start over, requests from now on are warm")
+			a.annotations.Emit(r.Context(), fmt.Sprintf("Cold start over after %d requests in %s", n, elapsed), annotations.TagDeploy)
+		}
+
+		start := a.clock.Now()
+		handler(w, r)
+		a.metrics.coldStartRequestDuration.WithLabelValues(endpoint, strconv.FormatBool(cold)).Observe(clock.Since(a.clock, start).Seconds())
+	}
+}
@@ -0,0 +1,256 @@
+package app
+
+import (
+	"fmt"
+	"goexample/pkg/adminauth"
+	"goexample/pkg/client"
+	"goexample/pkg/dependency"
+	"goexample/pkg/kafkapkg"
+	"goexample/pkg/telemetry"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config holds the settings of the goexample HTTP service
+type Config struct {
+	// Probability of /hello failing with a random 500
+	ErrorRate float64
+	// Identical in-flight calls to goexample1 share one request
+	DownstreamCoalescing bool
+	// Retries of failed GET calls to goexample1 and their budget
+	DownstreamRetry client.RetryPolicy
+	// Local proxy, e.g. a mesh sidecar, the calls to goexample1 go through, direct when it has no address
+	DownstreamProxy client.ProxyConfig
+	// Calls to goexample1 are simulated in process with this latency distribution, nil calls goexample1
+	DownstreamLatency client.LatencyModel
+	// Route every hello request through one of the virtual services of goexample1
+	SyntheticTopology bool
+	// Fraction of requests annotated with their heap allocations, 0 disables it
+	CostSampleRate float64
+	// Largest body of POST /upload, and the bandwidth in bytes per second of the object storage
+	// stub uploads are written to, 0 discards them at once
+	UploadMaxBytes       int64
+	UploadStoreBandwidth int64
+	// Requests after start tagged with cold_start=true, 0 disables it
+	ColdStartRequests int
+	// Publish hello messages from a background batcher instead of in the request path
+	AsyncPublish bool
+	// Add a span per metrics scrape
+	ScrapeTracing bool
+	// Kafka clusters and the cluster of each topic, their brokers are recorded on producer spans
+	KafkaClusters *kafkapkg.Clusters
+	// Envelope of the order events, see kafkapkg.EventMode
+	OrderEventMode kafkapkg.EventMode
+	// Request path Kafka writes ignore the request's cancellation, they are still bounded by their timeout
+	KafkaWriteDetached bool
+	// Timeouts of the calls to goexample1 and of Kafka writes
+	Timeouts dependency.Timeouts
+	// Retry policies of failed Kafka writes by produce error reason
+	KafkaRetryPolicies kafkapkg.RetryPolicies
+	// Values of the X-Client-Service header kept as label, anything else becomes "other"
+	ClientServices map[string]bool
+	// Response caching with stale-while-revalidate per route, e.g. "/hello"
+	CachePolicies map[string]CachePolicy
+	// Concurrency limit per priority class and how long requests wait for a slot
+	PriorityLimits       map[string]int
+	PriorityQueueTimeout time.Duration
+	// How long async task results can be polled
+	TaskResultTTL time.Duration
+	// Base URL requests are mirrored to and the percentage of GET and HEAD requests mirrored
+	ShadowTarget  string
+	ShadowPercent float64
+	// Server wide in-flight limit (0 disables it) and number of requests queued beyond it
+	MaxInFlight   int
+	MaxQueueDepth int
+	// Concurrency limit adjusted from the request latency, disabled without an algorithm
+	AdaptiveLimit AdaptiveLimitConfig
+	// Credentials and IP allowlist for the metrics and admin endpoints
+	AdminAuth adminauth.Config
+	// Deployment environment, region, zone and variant
+	Deployment telemetry.Deployment
+}
+
+// DefaultConfig returns the settings used when no environment variable is set
+func DefaultConfig() Config {
+	limits, _ := parsePriorityLimits(defaultPriorityLimits)
+	return Config{
+		ErrorRate:            defaultErrorRate,
+		ClientServices:       parseClientServices(""),
+		PriorityLimits:       limits,
+		PriorityQueueTimeout: defaultPriorityQueueTimeout,
+		Timeouts:             defaultDependencyTimeouts(),
+		KafkaRetryPolicies:   kafkapkg.DefaultRetryPolicies(),
+		DownstreamRetry:      client.DefaultRetryPolicy(),
+		TaskResultTTL:        defaultTaskResultTTL,
+		ColdStartRequests:    defaultColdStartRequests,
+		OrderEventMode:       kafkapkg.EventModeNone,
+		UploadMaxBytes:       defaultUploadMaxBytes,
+	}
+}
+
+// ConfigFromEnv reads the service settings from environment variables
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+	cfg.DownstreamCoalescing = os.Getenv("DOWNSTREAM_COALESCING") == "true"
+	if spec := os.Getenv("DOWNSTREAM_RETRY"); spec != "" {
+		policy, err := client.ParseRetryPolicy(spec)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid DOWNSTREAM_RETRY: %w", err)
+		}
+		cfg.DownstreamRetry = policy
+	}
+	if spec := os.Getenv("DOWNSTREAM_LATENCY_MODEL"); spec != "" {
+		model, err := client.ParseLatencyModel(spec)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid DOWNSTREAM_LATENCY_MODEL: %w", err)
+		}
+		cfg.DownstreamLatency = model
+	}
+	cfg.SyntheticTopology = os.Getenv("SYNTHETIC_TOPOLOGY") == "true"
+	cfg.AsyncPublish = os.Getenv("KAFKA_ASYNC_PUBLISH") == "true"
+	cfg.ScrapeTracing = os.Getenv("METRICS_SCRAPE_TRACING") == "true"
+	if services := os.Getenv("CLIENT_SERVICES"); services != "" {
+		cfg.ClientServices = parseClientServices(services)
+	}
+	cfg.Deployment = telemetry.DeploymentFromEnv()
+	if rate := os.Getenv("REQUEST_COST_SAMPLE_RATE"); rate != "" {
+		r, err := strconv.ParseFloat(rate, 64)
+		if err != nil || !(r >= 0 && r <= 1) {
+			return cfg, fmt.Errorf("invalid REQUEST_COST_SAMPLE_RATE %q, want a number between 0 and 1", rate)
+		}
+		cfg.CostSampleRate = r
+	}
+
+	var err error
+	if cfg.DownstreamProxy, err = client.ProxyConfigFromEnv(); err != nil {
+		return cfg, err
+	}
+	if cfg.KafkaClusters, err = kafkapkg.LoadClusters(); err != nil {
+		return cfg, err
+	}
+	if _, err = kafkapkg.GetCompression(os.Getenv("KAFKA_COMPRESSION")); err != nil {
+		return cfg, err
+	}
+	if _, err = kafkapkg.GetBalancer(os.Getenv("KAFKA_BALANCER")); err != nil {
+		return cfg, err
+	}
+	// Chaos settings, canary deployments may use their own error rate
+	if cfg.ErrorRate, err = loadErrorRate(cfg.Deployment.Variant); err != nil {
+		return cfg, err
+	}
+
+	// Per priority class concurrency limits (X-Priority header)
+	if limits := os.Getenv("PRIORITY_LIMITS"); limits != "" {
+		if cfg.PriorityLimits, err = parsePriorityLimits(limits); err != nil {
+			return cfg, err
+		}
+	}
+	if timeout := os.Getenv("PRIORITY_QUEUE_TIMEOUT"); timeout != "" {
+		if cfg.PriorityQueueTimeout, err = time.ParseDuration(timeout); err != nil {
+			return cfg, fmt.Errorf("invalid PRIORITY_QUEUE_TIMEOUT: %w", err)
+		}
+		if cfg.PriorityQueueTimeout <= 0 {
+			return cfg, fmt.Errorf("invalid PRIORITY_QUEUE_TIMEOUT %q, want a positive duration", timeout)
+		}
+	}
+
+	// Cached routes (HTTP_CACHE="/hello=5s/30s")
+	if spec := os.Getenv("HTTP_CACHE"); spec != "" {
+		if cfg.CachePolicies, err = parseCachePolicies(spec); err != nil {
+			return cfg, err
+		}
+	}
+
+	// Server wide in-flight limit with a bounded queue
+	if cfg.MaxInFlight, err = envInt("MAX_IN_FLIGHT"); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxQueueDepth, err = envInt("MAX_QUEUE_DEPTH"); err != nil {
+		return cfg, err
+	}
+
+	// Upload size limit and stub object storage (UPLOAD_STORE_BANDWIDTH=10485760 for 10MB/s)
+	if v := os.Getenv("UPLOAD_MAX_BYTES"); v != "" {
+		if cfg.UploadMaxBytes, err = strconv.ParseInt(v, 10, 64); err != nil || cfg.UploadMaxBytes <= 0 {
+			return cfg, fmt.Errorf("invalid UPLOAD_MAX_BYTES: %q", v)
+		}
+	}
+	if v := os.Getenv("UPLOAD_STORE_BANDWIDTH"); v != "" {
+		if cfg.UploadStoreBandwidth, err = strconv.ParseInt(v, 10, 64); err != nil || cfg.UploadStoreBandwidth < 0 {
+			return cfg, fmt.Errorf("invalid UPLOAD_STORE_BANDWIDTH: %q", v)
+		}
+	}
+
+	// Latency driven concurrency limit (ADAPTIVE_CONCURRENCY="algorithm=vegas,max=200")
+	if spec := os.Getenv("ADAPTIVE_CONCURRENCY"); spec != "" {
+		if cfg.AdaptiveLimit, err = parseAdaptiveLimit(spec); err != nil {
+			return cfg, fmt.Errorf("invalid ADAPTIVE_CONCURRENCY: %w", err)
+		}
+	}
+
+	// Warmup requests separated in latency analysis (COLD_START_REQUESTS=50)
+	if _, ok := os.LookupEnv("COLD_START_REQUESTS"); ok {
+		if cfg.ColdStartRequests, err = envInt("COLD_START_REQUESTS"); err != nil {
+			return cfg, err
+		}
+	}
+
+	// Polling window of async task results (TASK_RESULT_TTL=10m)
+	if ttl := os.Getenv("TASK_RESULT_TTL"); ttl != "" {
+		if cfg.TaskResultTTL, err = time.ParseDuration(ttl); err != nil {
+			return cfg, fmt.Errorf("invalid TASK_RESULT_TTL: %w", err)
+		}
+	}
+
+	// Traffic mirroring (SHADOW_TARGET=http://goexample-canary:8080 SHADOW_PERCENT=10)
+	if target := os.Getenv("SHADOW_TARGET"); target != "" {
+		if cfg.ShadowTarget, err = parseShadowTarget(target); err != nil {
+			return cfg, err
+		}
+	}
+	if percent := os.Getenv("SHADOW_PERCENT"); percent != "" {
+		if cfg.ShadowPercent, err = parseShadowPercent(percent); err != nil {
+			return cfg, err
+		}
+	}
+
+	// Decoupling of request path Kafka writes from the request context
+	cfg.KafkaWriteDetached = os.Getenv("KAFKA_WRITE_CONTEXT") == "detached"
+
+	// Per dependency timeouts (DEPENDENCY_TIMEOUTS="goexample1=2s,kafka_write=5s")
+	if spec := os.Getenv("DEPENDENCY_TIMEOUTS"); spec != "" {
+		if cfg.Timeouts, err = dependency.ParseTimeouts(spec, defaultDependencyTimeouts()); err != nil {
+			return cfg, fmt.Errorf("invalid DEPENDENCY_TIMEOUTS: %w", err)
+		}
+	}
+
+	// Retries of Kafka writes per produce error reason (KAFKA_RETRY_POLICIES="leader_not_available=4/250ms,timeout=1")
+	if spec := os.Getenv("KAFKA_RETRY_POLICIES"); spec != "" {
+		if cfg.KafkaRetryPolicies, err = kafkapkg.ParseRetryPolicies(spec); err != nil {
+			return cfg, fmt.Errorf("invalid KAFKA_RETRY_POLICIES: %w", err)
+		}
+	}
+
+	// CloudEvents envelope of the order events (KAFKA_CLOUDEVENTS=binary)
+	if cfg.OrderEventMode, err = kafkapkg.ParseEventMode(os.Getenv("KAFKA_CLOUDEVENTS")); err != nil {
+		return cfg, fmt.Errorf("invalid KAFKA_CLOUDEVENTS: %w", err)
+	}
+
+	if cfg.AdminAuth, err = adminauth.ConfigFromEnv(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func envInt(name string) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, value)
+	}
+	return n, nil
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigFromEnvDependencyTimeouts(t *testing.T) {
+	t.Setenv("DEPENDENCY_TIMEOUTS", "kafka_write=3s")
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Timeouts[dependencyKafkaWrite]; got != 3*time.Second {
+		t.Errorf("kafka_write timeout = %s, want 3s", got)
+	}
+	if got := cfg.Timeouts[dependencyGoexample1]; got != defaultDependencyTimeouts()[dependencyGoexample1] {
+		t.Errorf("goexample1 timeout = %s, want the default", got)
+	}
+}
+
+func TestConfigFromEnvRejectsUnknownCompression(t *testing.T) {
+	t.Setenv("KAFKA_COMPRESSION", "brotli")
+
+	if _, err := ConfigFromEnv(); err == nil || !strings.Contains(err.Error(), `"brotli"`) {
+		t.Errorf("ConfigFromEnv() error = %v, want one naming the unknown codec", err)
+	}
+}
+
+func TestConfigFromEnvCostSampleRate(t *testing.T) {
+	for _, rate := range []string{"often", "-0.1", "1.5", "NaN"} {
+		t.Run(rate, func(t *testing.T) {
+			t.Setenv("REQUEST_COST_SAMPLE_RATE", rate)
+			if _, err := ConfigFromEnv(); err == nil || !strings.Contains(err.Error(), "REQUEST_COST_SAMPLE_RATE") {
+				t.Errorf("ConfigFromEnv() error = %v, want one naming REQUEST_COST_SAMPLE_RATE", err)
+			}
+		})
+	}
+
+	t.Setenv("REQUEST_COST_SAMPLE_RATE", "0.25")
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CostSampleRate != 0.25 {
+		t.Errorf("CostSampleRate = %v, want 0.25", cfg.CostSampleRate)
+	}
+}
+
+func TestConfigFromEnvRejectsUnknownBalancer(t *testing.T) {
+	t.Setenv("KAFKA_BALANCER", "round_robin")
+
+	if _, err := ConfigFromEnv(); err == nil || !strings.Contains(err.Error(), `"round_robin"`) {
+		t.Errorf("ConfigFromEnv() error = %v, want one naming the unknown balancer", err)
+	}
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/otelconnect"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Connect procedure of the hello API, callable with the Connect protocol, gRPC or gRPC-Web using JSON
+const helloProcedure = "/demo.v1.HelloService/Hello"
+
+type helloRequest struct {
+	Name string `json:"name"`
+}
+
+type helloResponse struct {
+	Message string `json:"message"`
+	TraceID string `json:"traceId"`
+}
+
+// jsonCodec lets connect handle plain Go structs instead of generated protobuf messages
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                       { return "json" }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// newConnectHelloHandler returns the path and handler of the Connect hello API
+func (a *App) newConnectHelloHandler() (string, http.Handler, error) {
+	// Trust the browser's traceparent so its spans and ours end up in the same trace
+	otelInterceptor, err := otelconnect.NewInterceptor(otelconnect.WithTrustRemote())
+	if err != nil {
+		return "", nil, err
+	}
+
+	handler := connect.NewUnaryHandler(
+		helloProcedure,
+		a.connectHello,
+		connect.WithCodec(jsonCodec{}),
+		connect.WithInterceptors(otelInterceptor),
+	)
+	return helloProcedure, handler, nil
+}
+
+func (a *App) connectHello(ctx context.Context, req *connect.Request[helloRequest]) (*connect.Response[helloResponse], error) {
+	a.logWithTrace(ctx).WithField("procedure", req.Spec().Procedure).Info("Handling connect hello request")
+
+	a.helloFlow(ctx)
+
+	name := req.Msg.Name
+	if name == "" {
+		name = "world"
+	}
+	return connect.NewResponse(&helloResponse{
+		Message: "hello " + name,
+		TraceID: trace.SpanFromContext(ctx).SpanContext().TraceID().String(),
+	}), nil
+}
+
+// corsMiddleware allows browser demo clients served from another origin to call the API
+func corsMiddleware(next http.Handler) http.Handler {
+	allowHeaders := strings.Join([]string{
+		"Content-Type", "Connect-Protocol-Version", "Connect-Timeout-Ms",
+		"Grpc-Timeout", "X-Grpc-Web", "X-User-Agent", "Traceparent", "Tracestate",
+	}, ", ")
+	exposeHeaders := strings.Join([]string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin"}, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Expose-Headers", exposeHeaders)
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,183 @@
+package app_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"goexample/pkg/app"
+	"goexample/pkg/app/apptest"
+	"goexample/pkg/app/stub"
+	"goexample/pkg/errfmt"
+	"goexample/pkg/kafkapkg"
+	"goexample/pkg/telemetry"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Directory of the golden files of the telemetry contract
+const contractDir = "testdata/contract"
+
+var update = flag.Bool("update", false, "rewrite the golden files of the telemetry contract with the current output")
+
+// scenario is a request whose telemetry is part of the contract
+type scenario struct {
+	name        string
+	method      string
+	target      string
+	contentType string
+	body        string
+}
+
+var scenarios = []scenario{
+	{name: "hello", method: http.MethodGet, target: "/hello"},
+	{name: "headers", method: http.MethodGet, target: "/headers"},
+	{name: "stream", method: http.MethodGet, target: "/stream?seconds=1"},
+	{name: "order", method: http.MethodPost, target: "/order"},
+	{name: "order_rollback", method: http.MethodPost, target: "/order?fail_at=publish"},
+	{name: "order_invalid", method: http.MethodPost, target: "/order?fail_at=nowhere",
+		contentType: "application/json", body: `{"item":"gadget","quantity":0}`},
+	{name: "quote", method: http.MethodPost, target: "/quote",
+		contentType: "application/json", body: `{"item":"gadget","quantity":2}`},
+	{name: "connect_hello", method: http.MethodPost, target: "/demo.v1.HelloService/Hello",
+		contentType: "application/json", body: `{"name":"contract"}`},
+	{name: "task", method: http.MethodPost, target: "/tasks",
+		contentType: "application/json", body: `{"kind":"export","work_ms":0}`},
+	{name: "upload", method: http.MethodPost, target: "/upload",
+		contentType: "application/octet-stream", body: "contract upload payload"},
+	{name: "status_page", method: http.MethodGet, target: "/"},
+}
+
+// TestTelemetryContract runs the handlers against in-memory fakes and compares the emitted spans
+// and metric families with the golden files, so instrumentation changes are noticed. After an
+// intended change run go test ./pkg/app -run TestTelemetryContract -update
+func TestTelemetryContract(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	errfmt.SetLogger(logger)
+
+	recorder := tracetest.NewSpanRecorder()
+	r, err := telemetry.Resource("goexample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder), sdktrace.WithResource(r))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	// Only the service's own metrics, isolated from anything registered on the default registry
+	registry := prometheus.NewRegistry()
+	service := newTestApp(t, logger, tp, registry)
+
+	for _, sc := range scenarios {
+		ended := len(recorder.Ended())
+		status := serve(service.Handler(), sc)
+		got := fmt.Sprintf("status %d\n", status) + apptest.SnapshotSpans(recorder.Ended()[ended:])
+		checkGolden(t, sc.name, got)
+	}
+
+	metrics, err := apptest.SnapshotMetrics(registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "metrics", metrics)
+}
+
+// newTestApp returns an App without random failures against in-memory fakes, its metrics
+// registered with registry
+func newTestApp(t *testing.T, logger *logrus.Logger, tp trace.TracerProvider, registry *prometheus.Registry) *app.App {
+	t.Helper()
+	cfg := app.DefaultConfig()
+	cfg.ErrorRate = 0
+
+	service, err := app.New(cfg, app.Deps{
+		Logger:         logger,
+		TracerProvider: tp,
+		HelloWriter:    kafkapkg.NewMemoryWriter(app.HelloTopic),
+		OrderWriter:    kafkapkg.NewMemoryWriter(app.OrdersTopic),
+		TaskWriter:     kafkapkg.NewMemoryWriter(app.TasksTopic),
+		HTTPClient:     stub.NewDownstreamClient(telemetry.Tracer(tp, "goexample1", telemetry.ScopeHTTPServer)),
+		Registry:       registry,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(service.Close)
+	return service
+}
+
+// serve runs the scenario's request through the handler in process and returns the status code
+func serve(handler http.Handler, sc scenario) int {
+	req := httptest.NewRequest(sc.method, sc.target, strings.NewReader(sc.body))
+	if sc.contentType != "" {
+		req.Header.Set("Content-Type", sc.contentType)
+	}
+	req.Header.Set("User-Agent", "contract")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// checkGolden compares got with the golden file of name, or rewrites it with -update
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join(contractDir, name+".golden")
+	if *update {
+		if err := os.MkdirAll(contractDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, []byte(got)) {
+		t.Errorf("%s differs, run with -update if the change is intended\n%s", path, lineDiff(string(want), got))
+	}
+}
+
+// lineDiff lists the lines only present in want (-) or got (+)
+func lineDiff(want, got string) string {
+	wantLines, gotLines := lineSet(want), lineSet(got)
+	var b strings.Builder
+	for _, line := range strings.Split(want, "\n") {
+		if !gotLines[line] {
+			fmt.Fprintf(&b, "- %s\n", line)
+		}
+	}
+	for _, line := range strings.Split(got, "\n") {
+		if !wantLines[line] {
+			fmt.Fprintf(&b, "+ %s\n", line)
+		}
+	}
+	if b.Len() == 0 {
+		return "  same lines in a different order"
+	}
+	return b.String()
+}
+
+func lineSet(s string) map[string]bool {
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(s, "\n") {
+		lines[line] = true
+	}
+	return lines
+}
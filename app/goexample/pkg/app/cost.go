@@ -0,0 +1,68 @@
+package app
+
+import (
+	"math/rand"
+	"net/http"
+	runtimemetrics "runtime/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// costMetrics are the metrics of the sampled request costs
+type costMetrics struct {
+	requestAllocBytes *prometheus.HistogramVec
+}
+
+func newCostMetrics() costMetrics {
+	return costMetrics{
+		requestAllocBytes: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "http_request_alloc_bytes",
+				Help:    "Heap bytes allocated while handling a sampled request",
+				Buckets: prometheus.ExponentialBuckets(1024, 4, 10), // 1KiB .. 256MiB
+			},
+			[]string{"endpoint"},
+		),
+	}
+}
+
+// costMiddleware attaches heap allocation deltas to the request span for a CostSampleRate fraction of requests.
+// The runtime counters are process wide, so concurrent requests inflate each other's numbers:
+// treat the results as an experiment rather than exact accounting.
+func (a *App) costMiddleware(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	if a.cfg.CostSampleRate <= 0 {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rand.Float64() >= a.cfg.CostSampleRate {
+			handler(w, r)
+			return
+		}
+
+		before := readAllocs()
+		handler(w, r)
+		after := readAllocs()
+
+		allocBytes := after[0].Value.Uint64() - before[0].Value.Uint64()
+		allocObjects := after[1].Value.Uint64() - before[1].Value.Uint64()
+
+		a.metrics.requestAllocBytes.WithLabelValues(endpoint).Observe(float64(allocBytes))
+		trace.SpanFromContext(r.Context()).SetAttributes(
+			attribute.Bool("request.cost.sampled", true),
+			attribute.Int64("request.cost.alloc_bytes", int64(allocBytes)),
+			attribute.Int64("request.cost.alloc_objects", int64(allocObjects)),
+		)
+	}
+}
+
+func readAllocs() []runtimemetrics.Sample {
+	samples := []runtimemetrics.Sample{
+		{Name: "/gc/heap/allocs:bytes"},
+		{Name: "/gc/heap/allocs:objects"},
+	}
+	runtimemetrics.Read(samples)
+	return samples
+}
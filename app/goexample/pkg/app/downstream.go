@@ -0,0 +1,103 @@
+package app
+
+import (
+	"context"
+	"goexample/pkg/client"
+	"goexample/pkg/clock"
+	"goexample/pkg/telemetry"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// Base URL of goexample1, the downstream service
+const goexample1URL = "http://goexample1:8080"
+
+// Connections the warm-up opens to goexample1, the idle connections http.DefaultTransport keeps per host
+const warmupConnections = 2
+
+// downstreamMetrics are the metrics of the calls to goexample1
+type downstreamMetrics struct {
+	coalescedRequestsTotal *prometheus.CounterVec
+}
+
+func newDownstreamMetrics() downstreamMetrics {
+	return downstreamMetrics{
+		coalescedRequestsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "downstream_coalesced_requests_total",
+				Help: "Total number of downstream calls served from another in-flight identical call",
+			},
+			[]string{"service"},
+		),
+	}
+}
+
+// callGoexample1 sends the hello request to goexample1 and returns the response body.
+// Identical in-flight calls share one request when DownstreamCoalescing is set. The shared request
+// is not cancelled with the request that started it, each caller stops waiting when its own ctx ends.
+func (a *App) callGoexample1(ctx context.Context) (string, error) {
+	if !a.cfg.DownstreamCoalescing {
+		return a.goexample1Hello(ctx)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	leader := false
+	ch := a.downstreamGroup.DoChan("GET "+goexample1URL+"/hello", func() (interface{}, error) {
+		leader = true
+		callCtx := context.WithoutCancel(ctx)
+		if timeout := a.cfg.Timeouts[dependencyGoexample1]; timeout > 0 {
+			var cancel context.CancelFunc
+			callCtx, cancel = context.WithTimeout(callCtx, timeout)
+			defer cancel()
+		}
+		return a.goexample1Hello(callCtx)
+	})
+
+	var res singleflight.Result
+	select {
+	case res = <-ch:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	span.SetAttributes(
+		attribute.Bool("singleflight.shared", res.Shared),
+		attribute.Bool("singleflight.leader", leader),
+	)
+	if !leader {
+		a.metrics.coalescedRequestsTotal.WithLabelValues("goexample1").Inc()
+		telemetry.Canonical(ctx).Inc("downstream_coalesced")
+	}
+
+	if res.Err != nil {
+		return "", res.Err
+	}
+	return res.Val.(string), nil
+}
+
+func (a *App) goexample1Hello(ctx context.Context) (string, error) {
+	defer a.timeDownstream(ctx, "goexample1")()
+	return a.goexample1.Hello(ctx)
+}
+
+// timeDownstream starts timing a call to a dependency, the returned func records the
+// duration as downstream_<name> on the canonical log line
+func (a *App) timeDownstream(ctx context.Context, name string) func() {
+	start := a.clock.Now()
+	return func() {
+		telemetry.Canonical(ctx).AddDuration("downstream_"+name, clock.Since(a.clock, start))
+	}
+}
+
+// WarmDownstream resolves goexample1 and opens connections to it before the first request needs
+// them. The simulated goexample1 of DownstreamLatency needs none.
+func (a *App) WarmDownstream(ctx context.Context) error {
+	c, ok := a.goexample1.(*client.Client)
+	if !ok {
+		return nil
+	}
+	return c.Warm(ctx, "/headers", warmupConnections)
+}
@@ -0,0 +1,33 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceIDHeader returns the trace ID of failed requests so users can report it
+const traceIDHeader = "X-Trace-Id"
+
+// errorResponse is the JSON body returned for failed requests
+type errorResponse struct {
+	Error   string `json:"error"`
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// writeError writes a JSON error body carrying the trace ID of the span in ctx
+func writeError(ctx context.Context, w http.ResponseWriter, status int, message string) {
+	body := errorResponse{Error: message}
+
+	sc := trace.SpanFromContext(ctx).SpanContext()
+	if sc.IsValid() {
+		body.TraceID = sc.TraceID().String()
+		w.Header().Set(traceIDHeader, body.TraceID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"goexample/pkg/errfmt"
+	"net/http"
+	"strings"
+)
+
+// Validator is implemented by request types that check their fields after decoding,
+// failed checks are returned as a *ValidationError
+type Validator interface {
+	Validate() error
+}
+
+// statusError is an error answered with an explicit HTTP status
+type statusError struct {
+	error
+	status int
+}
+
+func (e statusError) Unwrap() error {
+	return e.error
+}
+
+// withStatus makes a typed handler answer err with status instead of the one derived from its category
+func withStatus(err error, status int) error {
+	return statusError{error: err, status: status}
+}
+
+// Statuses of the errfmt categories, used when a handler error carries no explicit status
+var categoryStatus = map[string]int{
+	errfmt.CategoryCanceled:   499,
+	errfmt.CategoryTimeout:    http.StatusGatewayTimeout,
+	errfmt.CategoryNetwork:    http.StatusBadGateway,
+	errfmt.CategoryRejected:   http.StatusConflict,
+	errfmt.CategoryDependency: http.StatusBadGateway,
+	errfmt.CategoryInternal:   http.StatusInternalServerError,
+}
+
+// errorStatus returns the HTTP status a typed handler answers err with
+func errorStatus(err error) int {
+	var se statusError
+	if errors.As(err, &se) {
+		return se.status
+	}
+	if status, ok := categoryStatus[errfmt.Category(err)]; ok {
+		return status
+	}
+	// A category without a status, e.g. one added to errfmt later
+	return http.StatusInternalServerError
+}
+
+// Handle registers fn for route ("POST /quote") behind the instrument middlewares.
+// The JSON request body is decoded into Req and validated when Req implements Validator, both
+// failures are answered with writeValidationError,
+// fn runs in a span named "Handle <route>" and its result is encoded as JSON.
+// Errors are answered with writeError, server errors are also recorded through errfmt.Wrap.
+func Handle[Req, Resp any](a *App, route string, fn func(ctx context.Context, req Req) (Resp, error)) {
+	endpoint := route
+	if _, path, ok := strings.Cut(route, " "); ok {
+		endpoint = path
+	}
+
+	a.mux.HandleFunc(route, a.instrument(endpoint, func(w http.ResponseWriter, req *http.Request) {
+		var in Req
+		if err := decodeJSON(req, &in); err != nil {
+			a.writeValidationError(req.Context(), w, req, err)
+			return
+		}
+		if v, ok := any(&in).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				a.writeValidationError(req.Context(), w, req, err)
+				return
+			}
+		}
+
+		ctx, span := a.tracer.Start(req.Context(), "Handle "+route)
+		defer span.End()
+
+		out, err := fn(ctx, in)
+		if err != nil {
+			status := errorStatus(err)
+			if status >= http.StatusInternalServerError {
+				errfmt.Wrap(ctx, err, "Handler "+route+" failed")
+			}
+			writeError(ctx, w, status, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+}
@@ -0,0 +1,29 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"goexample/pkg/errfmt"
+	"net/http"
+	"testing"
+)
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"explicit status", withStatus(errors.New("missing"), http.StatusNotFound), http.StatusNotFound},
+		{"timeout", context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{"internal", errors.New("broken"), http.StatusInternalServerError},
+		{"unknown category", errfmt.WithCategory(errors.New("odd"), "unheard_of"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorStatus(tt.err); got != tt.want {
+				t.Errorf("errorStatus() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"goexample/pkg/chaos"
+	"goexample/pkg/clock"
+	"goexample/pkg/errfmt"
+	"goexample/pkg/kafkapkg"
+	"goexample/pkg/telemetry"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// hello handles /hello, ?size=64KB pads the response to demonstrate bandwidth and GC under load
+func (a *App) hello(w http.ResponseWriter, req *http.Request) {
+	ctx, span := a.tracer.Start(req.Context(), "Start hello handler")
+	defer span.End()
+
+	padding, err := a.responsePadding(req)
+	if err != nil {
+		writeError(ctx, w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	a.logWithTrace(ctx).WithFields(logrus.Fields{
+		"method": req.Method,
+		"path":   req.URL.Path,
+	}).Info("Handling hello request")
+
+	// Randomly return 500 error (30% chance by default), unless a route override decided already
+	errorRate := a.chaos.Current().ErrorRate
+	if o := routeOverrideFrom(ctx); o != nil && o.ErrorRate != nil {
+		errorRate = 0
+	}
+	if chaos.Roll(ctx, chaos.RuleErrorRate, errorRate) {
+		errfmt.Wrap(ctx, errors.New("random internal server error"), "Random internal server error",
+			"method", req.Method,
+			"path", req.URL.Path,
+		)
+
+		writeError(ctx, w, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+
+	a.helloFlow(ctx)
+
+	fmt.Fprintf(w, "hello\n")
+	if padding > 0 {
+		span.SetAttributes(attribute.Int64("hello.padding_bytes", int64(padding)))
+		// Allocated per request on purpose, large sizes show up in GC and heap metrics
+		_, _ = w.Write(bytes.Repeat([]byte{'.'}, int(padding)))
+	}
+}
+
+// responsePadding returns the bytes added to the hello response: the size query parameter,
+// otherwise the chaos setting
+func (a *App) responsePadding(req *http.Request) (chaos.ByteSize, error) {
+	value := req.URL.Query().Get("size")
+	if value == "" {
+		return a.chaos.Current().ResponseSize, nil
+	}
+	size, err := chaos.ParseByteSize(value)
+	if err != nil {
+		return 0, err
+	}
+	if size > chaos.MaxResponseSize {
+		return 0, fmt.Errorf("size must be at most %s", chaos.MaxResponseSize)
+	}
+	return size, nil
+}
+
+// helloFlow calls goexample1, simulates processing and publishes the hello message to Kafka
+func (a *App) helloFlow(ctx context.Context) {
+	span := trace.SpanFromContext(ctx)
+
+	// send http request to goexample1:8080
+	body, err := a.callGoexample1(ctx)
+	if err != nil {
+		errfmt.Wrap(ctx, err, "Failed to send request", "service", "goexample1")
+	}
+
+	// print response body ouput
+	span.SetAttributes(telemetry.String("response", body))
+
+	if a.cfg.SyntheticTopology {
+		if err := a.callVirtualService(ctx); err != nil {
+			errfmt.Wrap(ctx, err, "Failed to call virtual service")
+		}
+	}
+
+	a.subHello(ctx)
+	a.sendHelloKafkaMsg(ctx)
+}
+
+func (a *App) sendHelloKafkaMsg(ctx context.Context) (err error) {
+	ctx, span := a.kafkaTracer.Start(ctx, "Sending hello message to kafka",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(telemetry.KafkaAttributes(a.kafkaEndpoint(HelloTopic), HelloTopic)...),
+	)
+	defer span.End()
+
+	// Create a map carrier to hold the propagated context
+	carrier := propagation.MapCarrier{}
+
+	// Inject the tracing context into the carrier
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	// Convert the carrier to Kafka headers
+	headers := make([]kafka.Header, 0, len(carrier)+1)
+	for key, value := range carrier {
+		headers = append(headers, kafka.Header{
+			Key:   key,
+			Value: []byte(value),
+		})
+	}
+
+	// Unique ID so consumers can recognize redelivered messages
+	headers = append(headers, kafka.Header{
+		Key:   kafkapkg.MessageIDHeader,
+		Value: []byte(uuid.NewString()),
+	})
+
+	if err = a.injectKafkaLatency(ctx); err != nil {
+		return errfmt.Wrap(ctx, err, "Error sending message to kafka",
+			"topic", HelloTopic,
+			"message_key", "test-message-goexample",
+		)
+	}
+
+	msg := kafka.Message{
+		Key:     []byte("test-message-goexample"),
+		Value:   []byte("hello from goexample"),
+		Headers: headers,
+	}
+	start := a.clock.Now()
+	if a.helloProducer != nil {
+		// Returns before the message is written, the delivery span links back to this one
+		err = a.helloProducer.PublishAsync(ctx, msg, func(err error) {
+			if err != nil {
+				a.logger.WithFields(logrus.Fields{
+					"error":       err,
+					"topic":       HelloTopic,
+					"message_key": "test-message-goexample",
+				}).Error("Error delivering message to kafka")
+			}
+		})
+	} else {
+		writeCtx, cancel := a.kafkaWriteContext(ctx)
+		err = a.helloWriter.WriteMessages(writeCtx, msg)
+		cancel()
+		a.observeKafkaWrite(ctx, HelloTopic, err)
+	}
+	telemetry.Canonical(ctx).AddDuration("kafka_publish", clock.Since(a.clock, start))
+	if err != nil {
+		telemetry.Canonical(ctx).Inc("kafka_publish_errors")
+		err = errfmt.Wrap(ctx, err, "Error sending message to kafka",
+			"topic", HelloTopic,
+			"message_key", "test-message-goexample",
+		)
+	}
+	return
+}
+
+func (a *App) subHello(ctx context.Context) {
+	_, span := a.tracer.Start(ctx, "Start subHello handler")
+	defer span.End()
+
+	// Simulate long processing time
+	a.clock.Sleep(100 * time.Millisecond)
+}
+
+func headers(w http.ResponseWriter, req *http.Request) {
+	for name, headers := range req.Header {
+		for _, h := range headers {
+			fmt.Fprintf(w, "%v: %v\n", name, h)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package app
+
+import (
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Supported values of the HIGH_RES_LATENCY env variable
+const (
+	// 40 exponential buckets between 1ms and 10s
+	highResBuckets = "buckets"
+	// Prometheus native histogram, scraped with --enable-feature=native-histograms
+	highResNative = "native"
+)
+
+// newHighResDuration returns an optional finer grained copy of http_request_duration_seconds
+// for heatmaps and tail latency analysis, nil when HIGH_RES_LATENCY is not set
+func newHighResDuration() *prometheus.HistogramVec {
+	opts := prometheus.HistogramOpts{
+		Name: "http_request_duration_highres_seconds",
+		Help: "High resolution HTTP request duration in seconds by status class (2xx, 4xx, 5xx)",
+	}
+
+	switch os.Getenv("HIGH_RES_LATENCY") {
+	case highResBuckets:
+		opts.Buckets = prometheus.ExponentialBucketsRange(0.001, 10, 40)
+	case highResNative:
+		// Bucket boundaries grow by at most 10%, classic buckets are kept for scrapers without native histogram support
+		opts.NativeHistogramBucketFactor = 1.1
+		opts.NativeHistogramMaxBucketNumber = 160
+		opts.Buckets = prometheus.DefBuckets
+	default:
+		return nil
+	}
+
+	return prometheus.NewHistogramVec(opts, []string{"method", "endpoint", "status_class"})
+}
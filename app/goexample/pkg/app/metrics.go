@@ -0,0 +1,263 @@
+package app
+
+import (
+	"goexample/pkg/adminauth"
+	"goexample/pkg/annotations"
+	"goexample/pkg/chaos"
+	"goexample/pkg/client"
+	"goexample/pkg/clock"
+	"goexample/pkg/errfmt"
+	"goexample/pkg/kafkapkg"
+	"goexample/pkg/server"
+	"goexample/pkg/telemetry"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// httpMetrics are the metrics of every instrumented route
+type httpMetrics struct {
+	httpRequestsTotal    *prometheus.CounterVec
+	httpRequestDuration  *prometheus.HistogramVec
+	httpResponseSize     *prometheus.HistogramVec
+	httpRequestsInFlight *prometheus.GaugeVec
+}
+
+func newHTTPMetrics() httpMetrics {
+	return httpMetrics{
+		httpRequestsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "http_requests_total",
+				Help: "Total number of HTTP requests",
+			},
+			[]string{"method", "endpoint", "status", "client", "client_service"},
+		),
+
+		httpRequestDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "http_request_duration_seconds",
+				Help:    "HTTP request duration in seconds by status class (2xx, 4xx, 5xx)",
+				Buckets: prometheus.DefBuckets, // Default buckets: 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10
+			},
+			[]string{"method", "endpoint", "status_class"},
+		),
+
+		httpResponseSize: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "http_response_size_bytes",
+				Help:    "Size of HTTP response bodies in bytes",
+				Buckets: prometheus.ExponentialBuckets(64, 4, 10), // 64B to 16MB
+			},
+			[]string{"method", "endpoint"},
+		),
+
+		httpRequestsInFlight: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "http_requests_in_flight",
+				Help: "Number of HTTP requests currently being handled per endpoint",
+			},
+			[]string{"endpoint"},
+		),
+	}
+}
+
+// metrics holds the collectors of an App. Each App registers its own with its registry, so two
+// Apps of one process, e.g. in tests, neither share values nor collide on a registry.
+type metrics struct {
+	httpMetrics
+	adaptiveMetrics
+	backpressureMetrics
+	budgetMetrics
+	burstMetrics
+	cacheMetrics
+	coldStartMetrics
+	costMetrics
+	downstreamMetrics
+	orderMetrics
+	overrideMetrics
+	priorityMetrics
+	profilingMetrics
+	serializationMetrics
+	shadowMetrics
+	sliMetrics
+	templateMetrics
+	sseMetrics
+	taskMetrics
+	uploadMetrics
+	validationMetrics
+	kafkaWriteMetrics
+	// Only set with HIGH_RES_LATENCY
+	httpRequestDurationHighRes *prometheus.HistogramVec
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		httpMetrics:                newHTTPMetrics(),
+		adaptiveMetrics:            newAdaptiveMetrics(),
+		backpressureMetrics:        newBackpressureMetrics(),
+		budgetMetrics:              newBudgetMetrics(),
+		burstMetrics:               newBurstMetrics(),
+		cacheMetrics:               newCacheMetrics(),
+		coldStartMetrics:           newColdStartMetrics(),
+		costMetrics:                newCostMetrics(),
+		downstreamMetrics:          newDownstreamMetrics(),
+		orderMetrics:               newOrderMetrics(),
+		overrideMetrics:            newOverrideMetrics(),
+		priorityMetrics:            newPriorityMetrics(),
+		profilingMetrics:           newProfilingMetrics(),
+		serializationMetrics:       newSerializationMetrics(),
+		shadowMetrics:              newShadowMetrics(),
+		sliMetrics:                 newSLIMetrics(),
+		templateMetrics:            newTemplateMetrics(),
+		sseMetrics:                 newSSEMetrics(),
+		taskMetrics:                newTaskMetrics(),
+		uploadMetrics:              newUploadMetrics(),
+		validationMetrics:          newValidationMetrics(),
+		kafkaWriteMetrics:          newKafkaWriteMetrics(),
+		httpRequestDurationHighRes: newHighResDuration(),
+	}
+}
+
+// register registers the metrics of the App with reg, and those of the packages it builds on. The
+// metrics of the other packages are package variables, registries of one process share their values.
+func (m *metrics) register(reg prometheus.Registerer) error {
+	collectors := []prometheus.Collector{
+		m.httpRequestsTotal,
+		m.httpRequestDuration,
+		m.httpResponseSize,
+		m.httpRequestsInFlight,
+		m.inFlightRequests,
+		m.queuedRequests,
+		m.shedRequestsTotal,
+		m.adaptiveLimit,
+		m.adaptiveInFlight,
+		m.adaptiveRejectedTotal,
+		m.adaptiveLatencyBaseline,
+		m.overBudgetTotal,
+		m.burstActive,
+		m.burstStartTime,
+		m.burstMessagesTotal,
+		m.cacheRequestsTotal,
+		m.cacheRevalidationsTotal,
+		m.cacheEntries,
+		m.requestAllocBytes,
+		m.coalescedRequestsTotal,
+		m.ordersTotal,
+		m.sagaRollbacksTotal,
+		m.tasksTotal,
+		m.tasksPending,
+		m.taskCompletionDuration,
+		m.serializationDuration,
+		m.serializationSize,
+		m.uploadsTotal,
+		m.uploadBytesTotal,
+		m.uploadSize,
+		m.uploadThroughput,
+		m.uploadReceivedBytes,
+		m.uploadExpectedBytes,
+		m.routeOverrideActive,
+		m.routeOverrideAppliedTotal,
+		m.coldStartRequestDuration,
+		m.coldStartRemaining,
+		m.taskPollsTotal,
+		m.priorityQueueWait,
+		m.priorityInFlight,
+		m.priorityShedTotal,
+		m.profilingRate,
+		m.sliValidTotal,
+		m.sliGoodTotal,
+		m.templateRenderDuration,
+		m.sseActiveStreams,
+		m.sseEventsSentTotal,
+		m.sseTimeToFirstByte,
+		m.sseFlushDuration,
+		m.validationFailuresTotal,
+		m.shadowRequestsTotal,
+		m.shadowRequestDuration,
+		m.kafkaWritesAbortedTotal,
+		m.kafkaWritesOutlivedRequestTotal,
+	}
+	if m.httpRequestDurationHighRes != nil {
+		collectors = append(collectors, m.httpRequestDurationHighRes)
+	}
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+
+	for _, register := range []func(prometheus.Registerer) error{
+		telemetry.Register,
+		kafkapkg.Register,
+		server.Register,
+		chaos.Register,
+		errfmt.Register,
+		adminauth.Register,
+		annotations.Register,
+		client.Register,
+	} {
+		if err := register(reg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// responseWriter wraps http.ResponseWriter to capture status code and body size
+type responseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	written    int64
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.written += int64(n)
+	return n, err
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	rw.statusCode = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer (e.g. for Flush)
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// metricsMiddleware wraps an HTTP handler with Prometheus metrics
+func (a *App) metricsMiddleware(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := a.clock.Now()
+		rw := newResponseWriter(w)
+
+		// Bounded caller classification
+		client, clientService := classifyClient(r), a.clientServiceName(r)
+		annotateClient(r, client, clientService)
+
+		inFlight := a.metrics.httpRequestsInFlight.WithLabelValues(endpoint)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		// Call the actual handler
+		handler(rw, r)
+
+		duration := clock.Since(a.clock, start).Seconds()
+		statusCode := strconv.Itoa(rw.statusCode)
+
+		// Record metrics, with the request's trace as exemplar
+		ctx := r.Context()
+		telemetry.AddWithExemplar(ctx, a.metrics.httpRequestsTotal.WithLabelValues(r.Method, endpoint, statusCode, client, clientService), 1)
+		telemetry.ObserveWithExemplar(ctx, a.metrics.httpRequestDuration.WithLabelValues(r.Method, endpoint, telemetry.StatusClass(rw.statusCode)), duration)
+		a.metrics.httpResponseSize.WithLabelValues(r.Method, endpoint).Observe(float64(rw.written))
+		if a.metrics.httpRequestDurationHighRes != nil {
+			telemetry.ObserveWithExemplar(ctx, a.metrics.httpRequestDurationHighRes.WithLabelValues(r.Method, endpoint, telemetry.StatusClass(rw.statusCode)), duration)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package app_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestAppsHaveIsolatedMetrics(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	tp := noop.NewTracerProvider()
+
+	first, second := prometheus.NewRegistry(), prometheus.NewRegistry()
+	served := newTestApp(t, logger, tp, first)
+	newTestApp(t, logger, tp, second)
+
+	for range 3 {
+		served.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/headers", nil))
+	}
+
+	if got := requestCount(t, first); got != 3 {
+		t.Errorf("http_requests_total of the App serving the requests = %v, want 3", got)
+	}
+	if got := requestCount(t, second); got != 0 {
+		t.Errorf("http_requests_total of the other App = %v, want 0", got)
+	}
+}
+
+// requestCount sums http_requests_total over its series in reg
+func requestCount(t *testing.T, reg *prometheus.Registry) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0.0
+	for _, f := range families {
+		if f.GetName() != "http_requests_total" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			total += m.GetCounter().GetValue()
+		}
+	}
+	return total
+}
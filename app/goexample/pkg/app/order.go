@@ -0,0 +1,288 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"goexample/pkg/chaos"
+	"goexample/pkg/client"
+	"goexample/pkg/clock"
+	"goexample/pkg/errfmt"
+	"goexample/pkg/kafkapkg"
+	"goexample/pkg/telemetry"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Upper bound for running a compensation after the request is gone
+const compensationTimeout = 10 * time.Second
+
+// orderMetrics are the metrics of the order workflow
+type orderMetrics struct {
+	ordersTotal        *prometheus.CounterVec
+	sagaRollbacksTotal *prometheus.CounterVec
+}
+
+func newOrderMetrics() orderMetrics {
+	return orderMetrics{
+		ordersTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "orders_total",
+				Help: "Total number of orders reaching each workflow state",
+			},
+			[]string{"state"},
+		),
+
+		sagaRollbacksTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "saga_rollbacks_total",
+				Help: "Total number of order workflows rolled back, by the step that failed",
+			},
+			[]string{"step"},
+		),
+	}
+}
+
+var (
+	// errOutOfStock is returned when goexample1 cannot reserve the requested quantity
+	errOutOfStock = errfmt.WithCategory(errors.New("out of stock"), errfmt.CategoryRejected)
+	// errInjectedFailure is returned by a workflow step selected through fail_at
+	errInjectedFailure = errors.New("injected failure")
+)
+
+// Workflow steps a failure can be injected at with ?fail_at=<step>, ship_panic crashes the shipping worker
+var orderSteps = []string{"reserve", "publish", "ship", "ship_panic"}
+
+// Largest quantity of an item that can be ordered or quoted at once
+const maxQuantity = 1000
+
+// order is the order event published to Kafka and shipped by the goexample1 worker
+type order struct {
+	ID       string `json:"order_id"`
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+	// Step at which the workflow fails on purpose, empty for none
+	FailAt string `json:"fail_at,omitempty"`
+}
+
+func (o *order) Validate() error {
+	var v validation
+	v.required("item", o.Item)
+	v.between("quantity", o.Quantity, 1, maxQuantity)
+	v.oneOf("fail_at", o.FailAt, orderSteps...)
+	return v.err()
+}
+
+// placeOrder handles POST /order: reserve inventory on goexample1, then publish the order for shipping.
+// A failure after the reservation releases the inventory again (saga compensation).
+func (a *App) placeOrder(w http.ResponseWriter, req *http.Request) {
+	o := order{Item: "widget", Quantity: 1}
+	if err := decodeJSON(req, &o); err != nil {
+		a.writeValidationError(req.Context(), w, req, err)
+		return
+	}
+	if step := req.URL.Query().Get("fail_at"); step != "" {
+		o.FailAt = step
+	}
+	if err := o.Validate(); err != nil {
+		a.writeValidationError(req.Context(), w, req, err)
+		return
+	}
+	o.ID = uuid.NewString()
+
+	ctx, span := a.tracer.Start(req.Context(), "Place order")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("order.id", o.ID),
+		attribute.String("order.item", o.Item),
+		attribute.Int("order.quantity", o.Quantity),
+	)
+	if o.FailAt != "" {
+		span.SetAttributes(attribute.String("saga.fail_at", o.FailAt))
+	}
+	a.metrics.ordersTotal.WithLabelValues("created").Inc()
+
+	if err := a.reserveInventory(ctx, o); err != nil {
+		status, state := http.StatusBadGateway, "failed"
+		if errors.Is(err, errOutOfStock) {
+			status, state = http.StatusConflict, "rejected"
+		}
+		a.metrics.ordersTotal.WithLabelValues(state).Inc()
+		errfmt.Wrap(ctx, err, "Failed to reserve inventory", "order_id", o.ID)
+		// The reservation may have happened before the failure, releasing an unknown order is a no-op
+		if state == "failed" {
+			a.compensateOrder(ctx, o, "reserve", err)
+		}
+
+		writeError(ctx, w, status, err.Error())
+		return
+	}
+	a.metrics.ordersTotal.WithLabelValues("reserved").Inc()
+
+	if err := a.publishOrder(ctx, o); err != nil {
+		a.metrics.ordersTotal.WithLabelValues("failed").Inc()
+		// Already logged and recorded by publishOrder
+		span.SetStatus(codes.Error, err.Error())
+		a.compensateOrder(ctx, o, "publish", err)
+		writeError(ctx, w, http.StatusInternalServerError, "failed to publish order")
+		return
+	}
+	a.metrics.ordersTotal.WithLabelValues("placed").Inc()
+	a.archiveOrder(ctx, o)
+
+	a.logWithTrace(ctx).WithFields(logrus.Fields{
+		"order_id": o.ID,
+		"item":     o.Item,
+		"quantity": o.Quantity,
+	}).Info("Order placed")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]string{"order_id": o.ID, "state": "placed"})
+}
+
+// reserveInventory asks goexample1 to hold stock for the order
+func (a *App) reserveInventory(ctx context.Context, o order) error {
+	ctx, span := a.tracer.Start(ctx, "Reserve inventory")
+	defer span.End()
+	defer a.timeDownstream(ctx, "inventory")()
+
+	err := a.goexample1.ReserveInventory(ctx, o.reservation())
+	if statusErr := (*client.StatusError)(nil); errors.As(err, &statusErr) && statusErr.Code == http.StatusConflict {
+		return errOutOfStock
+	}
+	return err
+}
+
+// releaseInventory asks goexample1 to put the reserved stock back
+func (a *App) releaseInventory(ctx context.Context, o order) error {
+	ctx, span := a.tracer.Start(ctx, "Release inventory")
+	defer span.End()
+	defer a.timeDownstream(ctx, "inventory")()
+
+	return a.goexample1.ReleaseInventory(ctx, o.reservation())
+}
+
+func (o order) reservation() client.Reservation {
+	return client.Reservation{OrderID: o.ID, Item: o.Item, Quantity: o.Quantity, FailAt: o.FailAt}
+}
+
+// Source and type of the order events in their CloudEvents envelope
+const (
+	orderEventSource = "/goexample/orders"
+	orderEventType   = "com.cozi.monitoring.order.placed"
+)
+
+// publishOrder writes the order event to Kafka with the trace context in its headers, or in the
+// CloudEvents envelope of OrderEventMode. Its errors are logged and recorded already.
+func (a *App) publishOrder(ctx context.Context, o order) error {
+	ctx, span := a.kafkaTracer.Start(ctx, "Publishing order to kafka",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(telemetry.KafkaAttributes(a.kafkaEndpoint(OrdersTopic), OrdersTopic)...),
+	)
+	defer span.End()
+
+	if o.FailAt == "publish" {
+		chaos.Inject(ctx, chaos.RuleFailAt, attribute.String("saga.fail_at", o.FailAt))
+		return errfmt.Wrap(ctx, errInjectedFailure, "Failed to publish order", "order_id", o.ID)
+	}
+
+	event, err := kafkapkg.NewEvent(ctx, o.ID, orderEventSource, orderEventType, o)
+	if err != nil {
+		return errfmt.Wrap(ctx, err, "Failed to encode order event", "order_id", o.ID)
+	}
+	event.Time = a.clock.Now().UTC()
+	event.Subject = o.Item
+	msg, err := event.Message(a.cfg.OrderEventMode)
+	if err != nil {
+		return errfmt.Wrap(ctx, err, "Failed to encode order event", "order_id", o.ID)
+	}
+	msg.Key = []byte(o.ID)
+	msg.Headers = append(msg.Headers, kafka.Header{Key: kafkapkg.MessageIDHeader, Value: []byte(o.ID)})
+	if a.cfg.OrderEventMode != kafkapkg.EventModeNone {
+		span.SetAttributes(event.Attributes()...)
+	}
+
+	if err := a.injectKafkaLatency(ctx); err != nil {
+		return errfmt.Wrap(ctx, err, "Error sending order to kafka",
+			"topic", OrdersTopic,
+			"order_id", o.ID,
+		)
+	}
+	start := a.clock.Now()
+	writeCtx, cancel := a.kafkaWriteContext(ctx)
+	defer cancel()
+	err = a.orderWriter.WriteMessages(writeCtx, msg)
+	a.observeKafkaWrite(ctx, OrdersTopic, err)
+	telemetry.Canonical(ctx).AddDuration("kafka_publish", clock.Since(a.clock, start))
+	if err != nil {
+		telemetry.Canonical(ctx).Inc("kafka_publish_errors")
+		return errfmt.Wrap(ctx, err, "Error sending order to kafka",
+			"topic", OrdersTopic,
+			"order_id", o.ID,
+		)
+	}
+	return nil
+}
+
+// archiveOrder stores the placed order in the object storage as orders/<id>.json. The order is
+// already placed, a failure is logged and recorded on the span but not returned.
+func (a *App) archiveOrder(ctx context.Context, o order) {
+	if a.objects == nil {
+		return
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		return
+	}
+	start := a.clock.Now()
+	_, err = a.objects.Put(ctx, "orders/"+o.ID+".json", bytes.NewReader(data), int64(len(data)), "application/json")
+	telemetry.Canonical(ctx).AddDuration("order_archive", clock.Since(a.clock, start))
+	if err != nil {
+		trace.SpanFromContext(ctx).AddEvent("order.archive_failed", trace.WithAttributes(attribute.String("error", err.Error())))
+		a.logWithTrace(ctx).WithFields(logrus.Fields{
+			"order_id": o.ID,
+			"error":    err,
+		}).Warn("Failed to archive order")
+	}
+}
+
+// compensateOrder undoes the completed steps of a failed order workflow.
+// It runs in its own trace linked to the order so the rollback survives the request being cancelled.
+func (a *App) compensateOrder(ctx context.Context, o order, failedStep string, cause error) {
+	ctx, span, cancel := telemetry.Detach(ctx, a.tracer, "Compensate order", compensationTimeout)
+	defer cancel()
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("order.id", o.ID),
+		attribute.String("saga.failed_step", failedStep),
+		attribute.String("saga.cause", cause.Error()),
+	)
+	a.metrics.sagaRollbacksTotal.WithLabelValues(failedStep).Inc()
+
+	if err := a.releaseInventory(ctx, o); err != nil {
+		a.metrics.ordersTotal.WithLabelValues("compensation_failed").Inc()
+		errfmt.Wrap(ctx, err, "Failed to roll back order",
+			"order_id", o.ID,
+			"failed_step", failedStep,
+		)
+		return
+	}
+
+	a.metrics.ordersTotal.WithLabelValues("rolled_back").Inc()
+	a.logWithTrace(ctx).WithFields(logrus.Fields{
+		"order_id":    o.ID,
+		"failed_step": failedStep,
+		"cause":       cause,
+	}).Warn("Rolled back order")
+}
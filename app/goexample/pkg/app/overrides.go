@@ -0,0 +1,296 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goexample/pkg/annotations"
+	"goexample/pkg/chaos"
+	"goexample/pkg/clock"
+	"goexample/pkg/telemetry"
+	"maps"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Settings of a route override, the setting label of route_override_applied_total
+const (
+	overrideErrorRate = "error_rate"
+	overrideLatency   = "latency"
+	overrideTimeout   = "timeout"
+	overrideRateLimit = "rate_limit"
+)
+
+// overrideMetrics are the metrics of the route overrides
+type overrideMetrics struct {
+	routeOverrideActive       *prometheus.GaugeVec
+	routeOverrideAppliedTotal *prometheus.CounterVec
+}
+
+func newOverrideMetrics() overrideMetrics {
+	return overrideMetrics{
+		routeOverrideActive: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "route_override_active",
+				Help: "Set to 1 while the route has settings overridden through /admin/overrides",
+			},
+			[]string{"endpoint"},
+		),
+
+		routeOverrideAppliedTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "route_override_applied_total",
+				Help: "Total number of requests affected by a route override: failed by error_rate, delayed by latency, " +
+					"cut by timeout or rejected by rate_limit",
+			},
+			[]string{"endpoint", "setting"},
+		),
+	}
+}
+
+// RouteOverride holds the chaos, timeout and rate limit settings of a single route, so a scenario
+// can target one endpoint without touching the others. Unset fields leave the route as it is.
+type RouteOverride struct {
+	// Probability of a request failing with an injected 500 before its handler runs. It replaces
+	// the service wide error rate on /hello.
+	ErrorRate *float64
+	// Delay added before the handler runs
+	Latency time.Duration
+	// Deadline of the requests, their downstream calls are cancelled with them
+	Timeout time.Duration
+	// Requests admitted per second, the others are rejected with 429
+	RateLimit float64
+
+	limiter *tokenBucket
+}
+
+// routeOverrideJSON is the body of PUT /admin/overrides and the entries of GET /admin/overrides,
+// durations as in "250ms"
+type routeOverrideJSON struct {
+	ErrorRate *float64 `json:"error_rate,omitempty"`
+	Latency   string   `json:"latency,omitempty"`
+	Timeout   string   `json:"timeout,omitempty"`
+	RateLimit float64  `json:"rate_limit,omitempty"`
+}
+
+func (r routeOverrideJSON) override() (*RouteOverride, error) {
+	var v validation
+	o := &RouteOverride{ErrorRate: r.ErrorRate, RateLimit: r.RateLimit}
+	if o.ErrorRate != nil && (*o.ErrorRate < 0 || *o.ErrorRate > 1) {
+		v.fail(overrideErrorRate, ruleMax, "must be between 0 and 1")
+	}
+	for _, d := range []struct {
+		field string
+		value string
+		dst   *time.Duration
+	}{
+		{overrideLatency, r.Latency, &o.Latency},
+		{overrideTimeout, r.Timeout, &o.Timeout},
+	} {
+		if d.value == "" {
+			continue
+		}
+		var err error
+		if *d.dst, err = time.ParseDuration(d.value); err != nil || *d.dst <= 0 {
+			v.fail(d.field, ruleType, "must be a positive duration, e.g. 250ms")
+		}
+	}
+	if o.RateLimit < 0 {
+		v.fail(overrideRateLimit, ruleMin, "must not be negative")
+	}
+	if o.ErrorRate == nil && o.Latency == 0 && o.Timeout == 0 && o.RateLimit == 0 {
+		v.fail(bodyField, ruleRequired, "must set error_rate, latency, timeout or rate_limit")
+	}
+	return o, v.err()
+}
+
+func (o *RouteOverride) json() routeOverrideJSON {
+	r := routeOverrideJSON{ErrorRate: o.ErrorRate, RateLimit: o.RateLimit}
+	if o.Latency > 0 {
+		r.Latency = o.Latency.String()
+	}
+	if o.Timeout > 0 {
+		r.Timeout = o.Timeout.String()
+	}
+	return r
+}
+
+// routeOverrides is a snapshot of the overrides by route. A snapshot is never modified, a change
+// stores a new one, so requests read the overrides with a single atomic load.
+type routeOverrides map[string]*RouteOverride
+
+// routeOverrideKey carries the override of the route of the request in its context
+type routeOverrideKey struct{}
+
+// routeOverrideFrom returns the override applied to the request of ctx, nil without one
+func routeOverrideFrom(ctx context.Context) *RouteOverride {
+	o, _ := ctx.Value(routeOverrideKey{}).(*RouteOverride)
+	return o
+}
+
+// overrideMiddleware applies the override of endpoint in effect when the request arrives
+func (a *App) overrideMiddleware(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		o := (*a.overrides.Load())[endpoint]
+		if o == nil {
+			handler(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), routeOverrideKey{}, o)
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(attribute.Bool("route_override", true))
+		telemetry.Canonical(ctx).Set("route_override", true)
+
+		if o.RateLimit > 0 && !o.limiter.allow() {
+			a.metrics.routeOverrideAppliedTotal.WithLabelValues(endpoint, overrideRateLimit).Inc()
+			span.AddEvent("route override rate limited", trace.WithAttributes(attribute.Float64("route_override.rate_limit", o.RateLimit)))
+			w.Header().Set("Retry-After", "1")
+			writeError(ctx, w, http.StatusTooManyRequests, "Too Many Requests")
+			return
+		}
+		if o.Latency > 0 {
+			a.metrics.routeOverrideAppliedTotal.WithLabelValues(endpoint, overrideLatency).Inc()
+			chaos.Inject(ctx, chaos.RuleRouteLatency, attribute.Int64("chaos.latency_ms", o.Latency.Milliseconds()))
+			a.clock.Sleep(o.Latency)
+		}
+		if o.ErrorRate != nil && chaos.Roll(ctx, chaos.RuleRouteErrorRate, *o.ErrorRate) {
+			a.metrics.routeOverrideAppliedTotal.WithLabelValues(endpoint, overrideErrorRate).Inc()
+			writeError(ctx, w, http.StatusInternalServerError, "Internal Server Error")
+			return
+		}
+		if o.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+			defer cancel()
+			defer func() {
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					a.metrics.routeOverrideAppliedTotal.WithLabelValues(endpoint, overrideTimeout).Inc()
+				}
+			}()
+		}
+		handler(w, r.WithContext(ctx))
+	}
+}
+
+// setRouteOverride stores a new snapshot with the override of route replaced, nil removes it.
+// Writers are serialized, readers keep using the snapshot they loaded.
+func (a *App) setRouteOverride(route string, o *RouteOverride) {
+	a.overridesMu.Lock()
+	defer a.overridesMu.Unlock()
+
+	next := maps.Clone(*a.overrides.Load())
+	if o == nil {
+		delete(next, route)
+		a.metrics.routeOverrideActive.DeleteLabelValues(route)
+	} else {
+		if o.RateLimit > 0 {
+			o.limiter = newTokenBucket(a.clock, o.RateLimit)
+		}
+		next[route] = o
+		a.metrics.routeOverrideActive.WithLabelValues(route).Set(1)
+	}
+	a.overrides.Store(&next)
+}
+
+// getOverrides handles GET /admin/overrides, the overrides in effect by route
+func (a *App) getOverrides(w http.ResponseWriter, _ *http.Request) {
+	overrides := *a.overrides.Load()
+	body := make(map[string]routeOverrideJSON, len(overrides))
+	for route, o := range overrides {
+		body[route] = o.json()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// putOverride handles PUT /admin/overrides?route=/order, replacing the override of the route with
+// the settings of the body, e.g. {"error_rate":0.2,"latency":"100ms","timeout":"1s","rate_limit":50}
+func (a *App) putOverride(w http.ResponseWriter, req *http.Request) {
+	route, ok := a.overrideRoute(w, req)
+	if !ok {
+		return
+	}
+	var body routeOverrideJSON
+	err := decodeJSON(req, &body)
+	var o *RouteOverride
+	if err == nil {
+		o, err = body.override()
+	}
+	if err != nil {
+		a.writeValidationError(req.Context(), w, req, err)
+		return
+	}
+
+	a.setRouteOverride(route, o)
+	a.logger.WithFields(logrus.Fields{
+		"route":    route,
+		"override": body,
+	}).Info("Overrode route settings")
+	a.annotations.Emit(req.Context(), fmt.Sprintf("%s settings overridden", route), annotations.TagConfig)
+	a.getOverrides(w, req)
+}
+
+// deleteOverride handles DELETE /admin/overrides?route=/order, restoring the settings of the route
+func (a *App) deleteOverride(w http.ResponseWriter, req *http.Request) {
+	route, ok := a.overrideRoute(w, req)
+	if !ok {
+		return
+	}
+	a.setRouteOverride(route, nil)
+	a.logger.WithField("route", route).Info("Removed route override")
+	a.annotations.Emit(req.Context(), fmt.Sprintf("%s override removed", route), annotations.TagConfig)
+	a.getOverrides(w, req)
+}
+
+// overrideRoute returns the route query parameter, answering 404 for a route that is not served
+func (a *App) overrideRoute(w http.ResponseWriter, req *http.Request) (string, bool) {
+	route := req.URL.Query().Get("route")
+	if !a.routes[route] {
+		routes := make([]string, 0, len(a.routes))
+		for r := range a.routes {
+			routes = append(routes, r)
+		}
+		sort.Strings(routes)
+		http.Error(w, fmt.Sprintf("unknown route %q, the routes are %v", route, routes), http.StatusNotFound)
+		return "", false
+	}
+	return route, true
+}
+
+// tokenBucket admits rate requests per second with bursts of up to one second worth of them
+type tokenBucket struct {
+	clock clock.Clock
+	rate  float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(c clock.Clock, rate float64) *tokenBucket {
+	burst := math.Max(1, rate)
+	return &tokenBucket{clock: c, rate: rate, tokens: burst, last: c.Now()}
+}
+
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.clock.Now()
+	b.tokens = math.Min(math.Max(1, b.rate), b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"fmt"
+	"goexample/pkg/clock"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Request priority classes, selected by the X-Priority header
+const (
+	priorityHigh   = "high"
+	priorityNormal = "normal"
+	priorityLow    = "low"
+)
+
+const (
+	defaultPriorityLimits       = "high=100,normal=50,low=10"
+	defaultPriorityQueueTimeout = 500 * time.Millisecond
+)
+
+// priorityMetrics are the metrics of the priority class limits
+type priorityMetrics struct {
+	priorityQueueWait *prometheus.HistogramVec
+	priorityInFlight  *prometheus.GaugeVec
+	priorityShedTotal *prometheus.CounterVec
+}
+
+func newPriorityMetrics() priorityMetrics {
+	return priorityMetrics{
+		priorityQueueWait: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "http_priority_queue_wait_seconds",
+				Help:    "Time requests spent waiting for a concurrency slot of their priority class",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"class"},
+		),
+
+		priorityInFlight: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "http_priority_in_flight",
+				Help: "Number of requests currently being handled per priority class",
+			},
+			[]string{"class"},
+		),
+
+		priorityShedTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "http_priority_shed_total",
+				Help: "Total number of requests rejected because their priority class was saturated",
+			},
+			[]string{"class"},
+		),
+	}
+}
+
+// classifyPriority maps the X-Priority header to a bounded priority class
+func classifyPriority(req *http.Request) string {
+	switch strings.ToLower(req.Header.Get("X-Priority")) {
+	case priorityHigh:
+		return priorityHigh
+	case priorityLow:
+		return priorityLow
+	default:
+		return priorityNormal
+	}
+}
+
+// priorityLimiter applies a separate concurrency limit to every priority class
+type priorityLimiter struct {
+	slots        map[string]chan struct{}
+	queueTimeout time.Duration
+	clock        clock.Clock
+	metrics      *metrics
+}
+
+// newPriorityLimiter creates a limiter with the given limit per priority class
+func newPriorityLimiter(limits map[string]int, queueTimeout time.Duration, c clock.Clock, m *metrics) *priorityLimiter {
+	l := &priorityLimiter{
+		slots:        make(map[string]chan struct{}),
+		queueTimeout: queueTimeout,
+		clock:        c,
+		metrics:      m,
+	}
+	for class, limit := range limits {
+		l.slots[class] = make(chan struct{}, limit)
+	}
+	return l
+}
+
+// parsePriorityLimits parses PRIORITY_LIMITS ("high=100,normal=50,low=10"), every class needs a limit
+func parsePriorityLimits(spec string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, pair := range strings.Split(spec, ",") {
+		class, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid priority limit %q", pair)
+		}
+		if class != priorityHigh && class != priorityNormal && class != priorityLow {
+			return nil, fmt.Errorf("unknown priority class %q", class)
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid limit for priority class %q: %q", class, value)
+		}
+		limits[class] = limit
+	}
+
+	for _, class := range []string{priorityHigh, priorityNormal, priorityLow} {
+		if _, ok := limits[class]; !ok {
+			return nil, fmt.Errorf("missing limit for priority class %q", class)
+		}
+	}
+
+	return limits, nil
+}
+
+// middleware queues requests until a slot of their class is free, shedding them after the queue timeout
+func (l *priorityLimiter) middleware(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		class := classifyPriority(r)
+		slots := l.slots[class]
+		start := l.clock.Now()
+
+		timer := l.clock.NewTicker(l.queueTimeout)
+		defer timer.Stop()
+
+		select {
+		case slots <- struct{}{}:
+		case <-timer.C():
+			l.metrics.priorityShedTotal.WithLabelValues(class).Inc()
+			w.Header().Set("Retry-After", "1")
+			writeError(r.Context(), w, http.StatusServiceUnavailable, "Service Unavailable")
+			return
+		case <-r.Context().Done():
+			return
+		}
+		defer func() { <-slots }()
+
+		l.metrics.priorityQueueWait.WithLabelValues(class).Observe(clock.Since(l.clock, start).Seconds())
+
+		l.metrics.priorityInFlight.WithLabelValues(class).Inc()
+		defer l.metrics.priorityInFlight.WithLabelValues(class).Dec()
+
+		handler(w, r)
+	}
+}
@@ -0,0 +1,39 @@
+package app
+
+import (
+	"goexample/pkg/clock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPriorityLimiterShedsOnTheClock(t *testing.T) {
+	m := newMetrics()
+	c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	l := newPriorityLimiter(map[string]int{priorityHigh: 1, priorityNormal: 1, priorityLow: 1}, time.Second, c, m)
+	l.slots[priorityNormal] <- struct{}{}
+
+	handler := l.middleware(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler ran without a free slot")
+	})
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler(rec, httptest.NewRequest(http.MethodGet, "/hello", nil))
+	}()
+
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	<-done
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if shed := testutil.ToFloat64(m.priorityShedTotal.WithLabelValues(priorityNormal)); shed != 1 {
+		t.Errorf("shed requests = %v, want 1", shed)
+	}
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"goexample/pkg/annotations"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// profilingMetrics are the metrics of the contention profiling toggles
+type profilingMetrics struct {
+	profilingRate *prometheus.GaugeVec
+}
+
+func newProfilingMetrics() profilingMetrics {
+	m := profilingMetrics{
+		profilingRate: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "runtime_contention_profiling_rate",
+				Help: "Current mutex profile fraction and block profile rate set through the admin API (0 is disabled)",
+			},
+			[]string{"profile"},
+		),
+	}
+	// The profiling rates are process wide, another App may have changed them already
+	state := currentProfiling()
+	m.profilingRate.WithLabelValues("mutex").Set(float64(state.MutexFraction))
+	m.profilingRate.WithLabelValues("block").Set(float64(state.BlockRate))
+	return m
+}
+
+// The runtime has no getter for the block profile rate, so keep track of it here
+var profiling = struct {
+	sync.Mutex
+	blockRate int
+}{}
+
+type profilingState struct {
+	// On average 1/MutexFraction of mutex contention events are reported
+	MutexFraction int `json:"mutex_fraction"`
+	// One blocking event is sampled per BlockRate nanoseconds spent blocked
+	BlockRate int `json:"block_rate"`
+}
+
+func currentProfiling() profilingState {
+	profiling.Lock()
+	defer profiling.Unlock()
+	return profilingState{
+		MutexFraction: runtime.SetMutexProfileFraction(-1),
+		BlockRate:     profiling.blockRate,
+	}
+}
+
+// getProfiling handles GET /admin/profiling
+func getProfiling(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(currentProfiling())
+}
+
+// setProfiling handles POST /admin/profiling/{profile}?rate=N, a rate of 0 disables the profile
+func (a *App) setProfiling(w http.ResponseWriter, req *http.Request) {
+	profile := req.PathValue("profile")
+	rate, err := strconv.Atoi(req.URL.Query().Get("rate"))
+	if err != nil || rate < 0 {
+		http.Error(w, "rate must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+
+	profiling.Lock()
+	switch profile {
+	case "mutex":
+		runtime.SetMutexProfileFraction(rate)
+	case "block":
+		runtime.SetBlockProfileRate(rate)
+		profiling.blockRate = rate
+	default:
+		profiling.Unlock()
+		http.Error(w, "unknown profile, expected mutex or block", http.StatusNotFound)
+		return
+	}
+	profiling.Unlock()
+	a.metrics.profilingRate.WithLabelValues(profile).Set(float64(rate))
+
+	a.logger.WithFields(logrus.Fields{
+		"profile": profile,
+		"rate":    rate,
+	}).Info("Changed contention profiling rate")
+	a.annotations.Emit(req.Context(), fmt.Sprintf("%s profiling rate set to %d", profile, rate), annotations.TagConfig)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(currentProfiling())
+}
+
+// pprofProfile handles GET /debug/pprof/{profile} serving a runtime profile such as mutex, block or goroutine.
+// net/http/pprof is not imported because it registers unprotected handlers on the default mux.
+func (a *App) pprofProfile(w http.ResponseWriter, req *http.Request) {
+	p := pprof.Lookup(req.PathValue("profile"))
+	if p == nil {
+		http.Error(w, "unknown profile", http.StatusNotFound)
+		return
+	}
+
+	debug, _ := strconv.Atoi(req.URL.Query().Get("debug"))
+	if debug > 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", p.Name()))
+	}
+	if err := p.WriteTo(w, debug); err != nil {
+		a.logWithTrace(req.Context()).WithField("error", err).Error("failed to write profile")
+	}
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Unit prices of the items that can be ordered
+var unitPrices = map[string]float64{
+	"widget": 2.50,
+	"gadget": 12.00,
+	"gizmo":  7.25,
+}
+
+// quoteRequest is the body of POST /quote
+type quoteRequest struct {
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+}
+
+func (q *quoteRequest) Validate() error {
+	if q.Item == "" {
+		q.Item = "widget"
+	}
+	if q.Quantity == 0 {
+		q.Quantity = 1
+	}
+	var v validation
+	v.between("quantity", q.Quantity, 1, maxQuantity)
+	return v.err()
+}
+
+// quoteResponse is the price of a quoteRequest
+type quoteResponse struct {
+	Item      string  `json:"item"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	Total     float64 `json:"total"`
+}
+
+// quote handles POST /quote, the price of an order without placing it
+func quote(ctx context.Context, req quoteRequest) (quoteResponse, error) {
+	price, ok := unitPrices[req.Item]
+	if !ok {
+		return quoteResponse{}, withStatus(fmt.Errorf("unknown item %q", req.Item), http.StatusNotFound)
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("order.item", req.Item),
+		attribute.Int("order.quantity", req.Quantity),
+	)
+	return quoteResponse{
+		Item:      req.Item,
+		Quantity:  req.Quantity,
+		UnitPrice: price,
+		Total:     price * float64(req.Quantity),
+	}, nil
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"encoding/json"
+	"goexample/pkg/telemetry"
+	"net/http"
+	"strconv"
+)
+
+// samplingDecisions handles GET /admin/sampling?sampled=false&limit=N, the recent sampling
+// decisions of traces entering the service, newest first
+func samplingDecisions(log *telemetry.SamplingLog) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		var sampled *bool
+		if v := query.Get("sampled"); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, "sampled must be true or false", http.StatusBadRequest)
+				return
+			}
+			sampled = &b
+		}
+		limit := 0
+		if v := query.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		decisions := make([]telemetry.SamplingDecision, 0)
+		for _, d := range log.Decisions() {
+			if sampled != nil && d.Sampled != *sampled {
+				continue
+			}
+			if limit > 0 && len(decisions) == limit {
+				break
+			}
+			decisions = append(decisions, d)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"decisions": decisions})
+	})
+}
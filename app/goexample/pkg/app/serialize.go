@@ -0,0 +1,215 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/protobuf/proto"
+)
+
+// Limits of POST /bench/serialize, a request encodes items*iterations items per format, at most
+// maxBenchEncodedItems, and lists every format once at most
+const (
+	maxBenchItems        = 1000
+	maxBenchIterations   = 10000
+	maxBenchEncodedItems = 1_000_000
+)
+
+// serializationMetrics are the metrics of the serialization benchmark
+type serializationMetrics struct {
+	serializationDuration *prometheus.HistogramVec
+	serializationSize     *prometheus.HistogramVec
+}
+
+func newSerializationMetrics() serializationMetrics {
+	return serializationMetrics{
+		serializationDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "serialization_duration_seconds",
+				Help:    "Time to encode the benchmark payload once, by format",
+				Buckets: prometheus.ExponentialBuckets(0.000001, 4, 10), // 1us to 262ms
+			},
+			[]string{"format"},
+		),
+
+		serializationSize: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "serialization_size_bytes",
+				Help:    "Size of the encoded benchmark payload, by format",
+				Buckets: prometheus.ExponentialBuckets(64, 4, 10), // 64B to 16MB
+			},
+			[]string{"format"},
+		),
+	}
+}
+
+// serializer encodes the benchmark payload in one format, add an entry to serializers to
+// benchmark another one
+type serializer struct {
+	Format string
+	// Encoder returns a function encoding p, what it prepares once is left out of the timings
+	Encoder func(p benchPayload) func() ([]byte, error)
+}
+
+// Formats benchmarked by POST /bench/serialize, in the order of its results
+var serializers = []serializer{
+	{Format: "json", Encoder: encodeJSON},
+	{Format: "protobuf", Encoder: encodeProtobuf},
+	{Format: "msgpack", Encoder: encodeMsgpack},
+}
+
+func serializerFormats() []string {
+	formats := make([]string, 0, len(serializers))
+	for _, s := range serializers {
+		formats = append(formats, s.Format)
+	}
+	return formats
+}
+
+// serializerFor returns the serializer of a validated format
+func serializerFor(format string) serializer {
+	for _, s := range serializers {
+		if s.Format == format {
+			return s
+		}
+	}
+	panic("unknown serialization format " + format)
+}
+
+// benchSerializeRequest is the body of POST /bench/serialize, all fields are optional
+type benchSerializeRequest struct {
+	Formats    []string `json:"formats"`
+	Items      int      `json:"items"`
+	Iterations int      `json:"iterations"`
+}
+
+func (b *benchSerializeRequest) Validate() error {
+	formats := serializerFormats()
+	if len(b.Formats) == 0 {
+		b.Formats = formats
+	}
+	if b.Items == 0 {
+		b.Items = 10
+	}
+	if b.Iterations == 0 {
+		b.Iterations = 100
+	}
+	var v validation
+	if len(b.Formats) > len(formats) {
+		v.fail("formats", ruleMax, fmt.Sprintf("must list at most %d formats", len(formats)))
+		return v.err()
+	}
+	for i, format := range b.Formats {
+		v.required("formats", format)
+		v.oneOf("formats", format, formats...)
+		if slices.Contains(b.Formats[:i], format) {
+			v.fail("formats", ruleUnique, "must not list "+format+" twice")
+		}
+	}
+	v.between("items", b.Items, 1, maxBenchItems)
+	v.between("iterations", b.Iterations, 1, maxBenchIterations)
+	if b.Items > 0 && b.Iterations > 0 && b.Items*b.Iterations > maxBenchEncodedItems {
+		v.fail("iterations", ruleMax, fmt.Sprintf("must be at most %d with %d items", maxBenchEncodedItems/b.Items, b.Items))
+	}
+	return v.err()
+}
+
+// benchSerializeResponse lists the results of the formats in the order requested
+type benchSerializeResponse struct {
+	Items      int                   `json:"items"`
+	Iterations int                   `json:"iterations"`
+	Results    []serializationResult `json:"results"`
+}
+
+type serializationResult struct {
+	Format    string  `json:"format"`
+	SizeBytes int     `json:"size_bytes"`
+	MeanNanos int64   `json:"mean_ns"`
+	SizeRatio float64 `json:"size_ratio_to_json,omitempty"`
+}
+
+// benchSerialize handles POST /bench/serialize, it encodes a sample payload Iterations times in
+// each format in a span per format and records the encode durations and sizes
+func (a *App) benchSerialize(ctx context.Context, req benchSerializeRequest) (benchSerializeResponse, error) {
+	payload := newBenchPayload(req.Items)
+	res := benchSerializeResponse{Items: req.Items, Iterations: req.Iterations}
+	jsonSize := 0
+	for _, format := range req.Formats {
+		r, err := a.runSerializer(ctx, serializerFor(format), payload, req.Iterations)
+		if err != nil {
+			return res, err
+		}
+		if format == "json" {
+			jsonSize = r.SizeBytes
+		}
+		res.Results = append(res.Results, r)
+	}
+	if jsonSize > 0 {
+		for i := range res.Results {
+			res.Results[i].SizeRatio = math.Round(float64(res.Results[i].SizeBytes)/float64(jsonSize)*1000) / 1000
+		}
+	}
+	return res, nil
+}
+
+// runSerializer encodes payload iterations times with s, it stops when ctx is done
+func (a *App) runSerializer(ctx context.Context, s serializer, payload benchPayload, iterations int) (serializationResult, error) {
+	ctx, span := a.tracer.Start(ctx, "Serialize "+s.Format)
+	defer span.End()
+
+	duration := a.metrics.serializationDuration.WithLabelValues(s.Format)
+	encode := s.Encoder(payload)
+	var encoded []byte
+	var total time.Duration
+	for range iterations {
+		if err := ctx.Err(); err != nil {
+			return serializationResult{}, err
+		}
+		start := time.Now()
+		b, err := encode()
+		elapsed := time.Since(start)
+		if err != nil {
+			return serializationResult{}, fmt.Errorf("encoding %s: %w", s.Format, err)
+		}
+		duration.Observe(elapsed.Seconds())
+		total += elapsed
+		encoded = b
+	}
+	a.metrics.serializationSize.WithLabelValues(s.Format).Observe(float64(len(encoded)))
+
+	r := serializationResult{
+		Format:    s.Format,
+		SizeBytes: len(encoded),
+		MeanNanos: total.Nanoseconds() / int64(iterations),
+	}
+	span.SetAttributes(
+		attribute.String("serialization.format", s.Format),
+		attribute.Int("serialization.iterations", iterations),
+		attribute.Int("serialization.size_bytes", r.SizeBytes),
+		attribute.Int64("serialization.mean_ns", r.MeanNanos),
+	)
+	return r, nil
+}
+
+// encodeJSON encodes p with encoding/json
+func encodeJSON(p benchPayload) func() ([]byte, error) {
+	return func() ([]byte, error) { return json.Marshal(p) }
+}
+
+// encodeProtobuf encodes p as the benchpb.Payload message, the conversion is not timed
+func encodeProtobuf(p benchPayload) func() ([]byte, error) {
+	m := p.proto()
+	return func() ([]byte, error) { return proto.Marshal(m) }
+}
+
+// encodeMsgpack encodes p as a MessagePack map with the keys of its JSON encoding, with the
+// code msgp generated in benchpayload_gen.go
+func encodeMsgpack(p benchPayload) func() ([]byte, error) {
+	return func() ([]byte, error) { return p.MarshalMsg(nil) }
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"goexample/pkg/app/benchpb"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/protobuf/proto"
+)
+
+// Every format decodes back to the payload it encoded
+func TestSerializersRoundTrip(t *testing.T) {
+	payload := newBenchPayload(3)
+	decoders := map[string]func(b []byte) (benchPayload, error){
+		"json": func(b []byte) (benchPayload, error) {
+			var p benchPayload
+			return p, json.Unmarshal(b, &p)
+		},
+		"protobuf": func(b []byte) (benchPayload, error) {
+			var m benchpb.Payload
+			if err := proto.Unmarshal(b, &m); err != nil {
+				return benchPayload{}, err
+			}
+			p := benchPayload{ID: m.Id, CreatedAt: m.CreatedAt, Tags: m.Tags}
+			for _, it := range m.Items {
+				p.Items = append(p.Items, benchItem{SKU: it.Sku, Quantity: it.Quantity, Price: it.Price})
+			}
+			return p, nil
+		},
+		"msgpack": func(b []byte) (benchPayload, error) {
+			var p benchPayload
+			_, err := p.UnmarshalMsg(b)
+			return p, err
+		},
+	}
+
+	for _, s := range serializers {
+		t.Run(s.Format, func(t *testing.T) {
+			decode, ok := decoders[s.Format]
+			if !ok {
+				t.Fatalf("no decoder for %s", s.Format)
+			}
+			b, err := s.Encoder(payload)()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decode(b)
+			if err != nil {
+				t.Fatalf("decoding: %v", err)
+			}
+			if !reflect.DeepEqual(got, payload) {
+				t.Errorf("decoded %+v, want %+v", got, payload)
+			}
+		})
+	}
+}
+
+func TestBenchSerializeRequestLimitsWork(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     benchSerializeRequest
+		wantErr bool
+	}{
+		{"defaults", benchSerializeRequest{}, false},
+		{"at the limit", benchSerializeRequest{Items: maxBenchItems, Iterations: maxBenchEncodedItems / maxBenchItems}, false},
+		{"over the limit", benchSerializeRequest{Items: maxBenchItems, Iterations: maxBenchIterations}, true},
+		{"too many items", benchSerializeRequest{Items: maxBenchItems + 1}, true},
+		{"unknown format", benchSerializeRequest{Formats: []string{"xml"}}, true},
+		{"duplicate format", benchSerializeRequest{Formats: []string{"json", "json"}}, true},
+		{"too many formats", benchSerializeRequest{Formats: []string{"json", "protobuf", "msgpack", "json"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunSerializerStopsWhenCanceled(t *testing.T) {
+	a := &App{tracer: noop.NewTracerProvider().Tracer(""), metrics: newMetrics()}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := a.runSerializer(ctx, serializerFor("json"), newBenchPayload(1), maxBenchIterations)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("runSerializer() = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"goexample/pkg/clock"
+	"goexample/pkg/telemetry"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// Mirrored requests in flight at once, requests beyond are not mirrored
+	maxShadowInFlight = 64
+	// Largest request body mirrored, requests with a larger one are not mirrored
+	maxShadowBodySize = 1 << 20
+	// Header marking mirrored requests, so the shadow target can tell them from live traffic
+	shadowHeader = "X-Shadow-Request"
+)
+
+// shadowMetrics are the metrics of the mirrored traffic
+type shadowMetrics struct {
+	shadowRequestsTotal   *prometheus.CounterVec
+	shadowRequestDuration *prometheus.HistogramVec
+}
+
+func newShadowMetrics() shadowMetrics {
+	return shadowMetrics{
+		shadowRequestsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "shadow_requests_total",
+				Help: "Total number of requests mirrored to the shadow target, outcome is the status class, error or dropped",
+			},
+			[]string{"endpoint", "outcome"},
+		),
+
+		shadowRequestDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "shadow_request_duration_seconds",
+				Help:    "Duration of the requests mirrored to the shadow target",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"endpoint"},
+		),
+	}
+}
+
+// parseShadowPercent parses SHADOW_PERCENT, the percentage of requests mirrored (0 to 100)
+func parseShadowPercent(value string) (float64, error) {
+	percent, err := strconv.ParseFloat(value, 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return 0, fmt.Errorf("invalid SHADOW_PERCENT %q", value)
+	}
+	return percent, nil
+}
+
+// parseShadowTarget parses SHADOW_TARGET, the base URL of the shadow deployment
+func parseShadowTarget(value string) (string, error) {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid SHADOW_TARGET %q", value)
+	}
+	return strings.TrimSuffix(value, "/"), nil
+}
+
+// shadowMiddleware mirrors ShadowPercent of the GET and HEAD requests to ShadowTarget.
+// Mirrored requests run next to the live request in their own trace linked to it, their
+// responses are discarded. Other methods are never mirrored, so orders are not placed twice.
+func (a *App) shadowMiddleware(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	if a.cfg.ShadowTarget == "" || a.cfg.ShadowPercent <= 0 {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Mirrored requests are not mirrored again, in case the shadow target mirrors too
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || r.Header.Get(shadowHeader) != "" ||
+			rand.Float64()*100 >= a.cfg.ShadowPercent {
+			handler(w, r)
+			return
+		}
+
+		span := trace.SpanFromContext(r.Context())
+		select {
+		case a.shadowSlots <- struct{}{}:
+		default:
+			a.metrics.shadowRequestsTotal.WithLabelValues(endpoint, "dropped").Inc()
+			span.SetAttributes(attribute.Bool("shadow.dropped", true))
+			handler(w, r)
+			return
+		}
+
+		// The body is read once for both requests, the live request gets it back in full
+		var body []byte
+		if r.Body != nil && r.ContentLength != 0 {
+			body, _ = io.ReadAll(io.LimitReader(r.Body, maxShadowBodySize+1))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		}
+		if len(body) > maxShadowBodySize {
+			// A truncated copy would not exercise the shadow target like the live request
+			<-a.shadowSlots
+			a.metrics.shadowRequestsTotal.WithLabelValues(endpoint, "dropped").Inc()
+			span.SetAttributes(attribute.Bool("shadow.dropped", true))
+			handler(w, r)
+			return
+		}
+		span.SetAttributes(attribute.Bool("shadow.mirrored", true))
+		shadow := r.Clone(r.Context())
+		telemetry.Go(r.Context(), a.tracer, "Shadow "+r.Method+" "+endpoint, a.cfg.Timeouts[dependencyShadow], func(ctx context.Context) {
+			defer func() { <-a.shadowSlots }()
+			a.mirror(ctx, endpoint, shadow, body)
+		})
+
+		handler(w, r)
+	}
+}
+
+// mirror sends the copy of a live request to the shadow target in a client span marked shadow=true
+func (a *App) mirror(ctx context.Context, endpoint string, live *http.Request, body []byte) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("shadow", true))
+	target := a.cfg.ShadowTarget + live.URL.RequestURI()
+	ctx, span := a.tracer.Start(ctx, live.Method+" shadow",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(telemetry.PeerAttributes("shadow", target)...),
+		trace.WithAttributes(attribute.Bool("shadow", true)),
+	)
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, live.Method, target, bytes.NewReader(body))
+	if err != nil {
+		a.metrics.shadowRequestsTotal.WithLabelValues(endpoint, "error").Inc()
+		return
+	}
+	req.Header = live.Header.Clone()
+	req.Header.Set(shadowHeader, "true")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	start := a.clock.Now()
+	res, err := a.httpClient.Do(req)
+	telemetry.FinishClientSpan(req, res, err)
+	a.metrics.shadowRequestDuration.WithLabelValues(endpoint).Observe(clock.Since(a.clock, start).Seconds())
+	if err != nil {
+		a.metrics.shadowRequestsTotal.WithLabelValues(endpoint, "error").Inc()
+		return
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	a.metrics.shadowRequestsTotal.WithLabelValues(endpoint, telemetry.StatusClass(res.StatusCode)).Inc()
+}
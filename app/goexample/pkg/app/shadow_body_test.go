@@ -0,0 +1,54 @@
+package app
+
+import (
+	"bytes"
+	"goexample/pkg/kafkapkg"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// discardClient answers every request with 204
+type discardClient struct{}
+
+func (discardClient) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusNoContent, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func TestShadowKeepsTheLiveBody(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	cfg := DefaultConfig()
+	cfg.ShadowTarget = "http://shadow:8080"
+	cfg.ShadowPercent = 100
+	a, err := New(cfg, Deps{
+		Logger:         logger,
+		TracerProvider: noop.NewTracerProvider(),
+		HelloWriter:    kafkapkg.NewMemoryWriter(HelloTopic),
+		OrderWriter:    kafkapkg.NewMemoryWriter(OrdersTopic),
+		HTTPClient:     discardClient{},
+		Registry:       prometheus.NewRegistry(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(a.Close)
+
+	for _, size := range []int{16, maxShadowBodySize, maxShadowBodySize + 1024} {
+		sent := bytes.Repeat([]byte("x"), size)
+		var received []byte
+		handler := a.shadowMiddleware("/echo", func(w http.ResponseWriter, r *http.Request) {
+			received, _ = io.ReadAll(r.Body)
+		})
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/echo", bytes.NewReader(sent)))
+		if len(received) != size {
+			t.Errorf("handler read %d bytes of a %d byte body", len(received), size)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package app_test
+
+import (
+	"goexample/pkg/app"
+	"goexample/pkg/kafkapkg"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingClient answers every request with 204 and reports them on requests
+type recordingClient struct {
+	requests chan *http.Request
+}
+
+func (c recordingClient) Do(req *http.Request) (*http.Response, error) {
+	c.requests <- req
+	return &http.Response{StatusCode: http.StatusNoContent, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func TestShadowUsesTheHTTPClientOfTheApp(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	cfg := app.DefaultConfig()
+	cfg.ErrorRate = 0
+	cfg.ShadowTarget = "http://shadow:8080"
+	cfg.ShadowPercent = 100
+	httpClient := recordingClient{requests: make(chan *http.Request, 1)}
+	service, err := app.New(cfg, app.Deps{
+		Logger:         logger,
+		TracerProvider: noop.NewTracerProvider(),
+		HelloWriter:    kafkapkg.NewMemoryWriter(app.HelloTopic),
+		OrderWriter:    kafkapkg.NewMemoryWriter(app.OrdersTopic),
+		HTTPClient:     httpClient,
+		Registry:       prometheus.NewRegistry(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(service.Close)
+
+	service.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/headers", nil))
+
+	select {
+	case req := <-httpClient.requests:
+		if got := req.URL.String(); got != "http://shadow:8080/headers" {
+			t.Errorf("mirrored to %s, want http://shadow:8080/headers", got)
+		}
+		if req.Header.Get("X-Shadow-Request") != "true" {
+			t.Error("mirrored request not marked with X-Shadow-Request")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request not mirrored through the HTTP client of the App")
+	}
+}
@@ -0,0 +1,89 @@
+package app
+
+import (
+	"goexample/pkg/clock"
+	"goexample/pkg/telemetry"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sliMetrics are the metrics of the route SLIs
+type sliMetrics struct {
+	sliValidTotal *prometheus.CounterVec
+	sliGoodTotal  *prometheus.CounterVec
+}
+
+func newSLIMetrics() sliMetrics {
+	return sliMetrics{
+		sliValidTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "sli_valid_total",
+				Help: "Total number of requests counted by the endpoint's SLI",
+			},
+			[]string{"endpoint"},
+		),
+
+		sliGoodTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "sli_good_total",
+				Help: "Total number of valid requests meeting the endpoint's SLI, sli_good_total / sli_valid_total is the SLI",
+			},
+			[]string{"endpoint"},
+		),
+	}
+}
+
+// SLI declares what a good request of a route is
+type SLI struct {
+	// Status classes of good requests, e.g. "2xx"
+	Good []string
+	// Good requests also complete within Latency, 0 for no latency objective
+	Latency time.Duration
+	// Status classes left out of the SLI entirely, e.g. "4xx" so client errors do not burn the error budget
+	Ignore []string
+}
+
+// good reports whether a valid request with status and duration meets the SLI
+func (s SLI) good(status int, duration time.Duration) bool {
+	if !slices.Contains(s.Good, telemetry.StatusClass(status)) {
+		return false
+	}
+	return s.Latency == 0 || duration <= s.Latency
+}
+
+// registerSLI declares the SLI of endpoint, call it before the route is registered
+func (a *App) registerSLI(endpoint string, sli SLI) {
+	a.slis[endpoint] = sli
+	a.metrics.sliValidTotal.WithLabelValues(endpoint)
+	a.metrics.sliGoodTotal.WithLabelValues(endpoint)
+}
+
+// sliMiddleware counts the requests of endpoint against its SLI, endpoints without one are not counted
+func (a *App) sliMiddleware(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	sli, ok := a.slis[endpoint]
+	if !ok {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := a.clock.Now()
+		rw := newResponseWriter(w)
+		handler(rw, r)
+		duration := clock.Since(a.clock, start)
+
+		if slices.Contains(sli.Ignore, telemetry.StatusClass(rw.statusCode)) {
+			return
+		}
+		good := sli.good(rw.statusCode, duration)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.Bool("sli.good", good))
+		a.metrics.sliValidTotal.WithLabelValues(endpoint).Inc()
+		if good {
+			a.metrics.sliGoodTotal.WithLabelValues(endpoint).Inc()
+		}
+	}
+}
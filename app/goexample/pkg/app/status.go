@@ -0,0 +1,127 @@
+package app
+
+import (
+	"bytes"
+	"embed"
+	"goexample/pkg/chaos"
+	"goexample/pkg/clock"
+	"goexample/pkg/errfmt"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Number of requests listed on the status page
+const recentRequestsSize = 20
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+// templateMetrics are the metrics of the HTML pages
+type templateMetrics struct {
+	templateRenderDuration *prometheus.HistogramVec
+}
+
+func newTemplateMetrics() templateMetrics {
+	return templateMetrics{
+		templateRenderDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "html_template_render_duration_seconds",
+				Help:    "Duration of rendering HTML templates",
+				Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1},
+			},
+			[]string{"template", "result"},
+		),
+	}
+}
+
+// requestRecord is a completed request shown on the status page
+type requestRecord struct {
+	Time     time.Time
+	Method   string
+	Route    string
+	Status   int
+	Duration time.Duration
+	TraceID  string
+}
+
+// recentRequests keeps the last recentRequestsSize requests
+type recentRequests struct {
+	mu      sync.Mutex
+	records []requestRecord
+	next    int
+}
+
+func (r *recentRequests) add(rec requestRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.records) < recentRequestsSize {
+		r.records = append(r.records, rec)
+		return
+	}
+	r.records[r.next] = rec
+	r.next = (r.next + 1) % recentRequestsSize
+}
+
+// list returns the records, newest first
+func (r *recentRequests) list() []requestRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]requestRecord, 0, len(r.records))
+	for i := range r.records {
+		list = append(list, r.records[(r.next+len(r.records)-1-i)%len(r.records)])
+	}
+	return list
+}
+
+// statusPage is the data of templates/status.html
+type statusPage struct {
+	Variant          string
+	Now              time.Time
+	Chaos            chaos.Settings
+	ErrorRatePercent float64
+	Requests         []requestRecord
+}
+
+// status handles GET /, a server-side rendered page of recent requests and chaos settings
+func (a *App) status(w http.ResponseWriter, req *http.Request) {
+	settings := a.chaos.Current()
+	a.renderHTML(w, req, "status.html", statusPage{
+		Variant:          a.cfg.Deployment.Variant,
+		Now:              a.clock.Now(),
+		Chaos:            settings,
+		ErrorRatePercent: settings.ErrorRate * 100,
+		Requests:         a.recent.list(),
+	})
+}
+
+// renderHTML renders the template name in its own span, the page is only written once
+// rendering succeeded so a failing template results in a clean 500
+func (a *App) renderHTML(w http.ResponseWriter, req *http.Request, name string, data any) {
+	ctx, span := a.tracer.Start(req.Context(), "Render "+name)
+	defer span.End()
+	span.SetAttributes(attribute.String("template.name", name))
+
+	var buf bytes.Buffer
+	start := a.clock.Now()
+	err := templates.ExecuteTemplate(&buf, name, data)
+	elapsed := clock.Since(a.clock, start)
+	span.SetAttributes(attribute.Int("template.output_bytes", buf.Len()))
+
+	if err != nil {
+		a.metrics.templateRenderDuration.WithLabelValues(name, "error").Observe(elapsed.Seconds())
+		errfmt.Wrap(ctx, err, "Failed to render template", "template", name)
+		writeError(ctx, w, http.StatusInternalServerError, "failed to render page")
+		return
+	}
+	a.metrics.templateRenderDuration.WithLabelValues(name, "success").Observe(elapsed.Seconds())
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = buf.WriteTo(w)
+}
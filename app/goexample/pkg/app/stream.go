@@ -0,0 +1,118 @@
+package app
+
+import (
+	"fmt"
+	"goexample/pkg/clock"
+	"goexample/pkg/errfmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultStreamSeconds = 10
+	maxStreamSeconds     = 300
+)
+
+// sseMetrics are the metrics of the server-sent event streams
+type sseMetrics struct {
+	sseActiveStreams   prometheus.Gauge
+	sseEventsSentTotal prometheus.Counter
+	sseTimeToFirstByte prometheus.Histogram
+	sseFlushDuration   prometheus.Histogram
+}
+
+func newSSEMetrics() sseMetrics {
+	return sseMetrics{
+		sseActiveStreams: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "sse_active_streams",
+				Help: "Number of Server-Sent Events streams currently open",
+			},
+		),
+
+		sseEventsSentTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "sse_events_sent_total",
+				Help: "Total number of Server-Sent Events flushed to clients",
+			},
+		),
+
+		sseTimeToFirstByte: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "sse_time_to_first_byte_seconds",
+				Help:    "Time from request start until the first event was flushed",
+				Buckets: prometheus.DefBuckets,
+			},
+		),
+
+		sseFlushDuration: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "sse_flush_duration_seconds",
+				Help:    "Time spent flushing a single event to the client",
+				Buckets: []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+			},
+		),
+	}
+}
+
+// stream sends one Server-Sent Event per second for ?seconds=N seconds
+func (a *App) stream(w http.ResponseWriter, req *http.Request) {
+	start := a.clock.Now()
+	ctx, span := a.tracer.Start(req.Context(), "Start stream handler")
+	defer span.End()
+
+	seconds := defaultStreamSeconds
+	if value := req.URL.Query().Get("seconds"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxStreamSeconds {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "seconds must be between 1 and %d\n", maxStreamSeconds)
+			return
+		}
+		seconds = n
+	}
+	span.SetAttributes(attribute.Int("sse.seconds", seconds))
+
+	a.metrics.sseActiveStreams.Inc()
+	defer a.metrics.sseActiveStreams.Dec()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	rc := http.NewResponseController(w)
+
+	ticker := a.clock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for i := 0; i < seconds; i++ {
+		fmt.Fprintf(w, "id: %d\nevent: tick\ndata: %s\n\n", i, a.clock.Now().Format(time.RFC3339Nano))
+
+		flushStart := a.clock.Now()
+		if err := rc.Flush(); err != nil {
+			errfmt.Wrap(ctx, err, "Failed to flush event stream")
+			return
+		}
+		a.metrics.sseFlushDuration.Observe(clock.Since(a.clock, flushStart).Seconds())
+		a.metrics.sseEventsSentTotal.Inc()
+		if i == 0 {
+			a.metrics.sseTimeToFirstByte.Observe(clock.Since(a.clock, start).Seconds())
+		}
+		span.AddEvent("sse event sent", trace.WithAttributes(attribute.Int("sse.event_id", i)))
+
+		select {
+		case <-ctx.Done():
+			span.AddEvent("client disconnected", trace.WithAttributes(attribute.Int("sse.events_sent", i+1)))
+			a.logWithTrace(ctx).WithFields(logrus.Fields{
+				"events_sent": i + 1,
+			}).Info("Event stream closed by client")
+			return
+		case <-ticker.C():
+		}
+	}
+}
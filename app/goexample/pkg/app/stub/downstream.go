@@ -0,0 +1,111 @@
+// Package stub holds in-process stand-ins of the downstream services, used by the standalone mode
+// and the tests
+package stub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Transport serves requests in process with Handler instead of going over the network
+type Transport struct {
+	Handler http.Handler
+}
+
+// RoundTrip implements http.RoundTripper
+func (t Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := &recorder{header: make(http.Header)}
+	t.Handler.ServeHTTP(rec, req)
+	rec.WriteHeader(http.StatusOK)
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.status, http.StatusText(rec.status)),
+		StatusCode:    rec.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rec.header,
+		Body:          io.NopCloser(&rec.body),
+		ContentLength: int64(rec.body.Len()),
+		Request:       req,
+	}, nil
+}
+
+// recorder buffers the response of a stub handler
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+// WriteHeader keeps the first status like a real response
+func (r *recorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
+
+// NewDownstreamClient returns a client answering for goexample1 in process
+func NewDownstreamClient(httpTracer trace.Tracer) *http.Client {
+	return &http.Client{Transport: Transport{Handler: NewDownstream(httpTracer)}}
+}
+
+// NewDownstream mimics the goexample1 endpoints goexample calls
+func NewDownstream(httpTracer trace.Tracer) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /hello", stubHandler(httpTracer, func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "hello again\n")
+	}))
+	mux.HandleFunc("GET /virtual/{service}", stubHandler(httpTracer, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("POST /inventory/reserve", stubHandler(httpTracer, func(w http.ResponseWriter, req *http.Request) {
+		var o struct {
+			FailAt string `json:"fail_at"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&o); err != nil {
+			http.Error(w, "invalid order", http.StatusBadRequest)
+			return
+		}
+		if o.FailAt == "reserve" {
+			http.Error(w, "injected failure", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("POST /inventory/release", stubHandler(httpTracer, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return mux
+}
+
+// stubHandler wraps a stub endpoint with the server span goexample1 would create
+func stubHandler(httpTracer trace.Tracer, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := httpTracer.Start(ctx, "stub "+req.Method+" "+req.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.Bool("stub", true)),
+		)
+		defer span.End()
+
+		handler(w, req.WithContext(ctx))
+	}
+}
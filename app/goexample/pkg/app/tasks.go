@@ -0,0 +1,400 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"goexample/pkg/clock"
+	"goexample/pkg/errfmt"
+	"goexample/pkg/kafkapkg"
+	"goexample/pkg/telemetry"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Task states, a task is queued until its result arrives
+const (
+	taskQueued    = "queued"
+	taskSucceeded = "succeeded"
+	taskFailed    = "failed"
+)
+
+const (
+	// How long task results can be polled by default
+	defaultTaskResultTTL = 10 * time.Minute
+	// Tasks kept in the result store, the oldest are forgotten beyond
+	maxStoredTasks = 10000
+	// Longest simulated work of a task
+	maxTaskWork = 60 * time.Second
+)
+
+// Kinds of task the goexample1 worker knows
+var taskKinds = []string{"report", "export", "thumbnail"}
+
+// taskMetrics are the metrics of the asynchronous tasks
+type taskMetrics struct {
+	tasksTotal             *prometheus.CounterVec
+	tasksPending           prometheus.Gauge
+	taskCompletionDuration *prometheus.HistogramVec
+	taskPollsTotal         *prometheus.CounterVec
+}
+
+func newTaskMetrics() taskMetrics {
+	return taskMetrics{
+		tasksTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "tasks_total",
+				Help: "Total number of async tasks reaching each state: enqueued, enqueue_failed, succeeded, failed",
+			},
+			[]string{"kind", "state"},
+		),
+
+		tasksPending: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "tasks_pending",
+				Help: "Async tasks enqueued and still waiting for their result",
+			},
+		),
+
+		taskCompletionDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "task_completion_duration_seconds",
+				Help:    "Time from enqueueing an async task to its result being stored",
+				Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+			},
+			[]string{"kind", "status"},
+		),
+
+		taskPollsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "task_polls_total",
+				Help: "Total number of GET /tasks/{id} polls by the status found: queued, succeeded, failed or not_found",
+			},
+			[]string{"status"},
+		),
+	}
+}
+
+// task is the task event published to Kafka and processed by the goexample1 worker
+type task struct {
+	ID   string `json:"task_id"`
+	Kind string `json:"kind"`
+	// Simulated processing time in milliseconds
+	WorkMS int `json:"work_ms"`
+	// The worker fails the task on purpose
+	Fail bool `json:"fail,omitempty"`
+}
+
+func (t *task) Validate() error {
+	var v validation
+	v.required("kind", t.Kind)
+	v.oneOf("kind", t.Kind, taskKinds...)
+	v.between("work_ms", t.WorkMS, 0, int(maxTaskWork.Milliseconds()))
+	return v.err()
+}
+
+// taskResult is the result event the goexample1 worker publishes once a task is processed
+type taskResult struct {
+	ID     string `json:"task_id"`
+	Status string `json:"status"`
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// storedTask is a task and its result as far as known, the spans link it to the enqueue and result traces
+type storedTask struct {
+	task
+	Status      string     `json:"status"`
+	Output      string     `json:"output,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	EnqueuedAt  time.Time  `json:"enqueued_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Polls       int        `json:"polls"`
+
+	enqueued  trace.SpanContext
+	completed trace.SpanContext
+}
+
+// taskStore holds the tasks for polling until they are older than ttl or pushed out by newer ones
+type taskStore struct {
+	ttl     time.Duration
+	metrics *metrics
+
+	mu    sync.Mutex
+	tasks map[string]*storedTask
+	// Task IDs in enqueue order, for expiry
+	order []string
+}
+
+func newTaskStore(ttl time.Duration, m *metrics) *taskStore {
+	return &taskStore{ttl: ttl, metrics: m, tasks: make(map[string]*storedTask)}
+}
+
+// add stores a task being enqueued
+func (s *taskStore) add(t *storedTask) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(t.EnqueuedAt)
+	s.tasks[t.ID] = t
+	s.order = append(s.order, t.ID)
+	s.metrics.tasksPending.Inc()
+}
+
+// remove forgets a task which could not be enqueued
+func (s *taskStore) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tasks[id]; ok && t.Status == taskQueued {
+		s.metrics.tasksPending.Dec()
+	}
+	delete(s.tasks, id)
+}
+
+// expire drops the tasks enqueued before now-ttl and the oldest beyond maxStoredTasks
+func (s *taskStore) expire(now time.Time) {
+	for len(s.order) > 0 {
+		t, ok := s.tasks[s.order[0]]
+		if ok && now.Sub(t.EnqueuedAt) < s.ttl && len(s.order) < maxStoredTasks {
+			break
+		}
+		if ok {
+			if t.Status == taskQueued {
+				s.metrics.tasksPending.Dec()
+			}
+			delete(s.tasks, t.ID)
+		}
+		s.order = s.order[1:]
+	}
+}
+
+// completion is the outcome of storing a task result
+type completion int
+
+const (
+	completionStored completion = iota
+	// Expired, or enqueued by another instance
+	completionUnknown
+	// Kafka delivers at least once, a redelivered result keeps the first one
+	completionDuplicate
+)
+
+// complete records the first result of a task, returning a copy of the task
+func (s *taskStore) complete(r taskResult, at time.Time, span trace.SpanContext) (storedTask, completion) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[r.ID]
+	if !ok {
+		return storedTask{}, completionUnknown
+	}
+	if t.Status != taskQueued {
+		return *t, completionDuplicate
+	}
+	s.metrics.tasksPending.Dec()
+	t.Status, t.Output, t.Error = r.Status, r.Output, r.Error
+	t.CompletedAt = &at
+	t.completed = span
+	return *t, completionStored
+}
+
+// poll returns a copy of the task with its poll counted
+func (s *taskStore) poll(id string) (storedTask, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[id]
+	if !ok {
+		return storedTask{}, false
+	}
+	t.Polls++
+	return *t, true
+}
+
+// enqueueTask handles POST /tasks: publish the task for the goexample1 worker and answer 202 with
+// its ID right away. The result is polled with GET /tasks/{id}.
+func (a *App) enqueueTask(w http.ResponseWriter, req *http.Request) {
+	t := task{Kind: "report", WorkMS: 200}
+	if err := decodeJSON(req, &t); err != nil {
+		a.writeValidationError(req.Context(), w, req, err)
+		return
+	}
+	if err := t.Validate(); err != nil {
+		a.writeValidationError(req.Context(), w, req, err)
+		return
+	}
+	t.ID = uuid.NewString()
+
+	ctx, span := a.tracer.Start(req.Context(), "Enqueue task")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("task.id", t.ID),
+		attribute.String("task.kind", t.Kind),
+	)
+
+	if err := a.publishTask(ctx, t); err != nil {
+		a.tasks.remove(t.ID)
+		a.metrics.tasksTotal.WithLabelValues(t.Kind, "enqueue_failed").Inc()
+		errfmt.Wrap(ctx, err, "Failed to enqueue task", "task_id", t.ID)
+		writeError(ctx, w, http.StatusInternalServerError, "failed to enqueue task")
+		return
+	}
+	a.metrics.tasksTotal.WithLabelValues(t.Kind, "enqueued").Inc()
+
+	a.logWithTrace(ctx).WithFields(logrus.Fields{
+		"task_id": t.ID,
+		"kind":    t.Kind,
+	}).Info("Task enqueued")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/tasks/"+t.ID)
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]string{"task_id": t.ID, "status": taskQueued})
+}
+
+// publishTask stores the task and writes its event to Kafka in a producer span, the worker and the
+// polls link to it
+func (a *App) publishTask(ctx context.Context, t task) error {
+	ctx, span := a.kafkaTracer.Start(ctx, "Publishing task to kafka",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(telemetry.KafkaAttributes(a.kafkaEndpoint(TasksTopic), TasksTopic)...),
+		trace.WithAttributes(attribute.String("task.id", t.ID)),
+	)
+	defer span.End()
+	// Stored first, a fast worker may answer before the write returns
+	a.tasks.add(&storedTask{task: t, Status: taskQueued, EnqueuedAt: a.clock.Now(), enqueued: span.SpanContext()})
+
+	value, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	headers := make([]kafka.Header, 0, len(carrier)+1)
+	for key, value := range carrier {
+		headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+	headers = append(headers, kafka.Header{Key: kafkapkg.MessageIDHeader, Value: []byte(t.ID)})
+
+	start := a.clock.Now()
+	writeCtx, cancel := a.kafkaWriteContext(ctx)
+	defer cancel()
+	err = a.taskWriter.WriteMessages(writeCtx, kafka.Message{
+		Key:     []byte(t.ID),
+		Value:   value,
+		Headers: headers,
+	})
+	a.observeKafkaWrite(ctx, TasksTopic, err)
+	telemetry.Canonical(ctx).AddDuration("kafka_publish", clock.Since(a.clock, start))
+	if err != nil {
+		telemetry.Canonical(ctx).Inc("kafka_publish_errors")
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+// pollTask handles GET /tasks/{id}: the task with its result once the worker answered, 404 for
+// unknown or expired tasks. The poll span links to the enqueue and result spans of the task.
+func (a *App) pollTask(w http.ResponseWriter, req *http.Request) {
+	id := req.PathValue("id")
+	t, ok := a.tasks.poll(id)
+	if !ok {
+		a.metrics.taskPollsTotal.WithLabelValues("not_found").Inc()
+		writeError(req.Context(), w, http.StatusNotFound, "unknown task")
+		return
+	}
+	a.metrics.taskPollsTotal.WithLabelValues(t.Status).Inc()
+
+	links := []trace.Link{{SpanContext: t.enqueued, Attributes: []attribute.KeyValue{attribute.String("task.link", "enqueue")}}}
+	if t.completed.IsValid() {
+		links = append(links, trace.Link{SpanContext: t.completed, Attributes: []attribute.KeyValue{attribute.String("task.link", "result")}})
+	}
+	ctx, span := a.tracer.Start(req.Context(), "Poll task", trace.WithLinks(links...))
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("task.id", t.ID),
+		attribute.String("task.kind", t.Kind),
+		attribute.String("task.status", t.Status),
+		attribute.Int("task.polls", t.Polls),
+		attribute.Int64("task.age_ms", a.clock.Now().Sub(t.EnqueuedAt).Milliseconds()),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	if t.Status == taskQueued {
+		w.Header().Set("Retry-After", "1")
+	}
+	if err := json.NewEncoder(w).Encode(t); err != nil {
+		errfmt.Wrap(ctx, err, "Failed to encode task", "task_id", t.ID)
+	}
+}
+
+// consumeTaskResults stores the results published by the goexample1 worker until ctx is done
+func (a *App) consumeTaskResults(ctx context.Context, reader kafkapkg.Reader) {
+	for {
+		m, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				a.logger.WithField("error", err).Error("Stopped reading task results")
+			}
+			return
+		}
+		a.storeTaskResult(m)
+	}
+}
+
+// storeTaskResult records a result in a consumer span continuing the worker's trace and linked
+// to the enqueue span of the task
+func (a *App) storeTaskResult(m kafka.Message) {
+	carrier := propagation.MapCarrier{}
+	for _, header := range m.Headers {
+		carrier[header.Key] = string(header.Value)
+	}
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+	ctx, span := a.kafkaTracer.Start(ctx, "Store task result",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(telemetry.KafkaAttributes(a.kafkaEndpoint(TaskResultsTopic), TaskResultsTopic)...),
+	)
+	defer span.End()
+
+	var r taskResult
+	if err := json.Unmarshal(m.Value, &r); err != nil {
+		errfmt.Wrap(ctx, err, "Failed to decode task result", "offset", m.Offset)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("task.id", r.ID),
+		attribute.String("task.status", r.Status),
+	)
+	if r.Status != taskSucceeded && r.Status != taskFailed {
+		errfmt.Wrap(ctx, errors.New("invalid task status "+r.Status), "Failed to store task result", "task_id", r.ID)
+		return
+	}
+
+	t, result := a.tasks.complete(r, a.clock.Now(), span.SpanContext())
+	switch result {
+	case completionUnknown:
+		span.SetAttributes(attribute.Bool("task.unknown", true))
+		return
+	case completionDuplicate:
+		span.SetAttributes(attribute.Bool("messaging.message.duplicate", true))
+		return
+	}
+	span.AddLink(trace.Link{SpanContext: t.enqueued, Attributes: []attribute.KeyValue{attribute.String("task.link", "enqueue")}})
+	a.metrics.tasksTotal.WithLabelValues(t.Kind, r.Status).Inc()
+	a.metrics.taskCompletionDuration.WithLabelValues(t.Kind, r.Status).Observe(t.CompletedAt.Sub(t.EnqueuedAt).Seconds())
+
+	a.logWithTrace(ctx).WithFields(logrus.Fields{
+		"task_id": t.ID,
+		"kind":    t.Kind,
+		"status":  r.Status,
+	}).Info("Task result stored")
+}
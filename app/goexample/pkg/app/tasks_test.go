@@ -0,0 +1,35 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTaskStoreCompleteIsIdempotent(t *testing.T) {
+	m := newMetrics()
+	s := newTaskStore(time.Hour, m)
+	enqueued := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.add(&storedTask{task: task{ID: "1"}, Status: taskQueued, EnqueuedAt: enqueued})
+
+	first := enqueued.Add(time.Second)
+	if _, got := s.complete(taskResult{ID: "1", Status: taskSucceeded, Output: "done"}, first, trace.SpanContext{}); got != completionStored {
+		t.Fatalf("complete() = %v, want completionStored", got)
+	}
+	stored, got := s.complete(taskResult{ID: "1", Status: taskFailed}, first.Add(time.Second), trace.SpanContext{})
+	if got != completionDuplicate {
+		t.Errorf("complete() of a redelivered result = %v, want completionDuplicate", got)
+	}
+	if stored.Status != taskSucceeded || !stored.CompletedAt.Equal(first) {
+		t.Errorf("task %s at %s after the redelivery, want the first result", stored.Status, stored.CompletedAt)
+	}
+	if pending := testutil.ToFloat64(m.tasksPending); pending != 0 {
+		t.Errorf("tasks pending = %v, want 0", pending)
+	}
+
+	if _, got := s.complete(taskResult{ID: "2", Status: taskSucceeded}, first, trace.SpanContext{}); got != completionUnknown {
+		t.Errorf("complete() of an unknown task = %v, want completionUnknown", got)
+	}
+}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"encoding/json"
+	"goexample/pkg/dependency"
+	"net/http"
+	"time"
+)
+
+// Dependencies with a timeout, the keys of DEPENDENCY_TIMEOUTS
+const (
+	dependencyGoexample1 = "goexample1"
+	dependencyKafkaWrite = "kafka_write"
+	dependencyShadow     = "shadow"
+)
+
+// Timeouts used for the dependencies DEPENDENCY_TIMEOUTS leaves out
+func defaultDependencyTimeouts() dependency.Timeouts {
+	return dependency.Timeouts{
+		dependencyGoexample1: 2 * time.Second,
+		dependencyKafkaWrite: 5 * time.Second,
+		dependencyShadow:     2 * time.Second,
+	}
+}
+
+// getConfig handles GET /admin/config, the effective settings of the service
+func (a *App) getConfig(w http.ResponseWriter, _ *http.Request) {
+	retries := make(map[string]string, len(a.cfg.KafkaRetryPolicies))
+	for reason, policy := range a.cfg.KafkaRetryPolicies {
+		retries[reason] = policy.String()
+	}
+	config := map[string]any{
+		"dependency_timeouts":  a.cfg.Timeouts.Strings(),
+		"kafka_retry_policies": retries,
+		"downstream_retry":     a.cfg.DownstreamRetry.String(),
+		"downstream_proxy":     a.cfg.DownstreamProxy.String(),
+		"cold_start_requests":  a.cfg.ColdStartRequests,
+		"adaptive_concurrency": a.cfg.AdaptiveLimit.String(),
+		"kafka_cloudevents":    a.cfg.OrderEventMode,
+		"object_store":         "disabled",
+	}
+	if a.objects != nil {
+		config["object_store"] = a.objects.Endpoint() + "/" + a.objects.Bucket()
+	}
+	if a.cfg.KafkaClusters != nil {
+		config["kafka_clusters"] = a.cfg.KafkaClusters.Endpoints()
+		config["kafka_topic_clusters"] = a.cfg.KafkaClusters.Routes()
+		config["kafka_security"] = a.cfg.KafkaClusters.Security()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(config)
+}
+
+// kafkaEndpoint returns the brokers of the cluster of topic, recorded on producer and consumer spans
+func (a *App) kafkaEndpoint(topic string) string {
+	if a.cfg.KafkaClusters == nil {
+		return ""
+	}
+	return a.cfg.KafkaClusters.ForTopic(topic).Endpoint()
+}
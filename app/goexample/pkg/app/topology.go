@@ -0,0 +1,17 @@
+package app
+
+import (
+	"context"
+	"math/rand"
+)
+
+// Virtual services served by goexample1 under /virtual/{service}
+var virtualServices = []string{"inventory", "pricing", "shipping"}
+
+// callVirtualService calls a randomly picked virtual service, its client span names the
+// virtual service as peer so the service graph gets an edge to it
+func (a *App) callVirtualService(ctx context.Context) error {
+	name := virtualServices[rand.Intn(len(virtualServices))]
+	defer a.timeDownstream(ctx, name)()
+	return a.goexample1.Virtual(ctx, name)
+}
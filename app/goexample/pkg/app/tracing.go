@@ -0,0 +1,40 @@
+package app
+
+import (
+	"goexample/pkg/server"
+	"goexample/pkg/telemetry"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceMiddleware wraps an HTTP handler with a server span covering the whole request,
+// continuing the caller's trace when it sent a traceparent header
+func (a *App) traceMiddleware(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parentCtx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := a.httpTracer.Start(parentCtx, r.Method+" "+endpoint,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", endpoint),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("network.protocol.name", "http"),
+				attribute.String("network.protocol.version", server.ProtocolVersion(r)),
+			),
+		)
+		defer span.End()
+		// Server saturation shows up here rather than in the handler's spans
+		if queued, ok := server.QueueTime(r.Context()); ok {
+			span.SetAttributes(attribute.Float64("http.server.queue_time_ms", float64(queued.Microseconds())/1000))
+		}
+
+		rw := newResponseWriter(w)
+		handler(rw, r.WithContext(ctx))
+
+		telemetry.SetHTTPStatus(span, rw.statusCode, trace.SpanKindServer)
+	}
+}
@@ -0,0 +1,276 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"goexample/pkg/clock"
+	"goexample/pkg/telemetry"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// Largest body accepted by POST /upload by default
+	defaultUploadMaxBytes = 1 << 30
+	// Bytes read from the body at once
+	uploadChunkSize = 32 << 10
+	// Progress span events are added every 10% of the declared size, or every 16MB without one
+	uploadProgressSteps    = 10
+	uploadProgressInterval = 16 << 20
+)
+
+// uploadMetrics are the metrics of POST /upload
+type uploadMetrics struct {
+	uploadsTotal        *prometheus.CounterVec
+	uploadBytesTotal    prometheus.Counter
+	uploadSize          prometheus.Histogram
+	uploadThroughput    prometheus.Histogram
+	uploadReceivedBytes prometheus.Gauge
+	uploadExpectedBytes prometheus.Gauge
+}
+
+func newUploadMetrics() uploadMetrics {
+	return uploadMetrics{
+		uploadsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "uploads_total",
+				Help: "Total number of uploads, result is success, too_large, interrupted or store_failed",
+			},
+			[]string{"result"},
+		),
+
+		uploadBytesTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "upload_bytes_total",
+				Help: "Total number of bytes received by POST /upload, its rate is the upload throughput",
+			},
+		),
+
+		uploadSize: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "upload_size_bytes",
+				Help:    "Size of the completed uploads",
+				Buckets: prometheus.ExponentialBuckets(1024, 4, 11), // 1KB to 1GB
+			},
+		),
+
+		uploadThroughput: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "upload_throughput_bytes_per_second",
+				Help:    "Throughput of the completed uploads, from the first to the last byte stored",
+				Buckets: prometheus.ExponentialBuckets(64<<10, 2, 12), // 64KB/s to 128MB/s
+			},
+		),
+
+		uploadReceivedBytes: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "upload_in_flight_received_bytes",
+				Help: "Bytes received so far by the uploads in progress",
+			},
+		),
+
+		uploadExpectedBytes: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "upload_in_flight_expected_bytes",
+				Help: "Declared Content-Length of the uploads in progress, received over expected is their progress",
+			},
+		),
+	}
+}
+
+// uploadResponse is the answer of POST /upload
+type uploadResponse struct {
+	Bytes          int64   `json:"bytes"`
+	SHA256         string  `json:"sha256"`
+	DurationMS     int64   `json:"duration_ms"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	StoredWithStub bool    `json:"stored_with_stub"`
+	// Key of the object in the object storage, empty without one
+	Key string `json:"key,omitempty"`
+}
+
+// throttledStore is an object storage stub accepting writes at a fixed bandwidth, so uploads take
+// as long as they would against a bucket
+type throttledStore struct {
+	clock          clock.Clock
+	bytesPerSecond int64
+}
+
+func (s throttledStore) Write(p []byte) (int, error) {
+	s.clock.Sleep(time.Duration(float64(len(p)) / float64(s.bytesPerSecond) * float64(time.Second)))
+	return len(p), nil
+}
+
+// objectUpload streams an upload to the object storage while the body is read
+type objectUpload struct {
+	pipe *io.PipeWriter
+	done chan error
+}
+
+// startObjectUpload starts the PutObject of key reading from the returned upload as it is written to
+func (a *App) startObjectUpload(ctx context.Context, key string, size int64, contentType string) objectUpload {
+	pr, pw := io.Pipe()
+	u := objectUpload{pipe: pw, done: make(chan error, 1)}
+	go func() {
+		_, err := a.objects.Put(ctx, key, pr, size, contentType)
+		// Unblocks the writer when the storage gives up early
+		pr.CloseWithError(err)
+		u.done <- err
+	}()
+	return u
+}
+
+// finish ends the body of the object, aborting it with err, and waits for the storage to store it
+func (u objectUpload) finish(err error) error {
+	_ = u.pipe.CloseWithError(err)
+	return <-u.done
+}
+
+// upload streams the request body to the object storage, or to the upload store stub without one,
+// while hashing it, the body is never held in memory. Progress is exported while the upload runs and
+// added as span events.
+func (a *App) upload(w http.ResponseWriter, req *http.Request) {
+	ctx, span := a.tracer.Start(req.Context(), "Store upload")
+	defer span.End()
+
+	expected := req.ContentLength
+	stub := a.objects == nil && a.cfg.UploadStoreBandwidth > 0
+	span.SetAttributes(
+		attribute.Int64("upload.expected_bytes", expected),
+		attribute.Bool("upload.stub_store", stub),
+	)
+	if expected > a.cfg.UploadMaxBytes {
+		a.metrics.uploadsTotal.WithLabelValues("too_large").Inc()
+		span.SetStatus(codes.Error, "upload too large")
+		writeError(ctx, w, http.StatusRequestEntityTooLarge, "upload is larger than the limit of the service")
+		return
+	}
+	if expected > 0 {
+		a.metrics.uploadExpectedBytes.Add(float64(expected))
+		defer a.metrics.uploadExpectedBytes.Sub(float64(expected))
+	}
+
+	var store io.Writer = io.Discard
+	if stub {
+		store = throttledStore{clock: a.clock, bytesPerSecond: a.cfg.UploadStoreBandwidth}
+	}
+	var object objectUpload
+	key := ""
+	if a.objects != nil {
+		key = "uploads/" + uuid.NewString()
+		size := expected
+		if size <= 0 {
+			size = -1
+		}
+		object = a.startObjectUpload(ctx, key, size, req.Header.Get("Content-Type"))
+		store = object.pipe
+		span.SetAttributes(attribute.String("upload.key", key))
+	}
+
+	body := http.MaxBytesReader(w, req.Body, a.cfg.UploadMaxBytes)
+	hash := sha256.New()
+	out := io.MultiWriter(hash, store)
+	buf := make([]byte, uploadChunkSize)
+	progressEvery := int64(uploadProgressInterval)
+	if expected > 0 {
+		progressEvery = max(expected/uploadProgressSteps, 1)
+	}
+
+	start := a.clock.Now()
+	var received int64
+	nextProgress := progressEvery
+	defer func() { a.metrics.uploadReceivedBytes.Sub(float64(received)) }()
+	var err error
+	for {
+		var n int
+		n, err = body.Read(buf)
+		if n > 0 {
+			_, _ = out.Write(buf[:n])
+			received += int64(n)
+			a.metrics.uploadBytesTotal.Add(float64(n))
+			a.metrics.uploadReceivedBytes.Add(float64(n))
+			if received >= nextProgress {
+				nextProgress += progressEvery
+				attrs := []attribute.KeyValue{attribute.Int64("upload.received_bytes", received)}
+				if expected > 0 {
+					attrs = append(attrs, attribute.Int64("upload.progress_percent", received*100/expected))
+				}
+				span.AddEvent("upload.progress", trace.WithAttributes(attrs...))
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	// The upload is complete once the object storage has it
+	if a.objects != nil {
+		if storeErr := object.finish(err); err == nil && storeErr != nil {
+			a.metrics.uploadsTotal.WithLabelValues("store_failed").Inc()
+			span.RecordError(storeErr)
+			span.SetStatus(codes.Error, storeErr.Error())
+			telemetry.WithTrace(a.logger, ctx).WithFields(logrus.Fields{
+				"key":            key,
+				"received_bytes": received,
+				"error":          storeErr,
+			}).Error("Failed to store upload")
+			writeError(ctx, w, http.StatusBadGateway, "failed to store upload")
+			return
+		}
+	}
+	elapsed := clock.Since(a.clock, start)
+	span.SetAttributes(attribute.Int64("upload.received_bytes", received))
+
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		status, result := http.StatusBadRequest, "interrupted"
+		if errors.As(err, &tooLarge) {
+			status, result = http.StatusRequestEntityTooLarge, "too_large"
+		}
+		a.metrics.uploadsTotal.WithLabelValues(result).Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		telemetry.WithTrace(a.logger, ctx).WithFields(logrus.Fields{
+			"received_bytes": received,
+			"expected_bytes": expected,
+			"error":          err,
+		}).Warn("Upload failed")
+		writeError(ctx, w, status, "upload failed: "+err.Error())
+		return
+	}
+
+	resp := uploadResponse{
+		Bytes:          received,
+		SHA256:         hex.EncodeToString(hash.Sum(nil)),
+		DurationMS:     elapsed.Milliseconds(),
+		StoredWithStub: stub,
+		Key:            key,
+	}
+	if elapsed > 0 {
+		resp.BytesPerSecond = float64(received) / elapsed.Seconds()
+		a.metrics.uploadThroughput.Observe(resp.BytesPerSecond)
+	}
+	a.metrics.uploadsTotal.WithLabelValues("success").Inc()
+	a.metrics.uploadSize.Observe(float64(received))
+	span.SetAttributes(
+		attribute.String("upload.sha256", resp.SHA256),
+		attribute.Float64("upload.bytes_per_second", resp.BytesPerSecond),
+	)
+	telemetry.Canonical(ctx).Set("upload_bytes", received)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
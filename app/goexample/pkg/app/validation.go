@@ -0,0 +1,179 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goexample/pkg/telemetry"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Validation rules, the rule label of validation_failures_total
+const (
+	ruleJSON     = "json"
+	ruleType     = "type"
+	ruleRequired = "required"
+	ruleMin      = "min"
+	ruleMax      = "max"
+	ruleOneOf    = "oneof"
+	ruleUnique   = "unique"
+	// Errors other than *ValidationError, reported as an invalid body
+	ruleInvalid = "invalid"
+)
+
+// Field of failures concerning the request body as a whole
+const bodyField = "body"
+
+// validationMetrics are the metrics of the request validation
+type validationMetrics struct {
+	validationFailuresTotal *prometheus.CounterVec
+}
+
+func newValidationMetrics() validationMetrics {
+	return validationMetrics{
+		validationFailuresTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "validation_failures_total",
+				Help: "Total number of request fields rejected by validation, by field and failed rule",
+			},
+			[]string{"field", "rule"},
+		),
+	}
+}
+
+// FieldError is a request field failing a validation rule
+type FieldError struct {
+	Field  string `json:"name"`
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError lists the fields of a request failing validation, it is answered with
+// 400 and a problem+json body
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	reasons := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		reasons = append(reasons, f.Field+": "+f.Reason)
+	}
+	return "invalid request: " + strings.Join(reasons, ", ")
+}
+
+// validation collects the failures of the checks of one request
+type validation struct {
+	fields []FieldError
+}
+
+func (v *validation) fail(field, rule, reason string) {
+	v.fields = append(v.fields, FieldError{Field: field, Rule: rule, Reason: reason})
+}
+
+func (v *validation) required(field, value string) {
+	if value == "" {
+		v.fail(field, ruleRequired, "must be set")
+	}
+}
+
+func (v *validation) between(field string, value, lo, hi int) {
+	switch {
+	case value < lo:
+		v.fail(field, ruleMin, fmt.Sprintf("must be at least %d", lo))
+	case value > hi:
+		v.fail(field, ruleMax, fmt.Sprintf("must be at most %d", hi))
+	}
+}
+
+// oneOf accepts an empty value, combine with required otherwise
+func (v *validation) oneOf(field, value string, allowed ...string) {
+	if value != "" && !slices.Contains(allowed, value) {
+		v.fail(field, ruleOneOf, "must be one of "+strings.Join(allowed, ", "))
+	}
+}
+
+// err returns a *ValidationError when a check failed
+func (v *validation) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.fields}
+}
+
+// decodeJSON decodes the request body into dst, an empty body leaves dst unchanged. Malformed
+// JSON and values of the wrong type are returned as a *ValidationError.
+func decodeJSON(req *http.Request, dst any) error {
+	if req.ContentLength == 0 {
+		return nil
+	}
+	err := json.NewDecoder(req.Body).Decode(dst)
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	var v validation
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		v.fail(typeErr.Field, ruleType, "must be of type "+typeErr.Type.String())
+	} else {
+		v.fail(bodyField, ruleJSON, "must be a valid JSON object")
+	}
+	return v.err()
+}
+
+// problem is an RFC 9457 problem details body
+type problem struct {
+	Type          string       `json:"type"`
+	Title         string       `json:"title"`
+	Status        int          `json:"status"`
+	Detail        string       `json:"detail,omitempty"`
+	Instance      string       `json:"instance,omitempty"`
+	InvalidParams []FieldError `json:"invalid_params,omitempty"`
+	TraceID       string       `json:"trace_id,omitempty"`
+}
+
+// writeValidationError answers a request failing validation with 400 and a problem+json body.
+// The failures are counted and recorded on the span as client errors, the span status stays unset.
+// Errors other than *ValidationError are reported as an invalid body.
+func (a *App) writeValidationError(ctx context.Context, w http.ResponseWriter, req *http.Request, err error) {
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		verr = &ValidationError{Fields: []FieldError{{Field: bodyField, Rule: ruleInvalid, Reason: err.Error()}}}
+	}
+
+	span := trace.SpanFromContext(ctx)
+	for _, f := range verr.Fields {
+		a.metrics.validationFailuresTotal.WithLabelValues(f.Field, f.Rule).Inc()
+		span.AddEvent("validation_failure", trace.WithAttributes(
+			attribute.String("validation.field", f.Field),
+			attribute.String("validation.rule", f.Rule),
+		))
+	}
+	span.SetAttributes(attribute.Int("validation.failures", len(verr.Fields)))
+	telemetry.Canonical(ctx).Set("validation_failures", len(verr.Fields))
+
+	body := problem{
+		Type:          "about:blank",
+		Title:         "Request validation failed",
+		Status:        http.StatusBadRequest,
+		Detail:        verr.Error(),
+		Instance:      req.URL.Path,
+		InvalidParams: verr.Fields,
+	}
+	if sc := span.SpanContext(); sc.IsValid() {
+		body.TraceID = sc.TraceID().String()
+		w.Header().Set(traceIDHeader, body.TraceID)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(body)
+}
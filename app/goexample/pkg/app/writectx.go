@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// kafkaWriteMetrics are the metrics of the Kafka writes of the request path
+type kafkaWriteMetrics struct {
+	kafkaWritesAbortedTotal         *prometheus.CounterVec
+	kafkaWritesOutlivedRequestTotal *prometheus.CounterVec
+}
+
+func newKafkaWriteMetrics() kafkaWriteMetrics {
+	return kafkaWriteMetrics{
+		kafkaWritesAbortedTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kafka_writes_aborted_total",
+				Help: "Total number of request path Kafka writes aborted by their context, cause is client_disconnect or deadline",
+			},
+			[]string{"topic", "cause"},
+		),
+
+		kafkaWritesOutlivedRequestTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kafka_writes_outlived_request_total",
+				Help: "Total number of detached Kafka writes that completed after the client disconnected",
+			},
+			[]string{"topic"},
+		),
+	}
+}
+
+// kafkaWriteContext returns the context of a Kafka write in the request path, bounded by the
+// kafka_write timeout. By default it derives from the request context, so a client disconnect
+// cancels the write half way. With KafkaWriteDetached the write keeps the trace but not the
+// cancellation of the request.
+func (a *App) kafkaWriteContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := a.cfg.Timeouts[dependencyKafkaWrite]
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int64("messaging.write.timeout_ms", timeout.Milliseconds()))
+	if !a.cfg.KafkaWriteDetached {
+		span.SetAttributes(attribute.String("messaging.write.context", "request"))
+		return context.WithTimeout(ctx, timeout)
+	}
+	span.SetAttributes(attribute.String("messaging.write.context", "detached"))
+	return context.WithTimeout(context.WithoutCancel(ctx), timeout)
+}
+
+// observeKafkaWrite counts writes aborted by their context and detached writes outliving
+// the request, reqCtx is the request context and err the result of the write
+func (a *App) observeKafkaWrite(reqCtx context.Context, topic string, err error) {
+	span := trace.SpanFromContext(reqCtx)
+	switch {
+	case errors.Is(err, context.Canceled):
+		a.metrics.kafkaWritesAbortedTotal.WithLabelValues(topic, "client_disconnect").Inc()
+		span.AddEvent("kafka write aborted by client disconnect")
+	case errors.Is(err, context.DeadlineExceeded):
+		a.metrics.kafkaWritesAbortedTotal.WithLabelValues(topic, "deadline").Inc()
+		span.AddEvent("kafka write aborted by deadline")
+	case err == nil && errors.Is(reqCtx.Err(), context.Canceled):
+		a.metrics.kafkaWritesOutlivedRequestTotal.WithLabelValues(topic).Inc()
+		span.AddEvent("kafka write completed after client disconnect")
+	}
+}
@@ -0,0 +1,61 @@
+package chaos
+
+import (
+	"context"
+	"goexample/pkg/telemetry"
+	"math/rand"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Rules injecting faults, the rule label of chaos_injections_total and chaos.rule of the span events
+const (
+	RuleErrorRate      = "error_rate"
+	RuleKafkaLatency   = "kafka_latency"
+	RuleRouteErrorRate = "route_override_error_rate"
+	RuleRouteLatency   = "route_override_latency"
+	// A workflow step failing on purpose, selected with fail_at
+	RuleFailAt = "fail_at"
+)
+
+var injectionsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "chaos_injections_total",
+		Help: "Total number of faults injected, by the rule that fired",
+	},
+	[]string{"rule"},
+)
+
+// Roll draws a random number and reports whether the fault of rule, injected with probability,
+// fires for the request of ctx. A fired fault is recorded as by Inject with the probability and
+// the roll, so the decision can be told apart from an organic failure in the trace.
+func Roll(ctx context.Context, rule string, probability float64) bool {
+	if probability <= 0 {
+		return false
+	}
+	roll := rand.Float64()
+	if roll >= probability {
+		return false
+	}
+	record(ctx, rule, attribute.Float64("chaos.probability", probability), attribute.Float64("chaos.roll", roll))
+	return true
+}
+
+// Inject records a fault of rule applied to every request, e.g. a latency: a "chaos injected"
+// event with attrs on the span of ctx, chaos.injected on the span and the canonical log line, and
+// chaos_injections_total.
+func Inject(ctx context.Context, rule string, attrs ...attribute.KeyValue) {
+	record(ctx, rule, append([]attribute.KeyValue{attribute.Float64("chaos.probability", 1)}, attrs...)...)
+}
+
+func record(ctx context.Context, rule string, attrs ...attribute.KeyValue) {
+	injectionsTotal.WithLabelValues(rule).Inc()
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Bool("chaos.injected", true))
+	span.AddEvent("chaos injected", trace.WithAttributes(
+		append([]attribute.KeyValue{attribute.String("chaos.rule", rule)}, attrs...)...,
+	))
+	telemetry.Canonical(ctx).Set("chaos_rule", rule)
+}
@@ -0,0 +1,135 @@
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"goexample/pkg/annotations"
+	"goexample/pkg/clock"
+	"goexample/pkg/telemetry"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+var scenarioActive = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "chaos_scenario_active",
+		Help: "Set to 1 for the scenario and step currently applied, absent when no scenario runs",
+	},
+	[]string{"scenario", "step"},
+)
+
+// Scenario is a timeline of fault settings, e.g. for incident simulations in workshops
+type Scenario struct {
+	Name string `yaml:"name"`
+	// Metrics, spans and logs are tagged with the experiment ID while the scenario runs, so runs
+	// can be compared. Give each run its own ID, e.g. with CHAOS_EXPERIMENT, empty tags nothing.
+	Experiment string `yaml:"experiment"`
+	Steps      []Step `yaml:"steps"`
+}
+
+// Step changes the settings At an offset from the start of the scenario.
+// Settings left out keep their current value.
+type Step struct {
+	At           time.Duration  `yaml:"at"`
+	Description  string         `yaml:"description"`
+	ErrorRate    *float64       `yaml:"error_rate"`
+	KafkaLatency *time.Duration `yaml:"kafka_latency"`
+	ResponseSize *ByteSize      `yaml:"response_size"`
+	// Restore the settings the service was started with
+	Recover bool `yaml:"recover"`
+}
+
+// LoadScenario reads a scenario from a YAML file, steps have to be in time order. CHAOS_EXPERIMENT
+// overrides the experiment ID of the file.
+func LoadScenario(path string) (Scenario, error) {
+	var sc Scenario
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return sc, err
+	}
+	if err := yaml.Unmarshal(data, &sc); err != nil {
+		return sc, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	if sc.Name == "" {
+		return sc, fmt.Errorf("%s: scenario has no name", path)
+	}
+	if id := os.Getenv("CHAOS_EXPERIMENT"); id != "" {
+		sc.Experiment = id
+	}
+	if sc.Experiment != "" {
+		if err := telemetry.ValidateExperimentID(sc.Experiment); err != nil {
+			return sc, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for i, step := range sc.Steps {
+		if i > 0 && step.At < sc.Steps[i-1].At {
+			return sc, fmt.Errorf("%s: step %d at %s comes before the previous step", path, i, step.At)
+		}
+		if step.ErrorRate != nil && (*step.ErrorRate < 0 || *step.ErrorRate > 1) {
+			return sc, fmt.Errorf("%s: step %d: error_rate must be between 0 and 1", path, i)
+		}
+		if step.KafkaLatency != nil && *step.KafkaLatency < 0 {
+			return sc, fmt.Errorf("%s: step %d: kafka_latency must not be negative", path, i)
+		}
+		if step.ResponseSize != nil && *step.ResponseSize > MaxResponseSize {
+			return sc, fmt.Errorf("%s: step %d: response_size must be at most %s", path, i, MaxResponseSize)
+		}
+	}
+	return sc, nil
+}
+
+// Run applies the steps of sc to state as their time comes, it returns after the last step or when ctx is done.
+// The start and end of the scenario are annotated on the dashboards.
+func Run(ctx context.Context, clk clock.Clock, logger *logrus.Logger, state *State, sc Scenario, annotate annotations.Emitter) {
+	start := clk.Now()
+	active := prometheus.Labels{}
+	defer func() { scenarioActive.Delete(active) }()
+	if sc.Experiment != "" {
+		experiment, _ := telemetry.SetExperiment(sc.Experiment)
+		defer func() { _, _ = telemetry.SetExperiment("") }()
+		logger.WithFields(logrus.Fields{
+			"scenario":      sc.Name,
+			"experiment_id": experiment,
+		}).Info("Tagging telemetry with the experiment ID")
+	}
+	annotate.Emit(ctx, "Chaos scenario "+sc.Name+" started", annotations.TagChaos)
+
+	for i, step := range sc.Steps {
+		if wait := step.At - clock.Since(clk, start); wait > 0 {
+			_ = clock.SleepContext(ctx, clk, wait)
+		}
+		if ctx.Err() != nil {
+			annotate.Emit(ctx, "Chaos scenario "+sc.Name+" stopped", annotations.TagChaos)
+			return
+		}
+
+		state.Apply(step)
+
+		name := step.Description
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		scenarioActive.Delete(active)
+		active = prometheus.Labels{"scenario": sc.Name, "step": name}
+		scenarioActive.With(active).Set(1)
+
+		current := state.Current()
+		logger.WithFields(logrus.Fields{
+			"scenario":      sc.Name,
+			"step":          name,
+			"at":            step.At.String(),
+			"error_rate":    current.ErrorRate,
+			"kafka_latency": current.KafkaLatency.String(),
+			"response_size": current.ResponseSize.String(),
+		}).Warn("Applied chaos scenario step")
+	}
+
+	logger.WithField("scenario", sc.Name).Info("Chaos scenario finished")
+	annotate.Emit(ctx, "Chaos scenario "+sc.Name+" finished", annotations.TagChaos)
+}
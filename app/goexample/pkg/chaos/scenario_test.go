@@ -0,0 +1,35 @@
+package chaos
+
+import (
+	"context"
+	"goexample/pkg/annotations"
+	"goexample/pkg/clock"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRunStopsWaitingOnCancel(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	state := NewState(Settings{})
+	latency := time.Second
+	sc := Scenario{Name: "slow kafka", Steps: []Step{{At: time.Hour, KafkaLatency: &latency}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, fake, logger, state, sc, annotations.Nop{})
+		close(done)
+	}()
+
+	fake.BlockUntil(1)
+	cancel()
+	<-done
+	if got := state.Current().KafkaLatency; got != 0 {
+		t.Errorf("Kafka latency = %s after canceling the scenario, want the step not applied", got)
+	}
+}
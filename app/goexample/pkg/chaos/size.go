@@ -0,0 +1,63 @@
+package chaos
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MaxResponseSize bounds the padding of responses, from scenarios and per request
+const MaxResponseSize ByteSize = 16 << 20
+
+// ByteSize is a number of bytes, written as 512, 64KB or 2MB (powers of 1024)
+type ByteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	size   ByteSize
+}{
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize parses a size like 512, 64KB or 2MB, it must not be negative
+func ParseByteSize(s string) (ByteSize, error) {
+	value, unit := strings.ToUpper(strings.TrimSpace(s)), ByteSize(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			value, unit = strings.TrimSuffix(value, u.suffix), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, use e.g. 512, 64KB or 2MB", s)
+	}
+	if n > math.MaxInt64/int64(unit) {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return ByteSize(n) * unit, nil
+}
+
+// UnmarshalYAML parses sizes written with a unit as well as plain numbers of bytes
+func (b *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	size, err := ParseByteSize(node.Value)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+func (b ByteSize) String() string {
+	for _, u := range byteUnits {
+		if b >= u.size && b%u.size == 0 {
+			return strconv.FormatInt(int64(b/u.size), 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(b), 10) + "B"
+}
@@ -0,0 +1,33 @@
+package chaos
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want ByteSize
+	}{
+		{"512", 512},
+		{"64KB", 64 << 10},
+		{" 2mb ", 2 << 20},
+		{"8796093022207MB", 8796093022207 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseByteSize(tt.s)
+			if err != nil || got != tt.want {
+				t.Errorf("ParseByteSize() = %d, %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseByteSizeErrors(t *testing.T) {
+	for _, s := range []string{"", "-1KB", "large", "8796093022208MB", "9223372036854775807KB"} {
+		t.Run(s, func(t *testing.T) {
+			if got, err := ParseByteSize(s); err == nil {
+				t.Errorf("ParseByteSize() = %d, want an error", got)
+			}
+		})
+	}
+}
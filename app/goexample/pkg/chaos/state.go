@@ -0,0 +1,105 @@
+package chaos
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	errorRateGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "chaos_error_rate",
+			Help: "Current probability of injected request failures",
+		},
+	)
+
+	kafkaLatencyGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "chaos_kafka_latency_seconds",
+			Help: "Current latency added to every Kafka publish",
+		},
+	)
+
+	responseSizeGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "chaos_response_size_bytes",
+			Help: "Current padding added to every hello response",
+		},
+	)
+)
+
+// Register registers the metrics of the package with reg, e.g. prometheus.DefaultRegisterer
+func Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		errorRateGauge,
+		kafkaLatencyGauge,
+		responseSizeGauge,
+		scenarioActive,
+		injectionsTotal,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Settings are the faults injected into the service
+type Settings struct {
+	// Probability of a request failing with a random 500
+	ErrorRate float64
+	// Delay added before every Kafka publish
+	KafkaLatency time.Duration
+	// Padding added to every hello response, a size query parameter overrides it per request
+	ResponseSize ByteSize
+}
+
+// State holds the current Settings, changed at runtime by scenarios
+type State struct {
+	mu      sync.RWMutex
+	base    Settings
+	current Settings
+}
+
+// NewState creates a State starting at, and recovering to, base
+func NewState(base Settings) *State {
+	s := &State{base: base, current: base}
+	observe(base)
+	return s
+}
+
+// Current returns the settings in effect
+func (s *State) Current() Settings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// Apply changes the settings named by step, a recover step restores the base settings first
+func (s *State) Apply(step Step) {
+	s.mu.Lock()
+	if step.Recover {
+		s.current = s.base
+	}
+	if step.ErrorRate != nil {
+		s.current.ErrorRate = *step.ErrorRate
+	}
+	if step.KafkaLatency != nil {
+		s.current.KafkaLatency = *step.KafkaLatency
+	}
+	if step.ResponseSize != nil {
+		s.current.ResponseSize = *step.ResponseSize
+	}
+	current := s.current
+	s.mu.Unlock()
+
+	observe(current)
+}
+
+func observe(settings Settings) {
+	errorRateGauge.Set(settings.ErrorRate)
+	kafkaLatencyGauge.Set(settings.KafkaLatency.Seconds())
+	responseSizeGauge.Set(float64(settings.ResponseSize))
+}
@@ -0,0 +1,294 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goexample/pkg/clock"
+	"goexample/pkg/errfmt"
+	"goexample/pkg/telemetry"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Doer sends HTTP requests, implemented by *http.Client
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Config of a Client
+type Config struct {
+	// Base URL of the service, e.g. http://goexample1:8080
+	BaseURL string
+	// Name of the called service in client spans, the host of BaseURL when empty
+	Service string
+	// Sent as X-Client-Service so the called service can attribute the traffic, e.g. loadgen
+	Caller string
+	// User-Agent of the requests, Go's default when empty
+	UserAgent string
+	// Sends the requests, http.DefaultClient when nil
+	HTTPClient Doer
+	// Creates the client spans, a tracer of the global provider when nil
+	Tracer trace.Tracer
+	// Bounds every call including retries and reading the response, unbounded when 0
+	Timeout time.Duration
+	// Retries of failed GET calls, none when zero
+	Retry RetryPolicy
+	// Waits out the retry backoffs and refills the retry budget, the wall clock when nil
+	Clock clock.Clock
+}
+
+// Client calls the HTTP API of the demo services. Every call gets a client span named
+// "<METHOD> <service>" with the peer attributes, connection events and outcome of the request,
+// and continues the trace of its context in the called service.
+type Client struct {
+	cfg     Config
+	baseURL string
+	budget  *retryBudget
+}
+
+// New creates a Client for the service at cfg.BaseURL
+func New(cfg Config) (*Client, error) {
+	u, err := url.Parse(cfg.BaseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q", cfg.BaseURL)
+	}
+	if cfg.Service == "" {
+		cfg.Service = u.Hostname()
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	if cfg.Tracer == nil {
+		cfg.Tracer = otel.Tracer("goexample/client")
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = clock.Real{}
+	}
+	return &Client{cfg: cfg, baseURL: strings.TrimSuffix(cfg.BaseURL, "/"), budget: newRetryBudget(cfg.Retry, cfg.Clock)}, nil
+}
+
+// StatusError is returned for responses other than 2xx, categorized as a dependency error
+type StatusError struct {
+	Service string
+	Code    int
+	// Start of the response body
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%s returned %d %s", e.Service, e.Code, http.StatusText(e.Code))
+	}
+	return fmt.Sprintf("%s returned %d %s: %s", e.Service, e.Code, http.StatusText(e.Code), e.Body)
+}
+
+// Hello calls GET /hello and returns the response body
+func (c *Client) Hello(ctx context.Context) (string, error) {
+	return c.text(ctx, c.cfg.Service, "/hello")
+}
+
+// Headers calls GET /headers and returns the request headers the service received
+func (c *Client) Headers(ctx context.Context) (string, error) {
+	return c.text(ctx, c.cfg.Service, "/headers")
+}
+
+// Virtual calls GET /virtual/{service} of goexample1, the client span names the virtual
+// service as peer so the service graph gets an edge to it
+func (c *Client) Virtual(ctx context.Context, service string) error {
+	_, err := c.text(ctx, service, "/virtual/"+url.PathEscape(service))
+	return err
+}
+
+// OrderRequest is the body of POST /order
+type OrderRequest struct {
+	Item     string `json:"item,omitempty"`
+	Quantity int    `json:"quantity,omitempty"`
+	// Workflow step failing on purpose: reserve, publish, ship or ship_panic
+	FailAt string `json:"fail_at,omitempty"`
+}
+
+// OrderResponse is the body of an accepted order
+type OrderResponse struct {
+	OrderID string `json:"order_id"`
+	State   string `json:"state"`
+}
+
+// Order calls POST /order of goexample
+func (c *Client) Order(ctx context.Context, req OrderRequest) (OrderResponse, error) {
+	var resp OrderResponse
+	err := c.do(ctx, c.cfg.Service, http.MethodPost, "/order", req, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&resp)
+	})
+	return resp, err
+}
+
+// Reservation is the body of the inventory endpoints of goexample1
+type Reservation struct {
+	OrderID  string `json:"order_id"`
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+	// Failing the reservation on purpose when "reserve"
+	FailAt string `json:"fail_at,omitempty"`
+}
+
+// ReserveInventory calls POST /inventory/reserve of goexample1, an out of stock item
+// is a StatusError with code 409
+func (c *Client) ReserveInventory(ctx context.Context, r Reservation) error {
+	return c.do(ctx, c.cfg.Service, http.MethodPost, "/inventory/reserve", r, nil)
+}
+
+// ReleaseInventory calls POST /inventory/release of goexample1
+func (c *Client) ReleaseInventory(ctx context.Context, r Reservation) error {
+	return c.do(ctx, c.cfg.Service, http.MethodPost, "/inventory/release", r, nil)
+}
+
+// Warm resolves the host of the service and opens conns connections to it with concurrent GET
+// requests of path, which stay idle in the pool of the HTTP client for the first calls.
+// http.DefaultTransport keeps 2 idle connections per host, more are closed right away.
+func (c *Client) Warm(ctx context.Context, path string, conns int) error {
+	host := c.host()
+	ctx, span := c.cfg.Tracer.Start(ctx, "Resolve "+host,
+		trace.WithAttributes(attribute.String("server.address", host)),
+	)
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	span.SetAttributes(attribute.StringSlice("network.peer.addresses", addrs))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", host, err)
+	}
+
+	errs := make(chan error, conns)
+	for range conns {
+		go func() {
+			_, err := c.text(ctx, c.cfg.Service, path)
+			errs <- err
+		}()
+	}
+	for range conns {
+		err = errors.Join(err, <-errs)
+	}
+	return err
+}
+
+// host returns the host name of the base URL
+func (c *Client) host() string {
+	u, _ := url.Parse(c.baseURL)
+	return u.Hostname()
+}
+
+// text performs a GET of path and returns the response body
+func (c *Client) text(ctx context.Context, peer, path string) (string, error) {
+	var text string
+	err := c.do(ctx, peer, http.MethodGet, path, nil, func(body io.Reader) error {
+		b, err := io.ReadAll(body)
+		text = string(b)
+		return err
+	})
+	return text, err
+}
+
+// do sends a request to path in a client span, in is sent as JSON unless nil and decode
+// reads a 2xx response body unless nil
+func (c *Client) do(ctx context.Context, peer, method, path string, in any, decode func(io.Reader) error) error {
+	target := c.baseURL + path
+	if c.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+	ctx, span := c.cfg.Tracer.Start(ctx, method+" "+peer,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(telemetry.PeerAttributes(peer, target)...),
+	)
+	defer span.End()
+
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	// Connection phases show up as events on the client span
+	req, err := http.NewRequestWithContext(telemetry.WithClientTrace(ctx), method, target, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.cfg.Caller != "" {
+		req.Header.Set("X-Client-Service", c.cfg.Caller)
+	}
+	if c.cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", c.cfg.UserAgent)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	res, err := c.send(ctx, span, req)
+	telemetry.FinishClientSpan(req, res, err)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return errfmt.WithCategory(&StatusError{Service: peer, Code: res.StatusCode, Body: string(bytes.TrimSpace(msg))}, errfmt.CategoryDependency)
+	}
+	if decode == nil {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil
+	}
+	return decode(res.Body)
+}
+
+// send sends req and retries it as the retry policy and budget allow, every retry is an event
+// on the client span
+func (c *Client) send(ctx context.Context, span trace.Span, req *http.Request) (*http.Response, error) {
+	c.budget.deposit()
+	retries := 0
+	defer func() { retriesPerRequest.WithLabelValues(c.cfg.Service).Observe(float64(retries)) }()
+
+	for {
+		res, err := c.cfg.HTTPClient.Do(req)
+		if retries >= c.cfg.Retry.MaxRetries || !retryable(req.Method, res, err) {
+			return res, err
+		}
+		if !c.budget.withdraw() {
+			retryBudgetExhaustedTotal.WithLabelValues(c.cfg.Service).Inc()
+			span.AddEvent("retry budget exhausted")
+			return res, err
+		}
+		if err == nil {
+			_, _ = io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		retries++
+		if err := clock.SleepContext(ctx, c.cfg.Clock, c.cfg.Retry.Backoff<<(retries-1)); err != nil {
+			return nil, err
+		}
+		span.AddEvent("retry", trace.WithAttributes(attribute.Int("http.request.retry", retries)))
+		// Only GET calls are retried, they have no body to rewind
+		req = req.Clone(req.Context())
+	}
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LatencyModel draws the latencies of simulated calls
+type LatencyModel interface {
+	Sample(r *rand.Rand) time.Duration
+	String() string
+}
+
+// Normal latencies around Mean, negative draws are cut to 0
+type Normal struct {
+	Mean, StdDev time.Duration
+}
+
+// Sample implements LatencyModel
+func (m Normal) Sample(r *rand.Rand) time.Duration {
+	return max(0, m.Mean+time.Duration(r.NormFloat64()*float64(m.StdDev)))
+}
+
+func (m Normal) String() string {
+	return "normal:" + m.Mean.String() + "/" + m.StdDev.String()
+}
+
+// LogNormal latencies with the given median, Sigma is the standard deviation of the log of the
+// latency and sets the length of the tail (0.5 makes p99 about 3x the median)
+type LogNormal struct {
+	Median time.Duration
+	Sigma  float64
+}
+
+// Sample implements LatencyModel
+func (m LogNormal) Sample(r *rand.Rand) time.Duration {
+	return time.Duration(float64(m.Median) * math.Exp(r.NormFloat64()*m.Sigma))
+}
+
+func (m LogNormal) String() string {
+	return "lognormal:" + m.Median.String() + "/" + strconv.FormatFloat(m.Sigma, 'g', -1, 64)
+}
+
+// Bimodal latencies, SlowFraction of the calls take the Slow mode, e.g. cache misses
+type Bimodal struct {
+	Fast, Slow   Normal
+	SlowFraction float64
+}
+
+// Sample implements LatencyModel
+func (m Bimodal) Sample(r *rand.Rand) time.Duration {
+	if r.Float64() < m.SlowFraction {
+		return m.Slow.Sample(r)
+	}
+	return m.Fast.Sample(r)
+}
+
+func (m Bimodal) String() string {
+	return fmt.Sprintf("bimodal:%s/%s,%s/%s,%g", m.Fast.Mean, m.Fast.StdDev, m.Slow.Mean, m.Slow.StdDev, m.SlowFraction)
+}
+
+// ParseLatencyModel parses a latency model spec:
+//
+//	normal:<mean>/<stddev>                          e.g. normal:50ms/10ms
+//	lognormal:<median>/<sigma>                      e.g. lognormal:40ms/0.5
+//	bimodal:<mean>/<stddev>,<mean>/<stddev>,<slow>  e.g. bimodal:20ms/5ms,400ms/50ms,0.1
+func ParseLatencyModel(spec string) (LatencyModel, error) {
+	kind, params, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "normal":
+		return parseNormal(params)
+	case "lognormal":
+		median, sigma, _ := strings.Cut(params, "/")
+		m := LogNormal{}
+		var err error
+		if m.Median, err = time.ParseDuration(median); err != nil || m.Median <= 0 {
+			return nil, fmt.Errorf("invalid lognormal median %q", median)
+		}
+		if m.Sigma, err = strconv.ParseFloat(sigma, 64); err != nil || m.Sigma < 0 {
+			return nil, fmt.Errorf("invalid lognormal sigma %q", sigma)
+		}
+		return m, nil
+	case "bimodal":
+		parts := strings.Split(params, ",")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid bimodal latency model %q", params)
+		}
+		fast, err := parseNormal(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		slow, err := parseNormal(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		fraction, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil || fraction < 0 || fraction > 1 {
+			return nil, fmt.Errorf("invalid bimodal slow fraction %q", parts[2])
+		}
+		return Bimodal{Fast: fast, Slow: slow, SlowFraction: fraction}, nil
+	default:
+		return nil, fmt.Errorf("unknown latency model %q", kind)
+	}
+}
+
+func parseNormal(params string) (Normal, error) {
+	mean, stddev, _ := strings.Cut(params, "/")
+	m := Normal{}
+	var err error
+	if m.Mean, err = time.ParseDuration(mean); err != nil || m.Mean < 0 {
+		return m, fmt.Errorf("invalid normal mean %q", mean)
+	}
+	if m.StdDev, err = time.ParseDuration(stddev); err != nil || m.StdDev < 0 {
+		return m, fmt.Errorf("invalid normal standard deviation %q", stddev)
+	}
+	return m, nil
+}
@@ -0,0 +1,144 @@
+package client
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseLatencyModel(t *testing.T) {
+	tests := []struct {
+		spec string
+		want LatencyModel
+	}{
+		{"normal:50ms/10ms", Normal{Mean: 50 * time.Millisecond, StdDev: 10 * time.Millisecond}},
+		{"normal:0s/0s", Normal{}},
+		{"lognormal:40ms/0.5", LogNormal{Median: 40 * time.Millisecond, Sigma: 0.5}},
+		{"bimodal:20ms/5ms,400ms/50ms,0.1", Bimodal{
+			Fast:         Normal{Mean: 20 * time.Millisecond, StdDev: 5 * time.Millisecond},
+			Slow:         Normal{Mean: 400 * time.Millisecond, StdDev: 50 * time.Millisecond},
+			SlowFraction: 0.1,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseLatencyModel(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseLatencyModel() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLatencyModel() = %#v, want %#v", got, tt.want)
+			}
+			if got.String() != tt.spec {
+				t.Errorf("String() = %q, want the spec back", got.String())
+			}
+		})
+	}
+}
+
+func TestParseLatencyModelErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"uniform:10ms/20ms",
+		"normal:fast/10ms",
+		"normal:-50ms/10ms",
+		"normal:50ms/-10ms",
+		"lognormal:0s/0.5",
+		"lognormal:40ms/-0.5",
+		"lognormal:40ms",
+		"bimodal:20ms/5ms,400ms/50ms",
+		"bimodal:20ms/5ms,400ms/50ms,1.5",
+		"bimodal:20ms/5ms,slow/50ms,0.1",
+	} {
+		t.Run(spec, func(t *testing.T) {
+			if m, err := ParseLatencyModel(spec); err == nil {
+				t.Errorf("ParseLatencyModel() = %v, want an error", m)
+			}
+		})
+	}
+}
+
+func TestLatencyModelDistribution(t *testing.T) {
+	// Quantiles of the distributions: the normal quantile of 0.99 is 2.326 standard deviations
+	tests := []struct {
+		name     string
+		model    LatencyModel
+		p50, p99 time.Duration
+	}{
+		{
+			name:  "normal",
+			model: Normal{Mean: 50 * time.Millisecond, StdDev: 10 * time.Millisecond},
+			p50:   50 * time.Millisecond,
+			p99:   73260 * time.Microsecond,
+		},
+		{
+			name:  "lognormal",
+			model: LogNormal{Median: 40 * time.Millisecond, Sigma: 0.5},
+			p50:   40 * time.Millisecond,
+			p99:   127930 * time.Microsecond,
+		},
+		{
+			// p50 is the 0.556 quantile of the fast mode, p99 the 0.9 quantile of the slow one
+			name: "bimodal",
+			model: Bimodal{
+				Fast:         Normal{Mean: 20 * time.Millisecond, StdDev: 5 * time.Millisecond},
+				Slow:         Normal{Mean: 400 * time.Millisecond, StdDev: 50 * time.Millisecond},
+				SlowFraction: 0.1,
+			},
+			p50: 20700 * time.Microsecond,
+			p99: 464080 * time.Microsecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := sample(tt.model, 20000)
+			for _, q := range []struct {
+				name string
+				got  time.Duration
+				want time.Duration
+			}{
+				{"p50", quantile(samples, 0.5), tt.p50},
+				{"p99", quantile(samples, 0.99), tt.p99},
+			} {
+				if math.Abs(float64(q.got-q.want)) > 0.05*float64(q.want) {
+					t.Errorf("%s = %s, want %s within 5%%", q.name, q.got, q.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalCutsNegativeLatencies(t *testing.T) {
+	samples := sample(Normal{Mean: time.Millisecond, StdDev: 10 * time.Millisecond}, 1000)
+	if samples[0] != 0 {
+		t.Errorf("lowest latency = %s, want negative draws cut to 0", samples[0])
+	}
+}
+
+func TestLatencyModelSeed(t *testing.T) {
+	m := LogNormal{Median: 40 * time.Millisecond, Sigma: 0.5}
+	a, b := rand.New(rand.NewSource(7)), rand.New(rand.NewSource(7))
+	for i := range 100 {
+		if x, y := m.Sample(a), m.Sample(b); x != y {
+			t.Fatalf("draw %d: %s and %s from the same seed", i, x, y)
+		}
+	}
+}
+
+// sample draws n latencies of m with a fixed seed, sorted
+func sample(m LatencyModel, n int) []time.Duration {
+	r := rand.New(rand.NewSource(1))
+	samples := make([]time.Duration, n)
+	for i := range samples {
+		samples[i] = m.Sample(r)
+	}
+	slices.Sort(samples)
+	return samples
+}
+
+// quantile returns the q quantile of sorted samples
+func quantile(sorted []time.Duration, q float64) time.Duration {
+	return sorted[int(q*float64(len(sorted)-1))]
+}
@@ -0,0 +1,193 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PROXY protocol versions written ahead of proxied connections
+const (
+	ProxyProtocolV1 = "v1"
+	ProxyProtocolV2 = "v2"
+)
+
+// Hop of calls going straight to the called service
+const hopDirect = "direct"
+
+// ProxyConfig routes the calls through a local proxy, e.g. a service mesh sidecar
+type ProxyConfig struct {
+	// unix:///path/to/socket or host:port of the proxy, calls go direct when empty
+	Address string
+	// PROXY protocol header telling the proxy the original destination: v1, v2 or empty for none
+	Protocol string
+	// Name of the hop, sent in the Via header and recorded on the client spans
+	Hop string
+}
+
+// ProxyConfigFromEnv reads DOWNSTREAM_PROXY, DOWNSTREAM_PROXY_PROTOCOL and DOWNSTREAM_PROXY_HOP (default sidecar)
+func ProxyConfigFromEnv() (ProxyConfig, error) {
+	cfg := ProxyConfig{
+		Address:  os.Getenv("DOWNSTREAM_PROXY"),
+		Protocol: os.Getenv("DOWNSTREAM_PROXY_PROTOCOL"),
+		Hop:      os.Getenv("DOWNSTREAM_PROXY_HOP"),
+	}
+	if cfg.Hop == "" {
+		cfg.Hop = "sidecar"
+	}
+	switch cfg.Protocol {
+	case "", ProxyProtocolV1, ProxyProtocolV2:
+	default:
+		return cfg, fmt.Errorf("invalid DOWNSTREAM_PROXY_PROTOCOL %q, expected v1 or v2", cfg.Protocol)
+	}
+	return cfg, nil
+}
+
+func (c ProxyConfig) String() string {
+	if c.Address == "" {
+		return hopDirect
+	}
+	s := c.Hop + " at " + c.Address
+	if c.Protocol != "" {
+		s += " with PROXY " + c.Protocol
+	}
+	return s
+}
+
+// network returns the network and address to dial for the proxy
+func (c ProxyConfig) network() (string, string) {
+	if path, ok := strings.CutPrefix(c.Address, "unix://"); ok {
+		return "unix", path
+	}
+	return "tcp", c.Address
+}
+
+// NewTransport returns a transport sending the requests through the proxy of cfg, or directly
+// when cfg has no address. The client span of each request records the hop it took:
+// network.hop, network.hop.transport and network.hop.proxy_protocol.
+func NewTransport(cfg ProxyConfig) http.RoundTripper {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Address == "" {
+		return hopTransport{base: base, attrs: []attribute.KeyValue{attribute.String("network.hop", hopDirect)}}
+	}
+
+	network, address := cfg.network()
+	dialer := &net.Dialer{}
+	base.DialContext = func(ctx context.Context, _, target string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Protocol == "" {
+			return conn, nil
+		}
+		header, err := proxyHeader(ctx, cfg.Protocol, conn, target)
+		if err == nil {
+			_, err = conn.Write(header)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("send PROXY header to %s: %w", cfg.Address, err)
+		}
+		return conn, nil
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("network.hop", cfg.Hop),
+		attribute.String("network.hop.transport", network),
+	}
+	if cfg.Protocol != "" {
+		attrs = append(attrs, attribute.String("network.hop.proxy_protocol", cfg.Protocol))
+	}
+	return hopTransport{base: base, hop: cfg.Hop, attrs: attrs}
+}
+
+// hopTransport records the hop on the client span and announces it in the Via header
+type hopTransport struct {
+	base  http.RoundTripper
+	hop   string
+	attrs []attribute.KeyValue
+}
+
+func (t hopTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace.SpanFromContext(req.Context()).SetAttributes(t.attrs...)
+	if t.hop != "" {
+		req = req.Clone(req.Context())
+		req.Header.Add("Via", "1.1 "+t.hop)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Signature starting a PROXY protocol v2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyHeader builds the PROXY header for a connection to target made through conn. The source
+// is the local address of conn, the loopback address on Unix sockets where the caller is a local
+// process. Destinations which do not resolve to an IP are sent as UNKNOWN.
+func proxyHeader(ctx context.Context, version string, conn net.Conn, target string) ([]byte, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	dstPort, _ := strconv.Atoi(port)
+	var dst net.IP
+	if ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host); err == nil && len(ips) > 0 {
+		dst = ips[0]
+	}
+
+	src, srcPort := net.IPv4(127, 0, 0, 1), 0
+	if tcp, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		src, srcPort = tcp.IP, tcp.Port
+	}
+	if dst != nil && dst.To4() == nil && src.To4() != nil {
+		if src.IsLoopback() {
+			src = net.IPv6loopback
+		} else {
+			dst = nil
+		}
+	}
+
+	if version == ProxyProtocolV1 {
+		if dst == nil {
+			return []byte("PROXY UNKNOWN\r\n"), nil
+		}
+		family := "TCP4"
+		if dst.To4() == nil {
+			family = "TCP6"
+		}
+		return fmt.Appendf(nil, "PROXY %s %s %s %d %d\r\n", family, src, dst, srcPort, dstPort), nil
+	}
+
+	var b bytes.Buffer
+	b.Write(proxyV2Signature)
+	b.WriteByte(0x21) // version 2, PROXY command
+	switch {
+	case dst == nil:
+		b.WriteByte(0x00) // AF_UNSPEC, the receiver uses the connection's own addresses
+		_ = binary.Write(&b, binary.BigEndian, uint16(0))
+	case dst.To4() != nil:
+		b.WriteByte(0x11) // TCP over IPv4
+		_ = binary.Write(&b, binary.BigEndian, uint16(12))
+		b.Write(src.To4())
+		b.Write(dst.To4())
+		_ = binary.Write(&b, binary.BigEndian, uint16(srcPort))
+		_ = binary.Write(&b, binary.BigEndian, uint16(dstPort))
+	default:
+		b.WriteByte(0x21) // TCP over IPv6
+		_ = binary.Write(&b, binary.BigEndian, uint16(36))
+		b.Write(src.To16())
+		b.Write(dst.To16())
+		_ = binary.Write(&b, binary.BigEndian, uint16(srcPort))
+		_ = binary.Write(&b, binary.BigEndian, uint16(dstPort))
+	}
+	return b.Bytes(), nil
+}
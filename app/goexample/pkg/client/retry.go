@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goexample/pkg/clock"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	retriesPerRequest = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "retries_per_request",
+			Help:    "Number of retries of each call to a downstream service, 0 for calls answered at the first attempt",
+			Buckets: []float64{0, 1, 2, 3, 5, 10},
+		},
+		[]string{"service"},
+	)
+
+	retryBudgetExhaustedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "retry_budget_exhausted_total",
+			Help: "Total number of retries of downstream calls skipped because the retry budget was spent",
+		},
+		[]string{"service"},
+	)
+)
+
+// Register registers the metrics of the package with reg, e.g. prometheus.DefaultRegisterer
+func Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		retriesPerRequest,
+		retryBudgetExhaustedTotal,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RetryPolicy retries GET calls failing with a transport error or a 500, 502, 503 or 504
+// response. Retries are bounded by a budget, so a failing dependency sees at most
+// BudgetRatio more requests instead of a retry storm.
+type RetryPolicy struct {
+	// Retries of one call, 0 disables retries
+	MaxRetries int
+	// Wait before the first retry, doubled for each further retry
+	Backoff time.Duration
+	// Retries allowed per call made, e.g. 0.2 for 20% extra load at most
+	BudgetRatio float64
+	// Retries allowed per second on top of BudgetRatio, so rarely used clients can retry too
+	BudgetMinPerSecond float64
+}
+
+// DefaultRetryPolicy retries twice within a budget of 20% of the calls
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxRetries: 2, Backoff: 25 * time.Millisecond, BudgetRatio: 0.2, BudgetMinPerSecond: 1}
+}
+
+// ParseRetryPolicy parses "retries=2,backoff=25ms,budget=0.2,min_per_second=1" over the defaults
+func ParseRetryPolicy(spec string) (RetryPolicy, error) {
+	p := DefaultRetryPolicy()
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return p, fmt.Errorf("invalid retry setting %q", pair)
+		}
+		var err error
+		switch key {
+		case "retries":
+			p.MaxRetries, err = strconv.Atoi(value)
+			if err == nil && p.MaxRetries < 0 {
+				err = errors.New("negative")
+			}
+		case "backoff":
+			p.Backoff, err = time.ParseDuration(value)
+		case "budget":
+			p.BudgetRatio, err = strconv.ParseFloat(value, 64)
+			if err == nil && p.BudgetRatio < 0 {
+				err = errors.New("negative")
+			}
+		case "min_per_second":
+			p.BudgetMinPerSecond, err = strconv.ParseFloat(value, 64)
+			if err == nil && p.BudgetMinPerSecond < 0 {
+				err = errors.New("negative")
+			}
+		default:
+			return p, fmt.Errorf("unknown retry setting %q", key)
+		}
+		if err != nil {
+			return p, fmt.Errorf("invalid retry setting %s: %q", key, value)
+		}
+	}
+	return p, nil
+}
+
+func (p RetryPolicy) String() string {
+	return fmt.Sprintf("retries=%d,backoff=%s,budget=%g,min_per_second=%g", p.MaxRetries, p.Backoff, p.BudgetRatio, p.BudgetMinPerSecond)
+}
+
+// retryable tells whether a call answered with res and err is worth another attempt
+func retryable(method string, res *http.Response, err error) bool {
+	if method != http.MethodGet {
+		return false
+	}
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch res.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Most retries a budget saves up while calls succeed
+const maxBudgetBalance = 10
+
+// retryBudget is a token bucket filled by the calls made and drained by retries
+type retryBudget struct {
+	policy RetryPolicy
+	clock  clock.Clock
+
+	mu      sync.Mutex
+	balance float64
+	updated time.Time
+}
+
+func newRetryBudget(policy RetryPolicy, c clock.Clock) *retryBudget {
+	return &retryBudget{policy: policy, clock: c, balance: maxBudgetBalance, updated: c.Now()}
+}
+
+// deposit credits a call made
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.balance = min(maxBudgetBalance, b.balance+b.policy.BudgetRatio)
+}
+
+// withdraw takes a retry from the budget, false when it is spent
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.balance < 1 {
+		return false
+	}
+	b.balance--
+	return true
+}
+
+func (b *retryBudget) refill() {
+	now := b.clock.Now()
+	b.balance = min(maxBudgetBalance, b.balance+now.Sub(b.updated).Seconds()*b.policy.BudgetMinPerSecond)
+	b.updated = now
+}
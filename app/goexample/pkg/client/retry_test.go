@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"goexample/pkg/clock"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// scriptedDoer answers the calls with the statuses of script in turn and reports every call on calls
+type scriptedDoer struct {
+	script []int
+	calls  chan *http.Request
+}
+
+func (d *scriptedDoer) Do(req *http.Request) (*http.Response, error) {
+	d.calls <- req
+	status := http.StatusOK
+	if len(d.script) > 0 {
+		status, d.script = d.script[0], d.script[1:]
+	}
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("hello")), Request: req}, nil
+}
+
+func newScriptedClient(t *testing.T, retry RetryPolicy, script ...int) (*Client, *scriptedDoer, *clock.Fake) {
+	t.Helper()
+	doer := &scriptedDoer{script: script, calls: make(chan *http.Request, len(script)+1)}
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	c, err := New(Config{
+		BaseURL:    "http://goexample1:8080",
+		HTTPClient: doer,
+		Tracer:     noop.NewTracerProvider().Tracer(""),
+		Retry:      retry,
+		Clock:      fake,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, doer, fake
+}
+
+func TestRetryBacksOffExponentially(t *testing.T) {
+	c, doer, fake := newScriptedClient(t, RetryPolicy{MaxRetries: 2, Backoff: 25 * time.Millisecond, BudgetRatio: 1},
+		http.StatusServiceUnavailable, http.StatusBadGateway)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Hello(context.Background())
+		done <- err
+	}()
+
+	<-doer.calls
+	for _, backoff := range []time.Duration{25 * time.Millisecond, 50 * time.Millisecond} {
+		fake.BlockUntil(1)
+		fake.Advance(backoff - time.Millisecond)
+		select {
+		case <-doer.calls:
+			t.Fatalf("retried before the backoff of %s passed", backoff)
+		default:
+		}
+		fake.Advance(time.Millisecond)
+		<-doer.calls
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("Hello() = %v, want nil after two retries", err)
+	}
+}
+
+func TestRetryGivesUpAfterMaxRetries(t *testing.T) {
+	c, doer, fake := newScriptedClient(t, RetryPolicy{MaxRetries: 1, Backoff: time.Second, BudgetRatio: 1},
+		http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Hello(context.Background())
+		done <- err
+	}()
+
+	<-doer.calls
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+	<-doer.calls
+
+	var statusErr *StatusError
+	if err := <-done; !errors.As(err, &statusErr) || statusErr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Hello() = %v, want the 503 of the last attempt", err)
+	}
+}
+
+func TestRetryBudgetRefillsWithTime(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	b := newRetryBudget(RetryPolicy{BudgetMinPerSecond: 2}, fake)
+	for b.withdraw() {
+	}
+
+	fake.Advance(400 * time.Millisecond)
+	if b.withdraw() {
+		t.Error("withdrew a retry from a budget refilled by 0.8")
+	}
+	fake.Advance(600 * time.Millisecond)
+	if !b.withdraw() {
+		t.Error("budget not refilled after 1s at 2 retries per second")
+	}
+}
+
+func TestRetryStopsBackoffOnCancel(t *testing.T) {
+	c, doer, fake := newScriptedClient(t, RetryPolicy{MaxRetries: 2, Backoff: time.Second, BudgetRatio: 1},
+		http.StatusServiceUnavailable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Hello(ctx)
+		done <- err
+	}()
+
+	<-doer.calls
+	fake.BlockUntil(1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Hello() = %v, want context.Canceled", err)
+	}
+}
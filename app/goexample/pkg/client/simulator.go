@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"goexample/pkg/chaos"
+	"goexample/pkg/clock"
+	"goexample/pkg/errfmt"
+	"goexample/pkg/telemetry"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SimulatorConfig of a Simulator
+type SimulatorConfig struct {
+	// Base URL and name of the simulated service, recorded on the client spans like by Client
+	BaseURL string
+	Service string
+	// Latency of every call
+	Model LatencyModel
+	// Calls drawing a longer latency fail with context.DeadlineExceeded after Timeout, unbounded when 0
+	Timeout time.Duration
+	// Seed of the latency draws, the same seed gives the same latencies
+	Seed int64
+	// Creates the client spans, a tracer of the global provider when nil
+	Tracer trace.Tracer
+	// Waits out the latencies, the wall clock when nil
+	Clock clock.Clock
+}
+
+// Simulator answers the goexample1 calls of Client in process after a latency drawn from a
+// LatencyModel, so latency demos can be tuned precisely and run without the network. Calls get
+// the client spans of Client, marked simulated=true.
+type Simulator struct {
+	cfg SimulatorConfig
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewSimulator creates a Simulator for the service at cfg.BaseURL
+func NewSimulator(cfg SimulatorConfig) *Simulator {
+	if cfg.Service == "" {
+		if u, err := url.Parse(cfg.BaseURL); err == nil {
+			cfg.Service = u.Hostname()
+		}
+	}
+	if cfg.Tracer == nil {
+		cfg.Tracer = otel.Tracer("goexample/client")
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = clock.Real{}
+	}
+	return &Simulator{cfg: cfg, rand: rand.New(rand.NewSource(cfg.Seed))}
+}
+
+// Hello simulates GET /hello
+func (s *Simulator) Hello(ctx context.Context) (string, error) {
+	return "hello again\n", s.call(ctx, s.cfg.Service, http.MethodGet, "/hello", http.StatusOK, "")
+}
+
+// Virtual simulates GET /virtual/{service}
+func (s *Simulator) Virtual(ctx context.Context, service string) error {
+	return s.call(ctx, service, http.MethodGet, "/virtual/"+url.PathEscape(service), http.StatusNoContent, "")
+}
+
+// ReserveInventory simulates POST /inventory/reserve, failing with 500 when r.FailAt is "reserve"
+func (s *Simulator) ReserveInventory(ctx context.Context, r Reservation) error {
+	if r.FailAt == "reserve" {
+		return s.call(ctx, s.cfg.Service, http.MethodPost, "/inventory/reserve", http.StatusInternalServerError, r.FailAt)
+	}
+	return s.call(ctx, s.cfg.Service, http.MethodPost, "/inventory/reserve", http.StatusNoContent, "")
+}
+
+// ReleaseInventory simulates POST /inventory/release
+func (s *Simulator) ReleaseInventory(ctx context.Context, _ Reservation) error {
+	return s.call(ctx, s.cfg.Service, http.MethodPost, "/inventory/release", http.StatusNoContent, "")
+}
+
+// call waits out a drawn latency in a client span and answers with status, failAt is the workflow
+// step failing on purpose with it, recorded as injected fault
+func (s *Simulator) call(ctx context.Context, peer, method, path string, status int, failAt string) error {
+	target := strings.TrimSuffix(s.cfg.BaseURL, "/") + path
+	ctx, span := s.cfg.Tracer.Start(ctx, method+" "+peer,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(telemetry.PeerAttributes(peer, target)...),
+		trace.WithAttributes(
+			attribute.Bool("simulated", true),
+			attribute.String("simulated.latency_model", s.cfg.Model.String()),
+		),
+	)
+	defer span.End()
+
+	s.mu.Lock()
+	latency := s.cfg.Model.Sample(s.rand)
+	s.mu.Unlock()
+	span.SetAttributes(attribute.Int64("simulated.latency_ms", latency.Milliseconds()))
+
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return err
+	}
+	if s.cfg.Timeout > 0 && latency > s.cfg.Timeout {
+		s.cfg.Clock.Sleep(s.cfg.Timeout)
+		err = context.DeadlineExceeded
+		telemetry.FinishClientSpan(req, nil, err)
+		return err
+	}
+	s.cfg.Clock.Sleep(latency)
+	if err := ctx.Err(); err != nil {
+		telemetry.FinishClientSpan(req, nil, err)
+		return err
+	}
+
+	if failAt != "" {
+		chaos.Inject(ctx, chaos.RuleFailAt, attribute.String("saga.fail_at", failAt))
+	}
+	telemetry.FinishClientSpan(req, &http.Response{StatusCode: status}, nil)
+	if status/100 != 2 {
+		return errfmt.WithCategory(&StatusError{Service: peer, Code: status, Body: "injected failure"}, errfmt.CategoryDependency)
+	}
+	return nil
+}
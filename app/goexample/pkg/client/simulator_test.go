@@ -0,0 +1,220 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"goexample/pkg/chaos"
+	"goexample/pkg/clock"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// downstream is the API shared by Client and Simulator
+type downstream interface {
+	Hello(ctx context.Context) (string, error)
+	Virtual(ctx context.Context, service string) error
+	ReserveInventory(ctx context.Context, r Reservation) error
+	ReleaseInventory(ctx context.Context, r Reservation) error
+}
+
+// roundTripFunc is a stub http.RoundTripper
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// goexample1Stub answers like goexample1 without the network
+func goexample1Stub(req *http.Request) (*http.Response, error) {
+	status, body := http.StatusNoContent, ""
+	switch {
+	case req.URL.Path == "/hello":
+		status, body = http.StatusOK, "hello again\n"
+	case req.URL.Path == "/inventory/reserve":
+		var r Reservation
+		if err := json.NewDecoder(req.Body).Decode(&r); err != nil {
+			return nil, err
+		}
+		if r.FailAt == "reserve" {
+			status, body = http.StatusInternalServerError, "injected failure"
+		}
+	case req.URL.Path == "/inventory/release", strings.HasPrefix(req.URL.Path, "/virtual/"):
+	default:
+		status = http.StatusNotFound
+	}
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+}
+
+const simulatedLatency = 30 * time.Millisecond
+
+func newTestSimulator(tracer *sdktrace.TracerProvider, model LatencyModel, timeout time.Duration) (*Simulator, *clock.Fake) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewSimulator(SimulatorConfig{
+		BaseURL: "http://goexample1:8080",
+		Model:   model,
+		Timeout: timeout,
+		Tracer:  tracer.Tracer(""),
+		Clock:   fake,
+	})
+	return s, fake
+}
+
+// waitOut runs call, which waits d on fake, and returns its error once the clock was advanced by d
+func waitOut(t *testing.T, fake *clock.Fake, d time.Duration, call func() error) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- call() }()
+
+	fake.BlockUntil(1)
+	fake.Advance(d - time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("call returned %v before its latency of %s passed", err, d)
+	default:
+	}
+	fake.Advance(time.Millisecond)
+	return <-done
+}
+
+// The simulator answers the calls like goexample1, so it can stand in for Client
+func TestSimulatorAnswersLikeClient(t *testing.T) {
+	c, err := New(Config{
+		BaseURL:    "http://goexample1:8080",
+		HTTPClient: &http.Client{Transport: roundTripFunc(goexample1Stub)},
+		Tracer:     noop.NewTracerProvider().Tracer(""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, fake := newTestSimulator(sdktrace.NewTracerProvider(), Normal{Mean: simulatedLatency}, 0)
+
+	tests := []struct {
+		name       string
+		call       func(d downstream) error
+		wantStatus int
+	}{
+		{"hello", func(d downstream) error {
+			body, err := d.Hello(context.Background())
+			if err == nil && body != "hello again\n" {
+				return errors.New("unexpected body " + body)
+			}
+			return err
+		}, 0},
+		{"virtual", func(d downstream) error { return d.Virtual(context.Background(), "ledger") }, 0},
+		{"reserve", func(d downstream) error {
+			return d.ReserveInventory(context.Background(), Reservation{OrderID: "1", Item: "gadget", Quantity: 1})
+		}, 0},
+		{"reserve failure", func(d downstream) error {
+			return d.ReserveInventory(context.Background(), Reservation{OrderID: "1", Item: "gadget", Quantity: 1, FailAt: "reserve"})
+		}, http.StatusInternalServerError},
+		{"release", func(d downstream) error {
+			return d.ReleaseInventory(context.Background(), Reservation{OrderID: "1", Item: "gadget", Quantity: 1})
+		}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, err := range map[string]error{
+				"client":    tt.call(c),
+				"simulator": waitOut(t, fake, simulatedLatency, func() error { return tt.call(s) }),
+			} {
+				var statusErr *StatusError
+				switch {
+				case tt.wantStatus == 0 && err != nil:
+					t.Errorf("%s: error = %v, want nil", name, err)
+				case tt.wantStatus != 0 && (!errors.As(err, &statusErr) || statusErr.Code != tt.wantStatus):
+					t.Errorf("%s: error = %v, want status %d", name, err, tt.wantStatus)
+				}
+			}
+		})
+	}
+}
+
+func TestSimulatorLatency(t *testing.T) {
+	tests := []struct {
+		name    string
+		latency time.Duration
+		timeout time.Duration
+		// Time the call takes on the clock
+		wantWait time.Duration
+		wantErr  error
+	}{
+		{"under timeout", 30 * time.Millisecond, time.Second, 30 * time.Millisecond, nil},
+		{"unbounded", 5 * time.Second, 0, 5 * time.Second, nil},
+		{"over timeout", 5 * time.Second, time.Second, time.Second, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			s, fake := newTestSimulator(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)), Normal{Mean: tt.latency}, tt.timeout)
+			start := fake.Now()
+
+			err := waitOut(t, fake, tt.wantWait, func() error { return s.Virtual(context.Background(), "ledger") })
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Virtual() = %v, want %v", err, tt.wantErr)
+			}
+			if got := clock.Since(fake, start); got != tt.wantWait {
+				t.Errorf("call took %s on the clock, want %s", got, tt.wantWait)
+			}
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("%d spans ended, want 1", len(spans))
+			}
+			attrs := attribute.NewSet(spans[0].Attributes()...)
+			if v, _ := attrs.Value("simulated"); !v.AsBool() {
+				t.Error("span not marked simulated=true")
+			}
+			if v, _ := attrs.Value("simulated.latency_ms"); v.AsInt64() != tt.latency.Milliseconds() {
+				t.Errorf("simulated.latency_ms = %d, want %d", v.AsInt64(), tt.latency.Milliseconds())
+			}
+		})
+	}
+}
+
+func TestSimulatorCanceled(t *testing.T) {
+	s, fake := newTestSimulator(sdktrace.NewTracerProvider(), Normal{Mean: simulatedLatency}, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := waitOut(t, fake, simulatedLatency, func() error { return s.Virtual(ctx, "ledger") })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Virtual() = %v, want context.Canceled", err)
+	}
+}
+
+func TestSimulatorRecordsInjectedFailure(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	s, fake := newTestSimulator(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)), Normal{Mean: simulatedLatency}, 0)
+
+	err := waitOut(t, fake, simulatedLatency, func() error {
+		return s.ReserveInventory(context.Background(), Reservation{OrderID: "1", Item: "gadget", Quantity: 1, FailAt: "reserve"})
+	})
+	if err == nil {
+		t.Fatal("ReserveInventory() = nil, want the injected failure")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("%d spans ended, want 1", len(spans))
+	}
+	for _, e := range spans[0].Events() {
+		if e.Name != "chaos injected" {
+			continue
+		}
+		attrs := attribute.NewSet(e.Attributes...)
+		if v, _ := attrs.Value("chaos.rule"); v.AsString() != chaos.RuleFailAt {
+			t.Errorf("chaos.rule = %q, want %q", v.AsString(), chaos.RuleFailAt)
+		}
+		return
+	}
+	t.Error("injected failure not recorded as a chaos injected event")
+}
@@ -0,0 +1,65 @@
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the time and waits, so code measuring or simulating latency can run against a Fake
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals like time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the wall clock
+type Real struct{}
+
+// Now implements Clock
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Sleep implements Clock
+func (Real) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// NewTicker implements Clock
+func (Real) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// Since returns the time elapsed on c since t
+func Since(c Clock, t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// SleepContext waits d on c, it returns ctx.Err() when ctx is done first
+func SleepContext(ctx context.Context, c Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := c.NewTicker(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,138 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a simulated clock that only moves when Advance is called. Sleepers and
+// tickers fire in time order while advancing, so latency logic runs deterministically
+// and without actually waiting.
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*waiter
+}
+
+// waiter is a pending sleep or ticker
+type waiter struct {
+	at     time.Time
+	period time.Duration // 0 for a one-off sleep
+	c      chan time.Time
+}
+
+// NewFake creates a Fake clock set to start
+func NewFake(start time.Time) *Fake {
+	f := &Fake{now: start}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now implements Clock
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Sleep implements Clock, it returns once the clock was advanced by d
+func (f *Fake) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	<-f.add(d, 0).c
+}
+
+// NewTicker implements Clock
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return &fakeTicker{clock: f, w: f.add(d, d)}
+}
+
+func (f *Fake) add(d, period time.Duration) *waiter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := &waiter{at: f.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	f.waiters = append(f.waiters, w)
+	f.cond.Broadcast()
+	return w
+}
+
+func (f *Fake) remove(w *waiter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removeLocked(w)
+}
+
+// Advance moves the clock forward by d, waking every sleeper and ticker due on the way
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	end := f.now.Add(d)
+	for {
+		next := f.next(end)
+		if next == nil {
+			break
+		}
+		f.now = next.at
+		// Like time.Ticker, a tick is dropped when the previous one was not received yet
+		select {
+		case next.c <- f.now:
+		default:
+		}
+		if next.period > 0 {
+			next.at = next.at.Add(next.period)
+		} else {
+			f.removeLocked(next)
+		}
+	}
+	f.now = end
+}
+
+// next returns the earliest waiter due at or before end
+func (f *Fake) next(end time.Time) *waiter {
+	var next *waiter
+	for _, w := range f.waiters {
+		if !w.at.After(end) && (next == nil || w.at.Before(next.at)) {
+			next = w
+		}
+	}
+	return next
+}
+
+func (f *Fake) removeLocked(w *waiter) {
+	for i, other := range f.waiters {
+		if other == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// BlockUntil waits until n sleepers and tickers are pending, so a test can advance
+// the clock only after the code under test started waiting
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+type fakeTicker struct {
+	clock *Fake
+	w     *waiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.w.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.remove(t.w)
+}
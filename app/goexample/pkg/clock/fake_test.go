@@ -0,0 +1,114 @@
+package clock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeAdvanceMovesNow(t *testing.T) {
+	f := NewFake(epoch)
+	f.Advance(1500 * time.Millisecond)
+	if got := Since(f, epoch); got != 1500*time.Millisecond {
+		t.Errorf("Since(start) = %s, want 1.5s", got)
+	}
+}
+
+func TestFakeSleepWakesWhenAdvanced(t *testing.T) {
+	f := NewFake(epoch)
+	woke := make(chan time.Time, 1)
+	go func() {
+		f.Sleep(time.Second)
+		woke <- f.Now()
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(999 * time.Millisecond)
+	select {
+	case <-woke:
+		t.Fatal("Sleep returned before the clock reached its end")
+	default:
+	}
+
+	f.Advance(time.Millisecond)
+	if got := <-woke; !got.Equal(epoch.Add(time.Second)) {
+		t.Errorf("woke at %s, want %s", got, epoch.Add(time.Second))
+	}
+}
+
+func TestFakeSleepersWakeInTimeOrder(t *testing.T) {
+	f := NewFake(epoch)
+	woke := make(chan time.Duration, 3)
+	for _, d := range []time.Duration{3 * time.Second, time.Second, 2 * time.Second} {
+		go func() {
+			f.Sleep(d)
+			woke <- d
+		}()
+	}
+	f.BlockUntil(3)
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		f.Advance(time.Second)
+		if got := <-woke; got != want {
+			t.Errorf("woke the sleeper of %s, want %s", got, want)
+		}
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(epoch)
+	ticker := f.NewTicker(time.Second)
+
+	for i := 1; i <= 3; i++ {
+		f.Advance(time.Second)
+		select {
+		case got := <-ticker.C():
+			if want := epoch.Add(time.Duration(i) * time.Second); !got.Equal(want) {
+				t.Errorf("tick %d at %s, want %s", i, got, want)
+			}
+		default:
+			t.Fatalf("tick %d not delivered", i)
+		}
+	}
+
+	// Like time.Ticker, the ticks passed while the previous one was not received are dropped
+	f.Advance(5 * time.Second)
+	if got := <-ticker.C(); !got.Equal(epoch.Add(4 * time.Second)) {
+		t.Errorf("pending tick at %s, want the first missed one at %s", got, epoch.Add(4*time.Second))
+	}
+	select {
+	case got := <-ticker.C():
+		t.Errorf("dropped tick at %s delivered", got)
+	default:
+	}
+
+	ticker.Stop()
+	f.Advance(time.Hour)
+	select {
+	case got := <-ticker.C():
+		t.Errorf("stopped ticker ticked at %s", got)
+	default:
+	}
+}
+
+func TestSleepContext(t *testing.T) {
+	f := NewFake(epoch)
+	done := make(chan error, 1)
+	go func() { done <- SleepContext(context.Background(), f, time.Second) }()
+	f.BlockUntil(1)
+	f.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Errorf("SleepContext() = %v, want nil", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { done <- SleepContext(ctx, f, time.Second) }()
+	f.BlockUntil(1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("SleepContext() = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,130 @@
+package errfmt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Error categories, the label values of errors_total
+const (
+	CategoryCanceled   = "canceled"
+	CategoryTimeout    = "timeout"
+	CategoryNetwork    = "network"
+	CategoryRejected   = "rejected"
+	CategoryDependency = "dependency"
+	CategoryInternal   = "internal"
+)
+
+var (
+	errorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "errors_total",
+			Help: "Total number of errors handled through errfmt.Wrap by category",
+		},
+		[]string{"category"},
+	)
+
+	logger = logrus.StandardLogger()
+)
+
+// Register registers the metrics of the package with reg, e.g. prometheus.DefaultRegisterer
+func Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		errorsTotal,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetLogger sets the logger Wrap writes to, the logrus standard logger by default
+func SetLogger(l *logrus.Logger) {
+	logger = l
+}
+
+// categorized is an error carrying an explicit category
+type categorized struct {
+	error
+	category string
+}
+
+func (e categorized) Unwrap() error {
+	return e.error
+}
+
+// WithCategory marks err with a category, overriding the one Category would derive
+func WithCategory(err error, category string) error {
+	if err == nil {
+		return nil
+	}
+	return categorized{error: err, category: category}
+}
+
+// Category returns the category of err: the one set with WithCategory, otherwise
+// canceled, timeout or network for context and network errors and internal for the rest
+func Category(err error) string {
+	var c categorized
+	if errors.As(err, &c) {
+		return c.category
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return CategoryCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return CategoryTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return CategoryTimeout
+	case errors.As(err, &netErr):
+		return CategoryNetwork
+	default:
+		return CategoryInternal
+	}
+}
+
+// Wrap handles an error in one call: it records err on the current span and marks the span
+// as failed, logs msg with trace correlation and counts the error by category.
+// fields are key value pairs added to the log entry and the span's exception event.
+// The returned error wraps err with msg.
+func Wrap(ctx context.Context, err error, msg string, fields ...any) error {
+	if err == nil {
+		return nil
+	}
+	category := Category(err)
+
+	logFields := logrus.Fields{
+		"error":          err,
+		"error_category": category,
+	}
+	attrs := []attribute.KeyValue{attribute.String("error.type", category)}
+	for i := 0; i+1 < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		logFields[key] = fields[i+1]
+		attrs = append(attrs, attribute.String(key, fmt.Sprint(fields[i+1])))
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err, trace.WithAttributes(attrs...))
+	span.SetStatus(codes.Error, msg)
+
+	if sc := span.SpanContext(); sc.IsValid() {
+		logFields["trace_id"] = sc.TraceID().String()
+		logFields["span_id"] = sc.SpanID().String()
+	}
+	logger.WithContext(ctx).WithFields(logFields).Error(msg)
+
+	errorsTotal.WithLabelValues(category).Inc()
+
+	return WithCategory(fmt.Errorf("%s: %w", msg, err), category)
+}
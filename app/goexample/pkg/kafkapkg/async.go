@@ -0,0 +1,215 @@
+package kafkapkg
+
+import (
+	"context"
+	"errors"
+	"goexample/pkg/telemetry"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrQueueFull is returned by PublishAsync when the producer queue has no room left
+	ErrQueueFull = errors.New("kafka async producer queue is full")
+	// ErrProducerClosed is returned by PublishAsync after Close
+	ErrProducerClosed = errors.New("kafka async producer is closed")
+)
+
+const (
+	// How long a worker waits for more messages before writing a partial batch
+	asyncBatchTimeout = 10 * time.Millisecond
+	// Upper bound for writing one batch
+	asyncWriteTimeout = 10 * time.Second
+)
+
+var (
+	asyncQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_async_queue_depth",
+			Help: "Number of messages waiting in the async producer queue",
+		},
+		[]string{"topic"},
+	)
+
+	asyncQueueWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kafka_async_queue_wait_seconds",
+			Help:    "Time messages spent queued in the async producer before being written",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"topic"},
+	)
+
+	asyncBatchSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kafka_async_batch_size",
+			Help:    "Number of messages written per async producer batch",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+		},
+		[]string{"topic"},
+	)
+
+	asyncRejectedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_async_rejected_total",
+			Help: "Total number of messages rejected by the async producer because its queue was full",
+		},
+		[]string{"topic"},
+	)
+)
+
+// AsyncProducer publishes messages in the background. Requests only enqueue, a pool of
+// workers batches the queued messages and writes them, reporting the outcome through callbacks.
+type AsyncProducer struct {
+	writer    Writer
+	topic     string
+	tracer    trace.Tracer
+	batchSize int
+	queue     chan asyncMessage
+	wg        sync.WaitGroup
+
+	// Guards closing the queue against concurrent sends
+	mu     sync.RWMutex
+	closed bool
+}
+
+type asyncMessage struct {
+	msg      kafka.Message
+	link     trace.Link
+	enqueued time.Time
+	callback func(error)
+}
+
+// NewAsyncProducer starts workers goroutines writing batches of up to batchSize messages to writer.
+// At most queueSize messages wait for a worker, further ones are rejected.
+func NewAsyncProducer(writer Writer, topic string, tracer trace.Tracer, workers, queueSize, batchSize int) *AsyncProducer {
+	p := &AsyncProducer{
+		writer:    writer,
+		topic:     topic,
+		tracer:    tracer,
+		batchSize: batchSize,
+		queue:     make(chan asyncMessage, queueSize),
+	}
+	asyncQueueDepth.WithLabelValues(topic).Set(0)
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// PublishAsync queues msg and returns immediately. callback, if not nil, is called from a
+// worker goroutine once the message was delivered or failed. The delivery span links back
+// to the span found in ctx.
+func (p *AsyncProducer) PublishAsync(ctx context.Context, msg kafka.Message, callback func(error)) error {
+	m := asyncMessage{
+		msg:      msg,
+		link:     trace.LinkFromContext(ctx),
+		enqueued: time.Now(),
+		callback: callback,
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrProducerClosed
+	}
+
+	// Counted before sending so a worker never takes the message off the gauge first
+	asyncQueueDepth.WithLabelValues(p.topic).Inc()
+	select {
+	case p.queue <- m:
+		return nil
+	default:
+		asyncQueueDepth.WithLabelValues(p.topic).Dec()
+		asyncRejectedTotal.WithLabelValues(p.topic).Inc()
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting messages and waits for the queued ones to be written
+func (p *AsyncProducer) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+	return nil
+}
+
+func (p *AsyncProducer) work() {
+	defer p.wg.Done()
+
+	for first := range p.queue {
+		batch := p.collect(first)
+		p.deliver(batch)
+	}
+}
+
+// collect adds queued messages to the batch until it is full or the batch timeout elapses
+func (p *AsyncProducer) collect(first asyncMessage) []asyncMessage {
+	batch := []asyncMessage{first}
+	timer := time.NewTimer(asyncBatchTimeout)
+	defer timer.Stop()
+
+	for len(batch) < p.batchSize {
+		select {
+		case m, ok := <-p.queue:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, m)
+		case <-timer.C:
+			return batch
+		}
+	}
+	return batch
+}
+
+// deliver writes a batch in a delivery span linked to the spans that published the messages
+func (p *AsyncProducer) deliver(batch []asyncMessage) {
+	asyncQueueDepth.WithLabelValues(p.topic).Sub(float64(len(batch)))
+	asyncBatchSize.WithLabelValues(p.topic).Observe(float64(len(batch)))
+
+	links := make([]trace.Link, 0, len(batch))
+	msgs := make([]kafka.Message, 0, len(batch))
+	now := time.Now()
+	for _, m := range batch {
+		asyncQueueWait.WithLabelValues(p.topic).Observe(now.Sub(m.enqueued).Seconds())
+		if m.link.SpanContext.IsValid() {
+			links = append(links, m.link)
+		}
+		msgs = append(msgs, m.msg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), asyncWriteTimeout)
+	defer cancel()
+	ctx, span := p.tracer.Start(ctx, "Delivering "+p.topic+" messages",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(telemetry.KafkaAttributes(ClusterForTopic(p.topic).Endpoint(), p.topic)...),
+		trace.WithAttributes(attribute.Int("messaging.batch.message_count", len(batch))),
+	)
+	defer span.End()
+
+	err := p.writer.WriteMessages(ctx, msgs...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "kafka write failed")
+	}
+
+	for _, m := range batch {
+		if m.callback != nil {
+			m.callback(err)
+		}
+	}
+}
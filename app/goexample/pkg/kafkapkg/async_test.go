@@ -0,0 +1,26 @@
+package kafkapkg
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestPublishAsyncAfterClose(t *testing.T) {
+	w := newScriptedWriter()
+	p := NewAsyncProducer(w, "orders", noop.NewTracerProvider().Tracer(""), 1, 1, 1)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := p.PublishAsync(context.Background(), kafka.Message{Value: []byte("late")}, nil)
+	if !errors.Is(err, ErrProducerClosed) {
+		t.Errorf("PublishAsync() after Close = %v, want ErrProducerClosed", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Errorf("second Close() = %v, want nil", err)
+	}
+}
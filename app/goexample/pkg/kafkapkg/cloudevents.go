@@ -0,0 +1,298 @@
+package kafkapkg
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// EventMode is how events are put in Kafka messages, see the CloudEvents Kafka protocol binding
+// (https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/bindings/kafka-protocol-binding.md)
+type EventMode string
+
+// Supported values of the KAFKA_CLOUDEVENTS env variable
+const (
+	// The value is the data, the trace context is in plain headers as before CloudEvents
+	EventModeNone EventMode = "none"
+	// The value is the data, the attributes are in ce_ headers
+	EventModeBinary EventMode = "binary"
+	// The value is a JSON envelope with the attributes and the data
+	EventModeStructured EventMode = "structured"
+)
+
+const (
+	cloudEventsSpecVersion  = "1.0"
+	cloudEventsHeaderPrefix = "ce_"
+	contentTypeHeader       = "content-type"
+	structuredContentType   = "application/cloudevents+json"
+	jsonContentType         = "application/json"
+)
+
+var cloudEventsDecodedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "kafka_cloudevents_decoded_total",
+		Help: "Total number of consumed messages by envelope, mode is binary, structured or none (plain messages), result is valid or invalid",
+	},
+	[]string{"topic", "mode", "result"},
+)
+
+// ParseEventMode parses the KAFKA_CLOUDEVENTS setting, empty is none
+func ParseEventMode(s string) (EventMode, error) {
+	switch mode := EventMode(s); mode {
+	case "":
+		return EventModeNone, nil
+	case EventModeNone, EventModeBinary, EventModeStructured:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown mode %q, expected %s, %s or %s", s, EventModeNone, EventModeBinary, EventModeStructured)
+	}
+}
+
+// Event is a CloudEvents 1.0 event
+type Event struct {
+	ID              string
+	Source          string
+	Type            string
+	Subject         string
+	Time            time.Time
+	DataContentType string
+	Data            []byte
+	// Extension attributes, e.g. traceparent and tracestate of the distributed tracing extension
+	Extensions map[string]string
+}
+
+// NewEvent returns an event with data encoded as JSON and the trace context of ctx in the
+// distributed tracing extension
+func NewEvent(ctx context.Context, id, source, eventType string, data any) (Event, error) {
+	value, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return Event{
+		ID:              id,
+		Source:          source,
+		Type:            eventType,
+		Time:            time.Now().UTC(),
+		DataContentType: jsonContentType,
+		Data:            value,
+		Extensions:      carrier,
+	}, nil
+}
+
+// Context returns ctx with the trace context of the event
+func (e Event) Context(ctx context.Context) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(e.Extensions))
+}
+
+// Attributes returns the span attributes of the event, none for plain messages
+func (e Event) Attributes() []attribute.KeyValue {
+	if e.ID == "" {
+		return nil
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("cloudevents.event_id", e.ID),
+		attribute.String("cloudevents.event_source", e.Source),
+		attribute.String("cloudevents.event_type", e.Type),
+		attribute.String("cloudevents.event_spec_version", cloudEventsSpecVersion),
+	}
+	if e.Subject != "" {
+		attrs = append(attrs, attribute.String("cloudevents.event_subject", e.Subject))
+	}
+	return attrs
+}
+
+// Message encodes the event as the value and headers of a Kafka message, the caller sets the key
+func (e Event) Message(mode EventMode) (kafka.Message, error) {
+	var m kafka.Message
+	switch mode {
+	case EventModeNone:
+		m.Value = e.Data
+		for key, value := range e.Extensions {
+			m.Headers = append(m.Headers, kafka.Header{Key: key, Value: []byte(value)})
+		}
+	case EventModeBinary:
+		m.Value = e.Data
+		for key, value := range e.attributes() {
+			m.Headers = append(m.Headers, kafka.Header{Key: cloudEventsHeaderPrefix + key, Value: []byte(value)})
+		}
+		if e.DataContentType != "" {
+			m.Headers = append(m.Headers, kafka.Header{Key: contentTypeHeader, Value: []byte(e.DataContentType)})
+		}
+	case EventModeStructured:
+		envelope := make(map[string]any, len(e.Extensions)+8)
+		for key, value := range e.attributes() {
+			envelope[key] = value
+		}
+		if e.DataContentType != "" {
+			envelope["datacontenttype"] = e.DataContentType
+		}
+		if isJSON(e.DataContentType) && json.Valid(e.Data) {
+			envelope["data"] = json.RawMessage(e.Data)
+		} else if e.Data != nil {
+			envelope["data_base64"] = base64.StdEncoding.EncodeToString(e.Data)
+		}
+		value, err := json.Marshal(envelope)
+		if err != nil {
+			return kafka.Message{}, err
+		}
+		m.Value = value
+		m.Headers = []kafka.Header{{Key: contentTypeHeader, Value: []byte(structuredContentType)}}
+	default:
+		return kafka.Message{}, fmt.Errorf("unknown event mode %q", mode)
+	}
+	return m, nil
+}
+
+// attributes returns the context attributes of the event besides datacontenttype, by their CloudEvents name
+func (e Event) attributes() map[string]string {
+	attrs := make(map[string]string, len(e.Extensions)+6)
+	for key, value := range e.Extensions {
+		attrs[key] = value
+	}
+	attrs["specversion"] = cloudEventsSpecVersion
+	attrs["id"] = e.ID
+	attrs["source"] = e.Source
+	attrs["type"] = e.Type
+	if e.Subject != "" {
+		attrs["subject"] = e.Subject
+	}
+	if !e.Time.IsZero() {
+		attrs["time"] = e.Time.Format(time.RFC3339Nano)
+	}
+	return attrs
+}
+
+// DecodeEvent returns the event of a consumed message and counts it in kafka_cloudevents_decoded_total.
+// Plain messages are returned with their value as data and the trace context of their headers, so
+// consumers handle producers before and after they switched to CloudEvents.
+func DecodeEvent(m kafka.Message) (Event, EventMode, error) {
+	e, mode, err := decodeEvent(m)
+	result := "valid"
+	if err != nil {
+		result = "invalid"
+	}
+	cloudEventsDecodedTotal.WithLabelValues(m.Topic, string(mode), result).Inc()
+	return e, mode, err
+}
+
+func decodeEvent(m kafka.Message) (Event, EventMode, error) {
+	if HeaderValue(m, cloudEventsHeaderPrefix+"specversion") != "" {
+		attrs := make(map[string]string)
+		for _, h := range m.Headers {
+			if name, ok := strings.CutPrefix(h.Key, cloudEventsHeaderPrefix); ok {
+				attrs[name] = string(h.Value)
+			}
+		}
+		e, err := eventFromAttributes(attrs)
+		e.DataContentType = HeaderValue(m, contentTypeHeader)
+		e.Data = m.Value
+		return e, EventModeBinary, err
+	}
+
+	if strings.HasPrefix(HeaderValue(m, contentTypeHeader), structuredContentType) {
+		var envelope map[string]json.RawMessage
+		if err := json.Unmarshal(m.Value, &envelope); err != nil {
+			return Event{}, EventModeStructured, fmt.Errorf("invalid structured event: %w", err)
+		}
+		attrs := make(map[string]string, len(envelope))
+		var data, dataBase64 json.RawMessage
+		for name, raw := range envelope {
+			switch name {
+			case "data":
+				data = raw
+			case "data_base64":
+				dataBase64 = raw
+			default:
+				var value string
+				if err := json.Unmarshal(raw, &value); err != nil {
+					// Extension attributes of other types are kept in their JSON form
+					value = string(raw)
+				}
+				attrs[name] = value
+			}
+		}
+		contentType := attrs["datacontenttype"]
+		delete(attrs, "datacontenttype")
+		e, err := eventFromAttributes(attrs)
+		e.DataContentType = contentType
+		switch {
+		case dataBase64 != nil:
+			var encoded string
+			if err := json.Unmarshal(dataBase64, &encoded); err != nil {
+				return e, EventModeStructured, fmt.Errorf("invalid data_base64: %w", err)
+			}
+			if e.Data, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+				return e, EventModeStructured, fmt.Errorf("invalid data_base64: %w", err)
+			}
+		case data != nil && isJSON(contentType):
+			e.Data = data
+		case data != nil:
+			// Non JSON data is a JSON string in the envelope
+			var s string
+			if json.Unmarshal(data, &s) == nil {
+				e.Data = []byte(s)
+			} else {
+				e.Data = data
+			}
+		}
+		return e, EventModeStructured, err
+	}
+
+	e := Event{Data: m.Value, Extensions: make(map[string]string)}
+	for _, field := range otel.GetTextMapPropagator().Fields() {
+		if value := HeaderValue(m, field); value != "" {
+			e.Extensions[field] = value
+		}
+	}
+	return e, EventModeNone, nil
+}
+
+// eventFromAttributes moves the context attributes to the event fields, the rest are extensions
+func eventFromAttributes(attrs map[string]string) (Event, error) {
+	e := Event{
+		ID:      attrs["id"],
+		Source:  attrs["source"],
+		Type:    attrs["type"],
+		Subject: attrs["subject"],
+	}
+	version := attrs["specversion"]
+	timestamp := attrs["time"]
+	for _, name := range []string{"specversion", "id", "source", "type", "subject", "time"} {
+		delete(attrs, name)
+	}
+	e.Extensions = attrs
+
+	if version != cloudEventsSpecVersion {
+		return e, fmt.Errorf("unsupported CloudEvents specversion %q", version)
+	}
+	if e.ID == "" || e.Source == "" || e.Type == "" {
+		return e, errors.New("event is missing one of the required id, source and type attributes")
+	}
+	if timestamp != "" {
+		t, err := time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return e, fmt.Errorf("invalid event time: %w", err)
+		}
+		e.Time = t
+	}
+	return e, nil
+}
+
+// isJSON tells if data of contentType is embedded as JSON in structured events, as with no content type
+func isJSON(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	return mediaType == "" || mediaType == jsonContentType || strings.HasSuffix(mediaType, "+json")
+}
@@ -1,18 +1,252 @@
 package kafkapkg
 
 import (
+	"context"
+	"fmt"
+	"math/rand/v2"
 	"os"
+	"strconv"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/segmentio/kafka-go"
+	metadataAPI "github.com/segmentio/kafka-go/protocol/metadata"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Supported values of the KAFKA_BALANCER env variable
+const (
+	BalancerLeastBytes = "least-bytes"
+	BalancerHash       = "hash"
+	BalancerRoundRobin = "round-robin"
+)
+
+// MessageIDHeader carries a producer assigned unique ID used to detect redelivered messages
+const MessageIDHeader = "message-id"
+
+var (
+	producedMessagesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_produced_messages_total",
+			Help: "Total number of messages produced to Kafka per partition",
+		},
+		[]string{"topic", "partition", "result"},
+	)
+
+	producedUncompressedBytesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_produced_uncompressed_bytes_total",
+			Help: "Total size of the keys, values and headers of the messages produced to Kafka",
+		},
+		[]string{"topic", "codec"},
+	)
+
+	producedCompressedBytesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_produced_compressed_bytes_total",
+			Help: "Estimated size of the produced messages after compression with the writer's codec, extrapolated from a sample of the batches",
+		},
+		[]string{"topic", "codec"},
+	)
+)
+
+// Register registers the metrics of the package with reg, e.g. prometheus.DefaultRegisterer
+func Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		producedMessagesTotal,
+		producedUncompressedBytesTotal,
+		producedCompressedBytesTotal,
+		asyncQueueDepth,
+		asyncQueueWait,
+		asyncBatchSize,
+		asyncRejectedTotal,
+		produceErrorsTotal,
+		produceRetriesTotal,
+		topicClusterInfo,
+		connectionsOpenedTotal,
+		connectionFailuresTotal,
+		cloudEventsDecodedTotal,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetBalancer returns the partition balancer for the given name, least-bytes for an empty name and
+// an error for an unknown one
+func GetBalancer(name string) (kafka.Balancer, error) {
+	switch name {
+	case "", BalancerLeastBytes:
+		return &kafka.LeastBytes{}, nil
+	case BalancerHash:
+		// Messages with the same key always land on the same partition
+		return &kafka.Hash{}, nil
+	case BalancerRoundRobin:
+		return &kafka.RoundRobin{}, nil
+	default:
+		return nil, fmt.Errorf("unknown kafka balancer %q, want %s, %s or %s", name, BalancerLeastBytes, BalancerHash, BalancerRoundRobin)
+	}
+}
+
+// GetCompression returns the codec for the given name (none, gzip, snappy, lz4 or zstd), none for
+// an empty name and an error for an unknown one
+func GetCompression(name string) (kafka.Compression, error) {
+	if name == "" {
+		return 0, nil
+	}
+	var c kafka.Compression
+	if err := c.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown kafka compression %q, want none, gzip, snappy, lz4 or zstd", name)
+	}
+	return c, nil
+}
+
+// GetKafkaWriter creates a writer of topic on the cluster of the topic, see LoadClusters. It makes
+// a single attempt per write, wrap it with NewRetryingWriter to retry the transient errors.
 func GetKafkaWriter(topic string) *kafka.Writer {
+	// KAFKA_COMPRESSION and KAFKA_BALANCER are checked by the configuration of the services, an
+	// unknown codec sends uncompressed and an unknown balancer picks the least-bytes partition
+	compression, _ := GetCompression(os.Getenv("KAFKA_COMPRESSION"))
+	balancer, err := GetBalancer(os.Getenv("KAFKA_BALANCER"))
+	if err != nil {
+		balancer = &kafka.LeastBytes{}
+	}
+	cluster := ClusterForTopic(topic)
 	return &kafka.Writer{
-		Addr:                   kafka.TCP(os.Getenv("KAFKA_ENDPOINT")),
+		Addr:                   kafka.TCP(cluster.Brokers...),
+		Transport:              cluster.transport(),
 		Topic:                  topic,
-		Balancer:               &kafka.LeastBytes{},
+		Balancer:               balancer,
+		Compression:            compression,
 		AllowAutoTopicCreation: true,
 		BatchTimeout:           10 * time.Millisecond,
+		// Retries follow the per cause policies of RetryingWriter
+		MaxAttempts: 1,
+		Completion: func(messages []kafka.Message, err error) {
+			recordProduced(topic, messages, err)
+			cluster.recordSASLFailure(err)
+			if err == nil {
+				recordBytes(topic, compression, messages)
+			}
+		},
+	}
+}
+
+// WarmWriter fetches the metadata of the topic of w through the transport of w, as its first write
+// would: the transport connects to the brokers and caches the partitions, and the brokers create
+// the topic when the writer allows it. The partitions are recorded on the span of ctx.
+func WarmWriter(ctx context.Context, w *kafka.Writer) error {
+	transport := w.Transport
+	if transport == nil {
+		transport = kafka.DefaultTransport
+	}
+	res, err := transport.RoundTrip(ctx, w.Addr, &metadataAPI.Request{
+		TopicNames:             []string{w.Topic},
+		AllowAutoTopicCreation: w.AllowAutoTopicCreation,
+	})
+	if err != nil {
+		return err
+	}
+	for _, t := range res.(*metadataAPI.Response).Topics {
+		if t.Name != w.Topic {
+			continue
+		}
+		if t.ErrorCode != 0 {
+			return fmt.Errorf("metadata of topic %s: %w", w.Topic, kafka.Error(t.ErrorCode))
+		}
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Int("messaging.kafka.partitions", len(t.Partitions)))
+		return nil
 	}
+	return fmt.Errorf("metadata of topic %s: %w", w.Topic, kafka.UnknownTopicOrPartition)
+}
+
+// GetKafkaReader creates a consumer group reader of topic on the cluster of the topic.
+// A new group starts at the end of the topic rather than replaying its retention.
+func GetKafkaReader(topic, groupID string) *kafka.Reader {
+	cluster := ClusterForTopic(topic)
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     cluster.Brokers,
+		Dialer:      cluster.Dialer(),
+		ErrorLogger: cluster.errorLogger(),
+		GroupID:     groupID,
+		Topic:       topic,
+		StartOffset: kafka.LastOffset,
+		// Results are small and awaited, do not wait for a batch to fill up
+		MaxWait: 100 * time.Millisecond,
+	})
+}
+
+// HeaderValue returns the value of the first header with the given key
+func HeaderValue(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// recordProduced counts written messages by the partition the balancer picked
+func recordProduced(topic string, messages []kafka.Message, err error) {
+	if err != nil {
+		// Partitions are only filled in on success
+		producedMessagesTotal.WithLabelValues(topic, "unknown", "error").Add(float64(len(messages)))
+		return
+	}
+	for _, m := range messages {
+		producedMessagesTotal.WithLabelValues(topic, strconv.Itoa(m.Partition), "success").Inc()
+	}
+}
+
+// Fraction of the written batches compressed again to estimate the compressed size
+const compressionSampleRate = 0.05
+
+// recordBytes counts the size of written messages before and after compression. kafka-go does not
+// report compressed sizes, so a compressionSampleRate fraction of the batches is compressed again
+// with the same codec and its size scaled up by the inverse of the rate.
+func recordBytes(topic string, compression kafka.Compression, messages []kafka.Message) {
+	codec := compression.String()
+
+	var uncompressed int
+	for _, m := range messages {
+		uncompressed += len(m.Key) + len(m.Value)
+		for _, h := range m.Headers {
+			uncompressed += len(h.Key) + len(h.Value)
+		}
+	}
+	producedUncompressedBytesTotal.WithLabelValues(topic, codec).Add(float64(uncompressed))
+
+	if compression.Codec() == nil {
+		producedCompressedBytesTotal.WithLabelValues(topic, codec).Add(float64(uncompressed))
+		return
+	}
+
+	if rand.Float64() >= compressionSampleRate {
+		return
+	}
+	counter := &byteCounter{}
+	w := compression.Codec().NewWriter(counter)
+	for _, m := range messages {
+		_, _ = w.Write(m.Key)
+		_, _ = w.Write(m.Value)
+		for _, h := range m.Headers {
+			_, _ = w.Write([]byte(h.Key))
+			_, _ = w.Write(h.Value)
+		}
+	}
+	_ = w.Close()
+	producedCompressedBytesTotal.WithLabelValues(topic, codec).Add(float64(counter.n) / compressionSampleRate)
+}
+
+// byteCounter is an io.Writer discarding everything but the number of bytes
+type byteCounter struct {
+	n int
+}
+
+func (c *byteCounter) Write(b []byte) (int, error) {
+	c.n += len(b)
+	return len(b), nil
 }
@@ -0,0 +1,52 @@
+package kafkapkg
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestGetCompression(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    kafka.Compression
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"none", 0, false},
+		{"zstd", kafka.Zstd, false},
+		{"snappy", kafka.Snappy, false},
+		{"brotli", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetCompression(tt.name)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("GetCompression() = %v, %v, want %v and error %t", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetBalancer(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    kafka.Balancer
+		wantErr bool
+	}{
+		{"", &kafka.LeastBytes{}, false},
+		{BalancerLeastBytes, &kafka.LeastBytes{}, false},
+		{BalancerHash, &kafka.Hash{}, false},
+		{BalancerRoundRobin, &kafka.RoundRobin{}, false},
+		{"round_robin", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetBalancer(tt.name)
+			if (err != nil) != tt.wantErr || fmt.Sprintf("%T", got) != fmt.Sprintf("%T", tt.want) {
+				t.Errorf("GetBalancer() = %T, %v, want %T and error %t", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package kafkapkg
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Writer is implemented by *kafka.Writer and MemoryWriter
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Reader is implemented by *kafka.Reader and MemoryWriter
+type Reader interface {
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+	Close() error
+}
+
+// Number of messages a MemoryWriter buffers before writes block
+const memoryQueueSize = 1024
+
+// ErrWriterClosed is returned by MemoryWriter.WriteMessages after Close
+var ErrWriterClosed = errors.New("kafka memory writer is closed")
+
+// MemoryWriter is a channel backed stand-in for a Kafka topic, used when running without a broker
+type MemoryWriter struct {
+	topic    string
+	messages chan kafka.Message
+
+	// Closed first by Close, wakes the writers blocked on a full queue
+	done      chan struct{}
+	closeOnce sync.Once
+	// Held for reading by writers so that messages is not closed under them
+	mu sync.RWMutex
+}
+
+// NewMemoryWriter creates an in-memory queue for topic
+func NewMemoryWriter(topic string) *MemoryWriter {
+	return &MemoryWriter{
+		topic:    topic,
+		messages: make(chan kafka.Message, memoryQueueSize),
+		done:     make(chan struct{}),
+	}
+}
+
+// WriteMessages queues the messages, blocking while the queue is full.
+// Like kafka.Writer it fails right away when ctx is already done or the writer is closed.
+func (w *MemoryWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	select {
+	case <-w.done:
+		recordProduced(w.topic, msgs, ErrWriterClosed)
+		return ErrWriterClosed
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		recordProduced(w.topic, msgs, err)
+		return err
+	}
+	written := make([]kafka.Message, 0, len(msgs))
+	for _, m := range msgs {
+		m.Topic = w.topic
+		m.Time = time.Now()
+		select {
+		case w.messages <- m:
+			written = append(written, m)
+		case <-ctx.Done():
+			recordProduced(w.topic, written, nil)
+			recordProduced(w.topic, msgs[len(written):], ctx.Err())
+			return ctx.Err()
+		case <-w.done:
+			recordProduced(w.topic, written, nil)
+			recordProduced(w.topic, msgs[len(written):], ErrWriterClosed)
+			return ErrWriterClosed
+		}
+	}
+	recordProduced(w.topic, written, nil)
+	return nil
+}
+
+// Close stops accepting messages, Messages is closed once drained
+func (w *MemoryWriter) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		// Waits for the writers woken by done
+		w.mu.Lock()
+		close(w.messages)
+		w.mu.Unlock()
+	})
+	return nil
+}
+
+// ReadMessage takes the next queued message, io.EOF once the queue is closed and drained
+func (w *MemoryWriter) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case m, ok := <-w.messages:
+		if !ok {
+			return kafka.Message{}, io.EOF
+		}
+		return m, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+// Messages returns the queued messages in write order
+func (w *MemoryWriter) Messages() <-chan kafka.Message {
+	return w.messages
+}
@@ -0,0 +1,40 @@
+package kafkapkg
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestMemoryWriterCloseWakesBlockedWriter(t *testing.T) {
+	w := NewMemoryWriter("hello")
+	for range memoryQueueSize {
+		if err := w.WriteMessages(context.Background(), kafka.Message{Value: []byte("queued")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- w.WriteMessages(context.Background(), kafka.Message{Value: []byte("blocked")}) }()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("blocked WriteMessages() = %v, want ErrWriterClosed", err)
+	}
+	if err := w.WriteMessages(context.Background(), kafka.Message{Value: []byte("late")}); !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("WriteMessages() after Close = %v, want ErrWriterClosed", err)
+	}
+
+	for range memoryQueueSize {
+		if _, err := w.ReadMessage(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := w.ReadMessage(context.Background()); !errors.Is(err, io.EOF) {
+		t.Errorf("ReadMessage() of a drained writer = %v, want io.EOF", err)
+	}
+}
@@ -0,0 +1,195 @@
+package kafkapkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goexample/pkg/clock"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Causes of failed produce attempts, the reason label of kafka_produce_errors_total and the keys
+// of KAFKA_RETRY_POLICIES
+const (
+	ProduceErrorLeaderNotAvailable = "leader_not_available"
+	ProduceErrorMessageTooLarge    = "message_too_large"
+	ProduceErrorTimeout            = "timeout"
+	ProduceErrorNetwork            = "network"
+	ProduceErrorCanceled           = "canceled"
+	ProduceErrorOther              = "other"
+)
+
+var (
+	produceErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_produce_errors_total",
+			Help: "Total number of failed Kafka produce attempts by cause, retryable tells whether the cause is retried",
+		},
+		[]string{"reason", "retryable"},
+	)
+
+	produceRetriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_produce_retries_total",
+			Help: "Total number of Kafka produce attempts repeated after a retryable error, by cause",
+		},
+		[]string{"reason"},
+	)
+)
+
+// ClassifyProduceError returns the cause of a failed write, ProduceErrorOther when unknown
+func ClassifyProduceError(err error) string {
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) {
+		// Messages of one batch usually fail for the same cause
+		for _, e := range writeErrs {
+			if e != nil {
+				return ClassifyProduceError(e)
+			}
+		}
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, kafka.LeaderNotAvailable), errors.Is(err, kafka.NotLeaderForPartition):
+		return ProduceErrorLeaderNotAvailable
+	case errors.Is(err, kafka.MessageSizeTooLarge):
+		return ProduceErrorMessageTooLarge
+	case errors.Is(err, kafka.RequestTimedOut), errors.Is(err, context.DeadlineExceeded):
+		return ProduceErrorTimeout
+	case errors.Is(err, context.Canceled):
+		return ProduceErrorCanceled
+	case errors.As(err, &netErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ProduceErrorNetwork
+	default:
+		return ProduceErrorOther
+	}
+}
+
+// RetryPolicy is how often and how fast a write failing for one cause is attempted
+type RetryPolicy struct {
+	// Total attempts including the first one, 1 makes the cause fatal
+	Attempts int
+	// Wait before the second attempt, doubled for each further attempt
+	Backoff time.Duration
+}
+
+// Retryable tells whether a failed write is attempted again
+func (p RetryPolicy) Retryable() bool {
+	return p.Attempts > 1
+}
+
+func (p RetryPolicy) String() string {
+	return strconv.Itoa(p.Attempts) + "/" + p.Backoff.String()
+}
+
+// RetryPolicies are the retry policies by produce error reason, causes without a policy are fatal
+type RetryPolicies map[string]RetryPolicy
+
+// DefaultRetryPolicies retries the transient causes. Oversized messages never fit and
+// cancellations come from the caller, retrying them only delays the error.
+func DefaultRetryPolicies() RetryPolicies {
+	return RetryPolicies{
+		ProduceErrorLeaderNotAvailable: {Attempts: 4, Backoff: 250 * time.Millisecond},
+		ProduceErrorTimeout:            {Attempts: 2, Backoff: 100 * time.Millisecond},
+		ProduceErrorNetwork:            {Attempts: 3, Backoff: 100 * time.Millisecond},
+		ProduceErrorMessageTooLarge:    {Attempts: 1},
+		ProduceErrorCanceled:           {Attempts: 1},
+		ProduceErrorOther:              {Attempts: 1},
+	}
+}
+
+// ParseRetryPolicies parses KAFKA_RETRY_POLICIES ("leader_not_available=4/250ms,timeout=1") over
+// the defaults, as attempts optionally followed by the initial backoff
+func ParseRetryPolicies(spec string) (RetryPolicies, error) {
+	policies := DefaultRetryPolicies()
+	for _, pair := range strings.Split(spec, ",") {
+		reason, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid retry policy %q", pair)
+		}
+		policy, known := policies[reason]
+		if !known {
+			return nil, fmt.Errorf("unknown produce error reason %q", reason)
+		}
+		attempts, backoff, hasBackoff := strings.Cut(value, "/")
+		n, err := strconv.Atoi(attempts)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid attempts for produce error reason %q: %q", reason, attempts)
+		}
+		policy.Attempts = n
+		if hasBackoff {
+			d, err := time.ParseDuration(backoff)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid backoff for produce error reason %q: %q", reason, backoff)
+			}
+			policy.Backoff = d
+		}
+		policies[reason] = policy
+	}
+	return policies, nil
+}
+
+// RetryingWriter retries failed writes following the policy of their cause. Writers built by
+// GetKafkaWriter make a single attempt, so the policies alone decide about retries.
+type RetryingWriter struct {
+	Writer
+	policies RetryPolicies
+	clock    clock.Clock
+}
+
+// NewRetryingWriter wraps w with the given retry policies
+func NewRetryingWriter(w Writer, policies RetryPolicies) *RetryingWriter {
+	return &RetryingWriter{Writer: w, policies: policies, clock: clock.Real{}}
+}
+
+// WriteMessages writes msgs, attempting the failed messages again while their cause is
+// retryable. Every failed attempt is counted and added as event to the span of ctx, the
+// error of the last attempt is returned.
+func (w *RetryingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	span := trace.SpanFromContext(ctx)
+	for attempt := 1; ; attempt++ {
+		err := w.Writer.WriteMessages(ctx, msgs...)
+		if err == nil {
+			return nil
+		}
+
+		reason := ClassifyProduceError(err)
+		policy := w.policies[reason]
+		produceErrorsTotal.WithLabelValues(reason, strconv.FormatBool(policy.Retryable())).Inc()
+		span.AddEvent("kafka produce error", trace.WithAttributes(
+			attribute.String("messaging.kafka.produce_error.reason", reason),
+			attribute.Int("messaging.kafka.produce_attempt", attempt),
+		))
+		span.SetAttributes(attribute.String("messaging.kafka.produce_error.reason", reason))
+
+		if attempt >= policy.Attempts || ctx.Err() != nil {
+			return err
+		}
+		// Only the messages of the batch that failed are written again
+		var writeErrs kafka.WriteErrors
+		if errors.As(err, &writeErrs) && len(writeErrs) == len(msgs) {
+			failed := make([]kafka.Message, 0, writeErrs.Count())
+			for i, e := range writeErrs {
+				if e != nil {
+					failed = append(failed, msgs[i])
+				}
+			}
+			msgs = failed
+		}
+
+		if clock.SleepContext(ctx, w.clock, policy.Backoff<<(attempt-1)) != nil {
+			return err
+		}
+		produceRetriesTotal.WithLabelValues(reason).Inc()
+	}
+}
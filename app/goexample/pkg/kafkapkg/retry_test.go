@@ -0,0 +1,120 @@
+package kafkapkg
+
+import (
+	"context"
+	"errors"
+	"goexample/pkg/clock"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// scriptedWriter fails its writes with the errors of script in turn and reports every attempt on calls
+type scriptedWriter struct {
+	script []error
+	calls  chan []kafka.Message
+}
+
+func newScriptedWriter(script ...error) *scriptedWriter {
+	return &scriptedWriter{script: script, calls: make(chan []kafka.Message, len(script)+1)}
+}
+
+func (w *scriptedWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.calls <- msgs
+	if len(w.script) == 0 {
+		return nil
+	}
+	err := w.script[0]
+	w.script = w.script[1:]
+	return err
+}
+
+func (w *scriptedWriter) Close() error {
+	return nil
+}
+
+func newFakeRetryingWriter(w Writer, policies RetryPolicies) (*RetryingWriter, *clock.Fake) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	rw := NewRetryingWriter(w, policies)
+	rw.clock = fake
+	return rw, fake
+}
+
+func TestRetryingWriterBacksOffExponentially(t *testing.T) {
+	w := newScriptedWriter(kafka.LeaderNotAvailable, kafka.LeaderNotAvailable)
+	rw, fake := newFakeRetryingWriter(w, RetryPolicies{
+		ProduceErrorLeaderNotAvailable: {Attempts: 4, Backoff: 250 * time.Millisecond},
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- rw.WriteMessages(context.Background(), kafka.Message{Value: []byte("hello")}) }()
+
+	<-w.calls
+	for _, backoff := range []time.Duration{250 * time.Millisecond, 500 * time.Millisecond} {
+		fake.BlockUntil(1)
+		fake.Advance(backoff - time.Millisecond)
+		select {
+		case <-w.calls:
+			t.Fatalf("attempted again before the backoff of %s passed", backoff)
+		default:
+		}
+		fake.Advance(time.Millisecond)
+		<-w.calls
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("WriteMessages() = %v, want nil after the third attempt", err)
+	}
+}
+
+func TestRetryingWriterRetriesOnlyFailedMessages(t *testing.T) {
+	w := newScriptedWriter(kafka.WriteErrors{nil, kafka.LeaderNotAvailable, nil})
+	rw, fake := newFakeRetryingWriter(w, DefaultRetryPolicies())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- rw.WriteMessages(context.Background(),
+			kafka.Message{Value: []byte("a")}, kafka.Message{Value: []byte("b")}, kafka.Message{Value: []byte("c")})
+	}()
+
+	<-w.calls
+	fake.BlockUntil(1)
+	fake.Advance(DefaultRetryPolicies()[ProduceErrorLeaderNotAvailable].Backoff)
+	retried := <-w.calls
+	if len(retried) != 1 || string(retried[0].Value) != "b" {
+		t.Errorf("retried %d messages, want only b", len(retried))
+	}
+	if err := <-done; err != nil {
+		t.Errorf("WriteMessages() = %v, want nil", err)
+	}
+}
+
+func TestRetryingWriterFatalCause(t *testing.T) {
+	w := newScriptedWriter(kafka.MessageSizeTooLarge)
+	rw, _ := newFakeRetryingWriter(w, DefaultRetryPolicies())
+
+	err := rw.WriteMessages(context.Background(), kafka.Message{Value: []byte("large")})
+	if !errors.Is(err, kafka.MessageSizeTooLarge) {
+		t.Errorf("WriteMessages() = %v, want MessageSizeTooLarge", err)
+	}
+	if n := len(w.calls); n != 1 {
+		t.Errorf("%d attempts, want 1", n)
+	}
+}
+
+func TestRetryingWriterStopsBackoffOnCancel(t *testing.T) {
+	w := newScriptedWriter(kafka.LeaderNotAvailable)
+	rw, fake := newFakeRetryingWriter(w, DefaultRetryPolicies())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- rw.WriteMessages(ctx, kafka.Message{Value: []byte("hello")}) }()
+
+	<-w.calls
+	fake.BlockUntil(1)
+	cancel()
+	if err := <-done; !errors.Is(err, kafka.LeaderNotAvailable) {
+		t.Errorf("WriteMessages() = %v, want the error of the last attempt", err)
+	}
+}
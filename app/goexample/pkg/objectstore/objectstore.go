@@ -0,0 +1,260 @@
+package objectstore
+
+import (
+	"context"
+	"fmt"
+	"goexample/pkg/telemetry"
+	"io"
+	"os"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Operations recorded on spans and metrics, named after the S3 API calls
+const (
+	OperationPutObject    = "PutObject"
+	OperationBucketExists = "HeadBucket"
+	OperationMakeBucket   = "CreateBucket"
+)
+
+const (
+	// Bucket used when OBJECT_STORE_BUCKET is not set
+	defaultBucket = "goexample"
+	// Part size of the multipart uploads of objects of unknown size. minio-go otherwise sizes the
+	// part buffer for the largest possible object, about 528MiB per upload.
+	unknownSizePartSize = 16 << 20
+)
+
+var (
+	operationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "object_store_operation_duration_seconds",
+			Help:    "Duration of the object storage operations, result is success or error",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"operation", "result"},
+	)
+
+	transferredBytesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "object_store_transferred_bytes_total",
+			Help: "Total number of object bytes written or read, by operation",
+		},
+		[]string{"operation"},
+	)
+)
+
+// Register registers the metrics of the package with reg, e.g. prometheus.DefaultRegisterer
+func Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{operationDuration, transferredBytesTotal} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Config of the S3 compatible object storage, e.g. MinIO
+type Config struct {
+	// host:port of the S3 API, the object storage is disabled when empty
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	TLS       bool
+}
+
+// ConfigFromEnv reads OBJECT_STORE_ENDPOINT, OBJECT_STORE_ACCESS_KEY, OBJECT_STORE_SECRET_KEY,
+// OBJECT_STORE_BUCKET and OBJECT_STORE_TLS
+func ConfigFromEnv() Config {
+	bucket := os.Getenv("OBJECT_STORE_BUCKET")
+	if bucket == "" {
+		bucket = defaultBucket
+	}
+	return Config{
+		Endpoint:  os.Getenv("OBJECT_STORE_ENDPOINT"),
+		AccessKey: os.Getenv("OBJECT_STORE_ACCESS_KEY"),
+		SecretKey: os.Getenv("OBJECT_STORE_SECRET_KEY"),
+		Bucket:    bucket,
+		TLS:       os.Getenv("OBJECT_STORE_TLS") == "true",
+	}
+}
+
+// Enabled tells whether an object storage endpoint is configured
+func (c Config) Enabled() bool {
+	return c.Endpoint != ""
+}
+
+// Object describes a stored object
+type Object struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	Size   int64  `json:"size"`
+	ETag   string `json:"etag,omitempty"`
+}
+
+// backend performs the operations against one bucket
+type backend interface {
+	put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (Object, error)
+	bucketExists(ctx context.Context) (bool, error)
+	makeBucket(ctx context.Context) error
+}
+
+// Store reads and writes objects of one bucket, each operation in a client span of the "minio"
+// peer service so object storage shows up in the service graph
+type Store struct {
+	backend  backend
+	bucket   string
+	endpoint string
+	tracer   trace.Tracer
+}
+
+// New connects to the object storage of cfg, nothing is sent until the first operation
+func New(cfg Config, tracer trace.Tracer) (*Store, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.TLS,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid object storage configuration: %w", err)
+	}
+	return &Store{
+		backend:  minioBackend{client: client, bucket: cfg.Bucket},
+		bucket:   cfg.Bucket,
+		endpoint: cfg.Endpoint,
+		tracer:   tracer,
+	}, nil
+}
+
+// NewDiscard returns a Store accepting the objects without keeping them, for standalone runs. Its
+// operations create the same spans and metrics as those of a real object storage.
+func NewDiscard(tracer trace.Tracer) *Store {
+	return &Store{
+		backend:  discardBackend{},
+		bucket:   defaultBucket,
+		endpoint: "discard:9000",
+		tracer:   tracer,
+	}
+}
+
+// Put stores the object read from r under key, size is -1 when unknown which makes it a multipart upload
+func (s *Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (Object, error) {
+	var obj Object
+	err := s.do(ctx, OperationPutObject, key, func(ctx context.Context) (int64, error) {
+		var err error
+		obj, err = s.backend.put(ctx, key, r, size, contentType)
+		return obj.Size, err
+	})
+	return obj, err
+}
+
+// EnsureBucket creates the bucket unless it exists, call it at startup
+func (s *Store) EnsureBucket(ctx context.Context) error {
+	var exists bool
+	err := s.do(ctx, OperationBucketExists, "", func(ctx context.Context) (int64, error) {
+		var err error
+		exists, err = s.backend.bucketExists(ctx)
+		return 0, err
+	})
+	if err != nil || exists {
+		return err
+	}
+	return s.do(ctx, OperationMakeBucket, "", func(ctx context.Context) (int64, error) {
+		return 0, s.backend.makeBucket(ctx)
+	})
+}
+
+// Bucket returns the name of the bucket of the store
+func (s *Store) Bucket() string {
+	return s.bucket
+}
+
+// Endpoint returns the host:port of the object storage
+func (s *Store) Endpoint() string {
+	return s.endpoint
+}
+
+// do runs op in a client span and records its duration and the bytes it transferred
+func (s *Store) do(ctx context.Context, operation, key string, op func(ctx context.Context) (int64, error)) error {
+	attrs := append(telemetry.PeerAttributes("minio", s.endpoint),
+		attribute.String("rpc.system", "aws-api"),
+		attribute.String("rpc.service", "S3"),
+		attribute.String("rpc.method", operation),
+		attribute.String("aws.s3.bucket", s.bucket),
+	)
+	if key != "" {
+		attrs = append(attrs, attribute.String("aws.s3.key", key))
+	}
+	ctx, span := s.tracer.Start(ctx, "S3."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	defer span.End()
+
+	start := time.Now()
+	n, err := op(ctx)
+	result := "success"
+	if err != nil {
+		result = "error"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if code := minio.ToErrorResponse(err).Code; code != "" {
+			span.SetAttributes(attribute.String("error.type", code))
+		}
+	}
+	operationDuration.WithLabelValues(operation, result).Observe(time.Since(start).Seconds())
+	if n > 0 {
+		transferredBytesTotal.WithLabelValues(operation).Add(float64(n))
+		span.SetAttributes(attribute.Int64("aws.s3.object_size", n))
+	}
+	return err
+}
+
+type minioBackend struct {
+	client *minio.Client
+	bucket string
+}
+
+func (b minioBackend) put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (Object, error) {
+	opts := minio.PutObjectOptions{ContentType: contentType}
+	if size < 0 {
+		opts.PartSize = unknownSizePartSize
+	}
+	info, err := b.client.PutObject(ctx, b.bucket, key, r, size, opts)
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{Bucket: info.Bucket, Key: info.Key, Size: info.Size, ETag: info.ETag}, nil
+}
+
+func (b minioBackend) bucketExists(ctx context.Context) (bool, error) {
+	return b.client.BucketExists(ctx, b.bucket)
+}
+
+func (b minioBackend) makeBucket(ctx context.Context) error {
+	err := b.client.MakeBucket(ctx, b.bucket, minio.MakeBucketOptions{})
+	// Another instance may have created it in the meantime
+	if code := minio.ToErrorResponse(err).Code; code == "BucketAlreadyOwnedByYou" || code == "BucketAlreadyExists" {
+		return nil
+	}
+	return err
+}
+
+// discardBackend reads the objects to the end without keeping them
+type discardBackend struct{}
+
+func (discardBackend) put(_ context.Context, key string, r io.Reader, _ int64, _ string) (Object, error) {
+	n, err := io.Copy(io.Discard, r)
+	return Object{Bucket: defaultBucket, Key: key, Size: n}, err
+}
+
+func (discardBackend) bucketExists(context.Context) (bool, error) {
+	return true, nil
+}
+
+func (discardBackend) makeBucket(context.Context) error {
+	return nil
+}
@@ -0,0 +1,269 @@
+package otlpreceiver
+
+import (
+	"compress/gzip"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	collogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// Traces kept for the web view, the oldest are dropped first
+	maxTraces = 200
+	// Upper bound of an export request body
+	maxBodySize = 16 << 20
+)
+
+// Span is the summary of a received span
+type Span struct {
+	TraceID, SpanID, ParentID string
+	Service, Name, Kind       string
+	Start                     time.Time
+	Duration                  time.Duration
+	Error                     bool
+}
+
+// Trace is the spans received so far for one trace ID
+type Trace struct {
+	ID       string
+	Spans    []Span
+	Received time.Time
+}
+
+// Root returns the span without a parent, or the earliest span while the root is still missing
+func (t *Trace) Root() Span {
+	root := t.Spans[0]
+	for _, s := range t.Spans {
+		if s.ParentID == "" {
+			return s
+		}
+		if s.Start.Before(root.Start) {
+			root = s
+		}
+	}
+	return root
+}
+
+// Duration is the time from the first span start to the last span end
+func (t *Trace) Duration() time.Duration {
+	var start, end time.Time
+	for i, s := range t.Spans {
+		if i == 0 || s.Start.Before(start) {
+			start = s.Start
+		}
+		if e := s.Start.Add(s.Duration); e.After(end) {
+			end = e
+		}
+	}
+	return end.Sub(start)
+}
+
+// Errors counts the spans with an error status
+func (t *Trace) Errors() int {
+	n := 0
+	for _, s := range t.Spans {
+		if s.Error {
+			n++
+		}
+	}
+	return n
+}
+
+// Receiver is a minimal OTLP/HTTP receiver for demos without a collector. It accepts
+// traces, metrics and logs in protobuf or JSON encoding, prints a line per received trace
+// and metric batch and keeps the last traces for its web view.
+type Receiver struct {
+	out io.Writer
+
+	mu     sync.Mutex
+	traces map[string]*Trace
+	order  []string
+	logs   int
+	// Metric data points received and the exemplars among them
+	points, exemplars int
+}
+
+// New creates a receiver printing trace summaries to out
+func New(out io.Writer) *Receiver {
+	return &Receiver{out: out, traces: make(map[string]*Trace)}
+}
+
+// Handler returns the OTLP endpoints (/v1/traces, /v1/metrics, /v1/logs) and the web view (/)
+func (r *Receiver) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/traces", r.exportTraces)
+	mux.HandleFunc("POST /v1/metrics", r.exportMetrics)
+	mux.HandleFunc("POST /v1/logs", r.exportLogs)
+	mux.HandleFunc("GET /{$}", r.listTraces)
+	mux.HandleFunc("GET /traces/{id}", r.showTrace)
+	return mux
+}
+
+func (r *Receiver) exportTraces(w http.ResponseWriter, req *http.Request) {
+	var export coltrace.ExportTraceServiceRequest
+	if err := decode(req, &export); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, t := range r.add(export.GetResourceSpans()) {
+		root := t.Root()
+		fmt.Fprintf(r.out, "otlp trace %s %s %q spans=%d errors=%d duration=%s\n",
+			t.ID, root.Service, root.Name, len(t.Spans), t.Errors(), t.Duration())
+	}
+	respond(w, req, &coltrace.ExportTraceServiceResponse{})
+}
+
+func (r *Receiver) exportMetrics(w http.ResponseWriter, req *http.Request) {
+	var export colmetrics.ExportMetricsServiceRequest
+	if err := decode(req, &export); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	metrics, points, exemplars := 0, 0, 0
+	for _, rm := range export.GetResourceMetrics() {
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				metrics++
+				for _, dp := range m.GetSum().GetDataPoints() {
+					points++
+					exemplars += len(dp.GetExemplars())
+				}
+				for _, dp := range m.GetHistogram().GetDataPoints() {
+					points++
+					exemplars += len(dp.GetExemplars())
+				}
+				points += len(m.GetGauge().GetDataPoints()) + len(m.GetSummary().GetDataPoints()) +
+					len(m.GetExponentialHistogram().GetDataPoints())
+			}
+		}
+	}
+	r.mu.Lock()
+	r.points += points
+	r.exemplars += exemplars
+	r.mu.Unlock()
+	fmt.Fprintf(r.out, "otlp metrics metrics=%d points=%d exemplars=%d\n", metrics, points, exemplars)
+	respond(w, req, &colmetrics.ExportMetricsServiceResponse{})
+}
+
+func (r *Receiver) exportLogs(w http.ResponseWriter, req *http.Request) {
+	var export collogs.ExportLogsServiceRequest
+	if err := decode(req, &export); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n := 0
+	for _, rl := range export.GetResourceLogs() {
+		for _, sl := range rl.GetScopeLogs() {
+			n += len(sl.GetLogRecords())
+		}
+	}
+	r.mu.Lock()
+	r.logs += n
+	r.mu.Unlock()
+	respond(w, req, &collogs.ExportLogsServiceResponse{})
+}
+
+// add stores the spans and returns the traces they belong to, in the order first seen
+func (r *Receiver) add(resourceSpans []*tracepb.ResourceSpans) []*Trace {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var touched []*Trace
+	for _, rs := range resourceSpans {
+		service := "unknown"
+		for _, attr := range rs.GetResource().GetAttributes() {
+			if attr.GetKey() == "service.name" {
+				service = attr.GetValue().GetStringValue()
+			}
+		}
+		for _, ss := range rs.GetScopeSpans() {
+			for _, s := range ss.GetSpans() {
+				span := Span{
+					TraceID:  hex.EncodeToString(s.GetTraceId()),
+					SpanID:   hex.EncodeToString(s.GetSpanId()),
+					ParentID: hex.EncodeToString(s.GetParentSpanId()),
+					Service:  service,
+					Name:     s.GetName(),
+					Kind:     strings.ToLower(strings.TrimPrefix(s.GetKind().String(), "SPAN_KIND_")),
+					Start:    time.Unix(0, int64(s.GetStartTimeUnixNano())),
+					Duration: time.Duration(s.GetEndTimeUnixNano() - s.GetStartTimeUnixNano()),
+					Error:    s.GetStatus().GetCode() == tracepb.Status_STATUS_CODE_ERROR,
+				}
+				t := r.trace(span.TraceID)
+				t.Spans = append(t.Spans, span)
+				if !slices.Contains(touched, t) {
+					touched = append(touched, t)
+				}
+			}
+		}
+	}
+	return touched
+}
+
+// trace returns the stored trace of id, creating it and dropping the oldest trace when full
+func (r *Receiver) trace(id string) *Trace {
+	if t, ok := r.traces[id]; ok {
+		return t
+	}
+	if len(r.order) >= maxTraces {
+		delete(r.traces, r.order[0])
+		r.order = r.order[1:]
+	}
+	t := &Trace{ID: id, Received: time.Now()}
+	r.traces[id] = t
+	r.order = append(r.order, id)
+	return t
+}
+
+// decode reads an export request in the encoding given by its Content-Type
+func decode(req *http.Request, msg proto.Message) error {
+	body := io.Reader(req.Body)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(req.Body)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		body = gz
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxBodySize))
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		return protojson.Unmarshal(data, msg)
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+// respond writes the export response in the encoding of the request
+func respond(w http.ResponseWriter, req *http.Request, msg proto.Message) {
+	var (
+		data []byte
+		err  error
+	)
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		data, err = protojson.Marshal(msg)
+	} else {
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		data, err = proto.Marshal(msg)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(data)
+}
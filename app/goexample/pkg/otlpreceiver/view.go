@@ -0,0 +1,123 @@
+package otlpreceiver
+
+import (
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+var listTemplate = template.Must(template.New("list").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta http-equiv="refresh" content="5"><title>Traces</title></head>
+<body style="font-family: sans-serif">
+<h1>Received traces</h1>
+<p>{{.Logs}} log records and {{.Points}} metric data points ({{.Exemplars}} exemplars) received</p>
+<table cellpadding="4">
+<tr><th align="left">Trace</th><th align="left">Root span</th><th>Spans</th><th>Errors</th><th>Duration</th></tr>
+{{range .Traces}}{{$root := .Root}}
+<tr>
+<td><a href="/traces/{{.ID}}"><code>{{.ID}}</code></a></td>
+<td>{{$root.Service}}: {{$root.Name}}</td>
+<td>{{len .Spans}}</td>
+<td>{{.Errors}}</td>
+<td>{{.Duration}}</td>
+</tr>
+{{else}}<tr><td colspan="5">No traces yet</td></tr>{{end}}
+</table>
+</body></html>
+`))
+
+var traceTemplate = template.Must(template.New("trace").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Trace {{.ID}}</title></head>
+<body style="font-family: sans-serif">
+<p><a href="/">All traces</a></p>
+<h1>Trace <code>{{.ID}}</code></h1>
+<table cellpadding="4">
+<tr><th align="left">Span</th><th align="left">Service</th><th>Kind</th><th>Offset</th><th>Duration</th></tr>
+{{range .Rows}}
+<tr{{if .Error}} style="color: #c00"{{end}}>
+<td style="padding-left: {{.Indent}}em">{{.Name}}</td>
+<td>{{.Service}}</td>
+<td>{{.Kind}}</td>
+<td>{{.Offset}}</td>
+<td>{{.Duration}}</td>
+</tr>
+{{end}}
+</table>
+</body></html>
+`))
+
+// spanRow is a span of the trace view, indented by its depth in the span tree
+type spanRow struct {
+	Span
+	Indent int
+	Offset time.Duration
+}
+
+// listTraces handles GET /, the received traces, newest first
+func (r *Receiver) listTraces(w http.ResponseWriter, _ *http.Request) {
+	r.mu.Lock()
+	traces := make([]Trace, 0, len(r.order))
+	for i := len(r.order) - 1; i >= 0; i-- {
+		t := r.traces[r.order[i]]
+		traces = append(traces, Trace{ID: t.ID, Spans: slices.Clone(t.Spans), Received: t.Received})
+	}
+	logs, points, exemplars := r.logs, r.points, r.exemplars
+	r.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = listTemplate.Execute(w, map[string]any{"Traces": traces, "Logs": logs, "Points": points, "Exemplars": exemplars})
+}
+
+// showTrace handles GET /traces/{id}, the span tree of one trace
+func (r *Receiver) showTrace(w http.ResponseWriter, req *http.Request) {
+	id := strings.ToLower(req.PathValue("id"))
+	r.mu.Lock()
+	t, ok := r.traces[id]
+	var spans []Span
+	if ok {
+		spans = slices.Clone(t.Spans)
+	}
+	r.mu.Unlock()
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = traceTemplate.Execute(w, map[string]any{"ID": id, "Rows": spanTree(spans)})
+}
+
+// spanTree orders spans depth first by start time, spans whose parent was not received are roots
+func spanTree(spans []Span) []spanRow {
+	ids := make(map[string]bool, len(spans))
+	children := make(map[string][]Span)
+	var start time.Time
+	for i, s := range spans {
+		ids[s.SpanID] = true
+		if i == 0 || s.Start.Before(start) {
+			start = s.Start
+		}
+	}
+	for _, s := range spans {
+		parent := s.ParentID
+		if !ids[parent] {
+			parent = ""
+		}
+		children[parent] = append(children[parent], s)
+	}
+
+	var rows []spanRow
+	var walk func(parent string, depth int)
+	walk = func(parent string, depth int) {
+		list := children[parent]
+		slices.SortFunc(list, func(a, b Span) int { return a.Start.Compare(b.Start) })
+		for _, s := range list {
+			rows = append(rows, spanRow{Span: s, Indent: depth * 2, Offset: s.Start.Sub(start)})
+			walk(s.SpanID, depth+1)
+		}
+	}
+	walk("", 0)
+	return rows
+}
@@ -0,0 +1,197 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells when a job runs next
+type Schedule interface {
+	// Next returns the first run strictly after t
+	Next(t time.Time) time.Time
+	String() string
+}
+
+// Every returns the schedule of a job run at a fixed interval
+func Every(interval time.Duration) Schedule {
+	return every(interval)
+}
+
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func (e every) String() string {
+	return "@every " + time.Duration(e).String()
+}
+
+// Predefined schedules accepted by ParseSchedule
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseSchedule parses a standard 5 field cron expression (minute, hour, day of month, month and day
+// of week, e.g. "*/15 9-17 * * 1-5"), a descriptor like @hourly or @daily, or "@every 30s"
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if interval, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid schedule %q: expected a positive duration", spec)
+		}
+		return Every(d), nil
+	}
+	expr := spec
+	if strings.HasPrefix(spec, "@") {
+		var ok bool
+		if expr, ok = descriptors[spec]; !ok {
+			return nil, fmt.Errorf("invalid schedule %q: unknown descriptor", spec)
+		}
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields, got %d", spec, len(fields))
+	}
+	c := cron{spec: spec}
+	var err error
+	for i, f := range []struct {
+		set      *uint64
+		min, max int
+	}{
+		{&c.minutes, 0, 59},
+		{&c.hours, 0, 23},
+		{&c.days, 1, 31},
+		{&c.months, 1, 12},
+		{&c.weekdays, 0, 7},
+	} {
+		if *f.set, err = parseField(fields[i], f.min, f.max); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+	}
+	// 7 is Sunday too
+	if c.weekdays&(1<<7) != 0 {
+		c.weekdays |= 1
+	}
+	// As in cron, a job restricted on both days runs when either matches
+	c.anyDay = fields[2] == "*" || fields[4] == "*"
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("invalid schedule %q: it never runs", spec)
+	}
+	return c, nil
+}
+
+// cron is a parsed cron expression, each field a bit set of its allowed values
+type cron struct {
+	spec                                   string
+	minutes, hours, days, months, weekdays uint64
+	anyDay                                 bool
+}
+
+// parseField parses a comma separated list of *, values and ranges, each with an optional /step
+func parseField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepSpec, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepSpec); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			first, last, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(first); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(last); err != nil {
+					return 0, fmt.Errorf("invalid value in %q", part)
+				}
+			} else if hasStep {
+				// "5/15" runs from 5 to the end of the range
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// Longest a search for the next run goes, e.g. "0 0 30 2 *" never runs
+const maxCronSearch = 5 * 366 * 24 * time.Hour
+
+func (c cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxCronSearch)
+	for t.Before(limit) {
+		switch {
+		case c.months&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hours&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minutes&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c cron) dayMatches(t time.Time) bool {
+	day := c.days&(1<<t.Day()) != 0
+	weekday := c.weekdays&(1<<int(t.Weekday())) != 0
+	if c.anyDay {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+func (c cron) String() string {
+	return c.spec
+}
+
+// ParseSchedules parses the schedules of named jobs separated by semicolons,
+// e.g. "self_report=*/5 * * * *;watchdog=@every 30s"
+func ParseSchedules(spec string) (map[string]Schedule, error) {
+	schedules := make(map[string]Schedule)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, expr, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid job schedule %q, expected name=schedule", entry)
+		}
+		schedule, err := ParseSchedule(expr)
+		if err != nil {
+			return nil, err
+		}
+		schedules[strings.TrimSpace(name)] = schedule
+	}
+	return schedules, nil
+}
@@ -0,0 +1,219 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"goexample/pkg/clock"
+	"goexample/pkg/telemetry"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+var (
+	jobRunDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "scheduled_job_duration_seconds",
+			Help:    "Duration of the scheduled job runs, result is success or failure",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"job_name", "result"},
+	)
+
+	jobLastSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "scheduled_job_last_success_timestamp_seconds",
+			Help: "Unix time the last successful run of the job ended",
+		},
+		[]string{"job_name"},
+	)
+
+	jobLastFailure = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "scheduled_job_last_failure_timestamp_seconds",
+			Help: "Unix time the last failed run of the job ended",
+		},
+		[]string{"job_name"},
+	)
+
+	jobNextRun = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "scheduled_job_next_run_timestamp_seconds",
+			Help: "Unix time the job is scheduled to run next",
+		},
+		[]string{"job_name"},
+	)
+
+	jobMissedRunsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scheduled_job_missed_runs_total",
+			Help: "Total number of scheduled runs skipped because the previous run of the job was still going",
+		},
+		[]string{"job_name"},
+	)
+)
+
+// Register registers the metrics of the package with reg, e.g. prometheus.DefaultRegisterer
+func Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		jobRunDuration,
+		jobLastSuccess,
+		jobLastFailure,
+		jobNextRun,
+		jobMissedRunsTotal,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Job is a function run by the Scheduler on its schedule
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler runs background jobs at fixed intervals or on cron schedules, each run in its own trace
+type Scheduler struct {
+	logger *logrus.Logger
+	clock  clock.Clock
+	tracer trace.Tracer
+	jobs   []Job
+}
+
+// New creates an empty Scheduler ticking on clk, tracer records a root span per job run and may be nil
+func New(logger *logrus.Logger, clk clock.Clock, tracer trace.Tracer) *Scheduler {
+	if tracer == nil {
+		tracer = noop.NewTracerProvider().Tracer("")
+	}
+	return &Scheduler{logger: logger, clock: clk, tracer: tracer}
+}
+
+// Every registers fn to be run every interval once the scheduler is started
+func (s *Scheduler) Every(name string, interval time.Duration, fn func(ctx context.Context) error) {
+	s.Add(name, Every(interval), fn)
+}
+
+// Add registers fn to be run on schedule once the scheduler is started
+func (s *Scheduler) Add(name string, schedule Schedule, fn func(ctx context.Context) error) {
+	s.jobs = append(s.jobs, Job{Name: name, Schedule: schedule, Run: fn})
+}
+
+// Reschedule replaces the schedules of the registered jobs by name, e.g. from JOB_SCHEDULES.
+// Unknown names are an error so a typo does not silently keep the default schedule.
+func (s *Scheduler) Reschedule(schedules map[string]Schedule) error {
+	known := make(map[string]bool, len(s.jobs))
+	for i := range s.jobs {
+		known[s.jobs[i].Name] = true
+		if schedule, ok := schedules[s.jobs[i].Name]; ok {
+			s.jobs[i].Schedule = schedule
+		}
+	}
+	for name := range schedules {
+		if !known[name] {
+			return fmt.Errorf("unknown job %q, the jobs are %v", name, s.names())
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) names() []string {
+	names := make([]string, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		names = append(names, job.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Start runs every registered job in its own goroutine until ctx is done
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		s.logger.WithFields(logrus.Fields{
+			"job":      job.Name,
+			"schedule": job.Schedule.String(),
+		}).Info("Scheduled job")
+		go s.loop(ctx, job)
+	}
+}
+
+// loop waits for the scheduled times of job and runs it. Runs are never concurrent: the scheduled
+// times passed while a run was going are skipped and counted as missed.
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	next := job.Schedule.Next(s.clock.Now())
+	for {
+		if next.IsZero() {
+			s.logger.WithField("job", job.Name).Error("Scheduled job never runs, its schedule has no next time")
+			return
+		}
+		jobNextRun.WithLabelValues(job.Name).Set(float64(next.Unix()))
+
+		wait := s.clock.NewTicker(max(next.Sub(s.clock.Now()), time.Millisecond))
+		select {
+		case <-ctx.Done():
+			wait.Stop()
+			return
+		case <-wait.C():
+			wait.Stop()
+		}
+
+		s.run(ctx, job, next)
+
+		now := s.clock.Now()
+		missed := 0
+		for next = job.Schedule.Next(next); !next.IsZero() && !next.After(now); next = job.Schedule.Next(next) {
+			missed++
+		}
+		if missed > 0 {
+			jobMissedRunsTotal.WithLabelValues(job.Name).Add(float64(missed))
+			s.logger.WithFields(logrus.Fields{
+				"job":    job.Name,
+				"missed": missed,
+			}).Warn("Scheduled job overran its schedule, runs were skipped")
+		}
+	}
+}
+
+// run runs job in a new trace and records its result
+func (s *Scheduler) run(ctx context.Context, job Job, scheduled time.Time) {
+	ctx, span := s.tracer.Start(ctx, "Scheduled job "+job.Name,
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			attribute.String("job.name", job.Name),
+			attribute.String("job.schedule", job.Schedule.String()),
+			attribute.String("job.scheduled_time", scheduled.UTC().Format(time.RFC3339)),
+		),
+	)
+	defer span.End()
+
+	start := s.clock.Now()
+	err := job.Run(ctx)
+	end := s.clock.Now()
+	span.SetAttributes(attribute.Int64("job.delay_ms", start.Sub(scheduled).Milliseconds()))
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		jobLastFailure.WithLabelValues(job.Name).Set(float64(end.Unix()))
+		telemetry.WithTrace(s.logger, ctx).WithFields(logrus.Fields{
+			"job":   job.Name,
+			"error": err,
+		}).Error("Scheduled job failed")
+	} else {
+		jobLastSuccess.WithLabelValues(job.Name).Set(float64(end.Unix()))
+	}
+	jobRunDuration.WithLabelValues(job.Name, result).Observe(end.Sub(start).Seconds())
+	span.SetAttributes(attribute.String("job.result", result))
+}
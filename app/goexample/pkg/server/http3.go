@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// Observed for every listener, compares the latency of HTTP/1.1, HTTP/2 and HTTP/3
+var protocolRequestDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "http_protocol_request_duration_seconds",
+		Help:    "Duration of HTTP requests per protocol (http/1.0, http/1.1, http/2 or http/3)",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"protocol"},
+)
+
+// ProtocolVersion returns the HTTP version of req as network.protocol.version: 1.0, 1.1, 2 or 3
+func ProtocolVersion(req *http.Request) string {
+	switch req.ProtoMajor {
+	case 1:
+		if req.ProtoMinor == 0 {
+			return "1.0"
+		}
+		return "1.1"
+	case 2:
+		return "2"
+	case 3:
+		return "3"
+	}
+	return req.Proto
+}
+
+// observeProtocol records the duration of a request by its HTTP version
+func observeProtocol(req *http.Request, duration time.Duration) {
+	protocolRequestDuration.WithLabelValues("http/" + ProtocolVersion(req)).Observe(duration.Seconds())
+}
+
+// newHTTP3Server opens the UDP socket of an HTTP/3 listener and creates a server counting its QUIC
+// connections. Queue and first request times are only measured for TCP listeners.
+func newHTTP3Server(l Listener, handler http.Handler, certs *certificates) (*http3.Server, net.PacketConn, error) {
+	config, err := certs.tlsConfig(l)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := net.ListenPacket(l.Network, l.Address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	srv := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(config),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			handler.ServeHTTP(w, req)
+			listenerRequestDuration.WithLabelValues(l.Name).Observe(time.Since(start).Seconds())
+			observeProtocol(req, time.Since(start))
+		}),
+		ConnContext: func(ctx context.Context, c *quic.Conn) context.Context {
+			connectionsTotal.WithLabelValues(l.Name).Inc()
+			connectionsActive.WithLabelValues(l.Name).Inc()
+			go func() {
+				<-c.Context().Done()
+				connectionsActive.WithLabelValues(l.Name).Dec()
+			}()
+			return ctx
+		},
+	}
+	return srv, conn, nil
+}
+
+// advertiseHTTP3 adds the Alt-Svc header announcing the HTTP/3 listeners to the responses of
+// handler, so clients of the TLS listeners can switch to HTTP/3
+func advertiseHTTP3(servers []*http3.Server, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for _, srv := range servers {
+			// Fails only until the server has started serving
+			_ = srv.SetQUICHeaders(w.Header())
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"fmt"
+	"os"
+)
+
+// Listener is one address the service is reachable on
+type Listener struct {
+	// Label value of the listener metrics: http, https, http3 or unix
+	Name string
+	// tcp, unix or udp for HTTP/3
+	Network string
+	Address string
+	// Serve TLS with this certificate and key, a self-signed certificate when empty
+	TLS      bool
+	CertFile string
+	KeyFile  string
+}
+
+// ListenersFromEnv reads the listeners from HTTP_ADDR (default :8080), HTTPS_ADDR with
+// TLS_CERT_FILE and TLS_KEY_FILE, HTTP3_ADDR (UDP, same certificate) and UNIX_SOCKET.
+// An empty HTTP_ADDR disables plain HTTP.
+func ListenersFromEnv() ([]Listener, error) {
+	var listeners []Listener
+
+	addr, ok := os.LookupEnv("HTTP_ADDR")
+	if !ok {
+		addr = ":8080"
+	}
+	if addr != "" {
+		listeners = append(listeners, Listener{Name: "http", Network: "tcp", Address: addr})
+	}
+
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if addr := os.Getenv("HTTPS_ADDR"); addr != "" {
+		listeners = append(listeners, Listener{
+			Name:     "https",
+			Network:  "tcp",
+			Address:  addr,
+			TLS:      true,
+			CertFile: certFile,
+			KeyFile:  keyFile,
+		})
+	}
+	if addr := os.Getenv("HTTP3_ADDR"); addr != "" {
+		listeners = append(listeners, Listener{
+			Name:     "http3",
+			Network:  "udp",
+			Address:  addr,
+			TLS:      true,
+			CertFile: certFile,
+			KeyFile:  keyFile,
+		})
+	}
+
+	if path := os.Getenv("UNIX_SOCKET"); path != "" {
+		listeners = append(listeners, Listener{Name: "unix", Network: "unix", Address: path})
+	}
+
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("no listener configured, set HTTP_ADDR, HTTPS_ADDR, HTTP3_ADDR or UNIX_SOCKET")
+	}
+	return listeners, nil
+}
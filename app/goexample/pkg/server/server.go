@@ -0,0 +1,279 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	connectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_listener_connections_total",
+			Help: "Total number of connections accepted per listener",
+		},
+		[]string{"listener"},
+	)
+
+	connectionsActive = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "http_listener_connections_active",
+			Help: "Number of open connections per listener",
+		},
+		[]string{"listener"},
+	)
+
+	// Observed on the connection's first request, for https this includes the TLS handshake
+	firstRequestLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_listener_first_request_seconds",
+			Help:    "Time from accepting a connection until its first request is read, per listener",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		},
+		[]string{"listener"},
+	)
+
+	// For a connection's first request this includes the TLS handshake and reading the headers
+	queueTime = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_server_queue_time_seconds",
+			Help:    "Time from accepting a connection, or reading the request of a kept alive one, until the handler starts, per listener",
+			Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		},
+		[]string{"listener"},
+	)
+
+	listenerRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_listener_request_duration_seconds",
+			Help:    "Duration of HTTP requests per listener",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"listener"},
+	)
+)
+
+// Register registers the metrics of the package with reg, e.g. prometheus.DefaultRegisterer
+func Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		connectionsTotal,
+		connectionsActive,
+		firstRequestLatency,
+		queueTime,
+		listenerRequestDuration,
+		protocolRequestDuration,
+		socketCollector{},
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Servers serve a handler on a set of listeners
+type Servers struct {
+	servers []*http.Server
+	h3      []*http3.Server
+	// UDP sockets of the HTTP/3 servers, they are not closed by the servers
+	packetConns []net.PacketConn
+	errs        chan error
+}
+
+// Start listens on every listener and serves handler on them in the background. With an HTTP/3
+// listener the responses of the TLS listeners announce it in Alt-Svc.
+func Start(logger *logrus.Logger, listeners []Listener, handler http.Handler) (*Servers, error) {
+	s := &Servers{errs: make(chan error, len(listeners))}
+	certs := newCertificates()
+	for _, l := range listeners {
+		if l.Network != "udp" {
+			continue
+		}
+		srv, conn, err := newHTTP3Server(l, handler, certs)
+		if err != nil {
+			_ = s.Shutdown(context.Background())
+			return nil, err
+		}
+		logger.WithFields(logrus.Fields{
+			"listener": l.Name,
+			"address":  l.Address,
+		}).Info("Listening")
+
+		s.h3 = append(s.h3, srv)
+		s.packetConns = append(s.packetConns, conn)
+		go func() {
+			if err := srv.Serve(conn); !errors.Is(err, http.ErrServerClosed) {
+				s.errs <- err
+			}
+		}()
+	}
+
+	for _, l := range listeners {
+		if l.Network == "udp" {
+			continue
+		}
+		h := handler
+		if l.TLS && len(s.h3) > 0 {
+			h = advertiseHTTP3(s.h3, handler)
+		}
+		srv, ln, err := newServer(l, h, certs)
+		if err != nil {
+			_ = s.Shutdown(context.Background())
+			return nil, err
+		}
+		logger.WithFields(logrus.Fields{
+			"listener": l.Name,
+			"address":  l.Address,
+		}).Info("Listening")
+
+		s.servers = append(s.servers, srv)
+		go func() {
+			if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+				s.errs <- err
+			}
+		}()
+	}
+	return s, nil
+}
+
+// Errors receives the error of a listener failing to serve
+func (s *Servers) Errors() <-chan error {
+	return s.errs
+}
+
+// Shutdown stops accepting connections and waits for the in-flight requests until ctx is done
+func (s *Servers) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, srv := range s.servers {
+		errs = append(errs, srv.Shutdown(ctx))
+	}
+	for _, srv := range s.h3 {
+		errs = append(errs, srv.Shutdown(ctx))
+	}
+	for _, conn := range s.packetConns {
+		errs = append(errs, conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// newServer opens the listener and creates a server counting its connections
+func newServer(l Listener, handler http.Handler, certs *certificates) (*http.Server, net.Listener, error) {
+	if l.Network == "unix" {
+		// A socket left behind by a previous run makes listen fail
+		if err := os.Remove(l.Address); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, nil, err
+		}
+	}
+	ln, err := net.Listen(l.Network, l.Address)
+	if err != nil {
+		return nil, nil, err
+	}
+	if l.TLS {
+		config, err := certs.tlsConfig(l)
+		if err != nil {
+			ln.Close()
+			return nil, nil, err
+		}
+		ln = tls.NewListener(ln, config)
+	}
+
+	conns := &connTracker{listener: l.Name, conns: make(map[net.Conn]*connTimes)}
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			if since, ok := conns.queuedSince(req.Context()); ok {
+				queued := start.Sub(since)
+				queueTime.WithLabelValues(l.Name).Observe(queued.Seconds())
+				req = req.WithContext(context.WithValue(req.Context(), queueTimeKey{}, queued))
+			}
+			handler.ServeHTTP(w, req)
+			listenerRequestDuration.WithLabelValues(l.Name).Observe(time.Since(start).Seconds())
+			observeProtocol(req, time.Since(start))
+		}),
+		ConnState: conns.connState,
+		// Lets the handler find the times of its connection
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			return context.WithValue(ctx, connKey{}, conn)
+		},
+	}
+	return srv, ln, nil
+}
+
+type (
+	connKey      struct{}
+	queueTimeKey struct{}
+)
+
+// QueueTime returns how long the request waited before the handler started: since its connection
+// was accepted for the first request of a connection, since the request was read for later ones
+func QueueTime(ctx context.Context) (time.Duration, bool) {
+	d, ok := ctx.Value(queueTimeKey{}).(time.Duration)
+	return d, ok
+}
+
+// connTracker updates the connection metrics of one listener
+type connTracker struct {
+	listener string
+
+	mu    sync.Mutex
+	conns map[net.Conn]*connTimes
+}
+
+type connTimes struct {
+	accepted time.Time
+	// Start of the queue time of the current request
+	queuedSince time.Time
+	// Set once the first request was read
+	served bool
+}
+
+func (t *connTracker) connState(conn net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	switch state {
+	case http.StateNew:
+		connectionsTotal.WithLabelValues(t.listener).Inc()
+		connectionsActive.WithLabelValues(t.listener).Inc()
+		t.conns[conn] = &connTimes{accepted: now, queuedSince: now}
+	case http.StateActive:
+		times, ok := t.conns[conn]
+		if !ok {
+			return
+		}
+		if !times.served {
+			firstRequestLatency.WithLabelValues(t.listener).Observe(now.Sub(times.accepted).Seconds())
+			times.served = true
+			return
+		}
+		times.queuedSince = now
+	case http.StateClosed, http.StateHijacked:
+		connectionsActive.WithLabelValues(t.listener).Dec()
+		delete(t.conns, conn)
+	}
+}
+
+// queuedSince returns the start of the queue time of the request on the connection in ctx
+func (t *connTracker) queuedSince(ctx context.Context) (time.Time, bool) {
+	conn, ok := ctx.Value(connKey{}).(net.Conn)
+	if !ok {
+		return time.Time{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	times, ok := t.conns[conn]
+	if !ok {
+		return time.Time{}, false
+	}
+	return times.queuedSince, true
+}
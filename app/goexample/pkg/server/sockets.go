@@ -0,0 +1,90 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	tcpConnectionsDesc = prometheus.NewDesc(
+		"tcp_connections",
+		"Number of TCP connections on the ports the service listens on by state, e.g. established, time_wait or close_wait",
+		[]string{"port", "state"}, nil,
+	)
+
+	listenBacklogDesc = prometheus.NewDesc(
+		"tcp_listen_backlog",
+		"Number of connections accepted by the kernel waiting for the service to accept them, per listening port",
+		[]string{"port"}, nil,
+	)
+
+	listenBacklogLimitDesc = prometheus.NewDesc(
+		"tcp_listen_backlog_limit",
+		"Size of the accept queue of the listening port, net.core.somaxconn which Go listens with, connections are dropped once tcp_listen_backlog reaches it",
+		[]string{"port"}, nil,
+	)
+)
+
+// socket is a TCP socket of the network namespace
+type socket struct {
+	port  int
+	state string
+	// For listening sockets the length of the accept queue
+	backlog uint64
+	inode   uint64
+}
+
+// Connection states always exported per port, so a leak shows as a rise from zero
+var baseStates = []string{"established", "time_wait", "close_wait"}
+
+// socketCollector exports the state of the sockets of the service's TCP ports, read from /proc on
+// every scrape. The ports are the ones of the listening sockets the process holds, other
+// operating systems export nothing.
+type socketCollector struct{}
+
+// Describe implements prometheus.Collector
+func (socketCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tcpConnectionsDesc
+	ch <- listenBacklogDesc
+	ch <- listenBacklogLimitDesc
+}
+
+// Collect implements prometheus.Collector
+func (socketCollector) Collect(ch chan<- prometheus.Metric) {
+	sockets, owned, err := readSockets()
+	if err != nil {
+		return
+	}
+	limit, limitErr := listenBacklogLimit()
+
+	listening := make(map[int]bool)
+	for _, s := range sockets {
+		if s.state == "listen" && owned[s.inode] && !listening[s.port] {
+			listening[s.port] = true
+			port := strconv.Itoa(s.port)
+			ch <- prometheus.MustNewConstMetric(listenBacklogDesc, prometheus.GaugeValue, float64(s.backlog), port)
+			if limitErr == nil {
+				ch <- prometheus.MustNewConstMetric(listenBacklogLimitDesc, prometheus.GaugeValue, float64(limit), port)
+			}
+		}
+	}
+
+	counts := make(map[int]map[string]int)
+	for port := range listening {
+		counts[port] = make(map[string]int)
+		for _, state := range baseStates {
+			counts[port][state] = 0
+		}
+	}
+	for _, s := range sockets {
+		if s.state != "listen" && listening[s.port] {
+			counts[s.port][s.state]++
+		}
+	}
+	for port, states := range counts {
+		for state, n := range states {
+			ch <- prometheus.MustNewConstMetric(tcpConnectionsDesc, prometheus.GaugeValue, float64(n), strconv.Itoa(port), state)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// States of the st column of /proc/net/tcp
+var tcpStates = map[string]string{
+	"01": "established",
+	"02": "syn_sent",
+	"03": "syn_recv",
+	"04": "fin_wait1",
+	"05": "fin_wait2",
+	"06": "time_wait",
+	"07": "close",
+	"08": "close_wait",
+	"09": "last_ack",
+	"0A": "listen",
+	"0B": "closing",
+}
+
+// readSockets returns the TCP sockets of the network namespace and the inodes of the sockets the
+// process holds
+func readSockets() ([]socket, map[uint64]bool, error) {
+	var sockets []socket
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		s, err := readProcNetTCP(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// No IPv6 support
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		sockets = append(sockets, s...)
+	}
+
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return nil, nil, err
+	}
+	owned := make(map[uint64]bool)
+	for _, fd := range fds {
+		target, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name()))
+		if err != nil {
+			// Closed since the directory was read
+			continue
+		}
+		if inode, ok := strings.CutPrefix(target, "socket:["); ok {
+			if n, err := strconv.ParseUint(strings.TrimSuffix(inode, "]"), 10, 64); err == nil {
+				owned[n] = true
+			}
+		}
+	}
+	return sockets, owned, nil
+}
+
+// readProcNetTCP parses the lines of /proc/net/tcp or tcp6:
+//
+//	sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ...
+func readProcNetTCP(path string) ([]socket, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sockets []socket
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		_, portHex, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseUint(portHex, 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid local address %q", path, fields[1])
+		}
+		state, ok := tcpStates[fields[3]]
+		if !ok {
+			continue
+		}
+		// rx_queue of a listening socket is its accept queue
+		_, rx, _ := strings.Cut(fields[4], ":")
+		backlog, _ := strconv.ParseUint(rx, 16, 64)
+		inode, _ := strconv.ParseUint(fields[9], 10, 64)
+		sockets = append(sockets, socket{
+			port:    int(port),
+			state:   state,
+			backlog: backlog,
+			inode:   inode,
+		})
+	}
+	return sockets, scanner.Err()
+}
+
+// listenBacklogLimit returns net.core.somaxconn, the backlog Go passes to listen and the kernel caps it to
+func listenBacklogLimit() (int, error) {
+	data, err := os.ReadFile("/proc/sys/net/core/somaxconn")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
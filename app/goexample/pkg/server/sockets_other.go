@@ -0,0 +1,14 @@
+//go:build !linux
+
+package server
+
+import "errors"
+
+// readSockets needs /proc, the socket metrics are Linux only
+func readSockets() ([]socket, map[uint64]bool, error) {
+	return nil, nil, errors.New("socket metrics are only supported on Linux")
+}
+
+func listenBacklogLimit() (int, error) {
+	return 0, errors.New("socket metrics are only supported on Linux")
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"time"
+)
+
+// certificates loads the certificates of the listeners once, so that the TLS and HTTP/3 listeners
+// of one certificate, or of none, present the same one
+type certificates struct {
+	loaded map[[2]string]tls.Certificate
+}
+
+func newCertificates() *certificates {
+	return &certificates{loaded: make(map[[2]string]tls.Certificate)}
+}
+
+// tlsConfig loads the listener's certificate, or generates a self-signed one when none is configured
+func (c *certificates) tlsConfig(l Listener) (*tls.Config, error) {
+	key := [2]string{l.CertFile, l.KeyFile}
+	cert, ok := c.loaded[key]
+	if !ok {
+		var err error
+		if l.CertFile != "" {
+			cert, err = tls.LoadX509KeyPair(l.CertFile, l.KeyFile)
+		} else {
+			cert, err = selfSignedCertificate()
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.loaded[key] = cert
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// selfSignedCertificate creates a certificate for localhost valid for a year, for demos only
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost", "goexample"},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
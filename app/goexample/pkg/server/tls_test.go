@@ -0,0 +1,21 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestListenersShareTheSelfSignedCertificate(t *testing.T) {
+	certs := newCertificates()
+	https, err := certs.tlsConfig(Listener{Name: "https", Network: "tcp", TLS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h3, err := certs.tlsConfig(Listener{Name: "http3", Network: "udp", TLS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(https.Certificates[0].Certificate[0], h3.Certificates[0].Certificate[0]) {
+		t.Error("the HTTPS and HTTP/3 listeners present different self-signed certificates")
+	}
+}
@@ -0,0 +1,106 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestGoStartsLinkedRootSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	member, err := baggage.NewMember("tenant", "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bag, err := baggage.New(member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(baggage.ContextWithBaggage(context.Background(), bag))
+	ctx, request := tracer.Start(ctx, "request")
+
+	type observed struct {
+		ctxErr error
+		tenant string
+	}
+	done := make(chan observed, 1)
+	release := make(chan struct{})
+	Go(ctx, tracer, "background", 0, func(ctx context.Context) {
+		<-release
+		done <- observed{
+			ctxErr: ctx.Err(),
+			tenant: baggage.FromContext(ctx).Member("tenant").Value(),
+		}
+	})
+
+	// The request ends before the background work runs
+	request.End()
+	cancel()
+	close(release)
+	got := <-done
+
+	if got.ctxErr != nil {
+		t.Errorf("background context cancelled with the request: %v", got.ctxErr)
+	}
+	if got.tenant != "acme" {
+		t.Errorf("baggage tenant = %q, want acme", got.tenant)
+	}
+
+	span := waitForSpan(t, recorder, "background")
+	if span.Parent().IsValid() {
+		t.Errorf("background span has parent %s, want a root span", span.Parent().SpanID())
+	}
+	if span.SpanContext().TraceID() == request.SpanContext().TraceID() {
+		t.Error("background span is in the trace of the request, want a new trace")
+	}
+	links := span.Links()
+	if len(links) != 1 {
+		t.Fatalf("background span has %d links, want 1", len(links))
+	}
+	if links[0].SpanContext.SpanID() != request.SpanContext().SpanID() ||
+		links[0].SpanContext.TraceID() != request.SpanContext().TraceID() {
+		t.Errorf("background span links to %s/%s, want the request span %s/%s",
+			links[0].SpanContext.TraceID(), links[0].SpanContext.SpanID(),
+			request.SpanContext().TraceID(), request.SpanContext().SpanID())
+	}
+}
+
+func TestDetachTimeout(t *testing.T) {
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+
+	ctx, span, cancel := Detach(context.Background(), tracer, "background", time.Millisecond)
+	defer cancel()
+	defer span.End()
+
+	select {
+	case <-ctx.Done():
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			t.Errorf("ctx.Err() = %v, want deadline exceeded", ctx.Err())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("detached context not cancelled after its timeout")
+	}
+}
+
+// waitForSpan returns the ended span named name, Go ends it after fn returns
+func waitForSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, s := range recorder.Ended() {
+			if s.Name() == name {
+				return s
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("span %q not ended", name)
+	return nil
+}
@@ -0,0 +1,79 @@
+package telemetry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type canonicalKey struct{}
+
+// CanonicalLine accumulates the fields of the single summary log line written when a request
+// completes. Its methods are safe for concurrent use and do nothing on a nil line, so code
+// running outside a request can call them unconditionally.
+type CanonicalLine struct {
+	mu     sync.Mutex
+	fields logrus.Fields
+}
+
+// WithCanonicalLine returns a context carrying a new, empty CanonicalLine
+func WithCanonicalLine(ctx context.Context) (context.Context, *CanonicalLine) {
+	line := &CanonicalLine{fields: logrus.Fields{}}
+	return context.WithValue(ctx, canonicalKey{}, line), line
+}
+
+// Canonical returns the CanonicalLine of the request in ctx, nil outside a request
+func Canonical(ctx context.Context) *CanonicalLine {
+	line, _ := ctx.Value(canonicalKey{}).(*CanonicalLine)
+	return line
+}
+
+// Set sets key to value
+func (l *CanonicalLine) Set(key string, value any) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fields[key] = value
+}
+
+// Inc increments the counter key
+func (l *CanonicalLine) Inc(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, _ := l.fields[key].(int)
+	l.fields[key] = n + 1
+}
+
+// AddDuration counts a call of name and adds d to its total, as <name>_count and <name>_ms
+func (l *CanonicalLine) AddDuration(name string, d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, _ := l.fields[name+"_count"].(int)
+	ms, _ := l.fields[name+"_ms"].(float64)
+	l.fields[name+"_count"] = n + 1
+	l.fields[name+"_ms"] = ms + float64(d.Microseconds())/1000
+}
+
+// Fields returns a copy of the accumulated fields
+func (l *CanonicalLine) Fields() logrus.Fields {
+	if l == nil {
+		return logrus.Fields{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fields := make(logrus.Fields, len(l.fields))
+	for key, value := range l.fields {
+		fields[key] = value
+	}
+	return fields
+}
@@ -0,0 +1,88 @@
+package telemetry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Supported values of the OTLP_COMPRESSION env variable
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+)
+
+var (
+	exportBytesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otel_export_bytes_total",
+			Help: "Bytes of OTLP export request bodies sent, after compression",
+		},
+		[]string{"signal", "compression"},
+	)
+
+	exportUncompressedBytesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otel_export_uncompressed_bytes_total",
+			Help: "Bytes of OTLP export request bodies before compression, the savings are 1 - sent / uncompressed",
+		},
+		[]string{"signal"},
+	)
+)
+
+// OTLPCompressionFromEnv reads the OTLP_COMPRESSION env variable, none when unset
+func OTLPCompressionFromEnv() (string, error) {
+	switch compression := os.Getenv("OTLP_COMPRESSION"); compression {
+	case "", CompressionNone:
+		return CompressionNone, nil
+	case CompressionGzip:
+		return CompressionGzip, nil
+	default:
+		return "", fmt.Errorf("unsupported OTLP_COMPRESSION %q, use none or gzip", compression)
+	}
+}
+
+// ExportClient returns an HTTP client for an OTLP exporter of signal (traces, logs) recording the
+// size of every export request body as sent and before compression
+func ExportClient(signal string) *http.Client {
+	return &http.Client{Transport: &exportTransport{signal: signal, base: http.DefaultTransport}}
+}
+
+type exportTransport struct {
+	signal string
+	base   http.RoundTripper
+}
+
+func (t *exportTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil {
+		return t.base.RoundTrip(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	compression := CompressionNone
+	uncompressed := int64(len(body))
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		compression = CompressionGzip
+		// Decompressing again costs some CPU, acceptable for a demo of the savings
+		if zr, err := gzip.NewReader(bytes.NewReader(body)); err == nil {
+			uncompressed, _ = io.Copy(io.Discard, zr)
+		}
+	}
+	exportBytesTotal.WithLabelValues(t.signal, compression).Add(float64(len(body)))
+	exportUncompressedBytesTotal.WithLabelValues(t.signal).Add(float64(uncompressed))
+
+	// The body was consumed, send a copy of the request with a fresh one
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	return t.base.RoundTrip(req)
+}
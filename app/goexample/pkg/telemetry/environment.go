@@ -0,0 +1,97 @@
+package telemetry
+
+import (
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// Supported values of the VARIANT env variable
+const (
+	VariantStable = "stable"
+	VariantCanary = "canary"
+)
+
+// Deployment describes where the service is running
+type Deployment struct {
+	Environment string
+	Region      string
+	Zone        string
+	// Variant distinguishes stable and canary deployments of the same service
+	Variant string
+}
+
+// DeploymentFromEnv reads the DEPLOYMENT_ENVIRONMENT, REGION, ZONE and VARIANT env variables
+func DeploymentFromEnv() Deployment {
+	variant := os.Getenv("VARIANT")
+	if variant != VariantCanary {
+		variant = VariantStable
+	}
+
+	return Deployment{
+		Environment: os.Getenv("DEPLOYMENT_ENVIRONMENT"),
+		Region:      os.Getenv("REGION"),
+		Zone:        os.Getenv("ZONE"),
+		Variant:     variant,
+	}
+}
+
+// Attributes returns the resource attributes for the non-empty fields
+func (d Deployment) Attributes() []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	if d.Environment != "" {
+		attrs = append(attrs, semconv.DeploymentEnvironmentName(d.Environment))
+	}
+	if d.Region != "" {
+		attrs = append(attrs, semconv.CloudRegion(d.Region))
+	}
+	if d.Zone != "" {
+		attrs = append(attrs, semconv.CloudAvailabilityZone(d.Zone))
+	}
+	if d.Variant != "" {
+		attrs = append(attrs, attribute.String("deployment.variant", d.Variant))
+	}
+	return attrs
+}
+
+// Labels returns the constant Prometheus labels for the non-empty fields
+func (d Deployment) Labels() prometheus.Labels {
+	labels := prometheus.Labels{}
+	if d.Environment != "" {
+		labels["environment"] = d.Environment
+	}
+	if d.Region != "" {
+		labels["region"] = d.Region
+	}
+	if d.Zone != "" {
+		labels["zone"] = d.Zone
+	}
+	if d.Variant != "" {
+		labels["variant"] = d.Variant
+	}
+	return labels
+}
+
+// LogFields returns the fields added to every log entry
+func (d Deployment) LogFields() logrus.Fields {
+	fields := logrus.Fields{}
+	if d.Variant != "" {
+		fields["variant"] = d.Variant
+	}
+	return fields
+}
+
+// Resource describes the service and its deployment for all exported telemetry
+func Resource(serviceName string) (*resource.Resource, error) {
+	attrs := append([]attribute.KeyValue{semconv.ServiceName(serviceName)}, DeploymentFromEnv().Attributes()...)
+
+	// Ensure default SDK resources and the required service name are set.
+	return resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, attrs...),
+	)
+}
@@ -0,0 +1,61 @@
+package telemetry
+
+import (
+	"context"
+	"maps"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type exemplarLabelsKey struct{}
+
+// WithExemplarLabel returns a copy of ctx whose exemplars also carry the label name=value, e.g.
+// to mark the observations of a request that is special without adding a label to the metrics.
+// Exemplar labels are limited to 128 characters in total, trace_id and span_id take 63.
+func WithExemplarLabel(ctx context.Context, name, value string) context.Context {
+	parent, _ := ctx.Value(exemplarLabelsKey{}).(prometheus.Labels)
+	labels := make(prometheus.Labels, len(parent)+1)
+	maps.Copy(labels, parent)
+	labels[name] = value
+	return context.WithValue(ctx, exemplarLabelsKey{}, labels)
+}
+
+// ExemplarLabels returns the trace_id and span_id exemplar labels of the sampled span of ctx and
+// the labels of WithExemplarLabel, nil when there are none
+func ExemplarLabels(ctx context.Context) prometheus.Labels {
+	extra, _ := ctx.Value(exemplarLabelsKey{}).(prometheus.Labels)
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() || !sc.IsSampled() {
+		if len(extra) == 0 {
+			return nil
+		}
+		return maps.Clone(extra)
+	}
+	labels := prometheus.Labels{"trace_id": sc.TraceID().String(), "span_id": sc.SpanID().String()}
+	maps.Copy(labels, extra)
+	return labels
+}
+
+// AddWithExemplar adds v to c with the span of ctx as exemplar, exemplars are exposed to
+// OpenMetrics scrapes and exported through OTLP (see NewMeterProvider)
+func AddWithExemplar(ctx context.Context, c prometheus.Counter, v float64) {
+	if labels := ExemplarLabels(ctx); labels != nil {
+		if ea, ok := c.(prometheus.ExemplarAdder); ok {
+			ea.AddWithExemplar(v, labels)
+			return
+		}
+	}
+	c.Add(v)
+}
+
+// ObserveWithExemplar observes v on o with the span of ctx as exemplar
+func ObserveWithExemplar(ctx context.Context, o prometheus.Observer, v float64) {
+	if labels := ExemplarLabels(ctx); labels != nil {
+		if eo, ok := o.(prometheus.ExemplarObserver); ok {
+			eo.ObserveWithExemplar(v, labels)
+			return
+		}
+	}
+	o.Observe(v)
+}
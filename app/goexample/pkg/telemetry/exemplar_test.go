@@ -0,0 +1,41 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestExemplarLabels(t *testing.T) {
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+	sc := span.SpanContext()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want prometheus.Labels
+	}{
+		{"no span", context.Background(), nil},
+		{"sampled span", ctx, prometheus.Labels{"trace_id": sc.TraceID().String(), "span_id": sc.SpanID().String()}},
+		{"extra label without span", WithExemplarLabel(context.Background(), "cold_start", "true"), prometheus.Labels{"cold_start": "true"}},
+		{"extra label", WithExemplarLabel(ctx, "cold_start", "true"), prometheus.Labels{
+			"trace_id": sc.TraceID().String(), "span_id": sc.SpanID().String(), "cold_start": "true",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExemplarLabels(tt.ctx)
+			if len(got) != len(tt.want) {
+				t.Fatalf("ExemplarLabels() = %v, want %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("ExemplarLabels()[%s] = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
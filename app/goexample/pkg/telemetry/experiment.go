@@ -0,0 +1,149 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	// Distinct experiment IDs a process labels its telemetry with, later ones become ExperimentOverflow
+	maxExperiments = 16
+	// Label value of the experiments beyond maxExperiments
+	ExperimentOverflow = "other"
+)
+
+// Experiment IDs are short names, e.g. kafka-degradation-2
+var experimentIDPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+var experimentActive = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "experiment_active",
+		Help: "Set to 1 for the experiment the telemetry is currently tagged with, absent when none runs",
+	},
+	[]string{"experiment_id"},
+)
+
+// experiments holds the current experiment ID and the IDs seen so far, which bound the label values
+var experiments = struct {
+	sync.RWMutex
+	current string
+	seen    map[string]bool
+}{seen: make(map[string]bool)}
+
+// SetExperiment tags the metrics, spans and logs from now on with id, an empty id stops tagging.
+// Past maxExperiments distinct IDs the tag is ExperimentOverflow, the returned value is the tag used.
+func SetExperiment(id string) (string, error) {
+	if id != "" {
+		if err := ValidateExperimentID(id); err != nil {
+			return "", err
+		}
+	}
+
+	experiments.Lock()
+	defer experiments.Unlock()
+	if id != "" && !experiments.seen[id] {
+		if len(experiments.seen) >= maxExperiments {
+			id = ExperimentOverflow
+		} else {
+			experiments.seen[id] = true
+		}
+	}
+	if experiments.current != "" {
+		experimentActive.DeleteLabelValues(experiments.current)
+	}
+	experiments.current = id
+	if id != "" {
+		experimentActive.WithLabelValues(id).Set(1)
+	}
+	return id, nil
+}
+
+// ValidateExperimentID checks id is a short name usable as label value
+func ValidateExperimentID(id string) error {
+	if !experimentIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid experiment ID %q, expected up to 64 letters, digits, '_', '.' or '-'", id)
+	}
+	return nil
+}
+
+// CurrentExperiment returns the experiment ID telemetry is tagged with, empty when none runs
+func CurrentExperiment() string {
+	experiments.RLock()
+	defer experiments.RUnlock()
+	return experiments.current
+}
+
+// WithExperimentLabel returns a Gatherer adding the experiment_id label of the current experiment
+// to every metric. Series switch to the new label value when an experiment starts, so
+// rate(...) by (experiment_id) compares the runs.
+func WithExperimentLabel(g prometheus.Gatherer) prometheus.Gatherer {
+	return experimentGatherer{g}
+}
+
+type experimentGatherer struct {
+	prometheus.Gatherer
+}
+
+// Gather implements prometheus.Gatherer
+func (g experimentGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	id := CurrentExperiment()
+	if id == "" {
+		return families, err
+	}
+	name := "experiment_id"
+	label := []*dto.LabelPair{{Name: &name, Value: &id}}
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			metric.Label = mergeLabels(metric.Label, label)
+		}
+	}
+	return families, err
+}
+
+// ExperimentProcessor is a span processor adding the experiment.id attribute to the spans started
+// during an experiment
+type ExperimentProcessor struct{}
+
+// OnStart implements sdktrace.SpanProcessor
+func (ExperimentProcessor) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	if id := CurrentExperiment(); id != "" {
+		s.SetAttributes(attribute.String("experiment.id", id))
+	}
+}
+
+// OnEnd implements sdktrace.SpanProcessor
+func (ExperimentProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+// Shutdown implements sdktrace.SpanProcessor
+func (ExperimentProcessor) Shutdown(context.Context) error { return nil }
+
+// ForceFlush implements sdktrace.SpanProcessor
+func (ExperimentProcessor) ForceFlush(context.Context) error { return nil }
+
+// ExperimentHook is a logrus hook adding the experiment_id field to the entries logged during an
+// experiment, add it before the hooks shipping the entries
+type ExperimentHook struct{}
+
+// Levels implements logrus.Hook
+func (ExperimentHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (ExperimentHook) Fire(entry *logrus.Entry) error {
+	if id := CurrentExperiment(); id != "" {
+		if _, ok := entry.Data["experiment_id"]; !ok {
+			entry.Data["experiment_id"] = id
+		}
+	}
+	return nil
+}
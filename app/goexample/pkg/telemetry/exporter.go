@@ -0,0 +1,91 @@
+package telemetry
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Maximum number of ended spans waiting for export, same as the SDK default
+const spanQueueSize = sdktrace.DefaultMaxQueueSize
+
+var (
+	spansExportedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "otel_spans_exported_total",
+			Help: "Total number of spans exported via OTLP",
+		},
+	)
+
+	spansDroppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otel_spans_dropped_total",
+			Help: "Total number of spans dropped before reaching the OTLP endpoint",
+		},
+		[]string{"reason"},
+	)
+
+	spanExportDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "otel_span_export_duration_seconds",
+			Help:    "Duration of span export requests",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"result"},
+	)
+)
+
+// NewBatchSpanProcessor returns a batch span processor exporting to exp which records
+// exported, failed and dropped spans as well as the export latency
+func NewBatchSpanProcessor(exp sdktrace.SpanExporter) sdktrace.SpanProcessor {
+	// pending counts spans accepted by the processor but not yet handed to the exporter
+	pending := &atomic.Int64{}
+	batcher := sdktrace.NewBatchSpanProcessor(
+		&countingSpanExporter{SpanExporter: exp, pending: pending},
+		sdktrace.WithMaxQueueSize(spanQueueSize),
+	)
+	return &boundedSpanProcessor{SpanProcessor: batcher, pending: pending, max: spanQueueSize}
+}
+
+// boundedSpanProcessor drops ended spans once the export queue is full, counting them as dropped
+type boundedSpanProcessor struct {
+	sdktrace.SpanProcessor
+	pending *atomic.Int64
+	max     int64
+}
+
+func (p *boundedSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+	if p.pending.Add(1) > p.max {
+		p.pending.Add(-1)
+		spansDroppedTotal.WithLabelValues("queue_full").Inc()
+		return
+	}
+	p.SpanProcessor.OnEnd(s)
+}
+
+// countingSpanExporter records exported and failed spans and the export latency
+type countingSpanExporter struct {
+	sdktrace.SpanExporter
+	pending *atomic.Int64
+}
+
+func (e *countingSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.pending.Add(-int64(len(spans)))
+
+	start := time.Now()
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if err != nil {
+		spanExportDuration.WithLabelValues("error").Observe(time.Since(start).Seconds())
+		spansDroppedTotal.WithLabelValues("export_failed").Add(float64(len(spans)))
+		return err
+	}
+	spanExportDuration.WithLabelValues("success").Observe(time.Since(start).Seconds())
+	spansExportedTotal.Add(float64(len(spans)))
+	return nil
+}
@@ -0,0 +1,40 @@
+package telemetry
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// FieldsHook is a logrus hook adding a fixed set of fields to every entry
+type FieldsHook struct {
+	Fields logrus.Fields
+}
+
+// Levels implements logrus.Hook
+func (h FieldsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (h FieldsHook) Fire(entry *logrus.Entry) error {
+	for key, value := range h.Fields {
+		if _, ok := entry.Data[key]; !ok {
+			entry.Data[key] = value
+		}
+	}
+	return nil
+}
+
+// WithTrace returns a log entry carrying the trace_id and span_id of the span in ctx
+func WithTrace(logger *logrus.Logger, ctx context.Context) *logrus.Entry {
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		return logger.WithContext(ctx).WithFields(logrus.Fields{
+			"trace_id": span.SpanContext().TraceID().String(),
+			"span_id":  span.SpanContext().SpanID().String(),
+		})
+	}
+	return logger.WithContext(ctx).WithFields(logrus.Fields{})
+}
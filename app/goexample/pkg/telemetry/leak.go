@@ -0,0 +1,145 @@
+package telemetry
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	unfinishedSpans = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "leak_unfinished_spans",
+			Help: "Number of spans started longer than the leak threshold ago and never ended",
+		},
+	)
+
+	leakedGoroutines = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "leak_goroutines",
+			Help: "Number of goroutines above the baseline taken at startup",
+		},
+	)
+)
+
+// OpenSpan describes a span which was started but has not ended yet
+type OpenSpan struct {
+	Name    string
+	TraceID trace.TraceID
+	SpanID  trace.SpanID
+	Started time.Time
+}
+
+// LeakDetector is a span processor tracking unfinished spans and goroutine growth
+type LeakDetector struct {
+	logger    *logrus.Logger
+	threshold time.Duration
+	baseline  int
+
+	mu   sync.Mutex
+	open map[trace.SpanID]OpenSpan
+}
+
+// NewLeakDetector creates a LeakDetector reporting spans open longer than threshold
+func NewLeakDetector(logger *logrus.Logger, threshold time.Duration) *LeakDetector {
+	return &LeakDetector{
+		logger:    logger,
+		threshold: threshold,
+		baseline:  runtime.NumGoroutine(),
+		open:      make(map[trace.SpanID]OpenSpan),
+	}
+}
+
+// OnStart implements sdktrace.SpanProcessor
+func (d *LeakDetector) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	sc := s.SpanContext()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.open[sc.SpanID()] = OpenSpan{
+		Name:    s.Name(),
+		TraceID: sc.TraceID(),
+		SpanID:  sc.SpanID(),
+		Started: s.StartTime(),
+	}
+}
+
+// OnEnd implements sdktrace.SpanProcessor
+func (d *LeakDetector) OnEnd(s sdktrace.ReadOnlySpan) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.open, s.SpanContext().SpanID())
+}
+
+// Shutdown implements sdktrace.SpanProcessor
+func (d *LeakDetector) Shutdown(context.Context) error {
+	d.Check()
+	return nil
+}
+
+// ForceFlush implements sdktrace.SpanProcessor
+func (d *LeakDetector) ForceFlush(context.Context) error {
+	return nil
+}
+
+// Rebase takes the current goroutine count as the baseline, call it once startup is complete
+func (d *LeakDetector) Rebase() {
+	d.baseline = runtime.NumGoroutine()
+}
+
+// Check updates the leak metrics and logs spans open for longer than the threshold
+func (d *LeakDetector) Check() {
+	var stale []OpenSpan
+	now := time.Now()
+
+	d.mu.Lock()
+	for _, s := range d.open {
+		if now.Sub(s.Started) > d.threshold {
+			stale = append(stale, s)
+		}
+	}
+	d.mu.Unlock()
+
+	unfinishedSpans.Set(float64(len(stale)))
+	for _, s := range stale {
+		d.logger.WithFields(logrus.Fields{
+			"span_name": s.Name,
+			"trace_id":  s.TraceID.String(),
+			"span_id":   s.SpanID.String(),
+			"open_for":  now.Sub(s.Started).String(),
+		}).Warn("Span was started but never ended")
+	}
+
+	extra := runtime.NumGoroutine() - d.baseline
+	if extra < 0 {
+		extra = 0
+	}
+	leakedGoroutines.Set(float64(extra))
+	if extra > 0 {
+		d.logger.WithFields(logrus.Fields{
+			"baseline":   d.baseline,
+			"goroutines": d.baseline + extra,
+		}).Warn("Goroutine count is above the startup baseline")
+	}
+}
+
+// Run calls Check every interval until ctx is done
+func (d *LeakDetector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.Check()
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package telemetry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Lifecycle events, the event label of the lifecycle metrics
+const (
+	LifecycleStart = "start"
+	LifecycleStop  = "stop"
+)
+
+var (
+	lifecycleDuration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "service_lifecycle_duration_seconds",
+			Help: "Duration of the last start or stop of the service",
+		},
+		[]string{"event"},
+	)
+
+	lifecyclePhaseDuration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "service_lifecycle_phase_duration_seconds",
+			Help: "Duration of each phase of the last start or stop of the service",
+		},
+		[]string{"event", "phase"},
+	)
+)
+
+// Lifecycle records the phases of starting or stopping the service, e.g. config load or
+// listener start. Phases may run before the tracer provider exists, End creates the spans
+// afterwards with the recorded times.
+type Lifecycle struct {
+	event string
+	start time.Time
+
+	mu     sync.Mutex
+	phases []lifecyclePhase
+}
+
+type lifecyclePhase struct {
+	name       string
+	start, end time.Time
+	err        error
+}
+
+// NewLifecycle starts recording a LifecycleStart or LifecycleStop event
+func NewLifecycle(event string) *Lifecycle {
+	return &Lifecycle{event: event, start: time.Now()}
+}
+
+// Phase starts the phase name, the returned func ends it with the phase's error, nil on success
+func (l *Lifecycle) Phase(name string) func(err error) {
+	start := time.Now()
+	return func(err error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.phases = append(l.phases, lifecyclePhase{name: name, start: start, end: time.Now(), err: err})
+	}
+}
+
+// End emits a root span "service.<event>" covering the event with a child span per phase and
+// records the durations as metrics
+func (l *Lifecycle) End(ctx context.Context, tracer trace.Tracer) {
+	end := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ctx, span := tracer.Start(ctx, "service."+l.event,
+		trace.WithNewRoot(),
+		trace.WithTimestamp(l.start),
+		trace.WithAttributes(attribute.String("service.lifecycle.event", l.event)),
+	)
+	for _, p := range l.phases {
+		_, phase := tracer.Start(ctx, "service."+l.event+" "+p.name,
+			trace.WithTimestamp(p.start),
+			trace.WithAttributes(attribute.String("service.lifecycle.phase", p.name)),
+		)
+		if p.err != nil {
+			phase.RecordError(p.err)
+			phase.SetStatus(codes.Error, p.err.Error())
+		}
+		phase.End(trace.WithTimestamp(p.end))
+		lifecyclePhaseDuration.WithLabelValues(l.event, p.name).Set(p.end.Sub(p.start).Seconds())
+	}
+	span.End(trace.WithTimestamp(end))
+	lifecycleDuration.WithLabelValues(l.event).Set(end.Sub(l.start).Seconds())
+}
@@ -0,0 +1,84 @@
+package telemetry
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Default maximum length of string attribute values, the SDK default is unlimited
+const defaultAttributeValueLengthLimit = 4096
+
+var (
+	spanAttributesTruncatedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "otel_span_attributes_truncated_total",
+			Help: "Total number of span attribute values truncated to the configured length limit",
+		},
+	)
+
+	spanDroppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otel_span_dropped_total",
+			Help: "Total number of span attributes, events and links dropped because of span limits",
+		},
+		[]string{"kind"},
+	)
+
+	// Effective attribute value length limit, negative means unlimited
+	valueLengthLimit atomic.Int64
+)
+
+func init() {
+	valueLengthLimit.Store(-1)
+}
+
+// SpanLimits returns the span limits to configure the tracer provider with.
+// The standard OTEL_SPAN_*_LIMIT and OTEL_ATTRIBUTE_*_LIMIT env variables are honoured,
+// the attribute value length is capped at 4096 characters unless configured otherwise.
+func SpanLimits() sdktrace.SpanLimits {
+	limits := sdktrace.NewSpanLimits()
+	if os.Getenv("OTEL_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT") == "" && os.Getenv("OTEL_ATTRIBUTE_VALUE_LENGTH_LIMIT") == "" {
+		limits.AttributeValueLengthLimit = defaultAttributeValueLengthLimit
+	}
+	valueLengthLimit.Store(int64(limits.AttributeValueLengthLimit))
+	return limits
+}
+
+// String creates a string attribute, counting it when the value exceeds the length limit.
+// Use it for attributes carrying unbounded data such as response bodies.
+func String(key, value string) attribute.KeyValue {
+	if limit := valueLengthLimit.Load(); limit >= 0 && int64(len(value)) > limit {
+		spanAttributesTruncatedTotal.Inc()
+	}
+	return attribute.String(key, value)
+}
+
+// LimitsProcessor is a span processor counting attributes, events and links dropped by span limits
+type LimitsProcessor struct{}
+
+// OnStart implements sdktrace.SpanProcessor
+func (LimitsProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+// OnEnd implements sdktrace.SpanProcessor
+func (LimitsProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if n := s.DroppedAttributes(); n > 0 {
+		spanDroppedTotal.WithLabelValues("attribute").Add(float64(n))
+	}
+	if n := s.DroppedEvents(); n > 0 {
+		spanDroppedTotal.WithLabelValues("event").Add(float64(n))
+	}
+	if n := s.DroppedLinks(); n > 0 {
+		spanDroppedTotal.WithLabelValues("link").Add(float64(n))
+	}
+}
+
+// Shutdown implements sdktrace.SpanProcessor
+func (LimitsProcessor) Shutdown(context.Context) error { return nil }
+
+// ForceFlush implements sdktrace.SpanProcessor
+func (LimitsProcessor) ForceFlush(context.Context) error { return nil }
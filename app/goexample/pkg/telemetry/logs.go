@@ -0,0 +1,206 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+const (
+	// Maximum number of log records waiting for export before new ones are dropped
+	logQueueSize = 2048
+	// Maximum number of log records sent in a single export request
+	logBatchSize = 512
+	// How often queued log records are exported
+	logExportInterval = time.Second
+)
+
+var (
+	logsExportedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "otel_logs_exported_total",
+			Help: "Total number of log records exported via OTLP",
+		},
+	)
+
+	logsDroppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otel_logs_dropped_total",
+			Help: "Total number of log records dropped before reaching the OTLP endpoint",
+		},
+		[]string{"reason"},
+	)
+)
+
+// Severity maps a logrus level to the matching OTel severity number
+func Severity(level logrus.Level) otellog.Severity {
+	switch level {
+	case logrus.TraceLevel:
+		return otellog.SeverityTrace
+	case logrus.DebugLevel:
+		return otellog.SeverityDebug
+	case logrus.InfoLevel:
+		return otellog.SeverityInfo
+	case logrus.WarnLevel:
+		return otellog.SeverityWarn
+	case logrus.ErrorLevel:
+		return otellog.SeverityError
+	case logrus.FatalLevel:
+		return otellog.SeverityFatal
+	case logrus.PanicLevel:
+		// Panic is more severe than Fatal in logrus (lower level number)
+		return otellog.SeverityFatal4
+	default:
+		return otellog.SeverityUndefined
+	}
+}
+
+// LogHook is a logrus hook forwarding every entry to an OTLP log exporter
+type LogHook struct {
+	provider *sdklog.LoggerProvider
+	logger   otellog.Logger
+}
+
+// NewLogHook creates a LogHook exporting batched log records to the given OTLP HTTP endpoint
+func NewLogHook(ctx context.Context, endpoint, serviceName string) (*LogHook, error) {
+	compression, err := OTLPCompressionFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	compressionOpt := otlploghttp.WithCompression(otlploghttp.NoCompression)
+	if compression == CompressionGzip {
+		compressionOpt = otlploghttp.WithCompression(otlploghttp.GzipCompression)
+	}
+
+	exp, err := otlploghttp.New(ctx,
+		otlploghttp.WithInsecure(),
+		otlploghttp.WithEndpoint(endpoint),
+		otlploghttp.WithHTTPClient(ExportClient("logs")),
+		compressionOpt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := Resource(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	// pending counts records accepted by the processor but not yet handed to the exporter
+	pending := &atomic.Int64{}
+	batcher := sdklog.NewBatchProcessor(
+		&countingExporter{Exporter: exp, pending: pending},
+		sdklog.WithMaxQueueSize(logQueueSize),
+		sdklog.WithExportMaxBatchSize(logBatchSize),
+		sdklog.WithExportInterval(logExportInterval),
+	)
+
+	provider := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(&boundedProcessor{Processor: batcher, pending: pending, max: logQueueSize}),
+		sdklog.WithResource(r),
+	)
+
+	return &LogHook{
+		provider: provider,
+		logger:   provider.Logger(serviceName),
+	}, nil
+}
+
+// Levels implements logrus.Hook
+func (h *LogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (h *LogHook) Fire(entry *logrus.Entry) error {
+	ctx := entry.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var record otellog.Record
+	record.SetTimestamp(entry.Time)
+	record.SetObservedTimestamp(time.Now())
+	record.SetSeverity(Severity(entry.Level))
+	record.SetSeverityText(entry.Level.String())
+	record.SetBody(otellog.StringValue(entry.Message))
+	for key, value := range entry.Data {
+		record.AddAttributes(otellog.KeyValue{Key: key, Value: logValue(value)})
+	}
+
+	h.logger.Emit(ctx, record)
+
+	// Fatal exits and Panic unwinds right after the hooks run, so don't leave the record in the queue
+	if entry.Level <= logrus.FatalLevel {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return h.provider.ForceFlush(flushCtx)
+	}
+	return nil
+}
+
+// Shutdown flushes the queued log records and stops the exporter
+func (h *LogHook) Shutdown(ctx context.Context) error {
+	return h.provider.Shutdown(ctx)
+}
+
+func logValue(v interface{}) otellog.Value {
+	switch val := v.(type) {
+	case string:
+		return otellog.StringValue(val)
+	case int:
+		return otellog.IntValue(val)
+	case int64:
+		return otellog.Int64Value(val)
+	case float64:
+		return otellog.Float64Value(val)
+	case bool:
+		return otellog.BoolValue(val)
+	case error:
+		return otellog.StringValue(val.Error())
+	default:
+		return otellog.StringValue(fmt.Sprint(val))
+	}
+}
+
+// boundedProcessor drops new records once the export queue is full, counting them as dropped
+type boundedProcessor struct {
+	sdklog.Processor
+	pending *atomic.Int64
+	max     int64
+}
+
+func (p *boundedProcessor) OnEmit(ctx context.Context, record *sdklog.Record) error {
+	if p.pending.Add(1) > p.max {
+		p.pending.Add(-1)
+		logsDroppedTotal.WithLabelValues("queue_full").Inc()
+		return nil
+	}
+	return p.Processor.OnEmit(ctx, record)
+}
+
+// countingExporter records exported and failed log records
+type countingExporter struct {
+	sdklog.Exporter
+	pending *atomic.Int64
+}
+
+func (e *countingExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	e.pending.Add(-int64(len(records)))
+
+	err := e.Exporter.Export(ctx, records)
+	if err != nil {
+		logsDroppedTotal.WithLabelValues("export_failed").Add(float64(len(records)))
+		return err
+	}
+	logsExportedTotal.Add(float64(len(records)))
+	return nil
+}
@@ -0,0 +1,297 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// Time a push to Loki may take
+const lokiPushTimeout = 10 * time.Second
+
+var (
+	lokiEntriesPushedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "loki_entries_pushed_total",
+			Help: "Total number of log entries pushed directly to the Loki push API",
+		},
+	)
+
+	lokiEntriesDroppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "loki_entries_dropped_total",
+			Help: "Total number of log entries dropped before reaching Loki, reason is queue_full, push_failed or shutdown",
+		},
+		[]string{"reason"},
+	)
+
+	lokiPushDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "loki_push_duration_seconds",
+			Help:    "Duration of the requests to the Loki push API",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+)
+
+// LokiConfig of the direct Loki push path
+type LokiConfig struct {
+	// Base URL of Loki, e.g. http://loki:3100, logs are not pushed when empty
+	URL string
+	// Entries per push and the longest an entry waits for its batch to fill up
+	BatchSize int
+	BatchWait time.Duration
+}
+
+// LokiConfigFromEnv reads LOKI_PUSH_URL, LOKI_BATCH_SIZE (default 512) and LOKI_BATCH_WAIT (default 1s)
+func LokiConfigFromEnv() (LokiConfig, error) {
+	cfg := LokiConfig{
+		URL:       strings.TrimSuffix(os.Getenv("LOKI_PUSH_URL"), "/"),
+		BatchSize: logBatchSize,
+		BatchWait: logExportInterval,
+	}
+	if v := os.Getenv("LOKI_BATCH_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size <= 0 {
+			return cfg, fmt.Errorf("invalid LOKI_BATCH_SIZE %q", v)
+		}
+		cfg.BatchSize = size
+	}
+	if v := os.Getenv("LOKI_BATCH_WAIT"); v != "" {
+		wait, err := time.ParseDuration(v)
+		if err != nil || wait <= 0 {
+			return cfg, fmt.Errorf("invalid LOKI_BATCH_WAIT %q", v)
+		}
+		cfg.BatchWait = wait
+	}
+	return cfg, nil
+}
+
+// lokiEntry is a log line of the stream of its level
+type lokiEntry struct {
+	level    string
+	time     time.Time
+	line     string
+	metadata map[string]string
+}
+
+// LokiHook is a logrus hook pushing every entry to the Loki push API in batches, an alternative to
+// shipping stdout with promtail or exporting through OTLP. Streams are labeled with the service,
+// level and deployment environment, the trace and span IDs go into structured metadata so they
+// do not create streams.
+type LokiHook struct {
+	cfg       LokiConfig
+	labels    map[string]string
+	formatter logrus.Formatter
+	client    *http.Client
+
+	// Guards entries and flush against use after Shutdown
+	mu     sync.RWMutex
+	closed bool
+
+	entries chan lokiEntry
+	// Asks the pusher for a synchronous flush, answered on the channel passed
+	flush chan chan struct{}
+	done  sync.WaitGroup
+}
+
+// NewLokiHook starts pushing batches of the logged entries to cfg.URL
+func NewLokiHook(cfg LokiConfig, serviceName string, deployment Deployment) *LokiHook {
+	labels := map[string]string{"service": serviceName, "shipper": "loki_push"}
+	if deployment.Environment != "" {
+		labels["env"] = deployment.Environment
+	}
+	h := &LokiHook{
+		cfg:       cfg,
+		labels:    labels,
+		formatter: &logrus.JSONFormatter{},
+		client:    ExportClient("loki"),
+		entries:   make(chan lokiEntry, logQueueSize),
+		flush:     make(chan chan struct{}),
+	}
+	h.done.Add(1)
+	go h.run()
+	return h
+}
+
+// Levels implements logrus.Hook
+func (h *LokiHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook, the entry is dropped when the queue is full
+func (h *LokiHook) Fire(entry *logrus.Entry) error {
+	line, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	e := lokiEntry{
+		level: entry.Level.String(),
+		time:  entry.Time,
+		line:  string(bytes.TrimSuffix(line, []byte("\n"))),
+	}
+	for _, key := range []string{"trace_id", "span_id"} {
+		if id, ok := entry.Data[key].(string); ok && id != "" {
+			if e.metadata == nil {
+				e.metadata = make(map[string]string, 2)
+			}
+			e.metadata[key] = id
+		}
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		lokiEntriesDroppedTotal.WithLabelValues("shutdown").Inc()
+		return nil
+	}
+	select {
+	case h.entries <- e:
+	default:
+		lokiEntriesDroppedTotal.WithLabelValues("queue_full").Inc()
+	}
+
+	// Fatal exits and Panic unwinds right after the hooks run, so push the queue right away
+	if entry.Level <= logrus.FatalLevel {
+		flushed := make(chan struct{})
+		h.flush <- flushed
+		<-flushed
+	}
+	return nil
+}
+
+// Shutdown pushes the queued entries and stops the hook, entries logged afterwards are lost
+func (h *LokiHook) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.entries)
+	}
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.done.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run batches the queued entries and pushes them every BatchWait or BatchSize entries
+func (h *LokiHook) run() {
+	defer h.done.Done()
+	ticker := time.NewTicker(h.cfg.BatchWait)
+	defer ticker.Stop()
+
+	batch := make([]lokiEntry, 0, h.cfg.BatchSize)
+	push := func() {
+		if len(batch) > 0 {
+			h.push(batch)
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case e, ok := <-h.entries:
+			if !ok {
+				push()
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= h.cfg.BatchSize {
+				push()
+			}
+		case <-ticker.C:
+			push()
+		case flushed := <-h.flush:
+			for drained := false; !drained; {
+				select {
+				case e := <-h.entries:
+					batch = append(batch, e)
+				default:
+					drained = true
+				}
+			}
+			push()
+			close(flushed)
+		}
+	}
+}
+
+// push sends a batch in one request, entries of the same level share a stream
+func (h *LokiHook) push(batch []lokiEntry) {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][]any           `json:"values"`
+	}
+	var streams []*stream
+	byLevel := make(map[string]*stream)
+	for _, e := range batch {
+		s, ok := byLevel[e.level]
+		if !ok {
+			labels := make(map[string]string, len(h.labels)+1)
+			for k, v := range h.labels {
+				labels[k] = v
+			}
+			labels["level"] = e.level
+			s = &stream{Stream: labels}
+			byLevel[e.level] = s
+			streams = append(streams, s)
+		}
+		value := []any{strconv.FormatInt(e.time.UnixNano(), 10), e.line}
+		if e.metadata != nil {
+			value = append(value, e.metadata)
+		}
+		s.Values = append(s.Values, value)
+	}
+
+	err := h.send(map[string]any{"streams": streams})
+	if err != nil {
+		lokiEntriesDroppedTotal.WithLabelValues("push_failed").Add(float64(len(batch)))
+		// Logging through the hook again would loop, stderr is the last resort
+		fmt.Fprintf(os.Stderr, "loki push of %d entries failed: %v\n", len(batch), err)
+		return
+	}
+	lokiEntriesPushedTotal.Add(float64(len(batch)))
+}
+
+func (h *LokiHook) send(payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lokiPushTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.cfg.URL+"/loki/api/v1/push", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	res, err := h.client.Do(req)
+	lokiPushDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("loki returned %d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// OTLPMetricsConfig configures the export of the Prometheus metrics through OTLP
+type OTLPMetricsConfig struct {
+	// host:port or URL of an OTLP/HTTP endpoint, e.g. http://prometheus:9090/api/v1/otlp/v1/metrics,
+	// empty disables the export
+	Endpoint string
+	Interval time.Duration
+}
+
+// OTLPMetricsFromEnv reads OTLP_METRICS_ENDPOINT and OTLP_METRICS_INTERVAL (default 30s)
+func OTLPMetricsFromEnv() (OTLPMetricsConfig, error) {
+	cfg := OTLPMetricsConfig{Endpoint: os.Getenv("OTLP_METRICS_ENDPOINT"), Interval: 30 * time.Second}
+	if v := os.Getenv("OTLP_METRICS_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid OTLP_METRICS_INTERVAL %q", v)
+		}
+		cfg.Interval = d
+	}
+	return cfg, nil
+}
+
+// NewMeterProvider exports the metrics of gatherer through OTLP every cfg.Interval. The
+// exemplars of counters and histograms (see AddWithExemplar) are exported with their trace and
+// span IDs, so backends ingesting OTLP can link the metrics to traces as well.
+func NewMeterProvider(ctx context.Context, cfg OTLPMetricsConfig, serviceName string, gatherer promclient.Gatherer) (*sdkmetric.MeterProvider, error) {
+	compression, err := OTLPCompressionFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	compressionOpt := otlpmetrichttp.WithCompression(otlpmetrichttp.NoCompression)
+	if compression == CompressionGzip {
+		compressionOpt = otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression)
+	}
+	endpointOpts := []otlpmetrichttp.Option{otlpmetrichttp.WithInsecure(), otlpmetrichttp.WithEndpoint(cfg.Endpoint)}
+	if strings.Contains(cfg.Endpoint, "://") {
+		endpointOpts = []otlpmetrichttp.Option{otlpmetrichttp.WithEndpointURL(cfg.Endpoint)}
+	}
+
+	exp, err := otlpmetrichttp.New(ctx, append(endpointOpts,
+		otlpmetrichttp.WithHTTPClient(ExportClient("metrics")),
+		compressionOpt,
+	)...)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := Resource(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := sdkmetric.NewPeriodicReader(exp,
+		sdkmetric.WithInterval(cfg.Interval),
+		sdkmetric.WithProducer(exemplarProducer{prometheus.NewMetricProducer(prometheus.WithGatherer(gatherer))}),
+	)
+	return sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(r)), nil
+}
+
+// exemplarProducer turns the hex trace_id and span_id labels of the Prometheus exemplars, which
+// the bridge copies verbatim, into the binary IDs OTLP expects
+type exemplarProducer struct {
+	sdkmetric.Producer
+}
+
+func (p exemplarProducer) Produce(ctx context.Context) ([]metricdata.ScopeMetrics, error) {
+	scopes, err := p.Producer.Produce(ctx)
+	for _, scope := range scopes {
+		for _, m := range scope.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[float64]:
+				for _, dp := range data.DataPoints {
+					decodeExemplarIDs(dp.Exemplars)
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					decodeExemplarIDs(dp.Exemplars)
+				}
+			}
+		}
+	}
+	return scopes, err
+}
+
+func decodeExemplarIDs(exemplars []metricdata.Exemplar[float64]) {
+	for i := range exemplars {
+		exemplars[i].TraceID = decodeID(exemplars[i].TraceID, 16)
+		exemplars[i].SpanID = decodeID(exemplars[i].SpanID, 8)
+	}
+}
+
+// decodeID returns the size bytes of the hex encoded id, nil when id is no such ID
+func decodeID(id []byte, size int) []byte {
+	if len(id) == size {
+		return id
+	}
+	decoded := make([]byte, size)
+	if n, err := hex.Decode(decoded, id); err != nil || n != size {
+		return nil
+	}
+	return decoded
+}
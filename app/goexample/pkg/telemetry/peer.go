@@ -0,0 +1,51 @@
+package telemetry
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// PeerAttributes identifies the remote side of a client span. peer.service names the node
+// in the Tempo service graph, server.address and server.port are parsed from target,
+// which is either a URL or a host:port pair.
+func PeerAttributes(peerService, target string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{semconv.PeerService(peerService)}
+
+	hostPort := target
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		hostPort = u.Host
+		if u.Port() == "" {
+			switch u.Scheme {
+			case "http":
+				hostPort += ":80"
+			case "https":
+				hostPort += ":443"
+			}
+		}
+	}
+
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return append(attrs, semconv.ServerAddress(hostPort))
+	}
+	attrs = append(attrs, semconv.ServerAddress(host))
+	if p, err := strconv.Atoi(port); err == nil {
+		attrs = append(attrs, semconv.ServerPort(p))
+	}
+	return attrs
+}
+
+// KafkaAttributes describes a Kafka producer or consumer span. brokers is the comma separated
+// broker list (KAFKA_ENDPOINT), the first broker is reported as the server.
+func KafkaAttributes(brokers, topic string) []attribute.KeyValue {
+	broker, _, _ := strings.Cut(brokers, ",")
+	return append(PeerAttributes("kafka", broker),
+		semconv.MessagingSystemKafka,
+		semconv.MessagingDestinationName(topic),
+	)
+}
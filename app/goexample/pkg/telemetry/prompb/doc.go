@@ -0,0 +1,4 @@
+// Package prompb holds the Prometheus remote write messages sent by PushSample
+package prompb
+
+//go:generate protoc -I ../../.. --go_out=../../.. --go_opt=paths=source_relative pkg/telemetry/prompb/remote.proto
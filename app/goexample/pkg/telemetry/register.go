@@ -0,0 +1,40 @@
+package telemetry
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Register registers the metrics of the package with reg, e.g. prometheus.DefaultRegisterer,
+// along with the Go runtime collector.
+func Register(reg prometheus.Registerer) error {
+	if err := registerRuntime(reg); err != nil {
+		return err
+	}
+	for _, c := range []prometheus.Collector{
+		exportBytesTotal,
+		exportUncompressedBytesTotal,
+		spansExportedTotal,
+		spansDroppedTotal,
+		spanExportDuration,
+		unfinishedSpans,
+		leakedGoroutines,
+		lifecycleDuration,
+		lifecyclePhaseDuration,
+		spanAttributesTruncatedTotal,
+		spanDroppedTotal,
+		logsExportedTotal,
+		logsDroppedTotal,
+		lokiEntriesPushedTotal,
+		lokiEntriesDroppedTotal,
+		lokiPushDuration,
+		samplerProbability,
+		samplerRateLimit,
+		samplerRefreshesTotal,
+		scrapeDuration,
+		scrapeSize,
+		experimentActive,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
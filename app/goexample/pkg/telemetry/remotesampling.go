@@ -0,0 +1,260 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Label value of the probability used for operations without their own strategy
+const defaultOperation = "default"
+
+var (
+	samplerProbability = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "otel_sampler_probability",
+			Help: "Sampling probability of root spans from the remote strategy, by operation (default for the others)",
+		},
+		[]string{"operation"},
+	)
+
+	samplerRateLimit = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "otel_sampler_rate_limit_traces_per_second",
+			Help: "Traces per second sampled at most by a rate limiting remote strategy, 0 when the strategy is probabilistic",
+		},
+	)
+
+	samplerRefreshesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otel_sampler_strategy_refreshes_total",
+			Help: "Total number of sampling strategy fetches from the remote sampling endpoint",
+		},
+		[]string{"result"},
+	)
+)
+
+// RemoteSamplingConfig locates a Jaeger remote sampling endpoint, e.g. the jaegerremotesampling
+// extension of an OpenTelemetry Collector
+type RemoteSamplingConfig struct {
+	// Strategies endpoint, e.g. http://otel-collector:5778/sampling, empty disables remote sampling
+	Endpoint        string
+	RefreshInterval time.Duration
+	// Probability of sampling a root span until a strategy was fetched
+	InitialRate float64
+}
+
+// RemoteSamplingFromEnv reads JAEGER_SAMPLING_ENDPOINT, JAEGER_SAMPLING_REFRESH_INTERVAL
+// (default 1m) and JAEGER_SAMPLING_INITIAL_RATE (default 1)
+func RemoteSamplingFromEnv() (RemoteSamplingConfig, error) {
+	cfg := RemoteSamplingConfig{
+		Endpoint:        os.Getenv("JAEGER_SAMPLING_ENDPOINT"),
+		RefreshInterval: time.Minute,
+		InitialRate:     1,
+	}
+	if v := os.Getenv("JAEGER_SAMPLING_REFRESH_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("invalid JAEGER_SAMPLING_REFRESH_INTERVAL %q", v)
+		}
+		cfg.RefreshInterval = d
+	}
+	if v := os.Getenv("JAEGER_SAMPLING_INITIAL_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return cfg, fmt.Errorf("JAEGER_SAMPLING_INITIAL_RATE must be between 0 and 1, got %q", v)
+		}
+		cfg.InitialRate = rate
+	}
+	return cfg, nil
+}
+
+// RemoteSampler samples root spans with the strategy the remote sampling endpoint serves for the
+// service, the strategy is replaced on every Refresh. Wrap it in sdktrace.ParentBased so child
+// spans follow the decision of their root.
+type RemoteSampler struct {
+	endpoint string
+	client   *http.Client
+	strategy atomic.Pointer[samplingStrategy]
+}
+
+// NewRemoteSampler creates a RemoteSampler sampling at cfg.InitialRate until the first Refresh
+func NewRemoteSampler(service string, cfg RemoteSamplingConfig) (*RemoteSampler, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid remote sampling endpoint %q", cfg.Endpoint)
+	}
+	q := u.Query()
+	q.Set("service", service)
+	u.RawQuery = q.Encode()
+
+	s := &RemoteSampler{endpoint: u.String(), client: &http.Client{Timeout: 5 * time.Second}}
+	s.setStrategy(&samplingStrategy{
+		probabilities: map[string]float64{defaultOperation: cfg.InitialRate},
+		samplers:      map[string]sdktrace.Sampler{defaultOperation: sdktrace.TraceIDRatioBased(cfg.InitialRate)},
+	})
+	return s, nil
+}
+
+// Refresh fetches the current strategy, the previous one stays in effect when that fails
+func (s *RemoteSampler) Refresh(ctx context.Context) error {
+	strategy, err := s.fetch(ctx)
+	if err != nil {
+		samplerRefreshesTotal.WithLabelValues("error").Inc()
+		return fmt.Errorf("fetch sampling strategy: %w", err)
+	}
+	samplerRefreshesTotal.WithLabelValues("success").Inc()
+	s.setStrategy(strategy)
+	return nil
+}
+
+func (s *RemoteSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	return s.strategy.Load().sampler(p.Name).ShouldSample(p)
+}
+
+// OperationDescription describes the sampler of the current strategy for spans named operation
+func (s *RemoteSampler) OperationDescription(operation string) string {
+	return s.strategy.Load().sampler(operation).Description()
+}
+
+func (s *RemoteSampler) Description() string {
+	return "RemoteSampler{" + s.endpoint + "}"
+}
+
+func (s *RemoteSampler) setStrategy(strategy *samplingStrategy) {
+	s.strategy.Store(strategy)
+
+	samplerProbability.Reset()
+	for operation, p := range strategy.probabilities {
+		samplerProbability.WithLabelValues(operation).Set(p)
+	}
+	samplerRateLimit.Set(strategy.rateLimit)
+}
+
+// strategyResponse is the JSON of a Jaeger sampling strategy, the strategy used is the most
+// specific one present: per operation, rate limiting or probabilistic
+type strategyResponse struct {
+	ProbabilisticSampling *probabilisticStrategy `json:"probabilisticSampling"`
+	RateLimitingSampling  *struct {
+		MaxTracesPerSecond float64 `json:"maxTracesPerSecond"`
+	} `json:"rateLimitingSampling"`
+	OperationSampling *struct {
+		DefaultSamplingProbability float64 `json:"defaultSamplingProbability"`
+		PerOperationStrategies     []struct {
+			Operation             string                `json:"operation"`
+			ProbabilisticSampling probabilisticStrategy `json:"probabilisticSampling"`
+		} `json:"perOperationStrategies"`
+	} `json:"operationSampling"`
+}
+
+type probabilisticStrategy struct {
+	SamplingRate float64 `json:"samplingRate"`
+}
+
+func (s *RemoteSampler) fetch(ctx context.Context) (*samplingStrategy, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	var resp strategyResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, err
+	}
+
+	strategy := &samplingStrategy{
+		probabilities: make(map[string]float64),
+		samplers:      make(map[string]sdktrace.Sampler),
+	}
+	switch {
+	case resp.OperationSampling != nil:
+		strategy.setProbability(defaultOperation, resp.OperationSampling.DefaultSamplingProbability)
+		for _, op := range resp.OperationSampling.PerOperationStrategies {
+			strategy.setProbability(op.Operation, op.ProbabilisticSampling.SamplingRate)
+		}
+	case resp.RateLimitingSampling != nil:
+		strategy.rateLimit = resp.RateLimitingSampling.MaxTracesPerSecond
+		strategy.samplers[defaultOperation] = newRateLimitingSampler(strategy.rateLimit)
+	case resp.ProbabilisticSampling != nil:
+		strategy.setProbability(defaultOperation, resp.ProbabilisticSampling.SamplingRate)
+	default:
+		return nil, fmt.Errorf("response contains no known strategy")
+	}
+	return strategy, nil
+}
+
+// samplingStrategy holds a sampler per operation (span name), defaultOperation for the others
+type samplingStrategy struct {
+	samplers      map[string]sdktrace.Sampler
+	probabilities map[string]float64
+	rateLimit     float64
+}
+
+func (s *samplingStrategy) setProbability(operation string, p float64) {
+	p = min(max(p, 0), 1)
+	s.probabilities[operation] = p
+	s.samplers[operation] = sdktrace.TraceIDRatioBased(p)
+}
+
+func (s *samplingStrategy) sampler(operation string) sdktrace.Sampler {
+	if sampler, ok := s.samplers[operation]; ok {
+		return sampler
+	}
+	return s.samplers[defaultOperation]
+}
+
+// rateLimitingSampler samples up to a number of traces per second, bursts up to one second's worth
+type rateLimitingSampler struct {
+	mu       sync.Mutex
+	rate     float64
+	credits  float64
+	lastTick time.Time
+}
+
+func newRateLimitingSampler(perSecond float64) *rateLimitingSampler {
+	return &rateLimitingSampler{rate: perSecond, credits: max(perSecond, 1), lastTick: time.Now()}
+}
+
+func (s *rateLimitingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	s.mu.Lock()
+	now := time.Now()
+	s.credits = min(s.credits+now.Sub(s.lastTick).Seconds()*s.rate, max(s.rate, 1))
+	s.lastTick = now
+	sampled := s.credits >= 1
+	if sampled {
+		s.credits--
+	}
+	s.mu.Unlock()
+
+	decision := sdktrace.Drop
+	if sampled {
+		decision = sdktrace.RecordAndSample
+	}
+	return sdktrace.SamplingResult{
+		Decision:   decision,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s *rateLimitingSampler) Description() string {
+	return fmt.Sprintf("RateLimitingSampler{%g}", s.rate)
+}
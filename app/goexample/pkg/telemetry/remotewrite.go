@@ -0,0 +1,62 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"goexample/pkg/telemetry/prompb"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/proto"
+)
+
+// PushSample sends a single sample to a Prometheus remote write endpoint
+// (e.g. http://prometheus:9090/api/v1/write, requires --web.enable-remote-write-receiver).
+func PushSample(ctx context.Context, url, name string, labels map[string]string, value float64, ts time.Time) error {
+	msg, err := encodeWriteRequest(name, labels, value, ts)
+	if err != nil {
+		return err
+	}
+	body := snappy.Encode(nil, msg)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("remote write returned %s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// encodeWriteRequest encodes a remote write 1.0 WriteRequest holding one time series with one sample
+func encodeWriteRequest(name string, labels map[string]string, value float64, ts time.Time) ([]byte, error) {
+	series := &prompb.TimeSeries{
+		Labels:  []*prompb.Label{{Name: "__name__", Value: name}},
+		Samples: []*prompb.Sample{{Value: value, Timestamp: ts.UnixMilli()}},
+	}
+	for k, v := range labels {
+		series.Labels = append(series.Labels, &prompb.Label{Name: k, Value: v})
+	}
+	// Labels must be sorted by name
+	slices.SortFunc(series.Labels, func(a, b *prompb.Label) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return proto.Marshal(&prompb.WriteRequest{Timeseries: []*prompb.TimeSeries{series}})
+}
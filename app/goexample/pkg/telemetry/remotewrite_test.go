@@ -0,0 +1,55 @@
+package telemetry
+
+import (
+	"context"
+	"goexample/pkg/telemetry/prompb"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPushSample(t *testing.T) {
+	received := make(chan *prompb.WriteRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		compressed, _ := io.ReadAll(req.Body)
+		body, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Errorf("body not snappy encoded: %v", err)
+		}
+		var wr prompb.WriteRequest
+		if err := proto.Unmarshal(body, &wr); err != nil {
+			t.Errorf("body not a WriteRequest: %v", err)
+		}
+		received <- &wr
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	labels := map[string]string{"service": "goexample", "check": "traces"}
+	if err := PushSample(context.Background(), srv.URL, "verify_failed", labels, 2, ts); err != nil {
+		t.Fatalf("PushSample() = %v", err)
+	}
+
+	wr := <-received
+	if len(wr.Timeseries) != 1 {
+		t.Fatalf("%d time series, want 1", len(wr.Timeseries))
+	}
+	series := wr.Timeseries[0]
+	var names []string
+	for _, l := range series.Labels {
+		names = append(names, l.Name)
+	}
+	if want := []string{"__name__", "check", "service"}; !slices.Equal(names, want) {
+		t.Errorf("labels %v, want %v sorted by name", names, want)
+	}
+	if len(series.Samples) != 1 || series.Samples[0].Value != 2 || series.Samples[0].Timestamp != ts.UnixMilli() {
+		t.Errorf("samples %v, want 2 at %d", series.Samples, ts.UnixMilli())
+	}
+}
@@ -0,0 +1,151 @@
+package telemetry
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+)
+
+// Reporter logs a periodic summary of the service's own metrics
+type Reporter struct {
+	gatherer prometheus.Gatherer
+	logger   *logrus.Logger
+
+	last     reportSnapshot
+	lastTime time.Time
+}
+
+// reportSnapshot holds the cumulative values the report is computed from
+type reportSnapshot struct {
+	requests       float64
+	errors         float64
+	buckets        map[float64]float64
+	kafkaProduced  float64
+	exportFailures float64
+}
+
+// NewReporter creates a Reporter reading metrics from g
+func NewReporter(g prometheus.Gatherer, logger *logrus.Logger) *Reporter {
+	r := &Reporter{gatherer: g, logger: logger, lastTime: time.Now()}
+	r.last, _ = r.snapshot()
+	return r
+}
+
+// Report logs request rate, error rate, p95 latency, produced Kafka messages and exporter
+// failures observed since the previous report
+func (r *Reporter) Report(context.Context) error {
+	now := time.Now()
+	current, err := r.snapshot()
+	if err != nil {
+		return err
+	}
+	elapsed := now.Sub(r.lastTime).Seconds()
+	prev := r.last
+	r.last, r.lastTime = current, now
+
+	requests := current.requests - prev.requests
+	errorRate := 0.0
+	if requests > 0 {
+		errorRate = (current.errors - prev.errors) / requests
+	}
+
+	deltaBuckets := make(map[float64]float64, len(current.buckets))
+	for le, count := range current.buckets {
+		deltaBuckets[le] = count - prev.buckets[le]
+	}
+
+	r.logger.WithFields(logrus.Fields{
+		"report":              "self_telemetry",
+		"interval_seconds":    math.Round(elapsed),
+		"requests_per_second": round(requests / elapsed),
+		"error_rate":          round(errorRate),
+		"p95_seconds":         round(bucketQuantile(0.95, deltaBuckets)),
+		"kafka_produced":      current.kafkaProduced - prev.kafkaProduced,
+		"exporter_failures":   current.exportFailures - prev.exportFailures,
+	}).Info("Self-telemetry report")
+	return nil
+}
+
+func (r *Reporter) snapshot() (reportSnapshot, error) {
+	s := reportSnapshot{buckets: make(map[float64]float64)}
+
+	families, err := r.gatherer.Gather()
+	if err != nil {
+		return s, err
+	}
+	for _, family := range families {
+		for _, m := range family.Metric {
+			switch family.GetName() {
+			case "http_requests_total":
+				s.requests += m.GetCounter().GetValue()
+				if strings.HasPrefix(label(m, "status"), "5") {
+					s.errors += m.GetCounter().GetValue()
+				}
+			case "http_request_duration_seconds":
+				for _, b := range m.GetHistogram().GetBucket() {
+					s.buckets[b.GetUpperBound()] += float64(b.GetCumulativeCount())
+				}
+			case "kafka_produced_messages_total":
+				if label(m, "result") == "success" {
+					s.kafkaProduced += m.GetCounter().GetValue()
+				}
+			case "otel_span_export_duration_seconds":
+				if label(m, "result") == "error" {
+					s.exportFailures += float64(m.GetHistogram().GetSampleCount())
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+func label(m *dto.Metric, name string) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+// bucketQuantile estimates a quantile from cumulative histogram buckets like PromQL's histogram_quantile
+func bucketQuantile(q float64, buckets map[float64]float64) float64 {
+	bounds := make([]float64, 0, len(buckets))
+	for le := range buckets {
+		bounds = append(bounds, le)
+	}
+	sort.Float64s(bounds)
+	if len(bounds) == 0 {
+		return 0
+	}
+
+	total := buckets[bounds[len(bounds)-1]]
+	if total <= 0 {
+		return 0
+	}
+	rank := q * total
+
+	prevBound, prevCount := 0.0, 0.0
+	for _, le := range bounds {
+		count := buckets[le]
+		if count >= rank {
+			if count == prevCount {
+				return le
+			}
+			return prevBound + (le-prevBound)*(rank-prevCount)/(count-prevCount)
+		}
+		prevBound, prevCount = le, count
+	}
+	// Above the highest finite bucket
+	return bounds[len(bounds)-1]
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
@@ -0,0 +1,35 @@
+package telemetry
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+func TestRegisterRuntimeReplacesGoCollector(t *testing.T) {
+	withDefault := prometheus.NewRegistry()
+	withDefault.MustRegister(collectors.NewGoCollector())
+
+	for name, reg := range map[string]*prometheus.Registry{
+		"empty registry":          prometheus.NewRegistry(),
+		"registry with collector": withDefault,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := registerRuntime(reg); err != nil {
+				t.Fatalf("registerRuntime() error = %v", err)
+			}
+			families, err := reg.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := false
+			for _, f := range families {
+				found = found || f.GetName() == "go_sched_latencies_seconds"
+			}
+			if !found {
+				t.Error("go_sched_latencies_seconds not gathered")
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package telemetry
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Sampling decisions kept by default
+const defaultSamplingLogSize = 100
+
+// Parents of a recorded sampling decision
+const (
+	ParentNone   = "none"
+	ParentRemote = "remote"
+)
+
+// SamplingDecision is the sampling decision taken for a trace entering the service
+type SamplingDecision struct {
+	Time     time.Time `json:"time"`
+	TraceID  string    `json:"trace_id"`
+	SpanName string    `json:"span_name"`
+	Sampled  bool      `json:"sampled"`
+	// none for root spans, remote when the trace was started by the caller
+	Parent string `json:"parent"`
+	// parent_sampled or parent_not_sampled, the root sampler in effect for root spans,
+	// e.g. TraceIDRatioBased{0.1}
+	Reason string `json:"reason"`
+}
+
+// SamplingLog keeps the last sampling decisions taken where traces enter the service, spans
+// with a local parent follow their root and are not recorded
+type SamplingLog struct {
+	mu        sync.Mutex
+	decisions []SamplingDecision
+	// Index of the next decision to overwrite once the log is full
+	next int
+}
+
+// SamplingLogSizeFromEnv reads SAMPLING_LOG_SIZE, the number of decisions kept (default 100, 0 disables the log)
+func SamplingLogSizeFromEnv() (int, error) {
+	value := os.Getenv("SAMPLING_LOG_SIZE")
+	if value == "" {
+		return defaultSamplingLogSize, nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid SAMPLING_LOG_SIZE %q", value)
+	}
+	return size, nil
+}
+
+// NewSamplingLog creates a SamplingLog keeping the last size decisions
+func NewSamplingLog(size int) *SamplingLog {
+	return &SamplingLog{decisions: make([]SamplingDecision, 0, size)}
+}
+
+// Sampler returns a sampler deciding like sdktrace.ParentBased(root) that records its decisions
+// for root spans and spans with a remote parent
+func (l *SamplingLog) Sampler(root sdktrace.Sampler) sdktrace.Sampler {
+	return recordingSampler{base: sdktrace.ParentBased(root), root: root, log: l}
+}
+
+// Decisions returns the recorded decisions, newest first
+func (l *SamplingLog) Decisions() []SamplingDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	decisions := make([]SamplingDecision, 0, len(l.decisions))
+	for i := range l.decisions {
+		decisions = append(decisions, l.decisions[(l.next-1-i+2*len(l.decisions))%len(l.decisions)])
+	}
+	return decisions
+}
+
+func (l *SamplingLog) record(d SamplingDecision) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if cap(l.decisions) == 0 {
+		return
+	}
+	if len(l.decisions) < cap(l.decisions) {
+		l.decisions = append(l.decisions, d)
+		l.next = len(l.decisions) % cap(l.decisions)
+		return
+	}
+	l.decisions[l.next] = d
+	l.next = (l.next + 1) % len(l.decisions)
+}
+
+// operationSampler is implemented by root samplers using a different sampler per span name
+type operationSampler interface {
+	OperationDescription(operation string) string
+}
+
+type recordingSampler struct {
+	base sdktrace.Sampler
+	root sdktrace.Sampler
+	log  *SamplingLog
+}
+
+func (s recordingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	result := s.base.ShouldSample(p)
+
+	parent := trace.SpanContextFromContext(p.ParentContext)
+	if parent.IsValid() && !parent.IsRemote() {
+		return result
+	}
+	d := SamplingDecision{
+		Time:     time.Now(),
+		TraceID:  p.TraceID.String(),
+		SpanName: p.Name,
+		Sampled:  result.Decision == sdktrace.RecordAndSample,
+		Parent:   ParentNone,
+	}
+	switch {
+	case parent.IsValid():
+		d.Parent = ParentRemote
+		d.Reason = "parent_not_sampled"
+		if parent.IsSampled() {
+			d.Reason = "parent_sampled"
+		}
+	default:
+		d.Reason = s.root.Description()
+		if op, ok := s.root.(operationSampler); ok {
+			d.Reason = op.OperationDescription(p.Name)
+		}
+	}
+	s.log.record(d)
+	return result
+}
+
+func (s recordingSampler) Description() string {
+	return "RecordingSampler{" + s.base.Description() + "}"
+}
@@ -0,0 +1,37 @@
+package telemetry
+
+import (
+	"os"
+	"runtime/debug"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Instrumentation scopes, each part of a service creates its spans with its own tracer
+const (
+	ScopeHTTPServer = "httpserver"
+	ScopeKafka      = "kafka"
+	ScopeBusiness   = "business"
+)
+
+// ScopeVersion returns the instrumentation scope version: the SERVICE_VERSION env variable,
+// the main module version recorded in the binary or "dev"
+func ScopeVersion() string {
+	if v := os.Getenv("SERVICE_VERSION"); v != "" {
+		return v
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
+// Tracer returns the tracer of one instrumentation scope of a service, named "<service>/<scope>"
+// and carrying the scope version and the semantic conventions schema URL
+func Tracer(tp trace.TracerProvider, service, scope string) trace.Tracer {
+	return tp.Tracer(service+"/"+scope,
+		trace.WithInstrumentationVersion(ScopeVersion()),
+		trace.WithSchemaURL(semconv.SchemaURL),
+	)
+}
@@ -0,0 +1,89 @@
+package telemetry
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	scrapeDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "metrics_scrape_duration_seconds",
+			Help:    "Time taken to serve a scrape of the metrics endpoint",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+	)
+
+	scrapeSize = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "metrics_scrape_size_bytes",
+			Help:    "Size of the metrics endpoint response body as sent (possibly compressed)",
+			Buckets: prometheus.ExponentialBuckets(1024, 2, 12), // 1KiB .. 2MiB
+		},
+	)
+)
+
+// InstrumentScrape records the duration and size of every scrape served by next.
+// If tracer is not nil every scrape also gets its own span.
+func InstrumentScrape(next http.Handler, tracer trace.Tracer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		var span trace.Span
+		if tracer != nil {
+			ctx, s := tracer.Start(r.Context(), r.Method+" /metrics", trace.WithSpanKind(trace.SpanKindServer))
+			span = s
+			r = r.WithContext(ctx)
+		}
+
+		cw := &countingWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+
+		duration := time.Since(start)
+		scrapeDuration.Observe(duration.Seconds())
+		scrapeSize.Observe(float64(cw.written))
+
+		if span != nil {
+			span.SetAttributes(
+				attribute.Int64("http.response.body.size", cw.written),
+				attribute.String("http.response.content_encoding", w.Header().Get("Content-Encoding")),
+			)
+			SetHTTPStatus(span, cw.status(), trace.SpanKindServer)
+			span.End()
+		}
+	})
+}
+
+// countingWriter counts the response bytes written
+type countingWriter struct {
+	http.ResponseWriter
+	written    int64
+	statusCode int
+}
+
+func (w *countingWriter) WriteHeader(code int) {
+	w.statusCode = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *countingWriter) status() int {
+	if w.statusCode == 0 {
+		return http.StatusOK
+	}
+	return w.statusCode
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
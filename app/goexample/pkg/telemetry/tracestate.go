@@ -0,0 +1,88 @@
+package telemetry
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceStateKey is the vendor key of the stack's entry in the W3C tracestate header,
+// e.g. tracestate: cozi=env:local;variant:canary
+const TraceStateKey = "cozi"
+
+// TraceState encodes the non-empty fields as the value of the stack's tracestate entry
+func (d Deployment) TraceState() string {
+	var fields []string
+	for _, f := range []struct{ key, value string }{
+		{"env", d.Environment},
+		{"region", d.Region},
+		{"zone", d.Zone},
+		{"variant", d.Variant},
+	} {
+		if f.value != "" {
+			fields = append(fields, f.key+":"+f.value)
+		}
+	}
+	return strings.Join(fields, ";")
+}
+
+// TraceStateAttributes returns the fields of the stack's tracestate entry as cozi.* span attributes
+func TraceStateAttributes(ts trace.TraceState) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	for _, field := range strings.Split(ts.Get(TraceStateKey), ";") {
+		if key, value, ok := strings.Cut(field, ":"); ok && key != "" {
+			attrs = append(attrs, attribute.String(TraceStateKey+"."+key, value))
+		}
+	}
+	return attrs
+}
+
+// TraceStateSampler wraps base so every span it samples carries value as the stack's tracestate
+// entry, replacing the one of the parent. Used at the edge, where requests enter the stack.
+func TraceStateSampler(base sdktrace.Sampler, value string) sdktrace.Sampler {
+	return traceStateSampler{base: base, value: value}
+}
+
+type traceStateSampler struct {
+	base  sdktrace.Sampler
+	value string
+}
+
+func (s traceStateSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	result := s.base.ShouldSample(p)
+	if s.value == "" {
+		return result
+	}
+	// An invalid value (e.g. an environment with a comma) leaves the tracestate as is
+	if ts, err := result.Tracestate.Insert(TraceStateKey, s.value); err == nil {
+		result.Tracestate = ts
+	}
+	return result
+}
+
+func (s traceStateSampler) Description() string {
+	return "TraceStateSampler{" + s.base.Description() + "}"
+}
+
+// TraceStateProcessor is a span processor adding the stack's tracestate entry as span attributes
+// to spans continuing a remote trace, so the edge's deployment is searchable downstream
+type TraceStateProcessor struct{}
+
+// OnStart implements sdktrace.SpanProcessor
+func (TraceStateProcessor) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	if s.Parent().IsRemote() {
+		s.SetAttributes(TraceStateAttributes(s.SpanContext().TraceState())...)
+	}
+}
+
+// OnEnd implements sdktrace.SpanProcessor
+func (TraceStateProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+// Shutdown implements sdktrace.SpanProcessor
+func (TraceStateProcessor) Shutdown(context.Context) error { return nil }
+
+// ForceFlush implements sdktrace.SpanProcessor
+func (TraceStateProcessor) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,147 @@
+package warmup
+
+import (
+	"context"
+	"fmt"
+	"goexample/pkg/telemetry"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Bound of the whole warm-up when WARMUP_TIMEOUT is not set
+const defaultTimeout = 10 * time.Second
+
+var (
+	targetDuration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "service_warmup_duration_seconds",
+			Help: "Duration of the warm-up of each dependency at the last start",
+		},
+		[]string{"target"},
+	)
+
+	targetFailed = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "service_warmup_failed",
+			Help: "Set to 1 when the warm-up of the dependency failed at the last start",
+		},
+		[]string{"target"},
+	)
+
+	warmedUp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "service_warmed_up",
+			Help: "1 when every dependency was warmed up before the first request, 0 without warm-up or when part of it failed",
+		},
+	)
+)
+
+// Register registers the metrics of the package with reg, e.g. prometheus.DefaultRegisterer
+func Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{targetDuration, targetFailed, warmedUp} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Config of the warm-up run before the listeners accept requests
+type Config struct {
+	Enabled bool
+	// Bound of the whole warm-up, the service starts anyway once it is over
+	Timeout time.Duration
+}
+
+// ConfigFromEnv reads WARMUP ("true" enables it) and WARMUP_TIMEOUT
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{Enabled: os.Getenv("WARMUP") == "true", Timeout: defaultTimeout}
+	if v := os.Getenv("WARMUP_TIMEOUT"); v != "" {
+		var err error
+		if cfg.Timeout, err = time.ParseDuration(v); err != nil || cfg.Timeout <= 0 {
+			return cfg, fmt.Errorf("invalid WARMUP_TIMEOUT: %q", v)
+		}
+	}
+	return cfg, nil
+}
+
+// Target is a dependency warmed up at start, e.g. the connections of a Kafka writer
+type Target struct {
+	// Label value of the warm-up metrics, e.g. kafka:orders
+	Name string
+	Warm func(ctx context.Context) error
+}
+
+// Run warms the targets up concurrently in a "service.warmup" trace with a span per target and
+// reports whether all of them succeeded. A failure is only logged: the first requests then open
+// the connections themselves, as they would without warm-up.
+func Run(ctx context.Context, cfg Config, logger *logrus.Logger, tracer trace.Tracer, targets []Target) bool {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	ctx, span := tracer.Start(ctx, "service.warmup",
+		trace.WithNewRoot(),
+		trace.WithAttributes(attribute.Int("warmup.targets", len(targets))),
+	)
+	defer span.End()
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed int
+	)
+	for _, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := warm(ctx, logger, tracer, target); err != nil {
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d of %d targets failed", failed, len(targets)))
+		warmedUp.Set(0)
+		return false
+	}
+	warmedUp.Set(1)
+	return true
+}
+
+// warm runs the warm-up of target in its own span and records its duration
+func warm(ctx context.Context, logger *logrus.Logger, tracer trace.Tracer, target Target) error {
+	ctx, span := tracer.Start(ctx, "Warm up "+target.Name,
+		trace.WithAttributes(attribute.String("warmup.target", target.Name)),
+	)
+	defer span.End()
+
+	start := time.Now()
+	err := target.Warm(ctx)
+	elapsed := time.Since(start)
+	targetDuration.WithLabelValues(target.Name).Set(elapsed.Seconds())
+	fields := logrus.Fields{
+		"target":      target.Name,
+		"duration_ms": elapsed.Milliseconds(),
+	}
+	if err != nil {
+		targetFailed.WithLabelValues(target.Name).Set(1)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		fields["error"] = err
+		telemetry.WithTrace(logger, ctx).WithFields(fields).Warn("Warm-up failed, the first requests connect on their own")
+		return err
+	}
+	targetFailed.WithLabelValues(target.Name).Set(0)
+	telemetry.WithTrace(logger, ctx).WithFields(fields).Info("Warmed up")
+	return nil
+}
@@ -0,0 +1,234 @@
+package watchdog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goexample/pkg/kafkapkg"
+	"os"
+	"runtime/metrics"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Watched resources, the label values of the watchdog metrics
+const (
+	ResourceHeap       = "heap"
+	ResourceGoroutines = "goroutines"
+	ResourceGCCPU      = "gc_cpu"
+)
+
+// runtime/metrics samples read on every check
+const (
+	heapMetric       = "/memory/classes/heap/objects:bytes"
+	goroutinesMetric = "/sched/goroutines:goroutines"
+	gcCPUMetric      = "/cpu/classes/gc/total:cpu-seconds"
+	totalCPUMetric   = "/cpu/classes/total:cpu-seconds"
+)
+
+var (
+	thresholdGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "watchdog_threshold",
+			Help: "Configured watchdog threshold per resource",
+		},
+		[]string{"resource"},
+	)
+
+	exceededGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "watchdog_threshold_exceeded",
+			Help: "Set to 1 while a resource is above its watchdog threshold",
+		},
+		[]string{"resource"},
+	)
+
+	crossingsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "watchdog_threshold_crossings_total",
+			Help: "Total number of times a resource went above its watchdog threshold",
+		},
+		[]string{"resource"},
+	)
+)
+
+// Register registers the metrics of the package with reg, e.g. prometheus.DefaultRegisterer
+func Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		thresholdGauge,
+		exceededGauge,
+		crossingsTotal,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Config holds the thresholds, a zero threshold is not watched
+type Config struct {
+	HeapBytes  uint64
+	Goroutines uint64
+	// Fraction of the process CPU time spent in the GC between two checks
+	GCCPUFraction float64
+	// Topic alerts are published to, none when empty
+	AlertTopic string
+}
+
+// ConfigFromEnv reads WATCHDOG_HEAP_BYTES, WATCHDOG_GOROUTINES, WATCHDOG_GC_CPU_FRACTION and WATCHDOG_ALERT_TOPIC
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{AlertTopic: os.Getenv("WATCHDOG_ALERT_TOPIC")}
+	var err error
+	if v := os.Getenv("WATCHDOG_HEAP_BYTES"); v != "" {
+		if cfg.HeapBytes, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return cfg, fmt.Errorf("invalid WATCHDOG_HEAP_BYTES: %q", v)
+		}
+	}
+	if v := os.Getenv("WATCHDOG_GOROUTINES"); v != "" {
+		if cfg.Goroutines, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return cfg, fmt.Errorf("invalid WATCHDOG_GOROUTINES: %q", v)
+		}
+	}
+	if v := os.Getenv("WATCHDOG_GC_CPU_FRACTION"); v != "" {
+		if cfg.GCCPUFraction, err = strconv.ParseFloat(v, 64); err != nil || cfg.GCCPUFraction < 0 || cfg.GCCPUFraction > 1 {
+			return cfg, fmt.Errorf("WATCHDOG_GC_CPU_FRACTION must be a number between 0 and 1, got %q", v)
+		}
+	}
+	return cfg, nil
+}
+
+// Enabled reports whether any threshold is set
+func (c Config) Enabled() bool {
+	return c.HeapBytes > 0 || c.Goroutines > 0 || c.GCCPUFraction > 0
+}
+
+// Alert is the Kafka message published when a threshold is crossed in either direction
+type Alert struct {
+	Service   string    `json:"service"`
+	Resource  string    `json:"resource"`
+	State     string    `json:"state"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Time      time.Time `json:"time"`
+}
+
+// Watchdog raises early warnings when heap size, goroutine count or GC CPU usage cross
+// their thresholds, comparing runtime/metrics samples with them on every Check
+type Watchdog struct {
+	service string
+	cfg     Config
+	logger  *logrus.Logger
+	// Alert publisher, nil without an alert topic
+	alerts kafkapkg.Writer
+
+	samples  []metrics.Sample
+	exceeded map[string]bool
+	// CPU counters of the previous check, for the GC fraction in between
+	lastGCCPU, lastTotalCPU float64
+}
+
+// New creates a watchdog, alerts may be nil
+func New(service string, cfg Config, logger *logrus.Logger, alerts kafkapkg.Writer) *Watchdog {
+	w := &Watchdog{
+		service: service,
+		cfg:     cfg,
+		logger:  logger,
+		alerts:  alerts,
+		samples: []metrics.Sample{
+			{Name: heapMetric},
+			{Name: goroutinesMetric},
+			{Name: gcCPUMetric},
+			{Name: totalCPUMetric},
+		},
+		exceeded: make(map[string]bool),
+	}
+	thresholdGauge.WithLabelValues(ResourceHeap).Set(float64(cfg.HeapBytes))
+	thresholdGauge.WithLabelValues(ResourceGoroutines).Set(float64(cfg.Goroutines))
+	thresholdGauge.WithLabelValues(ResourceGCCPU).Set(cfg.GCCPUFraction)
+	for _, resource := range []string{ResourceHeap, ResourceGoroutines, ResourceGCCPU} {
+		exceededGauge.WithLabelValues(resource).Set(0)
+	}
+	return w
+}
+
+// Check reads the runtime metrics and reports thresholds crossed since the last check
+func (w *Watchdog) Check(ctx context.Context) error {
+	metrics.Read(w.samples)
+	heap := float64(w.samples[0].Value.Uint64())
+	goroutines := float64(w.samples[1].Value.Uint64())
+	gcCPU, totalCPU := w.samples[2].Value.Float64(), w.samples[3].Value.Float64()
+
+	gcFraction := 0.0
+	if delta := totalCPU - w.lastTotalCPU; w.lastTotalCPU > 0 && delta > 0 {
+		gcFraction = (gcCPU - w.lastGCCPU) / delta
+	}
+	w.lastGCCPU, w.lastTotalCPU = gcCPU, totalCPU
+
+	var errs []error
+	if w.cfg.HeapBytes > 0 {
+		errs = append(errs, w.compare(ctx, ResourceHeap, heap, float64(w.cfg.HeapBytes)))
+	}
+	if w.cfg.Goroutines > 0 {
+		errs = append(errs, w.compare(ctx, ResourceGoroutines, goroutines, float64(w.cfg.Goroutines)))
+	}
+	if w.cfg.GCCPUFraction > 0 {
+		errs = append(errs, w.compare(ctx, ResourceGCCPU, gcFraction, w.cfg.GCCPUFraction))
+	}
+	return errors.Join(errs...)
+}
+
+// compare emits an event when resource crosses its threshold in either direction
+func (w *Watchdog) compare(ctx context.Context, resource string, value, threshold float64) error {
+	exceeded := value > threshold
+	if exceeded == w.exceeded[resource] {
+		return nil
+	}
+	w.exceeded[resource] = exceeded
+
+	state := "recovered"
+	if exceeded {
+		state = "exceeded"
+		exceededGauge.WithLabelValues(resource).Set(1)
+		crossingsTotal.WithLabelValues(resource).Inc()
+	} else {
+		exceededGauge.WithLabelValues(resource).Set(0)
+	}
+
+	// A log record without a span, shipped as an OTel event when OTLP logs are enabled
+	entry := w.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"event.name": "watchdog.threshold." + state,
+		"resource":   resource,
+		"value":      value,
+		"threshold":  threshold,
+	})
+	if exceeded {
+		entry.Warn("Watchdog threshold exceeded")
+	} else {
+		entry.Info("Watchdog threshold recovered")
+	}
+
+	if w.alerts == nil {
+		return nil
+	}
+	alert, err := json.Marshal(Alert{
+		Service:   w.service,
+		Resource:  resource,
+		State:     state,
+		Value:     value,
+		Threshold: threshold,
+		Time:      time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := w.alerts.WriteMessages(ctx, kafka.Message{Key: []byte(resource), Value: alert}); err != nil {
+		return fmt.Errorf("publishing %s watchdog alert: %w", resource, err)
+	}
+	return nil
+}
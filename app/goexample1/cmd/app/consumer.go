@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goexample/pkg/dedup"
+	"goexample/pkg/errfmt"
+	"goexample/pkg/kafkapkg"
+	"goexample/pkg/telemetry"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Number of message IDs remembered for duplicate detection
+const dedupCapacity = 10000
+
+var (
+	messageProcessingDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kafka_message_processing_duration_seconds",
+			Help:    "Time spent processing a consumed Kafka message",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"topic", "result"},
+	)
+
+	filteredMessagesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_filtered_messages_total",
+			Help: "Total number of consumed Kafka messages skipped because they did not match the handler's filter",
+		},
+		[]string{"topic", "handler"},
+	)
+
+	duplicateMessagesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_duplicate_messages_total",
+			Help: "Total number of consumed Kafka messages skipped because their ID was already processed",
+		},
+		[]string{"topic"},
+	)
+
+	consumerLag = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_consumer_lag",
+			Help: "Messages between the last consumed message and the end of its partition, sum by topic for the lag of the group",
+		},
+		[]string{"topic", "partition"},
+	)
+
+	messageDelay = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kafka_message_delay_seconds",
+			Help:    "Time between a message being produced and consumed, grows with consumer lag",
+			Buckets: []float64{.005, .01, .05, .1, .5, 1, 5, 10, 30, 60, 300, 900, 3600},
+		},
+		[]string{"topic"},
+	)
+
+	consumerPanicsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_consumer_panics_total",
+			Help: "Total number of panics recovered while processing consumed Kafka messages",
+		},
+		[]string{"topic"},
+	)
+
+	staleMessagesDiscardedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_stale_messages_discarded_total",
+			Help: "Total number of consumed Kafka messages discarded because they were older than the handler's TTL",
+		},
+		[]string{"topic", "handler"},
+	)
+
+	deadLetterMessagesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_dead_letter_messages_total",
+			Help: "Total number of consumed Kafka messages moved to the dead letter topic, by original topic",
+		},
+		[]string{"topic", "result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(messageProcessingDuration)
+	prometheus.MustRegister(filteredMessagesTotal)
+	prometheus.MustRegister(duplicateMessagesTotal)
+	prometheus.MustRegister(consumerLag)
+	prometheus.MustRegister(messageDelay)
+	prometheus.MustRegister(consumerPanicsTotal)
+	prometheus.MustRegister(staleMessagesDiscardedTotal)
+	prometheus.MustRegister(deadLetterMessagesTotal)
+}
+
+// kakaConsumer handles the hello messages of the trace topic matching filter, discarding the stale ones
+func kakaConsumer(filter kafkapkg.Filter, stale kafkapkg.StalePolicy) {
+	reader := kafkapkg.GetKafkaReader("trace", "go", kafkapkg.NewGroupObserver("go", logger, kafkaTracer))
+	defer reader.Close()
+	dlq := kafkapkg.GetKafkaWriter(kafkapkg.DeadLetterTopic("trace"))
+	defer dlq.Close()
+
+	seen := dedup.NewLRU(dedupCapacity)
+	pause := consumerSwitch("trace")
+
+	logger.Info("start consuming kafka messages")
+	for {
+		// Blocks while consumption is paused through the admin API
+		_ = pause.Wait(context.Background())
+
+		m, err := reader.ReadMessage(context.Background())
+		if err != nil {
+			logger.WithField("error", err).Fatal("Error reading kafka message")
+		}
+		observeConsumed(reader, m)
+
+		// The topic may be shared with other consumers, skip what this handler is not meant for
+		if !filter.Match(m) {
+			filteredMessagesTotal.WithLabelValues(m.Topic, "hello").Inc()
+			continue
+		}
+
+		// Extract the context from Kafka headers
+		carrier := propagation.MapCarrier{}
+		for _, header := range m.Headers {
+			carrier[header.Key] = string(header.Value)
+		}
+
+		// Extract the tracing context from the carrier
+		ctx := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+
+		// Start a new span with the extracted context
+		start := time.Now()
+		_, span := kafkaTracer.Start(ctx, "Processing kafka message",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(telemetry.KafkaAttributes(kafkapkg.ClusterForTopic(m.Topic).Endpoint(), m.Topic)...),
+		)
+		span.SetAttributes(attribute.String("message", string(m.Value)))
+
+		// Old hellos are not worth processing anymore
+		if discardStale(ctx, span, m, "hello", stale) {
+			span.End()
+			observeProcessing(span, m.Topic, "stale", time.Since(start))
+			continue
+		}
+
+		// Delivery is at-least-once, skip messages that were already processed
+		if id := kafkapkg.HeaderValue(m, kafkapkg.MessageIDHeader); id != "" {
+			duplicate := seen.Seen(id)
+			span.SetAttributes(
+				attribute.String("messaging.message.id", id),
+				attribute.Bool("messaging.message.duplicate", duplicate),
+			)
+			if duplicate {
+				duplicateMessagesTotal.WithLabelValues(m.Topic).Inc()
+				logWithTrace(ctx).WithFields(logrus.Fields{
+					"topic":      m.Topic,
+					"partition":  m.Partition,
+					"offset":     m.Offset,
+					"message_id": id,
+				}).Warn("Skipping duplicate kafka message")
+
+				span.End()
+				observeProcessing(span, m.Topic, "duplicate", time.Since(start))
+				continue
+			}
+		}
+
+		err = processMessage(ctx, span, dlq, m, func(ctx context.Context) error {
+			logWithTrace(ctx).WithFields(logrus.Fields{
+				"topic":     m.Topic,
+				"partition": m.Partition,
+				"offset":    m.Offset,
+				"key":       string(m.Key),
+				"value":     string(m.Value),
+			}).Info("Received kafka message")
+			return nil
+		})
+
+		span.End()
+		observeProcessing(span, m.Topic, processingResult(err), time.Since(start))
+	}
+}
+
+// discardStale records the age of m on span, and reports whether policy discards m as stale for handler.
+// The age distribution is kafka_message_delay_seconds, observed for every consumed message.
+func discardStale(ctx context.Context, span trace.Span, m kafka.Message, handler string, policy kafkapkg.StalePolicy) bool {
+	age := kafkapkg.Age(m, time.Now())
+	span.SetAttributes(attribute.Int64("messaging.message.age_ms", age.Milliseconds()))
+	if !policy.Stale(age) {
+		return false
+	}
+
+	staleMessagesDiscardedTotal.WithLabelValues(m.Topic, handler).Inc()
+	span.SetAttributes(attribute.Bool("messaging.message.stale", true))
+	logWithTrace(ctx).WithFields(logrus.Fields{
+		"topic":     m.Topic,
+		"partition": m.Partition,
+		"offset":    m.Offset,
+		"age":       age.String(),
+		"ttl":       policy.TTL.String(),
+	}).Warn("Discarding stale kafka message")
+	return true
+}
+
+// errPanic wraps a value recovered from a panic during message processing
+var errPanic = errors.New("panic while processing message")
+
+// processMessage runs process for m. A panic does not crash the consumer loop: it is recorded
+// on the consumer span, counted, and m is moved to the dead letter topic so consumption continues.
+func processMessage(ctx context.Context, span trace.Span, dlq *kafka.Writer, m kafka.Message, process func(ctx context.Context) error) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		err = fmt.Errorf("%w: %v", errPanic, r)
+		consumerPanicsTotal.WithLabelValues(m.Topic).Inc()
+		span.RecordError(err, trace.WithStackTrace(true))
+		span.SetStatus(codes.Error, errPanic.Error())
+		logWithTrace(ctx).WithFields(logrus.Fields{
+			"topic":     m.Topic,
+			"partition": m.Partition,
+			"offset":    m.Offset,
+			"panic":     fmt.Sprint(r),
+			"stack":     string(debug.Stack()),
+		}).Error("Recovered from panic while processing kafka message")
+
+		deadLetter(ctx, span, dlq, m, err)
+	}()
+
+	return process(ctx)
+}
+
+// deadLetter moves m to its dead letter topic, tagged with the failed consumer span.
+// A failure is logged since the consumer moves on regardless.
+func deadLetter(ctx context.Context, failed trace.Span, dlq *kafka.Writer, m kafka.Message, cause error) {
+	ctx, span := kafkaTracer.Start(trace.ContextWithSpan(ctx, failed), "Dead letter kafka message",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(telemetry.KafkaAttributes(kafkapkg.ClusterForTopic(dlq.Topic).Endpoint(), dlq.Topic)...),
+	)
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("error.type", errfmt.Category(cause)),
+		attribute.Int("messaging.dlq.attempts", kafkapkg.DeadLetterAttempts(m)+1),
+	)
+
+	if err := kafkapkg.DeadLetter(ctx, dlq, m, cause, failed.SpanContext()); err != nil {
+		deadLetterMessagesTotal.WithLabelValues(m.Topic, "error").Inc()
+		errfmt.Wrap(ctx, err, "Failed to move message to dead letter topic",
+			"topic", m.Topic,
+			"offset", m.Offset,
+		)
+		return
+	}
+	deadLetterMessagesTotal.WithLabelValues(m.Topic, "success").Inc()
+}
+
+// processingResult is the result label of kafka_message_processing_duration_seconds for err
+func processingResult(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, errPanic):
+		return "panic"
+	default:
+		return "error"
+	}
+}
+
+// observeConsumed records the lag of the partition of m, how long m waited in Kafka and the offsets
+// of its partition. Reader.Lag is always -1 for consumer group readers, the lag is computed from the
+// high-water mark fetched with m instead.
+func observeConsumed(reader *kafka.Reader, m kafka.Message) {
+	consumerLag.WithLabelValues(m.Topic, strconv.Itoa(m.Partition)).Set(float64(max(m.HighWaterMark-m.Offset-1, 0)))
+	kafkapkg.RecordOffsets(reader.Config().GroupID, m)
+	if !m.Time.IsZero() {
+		messageDelay.WithLabelValues(m.Topic).Observe(time.Since(m.Time).Seconds())
+	}
+}
+
+// observeProcessing records the processing time with the consumer span's trace ID as exemplar
+func observeProcessing(span trace.Span, topic, result string, duration time.Duration) {
+	observer := messageProcessingDuration.WithLabelValues(topic, result)
+	sc := span.SpanContext()
+	if eo, ok := observer.(prometheus.ExemplarObserver); ok && sc.IsSampled() {
+		eo.ObserveWithExemplar(duration.Seconds(), prometheus.Labels{"trace_id": sc.TraceID().String()})
+		return
+	}
+	observer.Observe(duration.Seconds())
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"goexample/pkg/errfmt"
+	"goexample/pkg/kafkapkg"
+	"goexample/pkg/telemetry"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// Dead letters listed per page by default and at most
+	defaultDLQPageSize = 20
+	maxDLQPageSize     = 100
+	// Dead letters requeued per request at most
+	maxDLQRequeue = 100
+	// Time to read a page or a single dead letter from Kafka
+	dlqReadTimeout = 5 * time.Second
+)
+
+var deadLetterRequeuedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "kafka_dead_letter_requeued_total",
+		Help: "Total number of dead letters requeued to their original topic through the admin API",
+	},
+	[]string{"topic", "result"},
+)
+
+func init() {
+	prometheus.MustRegister(deadLetterRequeuedTotal)
+}
+
+// deadLetterSummary is a dead letter as listed, deadLetterDetail adds its headers and payload
+type deadLetterSummary struct {
+	Partition  int       `json:"partition"`
+	Offset     int64     `json:"offset"`
+	Time       time.Time `json:"time"`
+	Key        string    `json:"key"`
+	Error      string    `json:"error"`
+	ErrorClass string    `json:"error_class"`
+	Attempts   int       `json:"attempts"`
+	TraceID    string    `json:"trace_id,omitempty"`
+	SpanID     string    `json:"span_id,omitempty"`
+}
+
+type deadLetterDetail struct {
+	deadLetterSummary
+	Headers map[string]string `json:"headers"`
+	Value   string            `json:"value"`
+}
+
+func summarizeDeadLetter(m kafka.Message) deadLetterSummary {
+	return deadLetterSummary{
+		Partition:  m.Partition,
+		Offset:     m.Offset,
+		Time:       m.Time,
+		Key:        string(m.Key),
+		Error:      kafkapkg.HeaderValue(m, kafkapkg.DeadLetterErrorHeader),
+		ErrorClass: kafkapkg.HeaderValue(m, kafkapkg.DeadLetterErrorClassHeader),
+		Attempts:   kafkapkg.DeadLetterAttempts(m),
+		TraceID:    kafkapkg.HeaderValue(m, kafkapkg.DeadLetterTraceIDHeader),
+		SpanID:     kafkapkg.HeaderValue(m, kafkapkg.DeadLetterSpanIDHeader),
+	}
+}
+
+// dlqTopic returns the dead letter topic of the {topic} path value, only consumed topics have one
+func dlqTopic(w http.ResponseWriter, req *http.Request) (string, bool) {
+	topic := req.PathValue("topic")
+	if _, ok := lookupConsumerSwitch(topic); !ok {
+		http.Error(w, "unknown topic", http.StatusNotFound)
+		return "", false
+	}
+	return kafkapkg.DeadLetterTopic(topic), true
+}
+
+// queryInt parses the query parameter name, def when it is absent
+func queryInt(req *http.Request, name string, def int64) (int64, error) {
+	value := req.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// listDeadLetters handles GET /admin/dlq/{topic}?partition=P&offset=O&limit=N, a page of the
+// dead letters of topic starting at offset O of partition P
+func listDeadLetters(w http.ResponseWriter, req *http.Request) {
+	dlq, ok := dlqTopic(w, req)
+	if !ok {
+		return
+	}
+	partition, err := queryInt(req, "partition", 0)
+	if err != nil || partition < 0 {
+		http.Error(w, "invalid partition", http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(req, "offset", 0)
+	if err != nil {
+		http.Error(w, "invalid offset", http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(req, "limit", defaultDLQPageSize)
+	if err != nil || limit <= 0 || limit > maxDLQPageSize {
+		http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxDLQPageSize), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), dlqReadTimeout)
+	defer cancel()
+	page, err := kafkapkg.ReadPartition(ctx, dlq, int(partition), offset, int(limit))
+	if err != nil {
+		errfmt.Wrap(ctx, err, "Failed to read dead letters", "topic", dlq, "partition", partition)
+		http.Error(w, "failed to read dead letters", http.StatusBadGateway)
+		return
+	}
+
+	messages := make([]deadLetterSummary, 0, len(page.Messages))
+	for _, m := range page.Messages {
+		messages = append(messages, summarizeDeadLetter(m))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"topic":       dlq,
+		"partition":   partition,
+		"next_offset": page.Next,
+		"end_offset":  page.End,
+		"messages":    messages,
+	})
+}
+
+// readDeadLetter reads the dead letter at offset of partition, ok is false when there is none
+func readDeadLetter(ctx context.Context, dlq string, partition int, offset int64) (m kafka.Message, ok bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, dlqReadTimeout)
+	defer cancel()
+	page, err := kafkapkg.ReadPartition(ctx, dlq, partition, offset, 1)
+	if err != nil || len(page.Messages) == 0 || page.Messages[0].Offset != offset {
+		return kafka.Message{}, false, err
+	}
+	return page.Messages[0], true, nil
+}
+
+// inspectDeadLetter handles GET /admin/dlq/{topic}/{partition}/{offset}, one dead letter with its headers and payload
+func inspectDeadLetter(w http.ResponseWriter, req *http.Request) {
+	dlq, ok := dlqTopic(w, req)
+	if !ok {
+		return
+	}
+	partition, err := strconv.Atoi(req.PathValue("partition"))
+	if err != nil || partition < 0 {
+		http.Error(w, "invalid partition", http.StatusBadRequest)
+		return
+	}
+	offset, err := strconv.ParseInt(req.PathValue("offset"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	m, found, err := readDeadLetter(req.Context(), dlq, partition, offset)
+	if err != nil {
+		errfmt.Wrap(req.Context(), err, "Failed to read dead letter", "topic", dlq, "partition", partition, "offset", offset)
+		http.Error(w, "failed to read dead letter", http.StatusBadGateway)
+		return
+	}
+	if !found {
+		http.Error(w, "no dead letter at this offset", http.StatusNotFound)
+		return
+	}
+
+	headers := make(map[string]string, len(m.Headers))
+	for _, h := range m.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(deadLetterDetail{
+		deadLetterSummary: summarizeDeadLetter(m),
+		Headers:           headers,
+		Value:             string(m.Value),
+	})
+}
+
+// requeueResult reports the requeue of one selected dead letter
+type requeueResult struct {
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Requeued  bool   `json:"requeued"`
+	TraceID   string `json:"trace_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// requeueDeadLetters handles POST /admin/dlq/{topic}/requeue with the selected dead letters,
+// {"messages": [{"partition": 0, "offset": 12}]}, writing each back to topic
+func requeueDeadLetters(w http.ResponseWriter, req *http.Request) {
+	dlq, ok := dlqTopic(w, req)
+	if !ok {
+		return
+	}
+	var body struct {
+		Messages []struct {
+			Partition int   `json:"partition"`
+			Offset    int64 `json:"offset"`
+		} `json:"messages"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil || len(body.Messages) == 0 || len(body.Messages) > maxDLQRequeue {
+		http.Error(w, "select between 1 and "+strconv.Itoa(maxDLQRequeue)+" messages", http.StatusBadRequest)
+		return
+	}
+
+	topic := req.PathValue("topic")
+	writer := kafkapkg.GetKafkaWriter(topic)
+	defer writer.Close()
+
+	results := make([]requeueResult, 0, len(body.Messages))
+	for _, selected := range body.Messages {
+		results = append(results, requeueDeadLetter(req.Context(), writer, dlq, selected.Partition, selected.Offset))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(results)
+}
+
+// requeueDeadLetter writes the dead letter at offset of partition back to the writer's topic. Its span
+// starts a new trace linked to the failed processing, the reprocessing becomes part of the new trace.
+func requeueDeadLetter(ctx context.Context, writer *kafka.Writer, dlq string, partition int, offset int64) requeueResult {
+	result := requeueResult{Partition: partition, Offset: offset}
+
+	m, found, err := readDeadLetter(ctx, dlq, partition, offset)
+	if err != nil {
+		deadLetterRequeuedTotal.WithLabelValues(writer.Topic, "error").Inc()
+		result.Error = errfmt.Wrap(ctx, err, "Failed to read dead letter", "topic", dlq, "partition", partition, "offset", offset).Error()
+		return result
+	}
+	if !found {
+		deadLetterRequeuedTotal.WithLabelValues(writer.Topic, "not_found").Inc()
+		result.Error = "no dead letter at this offset"
+		return result
+	}
+
+	opts := []trace.SpanStartOption{
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(telemetry.KafkaAttributes(kafkapkg.ClusterForTopic(writer.Topic).Endpoint(), writer.Topic)...),
+		trace.WithAttributes(
+			attribute.String("messaging.dlq.topic", dlq),
+			attribute.Int("messaging.dlq.partition", partition),
+			attribute.Int64("messaging.dlq.offset", offset),
+			attribute.Int("messaging.dlq.attempts", kafkapkg.DeadLetterAttempts(m)),
+		),
+	}
+	if failed := kafkapkg.DeadLetterSpanContext(m); failed.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{
+			SpanContext: failed,
+			Attributes:  []attribute.KeyValue{attribute.String("link.type", "dead_letter")},
+		}))
+	}
+	ctx, span := kafkaTracer.Start(ctx, "Requeue dead letter", opts...)
+	defer span.End()
+	result.TraceID = span.SpanContext().TraceID().String()
+
+	if err := kafkapkg.Requeue(ctx, writer, m); err != nil {
+		deadLetterRequeuedTotal.WithLabelValues(writer.Topic, "error").Inc()
+		span.SetStatus(codes.Error, "requeue failed")
+		result.Error = errfmt.Wrap(ctx, err, "Failed to requeue dead letter", "topic", writer.Topic, "offset", offset).Error()
+		return result
+	}
+	deadLetterRequeuedTotal.WithLabelValues(writer.Topic, "success").Inc()
+	result.Requeued = true
+
+	logWithTrace(ctx).WithFields(logrus.Fields{
+		"topic":           writer.Topic,
+		"dlq_partition":   partition,
+		"dlq_offset":      offset,
+		"attempts":        kafkapkg.DeadLetterAttempts(m),
+		"failed_trace_id": kafkapkg.HeaderValue(m, kafkapkg.DeadLetterTraceIDHeader),
+	}).Info("Requeued dead letter")
+	return result
+}
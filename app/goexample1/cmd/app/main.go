@@ -3,25 +3,29 @@ package main
 import (
 	"context"
 	"fmt"
+	"goexample/pkg/adminauth"
+	"goexample/pkg/errfmt"
 	"goexample/pkg/kafkapkg"
+	"goexample/pkg/telemetry"
 	"io"
 	"log"
 	"net/http"
 	"os"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
 var (
-	logger *logrus.Logger
+	adminAuth adminauth.Config
+	logger    *logrus.Logger
 )
 
 // logWithTrace returns a logrus.Entry with trace_id and span_id from context
@@ -39,7 +43,7 @@ func logWithTrace(ctx context.Context) *logrus.Entry {
 func hello(w http.ResponseWriter, req *http.Request) {
 	// Extract the context from the incoming HTTP headers
 	parentCtx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
-	_, span := tracer.Start(parentCtx, "Start hello handler")
+	ctx, span := httpTracer.Start(parentCtx, "Start hello handler")
 	defer span.End()
 
 	logWithTrace(parentCtx).WithFields(logrus.Fields{
@@ -52,15 +56,23 @@ func hello(w http.ResponseWriter, req *http.Request) {
 	fmt.Fprintf(w, "hello again\n")
 
 	// sent to rustexample:8080
-	appreq, _ := http.NewRequest("GET", "http://rustexample:8080", nil)
-	otel.GetTextMapPropagator().Inject(parentCtx, propagation.HeaderCarrier(appreq.Header))
-	res, err := http.DefaultClient.Do(appreq)
+	const rustURL = "http://rustexample:8080"
+	clientCtx, clientSpan := httpTracer.Start(ctx, "GET rustexample",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(telemetry.PeerAttributes("rustexample", rustURL)...),
+	)
+	defer clientSpan.End()
+
+	// Connection phases show up as events on the client span
+	appreq, _ := http.NewRequestWithContext(telemetry.WithClientTrace(clientCtx), "GET", rustURL, nil)
+	otel.GetTextMapPropagator().Inject(clientCtx, propagation.HeaderCarrier(appreq.Header))
+	res, err := rustexampleClient.Do(appreq)
+	telemetry.FinishClientSpan(appreq, res, err)
 	if err != nil {
-		logWithTrace(parentCtx).WithFields(logrus.Fields{
-			"error":   err,
-			"service": "rustexample",
-		}).Error("Failed to send request")
+		errfmt.Wrap(clientCtx, err, "Failed to send request", "service", "rustexample")
+		return
 	}
+	defer res.Body.Close()
 	bodyB, _ := io.ReadAll(res.Body)
 	span.SetAttributes(attribute.String("response", string(bodyB)))
 }
@@ -80,6 +92,8 @@ func main() {
 	logger = logrus.New()
 	logger.SetFormatter(&logrus.JSONFormatter{})
 	logger.SetLevel(logrus.InfoLevel)
+	logger.AddHook(telemetry.FieldsHook{Fields: telemetry.DeploymentFromEnv().LogFields()})
+	errfmt.SetLogger(logger)
 
 	logger.WithFields(logrus.Fields{
 		"service": "goexample1",
@@ -100,61 +114,118 @@ func main() {
 	// Handle shutdown properly so nothing leaks.
 	defer func() { _ = tp.Shutdown(ctx) }()
 
+	// Virtual downstream services for a richer service graph (GET /virtual/{service})
+	stopVirtualServices, err := startVirtualServices(exp)
+	if err != nil {
+		logger.WithField("error", err).Fatal("failed to start virtual services")
+	}
+	defer stopVirtualServices(ctx)
+
 	otel.SetTracerProvider(tp)
 	otel.SetTextMapPropagator(propagation.TraceContext{})
 
-	// Finally, set the tracer that can be used for this package.
-	tracer = tp.Tracer("goexample1")
+	// Finally, set the tracers that can be used for this package, one per instrumentation scope.
+	tracer = telemetry.Tracer(tp, "goexample1", telemetry.ScopeBusiness)
+	httpTracer = telemetry.Tracer(tp, "goexample1", telemetry.ScopeHTTPServer)
+	kafkaTracer = telemetry.Tracer(tp, "goexample1", telemetry.ScopeKafka)
 
-	// kafka
-	go kakaConsumer()
-
-	// routes
-	http.HandleFunc("/hello", hello)
-	http.HandleFunc("/headers", headers)
+	// Timeouts of the calls to rustexample
+	if err := loadDependencyTimeouts(); err != nil {
+		logger.WithField("error", err).Fatal("failed to configure dependency timeouts")
+	}
 
-	logger.Info("Server is ready to handle requests")
-	http.ListenAndServe(":8080", nil)
-}
+	// kafka clusters, topics can be routed to other clusters than KAFKA_ENDPOINT
+	kafkaClusters, err := kafkapkg.LoadClusters()
+	if err != nil {
+		logger.WithField("error", err).Fatal("failed to configure kafka clusters")
+	}
 
-func kakaConsumer() {
-	reader := kafkapkg.GetKafkaReader("trace", "go")
-	defer reader.Close()
+	// kafka, every handler only processes the messages matching its KAFKA_FILTER_<HANDLER>
+	helloFilter, err := kafkapkg.FilterFromEnv("hello")
+	if err != nil {
+		logger.WithField("error", err).Fatal("failed to configure kafka filter")
+	}
+	ordersFilter, err := kafkapkg.FilterFromEnv("orders")
+	if err != nil {
+		logger.WithField("error", err).Fatal("failed to configure kafka filter")
+	}
+	// Every handler also discards the messages older than its KAFKA_MESSAGE_TTL_<HANDLER>, when set
+	helloStale, err := kafkapkg.StalePolicyFromEnv("hello")
+	if err != nil {
+		logger.WithField("error", err).Fatal("failed to configure kafka message TTL")
+	}
+	ordersStale, err := kafkapkg.StalePolicyFromEnv("orders")
+	if err != nil {
+		logger.WithField("error", err).Fatal("failed to configure kafka message TTL")
+	}
+	go kakaConsumer(helloFilter, helloStale)
 
-	logger.Info("start consuming kafka messages")
-	for {
-		m, err := reader.ReadMessage(context.Background())
-		if err != nil {
-			logger.WithField("error", err).Fatal("Error reading kafka message")
-		}
+	// orders workflow
+	go runRestock()
+	go orderWorker(ordersFilter, ordersStale)
 
-		// Extract the context from Kafka headers
-		carrier := propagation.MapCarrier{}
-		for _, header := range m.Headers {
-			carrier[header.Key] = string(header.Value)
-		}
+	// async tasks of goexample, results are published back for polling
+	go taskWorker()
 
-		// Extract the tracing context from the carrier
-		ctx := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+	// routes
+	http.HandleFunc("/hello", hello)
+	http.HandleFunc("/headers", headers)
+	http.HandleFunc("POST /inventory/reserve", reserveInventory)
+	http.HandleFunc("POST /inventory/release", releaseInventory)
+	http.HandleFunc("GET /virtual/{service}", virtualService)
 
-		// Start a new span with the extracted context
-		_, span := tracer.Start(ctx, "Processing kafka message")
-		span.SetAttributes(attribute.String("message", string(m.Value)))
+	// Reverse proxy routes to additional example services
+	proxyRoutes, err := parseProxyRoutes()
+	if err != nil {
+		logger.WithField("error", err).Fatal("failed to configure proxy routes")
+	}
+	for _, route := range proxyRoutes {
+		http.Handle(route.prefix+"/", newProxyHandler(route))
+		logger.WithFields(logrus.Fields{
+			"route":  route.prefix,
+			"target": route.target.String(),
+		}).Info("Proxying route")
+	}
 
-		logWithTrace(ctx).WithFields(logrus.Fields{
-			"topic":     m.Topic,
-			"partition": m.Partition,
-			"offset":    m.Offset,
-			"key":       string(m.Key),
-			"value":     string(m.Value),
-		}).Info("Received kafka message")
+	// Optional credentials and IP allowlist for the metrics and admin endpoints
+	adminAuth, err = adminauth.ConfigFromEnv()
+	if err != nil {
+		logger.WithField("error", err).Fatal("failed to configure admin auth")
+	}
 
-		span.End()
+	// Admin API
+	http.Handle("GET /admin/config", adminauth.Protect(adminAuth, "/admin/config", getConfig(kafkaClusters)))
+	http.Handle("GET /admin/consumers", adminauth.Protect(adminAuth, "/admin/consumers", http.HandlerFunc(listConsumers)))
+	http.Handle("POST /admin/consumers/{topic}/pause", adminauth.Protect(adminAuth, "/admin/consumers/pause", http.HandlerFunc(pauseConsumer)))
+	http.Handle("POST /admin/consumers/{topic}/resume", adminauth.Protect(adminAuth, "/admin/consumers/resume", http.HandlerFunc(resumeConsumer)))
+	// Browse the dead letters of a consumed topic and requeue them to it
+	http.Handle("GET /admin/dlq/{topic}", adminauth.Protect(adminAuth, "/admin/dlq", http.HandlerFunc(listDeadLetters)))
+	http.Handle("GET /admin/dlq/{topic}/{partition}/{offset}", adminauth.Protect(adminAuth, "/admin/dlq", http.HandlerFunc(inspectDeadLetter)))
+	http.Handle("POST /admin/dlq/{topic}/requeue", adminauth.Protect(adminAuth, "/admin/dlq/requeue", http.HandlerFunc(requeueDeadLetters)))
+
+	// Prometheus metrics endpoint
+	// OpenMetrics is required to expose exemplars
+	// Deployment environment, region, zone and variant are added to every metric as constant labels
+	// Scrape duration and size are always measured, METRICS_SCRAPE_TRACING=true adds a span per scrape
+	var scrapeTracer trace.Tracer
+	if os.Getenv("METRICS_SCRAPE_TRACING") == "true" {
+		scrapeTracer = httpTracer
 	}
+	http.Handle("/metrics", adminauth.Protect(adminAuth, "/metrics", telemetry.InstrumentScrape(promhttp.HandlerFor(
+		telemetry.WithConstLabels(prometheus.DefaultGatherer, telemetry.DeploymentFromEnv().Labels()),
+		promhttp.HandlerOpts{
+			EnableOpenMetrics: true,
+		}), scrapeTracer)))
+
+	logger.Info("Server is ready to handle requests")
+	http.ListenAndServe(":8080", nil)
 }
 
 var (
+	// Spans of the business logic, the HTTP server and the Kafka consumers
 	tracer       trace.Tracer
+	httpTracer   trace.Tracer
+	kafkaTracer  trace.Tracer
 	otlpEndpoint string
 )
 
@@ -187,15 +258,8 @@ func newOTLPExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
 // TracerProvider is an OpenTelemetry TracerProvider.
 // It provides Tracers to instrumentation so it can trace operational flow through a system.
 func newTraceProvider(exp sdktrace.SpanExporter) *sdktrace.TracerProvider {
-	// Ensure default SDK resources and the required service name are set.
-	r, err := resource.Merge(
-		resource.Default(),
-		resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceName("goexample1"),
-		),
-	)
-
+	// Service name plus deployment environment, region and zone
+	r, err := telemetry.Resource("goexample1")
 	if err != nil {
 		panic(err)
 	}
@@ -203,5 +267,7 @@ func newTraceProvider(exp sdktrace.SpanExporter) *sdktrace.TracerProvider {
 	return sdktrace.NewTracerProvider(
 		sdktrace.WithBatcher(exp),
 		sdktrace.WithResource(r),
+		// The edge's deployment from the cozi tracestate entry as cozi.* attributes
+		sdktrace.WithSpanProcessor(telemetry.TraceStateProcessor{}),
 	)
 }
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goexample/pkg/dedup"
+	"goexample/pkg/errfmt"
+	"goexample/pkg/kafkapkg"
+	"goexample/pkg/telemetry"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ordersTopic = "orders"
+	// Units of every item in stock after a restock
+	stockCapacity = 100
+	// How often the simulated supplier refills the inventory
+	restockInterval = 30 * time.Second
+	// Upper bound for running a compensation
+	compensationTimeout = 10 * time.Second
+)
+
+// errStaleOrder is the cause of rolling back an order older than the orders TTL
+var errStaleOrder = errors.New("order expired before shipping")
+
+var (
+	ordersTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "orders_total",
+			Help: "Total number of orders reaching each workflow state",
+		},
+		[]string{"state"},
+	)
+
+	sagaRollbacksTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "saga_rollbacks_total",
+			Help: "Total number of order workflows rolled back, by the step that failed",
+		},
+		[]string{"step"},
+	)
+
+	inventoryStock = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "inventory_stock",
+			Help: "Units of each item currently available for reservation",
+		},
+		[]string{"item"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(ordersTotal)
+	prometheus.MustRegister(sagaRollbacksTotal)
+	prometheus.MustRegister(inventoryStock)
+}
+
+// order is the order event published by goexample
+type order struct {
+	ID       string `json:"order_id"`
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+	// Step at which the workflow fails on purpose, empty for none
+	FailAt string `json:"fail_at,omitempty"`
+}
+
+// inventory is the in-memory stock of the items that can be ordered and the
+// reservations held per order ID
+var inventory = struct {
+	sync.Mutex
+	stock        map[string]int
+	reservations map[string]order
+}{
+	stock:        map[string]int{"widget": 0, "gadget": 0, "gizmo": 0},
+	reservations: make(map[string]order),
+}
+
+// restock refills every item to full capacity
+func restock() {
+	inventory.Lock()
+	defer inventory.Unlock()
+	for item := range inventory.stock {
+		inventory.stock[item] = stockCapacity
+		inventoryStock.WithLabelValues(item).Set(stockCapacity)
+	}
+}
+
+// runRestock periodically refills the inventory
+func runRestock() {
+	restock()
+	for range time.Tick(restockInterval) {
+		restock()
+	}
+}
+
+// reserve takes the order's quantity out of stock, reporting whether enough was available
+func reserve(o order) bool {
+	inventory.Lock()
+	defer inventory.Unlock()
+
+	if _, ok := inventory.reservations[o.ID]; ok {
+		return true
+	}
+	available, ok := inventory.stock[o.Item]
+	if !ok || available < o.Quantity {
+		return false
+	}
+	inventory.stock[o.Item] = available - o.Quantity
+	inventory.reservations[o.ID] = o
+	inventoryStock.WithLabelValues(o.Item).Set(float64(available - o.Quantity))
+	return true
+}
+
+// release puts the stock reserved for the order back, reporting whether a reservation existed
+func release(orderID string) bool {
+	inventory.Lock()
+	defer inventory.Unlock()
+
+	o, ok := inventory.reservations[orderID]
+	if !ok {
+		return false
+	}
+	delete(inventory.reservations, orderID)
+	// Restocking may have refilled the item in the meantime
+	inventory.stock[o.Item] = min(inventory.stock[o.Item]+o.Quantity, stockCapacity)
+	inventoryStock.WithLabelValues(o.Item).Set(float64(inventory.stock[o.Item]))
+	return true
+}
+
+// fulfil drops the reservation of a shipped order
+func fulfil(orderID string) {
+	inventory.Lock()
+	defer inventory.Unlock()
+	delete(inventory.reservations, orderID)
+}
+
+// reserveInventory handles POST /inventory/reserve, responding 409 when the order cannot be fulfilled
+func reserveInventory(w http.ResponseWriter, req *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+	ctx, span := httpTracer.Start(ctx, "Reserve inventory", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	var o order
+	if err := json.NewDecoder(req.Body).Decode(&o); err != nil || o.Quantity <= 0 {
+		span.SetStatus(codes.Error, "invalid order")
+		http.Error(w, "invalid order", http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("order.id", o.ID),
+		attribute.String("order.item", o.Item),
+		attribute.Int("order.quantity", o.Quantity),
+	)
+
+	if !reserve(o) {
+		ordersTotal.WithLabelValues("out_of_stock").Inc()
+		span.SetStatus(codes.Error, "out of stock")
+		logWithTrace(ctx).WithFields(logrus.Fields{
+			"order_id": o.ID,
+			"item":     o.Item,
+			"quantity": o.Quantity,
+		}).Warn("Not enough stock to reserve order")
+		http.Error(w, "out of stock", http.StatusConflict)
+		return
+	}
+
+	ordersTotal.WithLabelValues("reserved").Inc()
+	logWithTrace(ctx).WithFields(logrus.Fields{
+		"order_id": o.ID,
+		"item":     o.Item,
+		"quantity": o.Quantity,
+	}).Info("Reserved inventory")
+
+	// Fail after reserving, the caller has to compensate
+	if o.FailAt == "reserve" {
+		span.SetStatus(codes.Error, "injected failure")
+		http.Error(w, "injected failure", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// releaseInventory handles POST /inventory/release, the compensation of a reservation.
+// Releasing an order without reservation succeeds so the call can be retried.
+func releaseInventory(w http.ResponseWriter, req *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+	ctx, span := httpTracer.Start(ctx, "Release inventory", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	var o order
+	if err := json.NewDecoder(req.Body).Decode(&o); err != nil || o.ID == "" {
+		span.SetStatus(codes.Error, "invalid order")
+		http.Error(w, "invalid order", http.StatusBadRequest)
+		return
+	}
+
+	released := release(o.ID)
+	span.SetAttributes(
+		attribute.String("order.id", o.ID),
+		attribute.Bool("inventory.released", released),
+	)
+	logWithTrace(ctx).WithFields(logrus.Fields{
+		"order_id": o.ID,
+		"released": released,
+	}).Info("Released inventory")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// orderWorker consumes placed orders matching filter and ships them, stale orders are rolled back
+func orderWorker(filter kafkapkg.Filter, stale kafkapkg.StalePolicy) {
+	reader := kafkapkg.GetKafkaReader(ordersTopic, "go-orders", kafkapkg.NewGroupObserver("go-orders", logger, kafkaTracer))
+	defer reader.Close()
+	dlq := kafkapkg.GetKafkaWriter(kafkapkg.DeadLetterTopic(ordersTopic))
+	defer dlq.Close()
+
+	seen := dedup.NewLRU(dedupCapacity)
+	pause := consumerSwitch(ordersTopic)
+
+	logger.Info("start shipping orders")
+	for {
+		_ = pause.Wait(context.Background())
+
+		m, err := reader.ReadMessage(context.Background())
+		if err != nil {
+			logger.WithField("error", err).Fatal("Error reading order message")
+		}
+		observeConsumed(reader, m)
+		if !filter.Match(m) {
+			filteredMessagesTotal.WithLabelValues(m.Topic, "orders").Inc()
+			continue
+		}
+
+		// Order events are plain JSON or in a CloudEvents envelope, depending on KAFKA_CLOUDEVENTS of goexample
+		event, _, decodeErr := kafkapkg.DecodeEvent(m)
+		ctx := event.Context(context.Background())
+
+		start := time.Now()
+		ctx, span := kafkaTracer.Start(ctx, "Ship order",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(telemetry.KafkaAttributes(kafkapkg.ClusterForTopic(m.Topic).Endpoint(), m.Topic)...),
+			trace.WithAttributes(event.Attributes()...),
+		)
+
+		if id := kafkapkg.HeaderValue(m, kafkapkg.MessageIDHeader); id != "" && seen.Seen(id) {
+			duplicateMessagesTotal.WithLabelValues(m.Topic).Inc()
+			span.SetAttributes(attribute.Bool("messaging.message.duplicate", true))
+			span.End()
+			observeProcessing(span, m.Topic, "duplicate", time.Since(start))
+			continue
+		}
+
+		// Shipping an order this late is pointless, its reservation is released instead. Duplicates are
+		// skipped first so a redelivered stale order is not released twice.
+		if discardStale(ctx, span, m, "orders", stale) {
+			var o order
+			if err := json.Unmarshal(event.Data, &o); err == nil {
+				compensateShipment(ctx, o, errStaleOrder)
+			}
+			span.End()
+			observeProcessing(span, m.Topic, "stale", time.Since(start))
+			continue
+		}
+
+		err = processMessage(ctx, span, dlq, m, func(ctx context.Context) error {
+			if decodeErr != nil {
+				return errfmt.Wrap(ctx, decodeErr, "Failed to decode order event", "offset", m.Offset)
+			}
+			var o order
+			if err := json.Unmarshal(event.Data, &o); err != nil {
+				return errfmt.Wrap(ctx, err, "Failed to decode order event", "offset", m.Offset)
+			}
+			span.SetAttributes(attribute.String("order.id", o.ID))
+
+			// A panicking shipment is dead-lettered by processMessage, its reservation is released first
+			defer func() {
+				if r := recover(); r != nil {
+					compensateShipment(ctx, o, fmt.Errorf("%w: %v", errPanic, r))
+					panic(r)
+				}
+			}()
+			if err := ship(ctx, o); err != nil {
+				errfmt.Wrap(ctx, err, "Failed to ship order", "order_id", o.ID)
+				compensateShipment(ctx, o, err)
+				return err
+			}
+			return nil
+		})
+
+		span.End()
+		observeProcessing(span, m.Topic, processingResult(err), time.Since(start))
+	}
+}
+
+// ship simulates handing the order to a carrier
+func ship(ctx context.Context, o order) error {
+	time.Sleep(50 * time.Millisecond)
+	switch o.FailAt {
+	case "ship":
+		return errors.New("injected failure")
+	case "ship_panic":
+		// Exercises the consumer's panic recovery and dead letter topic
+		panic("injected panic while shipping order " + o.ID)
+	}
+
+	fulfil(o.ID)
+	ordersTotal.WithLabelValues("shipped").Inc()
+	logWithTrace(ctx).WithFields(logrus.Fields{
+		"order_id": o.ID,
+		"item":     o.Item,
+		"quantity": o.Quantity,
+	}).Info("Order shipped")
+	return nil
+}
+
+// compensateShipment releases the inventory of an order that could not be shipped,
+// in its own trace linked to the order's trace
+func compensateShipment(ctx context.Context, o order, cause error) {
+	ctx, span, cancel := telemetry.Detach(ctx, tracer, "Compensate order", compensationTimeout)
+	defer cancel()
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("order.id", o.ID),
+		attribute.String("saga.failed_step", "ship"),
+		attribute.String("saga.cause", cause.Error()),
+	)
+	sagaRollbacksTotal.WithLabelValues("ship").Inc()
+
+	_, releaseSpan := tracer.Start(ctx, "Release inventory")
+	released := release(o.ID)
+	releaseSpan.SetAttributes(attribute.Bool("inventory.released", released))
+	releaseSpan.End()
+
+	ordersTotal.WithLabelValues("rolled_back").Inc()
+	logWithTrace(ctx).WithFields(logrus.Fields{
+		"order_id":    o.ID,
+		"failed_step": "ship",
+		"cause":       cause,
+	}).Warn("Rolled back order")
+}
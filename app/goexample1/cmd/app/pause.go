@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var consumerPaused = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "kafka_consumer_paused",
+		Help: "Whether consumption of the topic is paused through the admin API (1) or running (0)",
+	},
+	[]string{"topic"},
+)
+
+func init() {
+	prometheus.MustRegister(consumerPaused)
+}
+
+// pauseSwitch blocks a consumer loop while paused. The reader keeps its group
+// membership and heartbeats, it just stops fetching once its buffer is full.
+type pauseSwitch struct {
+	mu      sync.Mutex
+	resumed chan struct{} // nil while running, closed when resumed
+}
+
+// Wait blocks while the switch is paused or until ctx is done
+func (p *pauseSwitch) Wait(ctx context.Context) error {
+	p.mu.Lock()
+	resumed := p.resumed
+	p.mu.Unlock()
+
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *pauseSwitch) pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumed == nil {
+		p.resumed = make(chan struct{})
+	}
+}
+
+func (p *pauseSwitch) resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumed != nil {
+		close(p.resumed)
+		p.resumed = nil
+	}
+}
+
+func (p *pauseSwitch) paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resumed != nil
+}
+
+// consumerSwitches holds one pause switch per consumed topic
+var consumerSwitches = struct {
+	sync.Mutex
+	topics map[string]*pauseSwitch
+}{topics: make(map[string]*pauseSwitch)}
+
+// consumerSwitch returns the pause switch of topic, creating it on first use
+func consumerSwitch(topic string) *pauseSwitch {
+	consumerSwitches.Lock()
+	defer consumerSwitches.Unlock()
+
+	p, ok := consumerSwitches.topics[topic]
+	if !ok {
+		p = &pauseSwitch{}
+		consumerSwitches.topics[topic] = p
+		consumerPaused.WithLabelValues(topic).Set(0)
+	}
+	return p
+}
+
+func lookupConsumerSwitch(topic string) (*pauseSwitch, bool) {
+	consumerSwitches.Lock()
+	defer consumerSwitches.Unlock()
+	p, ok := consumerSwitches.topics[topic]
+	return p, ok
+}
+
+// listConsumers responds with the paused state of every consumed topic
+func listConsumers(w http.ResponseWriter, req *http.Request) {
+	consumerSwitches.Lock()
+	topics := make([]string, 0, len(consumerSwitches.topics))
+	for topic := range consumerSwitches.topics {
+		topics = append(topics, topic)
+	}
+	consumerSwitches.Unlock()
+	sort.Strings(topics)
+
+	type consumerState struct {
+		Topic  string `json:"topic"`
+		Paused bool   `json:"paused"`
+	}
+	states := make([]consumerState, 0, len(topics))
+	for _, topic := range topics {
+		p, _ := lookupConsumerSwitch(topic)
+		states = append(states, consumerState{Topic: topic, Paused: p.paused()})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(states)
+}
+
+// pauseConsumer handles POST /admin/consumers/{topic}/pause
+func pauseConsumer(w http.ResponseWriter, req *http.Request) {
+	setConsumerPaused(w, req, true)
+}
+
+// resumeConsumer handles POST /admin/consumers/{topic}/resume
+func resumeConsumer(w http.ResponseWriter, req *http.Request) {
+	setConsumerPaused(w, req, false)
+}
+
+func setConsumerPaused(w http.ResponseWriter, req *http.Request, paused bool) {
+	topic := req.PathValue("topic")
+	p, ok := lookupConsumerSwitch(topic)
+	if !ok {
+		http.Error(w, "unknown topic", http.StatusNotFound)
+		return
+	}
+
+	if paused {
+		p.pause()
+		consumerPaused.WithLabelValues(topic).Set(1)
+	} else {
+		p.resume()
+		consumerPaused.WithLabelValues(topic).Set(0)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"topic":  topic,
+		"paused": paused,
+	}).Info("Changed kafka consumer state")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"goexample/pkg/errfmt"
+	"goexample/pkg/telemetry"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	proxyRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_requests_total",
+			Help: "Total number of requests forwarded by the reverse proxy",
+		},
+		[]string{"route", "status"},
+	)
+
+	proxyRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "proxy_request_duration_seconds",
+			Help:    "Duration of requests forwarded by the reverse proxy",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"route"},
+	)
+
+	proxyErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "proxy_errors_total",
+			Help: "Total number of requests the reverse proxy failed to forward",
+		},
+		[]string{"route"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(proxyRequestsTotal)
+	prometheus.MustRegister(proxyRequestDuration)
+	prometheus.MustRegister(proxyErrorsTotal)
+}
+
+// proxyRoute forwards every request below prefix to target
+type proxyRoute struct {
+	prefix string
+	target *url.URL
+}
+
+// parseProxyRoutes reads PROXY_ROUTES, e.g. "/python=http://pyexample:8000,/node=http://nodeexample:3000"
+func parseProxyRoutes() ([]proxyRoute, error) {
+	value := os.Getenv("PROXY_ROUTES")
+	if value == "" {
+		return nil, nil
+	}
+
+	var routes []proxyRoute
+	for _, pair := range strings.Split(value, ",") {
+		prefix, rawURL, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("invalid proxy route %q", pair)
+		}
+		target, err := url.Parse(rawURL)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			return nil, fmt.Errorf("invalid proxy target %q", rawURL)
+		}
+		routes = append(routes, proxyRoute{prefix: strings.TrimSuffix(prefix, "/"), target: target})
+	}
+	return routes, nil
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.statusCode = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// newProxyHandler returns a traced reverse proxy for the route
+func newProxyHandler(route proxyRoute) http.Handler {
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(route.target)
+			pr.SetXForwarded()
+			// Record the upstream connection phases on the proxy span
+			pr.Out = pr.Out.WithContext(telemetry.WithClientTrace(pr.Out.Context()))
+			// Continue the trace from the proxy span rather than the caller's span
+			otel.GetTextMapPropagator().Inject(pr.Out.Context(), propagation.HeaderCarrier(pr.Out.Header))
+		},
+		ModifyResponse: func(res *http.Response) error {
+			telemetry.FinishClientSpan(res.Request, res, nil)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			telemetry.FinishClientSpan(req, nil, err)
+			proxyErrorsTotal.WithLabelValues(route.prefix).Inc()
+			errfmt.Wrap(req.Context(), errfmt.WithCategory(err, errfmt.CategoryDependency), "Failed to proxy request",
+				"route", route.prefix,
+				"target", route.target.String(),
+			)
+
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		parentCtx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := httpTracer.Start(parentCtx, "Proxy "+route.prefix, trace.WithSpanKind(trace.SpanKindClient))
+		defer span.End()
+
+		span.SetAttributes(
+			attribute.String("proxy.route", route.prefix),
+			attribute.String("proxy.target", route.target.String()),
+		)
+		span.SetAttributes(telemetry.PeerAttributes(route.target.Hostname(), route.target.String())...)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		proxy.ServeHTTP(rec, req.WithContext(ctx))
+
+		proxyRequestsTotal.WithLabelValues(route.prefix, strconv.Itoa(rec.statusCode)).Inc()
+		proxyRequestDuration.WithLabelValues(route.prefix).Observe(time.Since(start).Seconds())
+	})
+
+	return http.StripPrefix(route.prefix, handler)
+}
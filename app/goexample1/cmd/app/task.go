@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"goexample/pkg/errfmt"
+	"goexample/pkg/kafkapkg"
+	"goexample/pkg/telemetry"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tasksTopic       = "tasks"
+	taskResultsTopic = "task-results"
+)
+
+var tasksProcessedTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tasks_processed_total",
+		Help: "Total number of async tasks processed, by kind and status (succeeded or failed)",
+	},
+	[]string{"kind", "status"},
+)
+
+func init() {
+	prometheus.MustRegister(tasksProcessedTotal)
+}
+
+// task is the async task event published by goexample
+type task struct {
+	ID     string `json:"task_id"`
+	Kind   string `json:"kind"`
+	WorkMS int    `json:"work_ms"`
+	Fail   bool   `json:"fail,omitempty"`
+}
+
+// taskResult is published to the task-results topic once a task is processed
+type taskResult struct {
+	ID     string `json:"task_id"`
+	Status string `json:"status"`
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// taskWorker processes the tasks enqueued by goexample and publishes their results. Each task
+// runs in its own trace linked to the enqueue span, the result message continues that trace.
+func taskWorker() {
+	reader := kafkapkg.GetKafkaReader(tasksTopic, "go-tasks", kafkapkg.NewGroupObserver("go-tasks", logger, kafkaTracer))
+	defer reader.Close()
+	results := kafkapkg.GetKafkaWriter(taskResultsTopic)
+	defer results.Close()
+
+	logger.Info("start processing tasks")
+	for {
+		m, err := reader.ReadMessage(context.Background())
+		if err != nil {
+			logger.WithField("error", err).Fatal("Error reading task message")
+		}
+		observeConsumed(reader, m)
+
+		carrier := propagation.MapCarrier{}
+		for _, header := range m.Headers {
+			carrier[header.Key] = string(header.Value)
+		}
+		enqueued := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+
+		start := time.Now()
+		ctx, span := kafkaTracer.Start(context.Background(), "Process task",
+			trace.WithNewRoot(),
+			trace.WithLinks(trace.LinkFromContext(enqueued, attribute.String("task.link", "enqueue"))),
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(telemetry.KafkaAttributes(kafkapkg.ClusterForTopic(m.Topic).Endpoint(), m.Topic)...),
+		)
+		err = processTask(ctx, span, results, m)
+		span.End()
+		observeProcessing(span, m.Topic, processingResult(err), time.Since(start))
+	}
+}
+
+// processTask does the simulated work of the task in m and publishes its result
+func processTask(ctx context.Context, span trace.Span, results *kafka.Writer, m kafka.Message) error {
+	var t task
+	if err := json.Unmarshal(m.Value, &t); err != nil {
+		span.SetStatus(codes.Error, "invalid task")
+		return errfmt.Wrap(ctx, err, "Failed to decode task event", "offset", m.Offset)
+	}
+	span.SetAttributes(
+		attribute.String("task.id", t.ID),
+		attribute.String("task.kind", t.Kind),
+	)
+
+	time.Sleep(time.Duration(t.WorkMS) * time.Millisecond)
+	r := taskResult{ID: t.ID, Status: "succeeded", Output: t.Kind + " ready"}
+	if t.Fail {
+		r = taskResult{ID: t.ID, Status: "failed", Error: "injected failure"}
+		span.SetStatus(codes.Error, r.Error)
+	}
+	span.SetAttributes(attribute.String("task.status", r.Status))
+	tasksProcessedTotal.WithLabelValues(t.Kind, r.Status).Inc()
+
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	headers := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, headers)
+	msg := kafka.Message{Key: []byte(t.ID), Value: value}
+	for key, value := range headers {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+	if err := results.WriteMessages(ctx, msg); err != nil {
+		return errfmt.Wrap(ctx, err, "Failed to publish task result", "task_id", t.ID)
+	}
+
+	logWithTrace(ctx).WithFields(logrus.Fields{
+		"task_id": t.ID,
+		"kind":    t.Kind,
+		"status":  r.Status,
+	}).Info("Task processed")
+	return nil
+}
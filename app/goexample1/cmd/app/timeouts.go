@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"goexample/pkg/dependency"
+	"goexample/pkg/kafkapkg"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Dependencies with a timeout, the keys of DEPENDENCY_TIMEOUTS
+const dependencyRustexample = "rustexample"
+
+var (
+	// Timeouts of the calls to each dependency
+	dependencyTimeouts = dependency.Timeouts{
+		dependencyRustexample: 2 * time.Second,
+	}
+	// Sends the requests to rustexample, bounded by its timeout
+	rustexampleClient = &http.Client{}
+)
+
+// loadDependencyTimeouts applies DEPENDENCY_TIMEOUTS ("rustexample=2s") over the defaults
+func loadDependencyTimeouts() error {
+	if spec := os.Getenv("DEPENDENCY_TIMEOUTS"); spec != "" {
+		timeouts, err := dependency.ParseTimeouts(spec, dependencyTimeouts)
+		if err != nil {
+			return err
+		}
+		dependencyTimeouts = timeouts
+	}
+	rustexampleClient.Timeout = dependencyTimeouts[dependencyRustexample]
+	return nil
+}
+
+// getConfig handles GET /admin/config, the effective settings of the service
+func getConfig(clusters *kafkapkg.Clusters) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"dependency_timeouts":  dependencyTimeouts.Strings(),
+			"kafka_clusters":       clusters.Endpoints(),
+			"kafka_security":       clusters.Security(),
+			"kafka_topic_clusters": clusters.Routes(),
+		})
+	}
+}
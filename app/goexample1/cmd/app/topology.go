@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"goexample/pkg/telemetry"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Virtual services served by goexample1 and the services each of them calls in turn.
+// They report their own service.name so the trace service graph shows them as separate nodes.
+var virtualServices = map[string][]string{
+	"inventory": nil,
+	"pricing":   {"inventory"},
+	"shipping":  {"pricing", "inventory"},
+}
+
+// virtualTracers holds one tracer per virtual service, each from a provider with its own resource
+var virtualTracers = make(map[string]trace.Tracer)
+
+// startVirtualServices creates the tracer providers of the virtual services exporting to exp.
+// The returned function shuts them down.
+func startVirtualServices(exp sdktrace.SpanExporter) (func(context.Context), error) {
+	providers := make([]*sdktrace.TracerProvider, 0, len(virtualServices))
+	for name := range virtualServices {
+		r, err := telemetry.Resource(name)
+		if err != nil {
+			return nil, err
+		}
+		tp := sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(sharedExporter{exp}),
+			sdktrace.WithResource(r),
+		)
+		providers = append(providers, tp)
+		virtualTracers[name] = telemetry.Tracer(tp, name, telemetry.ScopeHTTPServer)
+	}
+
+	return func(ctx context.Context) {
+		for _, tp := range providers {
+			_ = tp.Shutdown(ctx)
+		}
+	}, nil
+}
+
+// sharedExporter is the exporter of the main tracer provider used by a virtual service. Shutting the
+// virtual provider down exports its queued spans but leaves the exporter to the main provider, which
+// shuts down last and would otherwise lose its final flush.
+type sharedExporter struct {
+	sdktrace.SpanExporter
+}
+
+func (sharedExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// virtualService handles GET /virtual/{service}
+func virtualService(w http.ResponseWriter, req *http.Request) {
+	name := req.PathValue("service")
+	if _, ok := virtualTracers[name]; !ok {
+		http.Error(w, "unknown service", http.StatusNotFound)
+		return
+	}
+
+	ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+	serveVirtual(ctx, name, req.Method+" /virtual/"+name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveVirtual records the server span of a virtual service and the calls it makes to its dependencies
+func serveVirtual(ctx context.Context, name, spanName string) {
+	ctx, span := virtualTracers[name].Start(ctx, spanName, trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	// Simulated work
+	time.Sleep(time.Duration(5+rand.Intn(25)) * time.Millisecond)
+
+	for _, dep := range virtualServices[name] {
+		clientCtx, client := virtualTracers[name].Start(ctx, "GET "+dep,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(telemetry.PeerAttributes(dep, "http://"+dep+":8080")...),
+			trace.WithAttributes(attribute.Bool("virtual", true)),
+		)
+		serveVirtual(clientCtx, dep, "GET /"+dep)
+		client.End()
+	}
+}
@@ -0,0 +1,136 @@
+package adminauth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var authFailuresTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "endpoint_auth_failures_total",
+		Help: "Total number of rejected requests to protected endpoints",
+	},
+	[]string{"endpoint", "reason"},
+)
+
+func init() {
+	prometheus.MustRegister(authFailuresTotal)
+}
+
+// Config describes how the metrics and admin endpoints are protected
+type Config struct {
+	Username    string
+	Password    string
+	BearerToken string
+	AllowedNets []*net.IPNet
+}
+
+// ConfigFromEnv reads ADMIN_BASIC_AUTH ("user:password"), ADMIN_BEARER_TOKEN
+// and ADMIN_ALLOWED_CIDRS ("10.0.0.0/8,127.0.0.1/32"). Everything is optional.
+func ConfigFromEnv() (Config, error) {
+	var cfg Config
+
+	if basic := os.Getenv("ADMIN_BASIC_AUTH"); basic != "" {
+		user, pass, ok := strings.Cut(basic, ":")
+		if !ok || user == "" || pass == "" {
+			return cfg, fmt.Errorf("ADMIN_BASIC_AUTH must be user:password")
+		}
+		cfg.Username, cfg.Password = user, pass
+	}
+	cfg.BearerToken = os.Getenv("ADMIN_BEARER_TOKEN")
+
+	if cidrs := os.Getenv("ADMIN_ALLOWED_CIDRS"); cidrs != "" {
+		for _, cidr := range strings.Split(cidrs, ",") {
+			_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+			if err != nil {
+				return cfg, fmt.Errorf("invalid ADMIN_ALLOWED_CIDRS entry %q: %w", cidr, err)
+			}
+			cfg.AllowedNets = append(cfg.AllowedNets, ipNet)
+		}
+	}
+	return cfg, nil
+}
+
+func (c Config) credentialsRequired() bool {
+	return c.Username != "" || c.BearerToken != ""
+}
+
+// Protect rejects requests to next coming from outside the allowed networks or lacking valid credentials.
+// When both basic auth and a bearer token are configured either one is accepted.
+func Protect(cfg Config, endpoint string, next http.Handler) http.Handler {
+	if !cfg.credentialsRequired() && len(cfg.AllowedNets) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.ipAllowed(r) {
+			authFailuresTotal.WithLabelValues(endpoint, "ip_denied").Inc()
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if cfg.credentialsRequired() {
+			if reason := cfg.checkCredentials(r); reason != "" {
+				authFailuresTotal.WithLabelValues(endpoint, reason).Inc()
+				if cfg.Username != "" {
+					w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+				}
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c Config) ipAllowed(r *http.Request) bool {
+	if len(c.AllowedNets) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range c.AllowedNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCredentials returns the failure reason, or an empty string when the request is authorized
+func (c Config) checkCredentials(r *http.Request) string {
+	if c.BearerToken != "" {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			if equal(token, c.BearerToken) {
+				return ""
+			}
+			return "invalid_credentials"
+		}
+	}
+	if c.Username != "" {
+		if user, pass, ok := r.BasicAuth(); ok {
+			if equal(user, c.Username) && equal(pass, c.Password) {
+				return ""
+			}
+			return "invalid_credentials"
+		}
+	}
+	return "missing_credentials"
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,49 @@
+package dedup
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU remembers the most recently seen message IDs up to a fixed capacity
+type LRU struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+// NewLRU creates an LRU holding at most capacity IDs
+func NewLRU(capacity int) *LRU {
+	return &LRU{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element, capacity),
+	}
+}
+
+// Seen marks id as seen and reports whether it had been seen before
+func (l *LRU) Seen(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[id]; ok {
+		l.order.MoveToFront(el)
+		return true
+	}
+
+	l.items[id] = l.order.PushFront(id)
+	if l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(string))
+	}
+	return false
+}
+
+// Len returns the number of remembered IDs
+func (l *LRU) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
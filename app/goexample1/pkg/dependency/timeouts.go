@@ -0,0 +1,42 @@
+// Package dependency holds the settings the services share about the dependencies they call
+package dependency
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+)
+
+// Timeouts bound every call to a dependency, by dependency name
+type Timeouts map[string]time.Duration
+
+// ParseTimeouts parses DEPENDENCY_TIMEOUTS ("goexample1=2s,kafka_write=5s") over defaults,
+// whose dependencies are the only ones known
+func ParseTimeouts(spec string, defaults Timeouts) (Timeouts, error) {
+	timeouts := maps.Clone(defaults)
+	for _, pair := range strings.Split(spec, ",") {
+		dependency, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid dependency timeout %q", pair)
+		}
+		if _, known := timeouts[dependency]; !known {
+			return nil, fmt.Errorf("unknown dependency %q", dependency)
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout for dependency %q: %q", dependency, value)
+		}
+		timeouts[dependency] = timeout
+	}
+	return timeouts, nil
+}
+
+// Strings returns the timeouts formatted like in DEPENDENCY_TIMEOUTS, e.g. for /admin/config
+func (t Timeouts) Strings() map[string]string {
+	s := make(map[string]string, len(t))
+	for dependency, timeout := range t {
+		s[dependency] = timeout.String()
+	}
+	return s
+}
@@ -0,0 +1,179 @@
+package kafkapkg
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// Supported values of the SASL_MECHANISM settings
+const (
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// Reasons of kafka_connection_failures_total
+const (
+	connectFailureNetwork = "network"
+	connectFailureTLS     = "tls"
+	connectFailureSASL    = "sasl"
+)
+
+// Time to open a broker connection including the TLS handshake, as the default kafka-go transport
+const dialTimeout = 3 * time.Second
+
+var (
+	connectionsOpenedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_connections_opened_total",
+			Help: "Total number of broker connections opened, after the TLS handshake when the cluster uses TLS",
+		},
+		[]string{"cluster"},
+	)
+
+	connectionFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_connection_failures_total",
+			Help: "Total number of failures connecting to Kafka brokers, reason is network, tls or sasl (rejected credentials)",
+		},
+		[]string{"cluster", "reason"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(connectionsOpenedTotal, connectionFailuresTotal)
+}
+
+// securityFromEnv reads the TLS and SASL settings of a cluster from the variables starting with prefix:
+// TLS ("true"), TLS_CA_FILE (implies TLS), TLS_SKIP_VERIFY ("true", self-signed demo brokers only),
+// SASL_MECHANISM (PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512), SASL_USERNAME and SASL_PASSWORD
+func securityFromEnv(prefix string) (*tls.Config, sasl.Mechanism, error) {
+	var tlsConfig *tls.Config
+	caFile := os.Getenv(prefix + "TLS_CA_FILE")
+	if os.Getenv(prefix+"TLS") == "true" || caFile != "" {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid %sTLS_CA_FILE: %w", prefix, err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, nil, fmt.Errorf("invalid %sTLS_CA_FILE: no PEM certificate in %s", prefix, caFile)
+			}
+		}
+		tlsConfig.InsecureSkipVerify = os.Getenv(prefix+"TLS_SKIP_VERIFY") == "true"
+	}
+
+	username, password := os.Getenv(prefix+"SASL_USERNAME"), os.Getenv(prefix+"SASL_PASSWORD")
+	var mechanism sasl.Mechanism
+	var err error
+	switch name := os.Getenv(prefix + "SASL_MECHANISM"); name {
+	case "":
+		return tlsConfig, nil, nil
+	case SASLPlain:
+		mechanism = plain.Mechanism{Username: username, Password: password}
+	case SASLScramSHA256:
+		mechanism, err = scram.Mechanism(scram.SHA256, username, password)
+	case SASLScramSHA512:
+		mechanism, err = scram.Mechanism(scram.SHA512, username, password)
+	default:
+		return nil, nil, fmt.Errorf("invalid %sSASL_MECHANISM %q, expected %s, %s or %s", prefix, name, SASLPlain, SASLScramSHA256, SASLScramSHA512)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid %sSASL credentials: %w", prefix, err)
+	}
+	if username == "" {
+		return nil, nil, fmt.Errorf("%sSASL_USERNAME is required with %sSASL_MECHANISM", prefix, prefix)
+	}
+	return tlsConfig, mechanism, nil
+}
+
+// dial opens a broker connection and does the TLS handshake itself rather than leaving it to
+// kafka-go, so network and TLS failures can be told apart
+func (c Cluster) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+	if err != nil {
+		connectionFailuresTotal.WithLabelValues(c.Name, connectFailureNetwork).Inc()
+		return nil, err
+	}
+	if c.TLS == nil {
+		connectionsOpenedTotal.WithLabelValues(c.Name).Inc()
+		return conn, nil
+	}
+
+	config := c.TLS
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName, _, _ = net.SplitHostPort(address)
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		connectionFailuresTotal.WithLabelValues(c.Name, connectFailureTLS).Inc()
+		return nil, fmt.Errorf("TLS handshake with %s: %w", address, err)
+	}
+	connectionsOpenedTotal.WithLabelValues(c.Name).Inc()
+	return tlsConn, nil
+}
+
+// transport returns the transport of the writers of the cluster
+func (c Cluster) transport() *kafka.Transport {
+	return &kafka.Transport{Dial: c.dial, SASL: c.SASL}
+}
+
+// Dialer returns a dialer for direct broker connections and the readers of the cluster
+func (c Cluster) Dialer() *kafka.Dialer {
+	return &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		DialFunc:      c.dial,
+		SASLMechanism: c.SASL,
+	}
+}
+
+// recordSASLFailure counts err as a connection failure when the broker rejected the credentials.
+// SASL runs inside kafka-go after the connection is opened, its failures only show in the errors.
+func (c Cluster) recordSASLFailure(err error) {
+	if errors.Is(err, kafka.SASLAuthenticationFailed) || errors.Is(err, kafka.UnsupportedSASLMechanism) || errors.Is(err, kafka.IllegalSASLState) {
+		connectionFailuresTotal.WithLabelValues(c.Name, connectFailureSASL).Inc()
+	}
+}
+
+// errorLogger counts the SASL failures of a reader, which only reports its errors as log lines
+func (c Cluster) errorLogger() kafka.Logger {
+	return kafka.LoggerFunc(func(msg string, args ...any) {
+		if c.SASL != nil && strings.Contains(fmt.Sprintf(msg, args...), "SASL") {
+			connectionFailuresTotal.WithLabelValues(c.Name, connectFailureSASL).Inc()
+		}
+	})
+}
+
+// Security describes the TLS and SASL settings, e.g. "tls+SCRAM-SHA-512", "plaintext" without either
+func (c Cluster) Security() string {
+	var parts []string
+	if c.TLS != nil {
+		parts = append(parts, "tls")
+	}
+	if c.SASL != nil {
+		parts = append(parts, c.SASL.Name())
+	}
+	if len(parts) == 0 {
+		return "plaintext"
+	}
+	return strings.Join(parts, "+")
+}
@@ -0,0 +1,67 @@
+package kafkapkg
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Max bytes fetched for one page
+const maxPageBytes = 10e6
+
+// PartitionPage is a bounded run of messages of one partition
+type PartitionPage struct {
+	Messages []kafka.Message
+	// Offset the next page starts at
+	Next int64
+	// End offset of the partition when the page was read
+	End int64
+}
+
+// ReadPartition reads up to limit messages of partition starting at offset, without joining a
+// consumer group or committing anything. An offset before the start of the partition starts there.
+func ReadPartition(ctx context.Context, topic string, partition int, offset int64, limit int) (PartitionPage, error) {
+	cluster := ClusterForTopic(topic)
+	var broker string
+	if len(cluster.Brokers) > 0 {
+		broker = cluster.Brokers[0]
+	}
+	conn, err := cluster.Dialer().DialLeader(ctx, "tcp", broker, topic, partition)
+	if err != nil {
+		return PartitionPage{}, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	first, last, err := conn.ReadOffsets()
+	if err != nil {
+		return PartitionPage{}, err
+	}
+	page := PartitionPage{Next: max(offset, first), End: last}
+	if page.Next >= last || limit <= 0 {
+		return page, nil
+	}
+	if _, err := conn.Seek(page.Next, kafka.SeekAbsolute); err != nil {
+		return PartitionPage{}, err
+	}
+
+	batch := conn.ReadBatch(1, maxPageBytes)
+	defer batch.Close()
+	for len(page.Messages) < limit && page.Next < last {
+		m, err := batch.ReadMessage()
+		if err != nil {
+			// A short page is fine, the caller continues from Next
+			if len(page.Messages) == 0 && !errors.Is(err, io.EOF) {
+				return page, err
+			}
+			break
+		}
+		page.Messages = append(page.Messages, m)
+		page.Next = m.Offset + 1
+	}
+	return page, nil
+}
@@ -0,0 +1,190 @@
+package kafkapkg
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go/sasl"
+)
+
+// DefaultCluster is the cluster at KAFKA_ENDPOINT, topics not routed elsewhere use it
+const DefaultCluster = "default"
+
+var clusterNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+var topicClusterInfo = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "kafka_topic_cluster_info",
+		Help: "Kafka cluster each topic routed with KAFKA_TOPIC_CLUSTERS is produced to and consumed from, always 1",
+	},
+	[]string{"topic", "cluster"},
+)
+
+func init() {
+	prometheus.MustRegister(topicClusterInfo)
+}
+
+// Cluster is a named Kafka cluster
+type Cluster struct {
+	Name    string
+	Brokers []string
+	// TLS is nil for plaintext connections
+	TLS *tls.Config
+	// SASL is nil when the brokers do not authenticate clients
+	SASL sasl.Mechanism
+}
+
+// Endpoint returns the comma separated broker list, as in KAFKA_ENDPOINT
+func (c Cluster) Endpoint() string {
+	return strings.Join(c.Brokers, ",")
+}
+
+// Clusters are the Kafka clusters the service connects to and the cluster of each topic
+type Clusters struct {
+	clusters map[string]Cluster
+	// Topics not in the map use the default cluster
+	topics map[string]string
+}
+
+// ClustersFromEnv reads the default cluster from KAFKA_ENDPOINT and the named clusters listed in
+// KAFKA_CLUSTERS (e.g. "replica,migration") from KAFKA_CLUSTER_<NAME>_ENDPOINT.
+// KAFKA_TOPIC_CLUSTERS routes topics to them, e.g. "orders=replica,tasks=migration".
+// TLS and SASL are set per cluster with the same prefixes, e.g. KAFKA_SASL_MECHANISM for the default
+// cluster and KAFKA_CLUSTER_<NAME>_SASL_MECHANISM, see securityFromEnv.
+func ClustersFromEnv() (*Clusters, error) {
+	tlsConfig, mechanism, err := securityFromEnv("KAFKA_")
+	if err != nil {
+		return nil, err
+	}
+	c := &Clusters{
+		clusters: map[string]Cluster{DefaultCluster: {
+			Name:    DefaultCluster,
+			Brokers: splitBrokers(os.Getenv("KAFKA_ENDPOINT")),
+			TLS:     tlsConfig,
+			SASL:    mechanism,
+		}},
+		topics: make(map[string]string),
+	}
+	for _, name := range strings.Split(os.Getenv("KAFKA_CLUSTERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !clusterNamePattern.MatchString(name) || name == DefaultCluster {
+			return nil, fmt.Errorf("invalid KAFKA_CLUSTERS: cluster name %q", name)
+		}
+		prefix := "KAFKA_CLUSTER_" + strings.ToUpper(name) + "_"
+		brokers := splitBrokers(os.Getenv(prefix + "ENDPOINT"))
+		if len(brokers) == 0 {
+			return nil, fmt.Errorf("cluster %s has no brokers, set %sENDPOINT", name, prefix)
+		}
+		tlsConfig, mechanism, err := securityFromEnv(prefix)
+		if err != nil {
+			return nil, err
+		}
+		c.clusters[name] = Cluster{Name: name, Brokers: brokers, TLS: tlsConfig, SASL: mechanism}
+	}
+
+	for _, route := range strings.Split(os.Getenv("KAFKA_TOPIC_CLUSTERS"), ",") {
+		route = strings.TrimSpace(route)
+		if route == "" {
+			continue
+		}
+		topic, name, ok := strings.Cut(route, "=")
+		if !ok || topic == "" {
+			return nil, fmt.Errorf("invalid KAFKA_TOPIC_CLUSTERS: %q, expected topic=cluster", route)
+		}
+		if _, ok := c.clusters[name]; !ok {
+			return nil, fmt.Errorf("invalid KAFKA_TOPIC_CLUSTERS: topic %s routed to unknown cluster %q", topic, name)
+		}
+		c.topics[topic] = name
+	}
+	return c, nil
+}
+
+func splitBrokers(endpoint string) []string {
+	var brokers []string
+	for _, broker := range strings.Split(endpoint, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	return brokers
+}
+
+// Default returns the cluster at KAFKA_ENDPOINT
+func (c *Clusters) Default() Cluster {
+	return c.clusters[DefaultCluster]
+}
+
+// ForTopic returns the cluster topic is produced to and consumed from
+func (c *Clusters) ForTopic(topic string) Cluster {
+	if name, ok := c.topics[topic]; ok {
+		return c.clusters[name]
+	}
+	return c.clusters[DefaultCluster]
+}
+
+// Routes returns the cluster names of the topics routed to another cluster than the default one
+func (c *Clusters) Routes() map[string]string {
+	routes := make(map[string]string, len(c.topics))
+	for topic, name := range c.topics {
+		routes[topic] = name
+	}
+	return routes
+}
+
+// Endpoints returns the broker lists by cluster name
+func (c *Clusters) Endpoints() map[string]string {
+	endpoints := make(map[string]string, len(c.clusters))
+	for name, cluster := range c.clusters {
+		endpoints[name] = cluster.Endpoint()
+	}
+	return endpoints
+}
+
+// Security returns the TLS and SASL settings by cluster name, without credentials
+func (c *Clusters) Security() map[string]string {
+	security := make(map[string]string, len(c.clusters))
+	for name, cluster := range c.clusters {
+		security[name] = cluster.Security()
+	}
+	return security
+}
+
+// Process wide clusters read from the environment on first use, see LoadClusters
+var envClusters struct {
+	once     sync.Once
+	clusters *Clusters
+	err      error
+}
+
+// LoadClusters reads the clusters from the environment once and exports the topic routes as
+// kafka_topic_cluster_info, call it at startup to fail on an invalid configuration.
+// GetKafkaWriter and GetKafkaReader connect to the cluster of their topic.
+func LoadClusters() (*Clusters, error) {
+	envClusters.once.Do(func() {
+		envClusters.clusters, envClusters.err = ClustersFromEnv()
+		if envClusters.err != nil {
+			return
+		}
+		for topic, name := range envClusters.clusters.topics {
+			topicClusterInfo.WithLabelValues(topic, name).Set(1)
+		}
+	})
+	return envClusters.clusters, envClusters.err
+}
+
+// ClusterForTopic returns the cluster of topic, the default cluster when the configuration is invalid
+func ClusterForTopic(topic string) Cluster {
+	clusters, err := LoadClusters()
+	if err != nil {
+		return Cluster{Name: DefaultCluster, Brokers: splitBrokers(os.Getenv("KAFKA_ENDPOINT"))}
+	}
+	return clusters.ForTopic(topic)
+}
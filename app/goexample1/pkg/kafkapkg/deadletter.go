@@ -0,0 +1,145 @@
+package kafkapkg
+
+import (
+	"context"
+	"goexample/pkg/errfmt"
+	"maps"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Headers added to dead letters, describing where the message came from and why it failed
+const (
+	DeadLetterTopicHeader     = "dlq-original-topic"
+	DeadLetterPartitionHeader = "dlq-original-partition"
+	DeadLetterOffsetHeader    = "dlq-original-offset"
+	DeadLetterErrorHeader     = "dlq-error"
+	// Category of the error as in errors_total, e.g. internal or timeout
+	DeadLetterErrorClassHeader = "dlq-error-class"
+	// Trace and span of the processing that failed, links a dead letter back to its trace
+	DeadLetterTraceIDHeader = "dlq-trace-id"
+	DeadLetterSpanIDHeader  = "dlq-span-id"
+	// Times the message failed processing, grows when a requeued message is dead lettered again
+	DeadLetterAttemptsHeader = "dlq-attempts"
+)
+
+// Prefix of the dead letter headers, those of an earlier dead lettering are replaced
+const deadLetterHeaderPrefix = "dlq-"
+
+// DeadLetterTopic returns the topic messages of topic are moved to when they cannot be processed
+func DeadLetterTopic(topic string) string {
+	return topic + "-dlq"
+}
+
+// DeadLetterAttempts returns the failed processing attempts recorded on m, 0 if it was never dead lettered
+func DeadLetterAttempts(m kafka.Message) int {
+	attempts, _ := strconv.Atoi(HeaderValue(m, DeadLetterAttemptsHeader))
+	return attempts
+}
+
+// DeadLetter writes m to the dead letter writer w, keeping its key, value and headers
+// (including the trace context) and recording its origin, its cause and the span that failed
+func DeadLetter(ctx context.Context, w *kafka.Writer, m kafka.Message, cause error, failed trace.SpanContext) error {
+	headers := make([]kafka.Header, 0, len(m.Headers)+8)
+	for _, h := range m.Headers {
+		if !strings.HasPrefix(h.Key, deadLetterHeaderPrefix) {
+			headers = append(headers, h)
+		}
+	}
+	headers = append(headers,
+		kafka.Header{Key: DeadLetterTopicHeader, Value: []byte(m.Topic)},
+		kafka.Header{Key: DeadLetterPartitionHeader, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: DeadLetterOffsetHeader, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		kafka.Header{Key: DeadLetterErrorHeader, Value: []byte(cause.Error())},
+		kafka.Header{Key: DeadLetterErrorClassHeader, Value: []byte(errfmt.Category(cause))},
+		kafka.Header{Key: DeadLetterAttemptsHeader, Value: []byte(strconv.Itoa(DeadLetterAttempts(m) + 1))},
+	)
+	if failed.IsValid() {
+		headers = append(headers,
+			kafka.Header{Key: DeadLetterTraceIDHeader, Value: []byte(failed.TraceID().String())},
+			kafka.Header{Key: DeadLetterSpanIDHeader, Value: []byte(failed.SpanID().String())},
+		)
+	}
+
+	return w.WriteMessages(ctx, kafka.Message{
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	})
+}
+
+// DeadLetterSpanContext returns the span whose processing of m failed, invalid if m carries none
+func DeadLetterSpanContext(m kafka.Message) trace.SpanContext {
+	traceID, err := trace.TraceIDFromHex(HeaderValue(m, DeadLetterTraceIDHeader))
+	if err != nil {
+		return trace.SpanContext{}
+	}
+	spanID, err := trace.SpanIDFromHex(HeaderValue(m, DeadLetterSpanIDHeader))
+	if err != nil {
+		return trace.SpanContext{}
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+}
+
+// Requeue writes dead letter m back to its original topic through w. The dead letter headers stay so a
+// repeated failure counts another attempt, the trace context is replaced by the one of ctx and the
+// message gets a new ID since consumers already saw the original one. The trace context of CloudEvents
+// is replaced in their ce_ headers or structured envelope.
+func Requeue(ctx context.Context, w *kafka.Writer, m kafka.Message) error {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	value := m.Value
+	var prefix string
+	if event, mode, err := decodeEvent(m); err == nil {
+		switch mode {
+		case EventModeBinary:
+			prefix = cloudEventsHeaderPrefix
+		case EventModeStructured:
+			for _, field := range otel.GetTextMapPropagator().Fields() {
+				delete(event.Extensions, field)
+			}
+			maps.Copy(event.Extensions, carrier)
+			encoded, err := event.Message(mode)
+			if err != nil {
+				return err
+			}
+			value = encoded.Value
+			carrier = propagation.MapCarrier{}
+		}
+	}
+
+	replaced := map[string]bool{MessageIDHeader: true}
+	for _, field := range otel.GetTextMapPropagator().Fields() {
+		replaced[field] = true
+		replaced[prefix+field] = true
+	}
+
+	headers := make([]kafka.Header, 0, len(m.Headers)+4)
+	for _, h := range m.Headers {
+		if !replaced[h.Key] {
+			headers = append(headers, h)
+		}
+	}
+	for key, value := range carrier {
+		headers = append(headers, kafka.Header{Key: prefix + key, Value: []byte(value)})
+	}
+	headers = append(headers, kafka.Header{Key: MessageIDHeader, Value: []byte(uuid.NewString())})
+
+	return w.WriteMessages(ctx, kafka.Message{
+		Key:     m.Key,
+		Value:   value,
+		Headers: headers,
+	})
+}
@@ -0,0 +1,79 @@
+package kafkapkg
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Filter selects the messages of a shared topic a handler processes.
+// A message matches when it satisfies every condition, the zero Filter matches everything.
+type Filter struct {
+	// Headers that must be present with the given value
+	Headers map[string]string
+	// Prefix the message key must start with
+	KeyPrefix string
+}
+
+// Match reports whether m satisfies the filter
+func (f Filter) Match(m kafka.Message) bool {
+	if !strings.HasPrefix(string(m.Key), f.KeyPrefix) {
+		return false
+	}
+	for key, value := range f.Headers {
+		if !hasHeader(m, key, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasHeader(m kafka.Message, key, value string) bool {
+	for _, h := range m.Headers {
+		if h.Key == key && string(h.Value) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFilter parses comma separated conditions: "header:<key>=<value>" and "key-prefix:<prefix>"
+func ParseFilter(spec string) (Filter, error) {
+	f := Filter{Headers: make(map[string]string)}
+	if strings.TrimSpace(spec) == "" {
+		return f, nil
+	}
+
+	for _, cond := range strings.Split(spec, ",") {
+		kind, arg, ok := strings.Cut(strings.TrimSpace(cond), ":")
+		if !ok {
+			return f, fmt.Errorf("invalid filter condition %q", cond)
+		}
+		switch kind {
+		case "header":
+			key, value, ok := strings.Cut(arg, "=")
+			if !ok || key == "" {
+				return f, fmt.Errorf("invalid header condition %q, expected header:<key>=<value>", cond)
+			}
+			f.Headers[key] = value
+		case "key-prefix":
+			f.KeyPrefix = arg
+		default:
+			return f, fmt.Errorf("unknown filter condition %q", kind)
+		}
+	}
+	return f, nil
+}
+
+// FilterFromEnv reads the filter of a handler from KAFKA_FILTER_<HANDLER>, e.g.
+// KAFKA_FILTER_ORDERS="header:variant=canary,key-prefix:order-"
+func FilterFromEnv(handler string) (Filter, error) {
+	name := "KAFKA_FILTER_" + strings.ToUpper(handler)
+	f, err := ParseFilter(os.Getenv(name))
+	if err != nil {
+		return f, fmt.Errorf("%s: %w", name, err)
+	}
+	return f, nil
+}
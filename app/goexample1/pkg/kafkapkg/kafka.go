@@ -1,28 +1,47 @@
 package kafkapkg
 
-import (
-	"os"
-	"strings"
+import "github.com/segmentio/kafka-go"
 
-	"github.com/segmentio/kafka-go"
-)
+// MessageIDHeader carries a producer assigned unique ID used to detect redelivered messages
+const MessageIDHeader = "message-id"
 
+// GetKafkaWriter creates a writer of topic on the cluster of the topic, see LoadClusters
 func GetKafkaWriter(topic string) *kafka.Writer {
+	cluster := ClusterForTopic(topic)
 	return &kafka.Writer{
-		Addr:                   kafka.TCP(os.Getenv("KAFKA_ENDPOINT")),
+		Addr:                   kafka.TCP(cluster.Brokers...),
+		Transport:              cluster.transport(),
 		Topic:                  topic,
 		Balancer:               &kafka.LeastBytes{},
 		AllowAutoTopicCreation: true,
+		Completion: func(_ []kafka.Message, err error) {
+			cluster.recordSASLFailure(err)
+		},
 	}
 }
 
-func GetKafkaReader(topic, groupID string) *kafka.Reader {
-	brokers := strings.Split(os.Getenv("KAFKA_ENDPOINT"), ",")
+// GetKafkaReader creates a consumer group reader on the cluster of topic, logger receives its
+// lifecycle messages (e.g. a GroupObserver)
+func GetKafkaReader(topic, groupID string, logger kafka.Logger) *kafka.Reader {
+	cluster := ClusterForTopic(topic)
 	return kafka.NewReader(kafka.ReaderConfig{
-		Brokers:  brokers,
-		GroupID:  groupID,
-		Topic:    topic,
-		MinBytes: 10e3, // 10KB
-		MaxBytes: 10e6, // 10MB
+		Brokers:     cluster.Brokers,
+		Dialer:      cluster.Dialer(),
+		GroupID:     groupID,
+		Topic:       topic,
+		MinBytes:    10e3, // 10KB
+		MaxBytes:    10e6, // 10MB
+		Logger:      logger,
+		ErrorLogger: cluster.errorLogger(),
 	})
 }
+
+// HeaderValue returns the value of the first header with the given key
+func HeaderValue(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+package kafkapkg
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+var (
+	committedOffsetDesc = prometheus.NewDesc(
+		"kafka_consumer_committed_offset",
+		"Offset committed by the consumer group, the next offset it will consume",
+		[]string{"group", "topic", "partition"}, nil,
+	)
+	latestOffsetDesc = prometheus.NewDesc(
+		"kafka_consumer_latest_offset",
+		"End offset of the partition as of the last consumed message",
+		[]string{"group", "topic", "partition"}, nil,
+	)
+	partitionLagDesc = prometheus.NewDesc(
+		"kafka_consumer_partition_lag",
+		"Messages between the committed offset and the end of the partition",
+		[]string{"group", "topic", "partition"}, nil,
+	)
+	timeLagDesc = prometheus.NewDesc(
+		"kafka_consumer_time_lag_seconds",
+		"Age of the last consumed message while messages are pending, 0 once the partition is caught up",
+		[]string{"group", "topic", "partition"}, nil,
+	)
+)
+
+// consumerOffsets is the checkpoint of the last consumed message of every partition
+var consumerOffsets = &offsetCollector{partitions: make(map[partitionKey]partitionOffsets)}
+
+func init() {
+	prometheus.MustRegister(consumerOffsets)
+}
+
+type partitionKey struct {
+	group, topic string
+	partition    int
+}
+
+type partitionOffsets struct {
+	committed, latest int64
+	// Producer timestamp of the last consumed message
+	lastMessage time.Time
+}
+
+// offsetCollector exports the partition checkpoints, the time lag is computed at scrape time
+// so it keeps growing while a consumer is stuck
+type offsetCollector struct {
+	mu         sync.Mutex
+	partitions map[partitionKey]partitionOffsets
+}
+
+// RecordOffsets checkpoints m as consumed by group. Readers commit right after ReadMessage,
+// so the committed offset is the one following m.
+func RecordOffsets(group string, m kafka.Message) {
+	consumerOffsets.mu.Lock()
+	defer consumerOffsets.mu.Unlock()
+	consumerOffsets.partitions[partitionKey{group: group, topic: m.Topic, partition: m.Partition}] = partitionOffsets{
+		committed:   m.Offset + 1,
+		latest:      m.HighWaterMark,
+		lastMessage: m.Time,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *offsetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- committedOffsetDesc
+	ch <- latestOffsetDesc
+	ch <- partitionLagDesc
+	ch <- timeLagDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *offsetCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for key, p := range c.partitions {
+		labels := []string{key.group, key.topic, strconv.Itoa(key.partition)}
+		lag := max(p.latest-p.committed, 0)
+		timeLag := 0.0
+		if lag > 0 && !p.lastMessage.IsZero() {
+			timeLag = now.Sub(p.lastMessage).Seconds()
+		}
+
+		ch <- prometheus.MustNewConstMetric(committedOffsetDesc, prometheus.GaugeValue, float64(p.committed), labels...)
+		ch <- prometheus.MustNewConstMetric(latestOffsetDesc, prometheus.GaugeValue, float64(p.latest), labels...)
+		ch <- prometheus.MustNewConstMetric(partitionLagDesc, prometheus.GaugeValue, float64(lag), labels...)
+		ch <- prometheus.MustNewConstMetric(timeLagDesc, prometheus.GaugeValue, timeLag, labels...)
+	}
+}
@@ -0,0 +1,188 @@
+package kafkapkg
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Log formats of the kafka-go consumer group lifecycle the observer reacts to
+const (
+	generationEndedFormat = "stopped heartbeat for group %s\n"
+	joinedFormat          = "joined group %s as member %s in generation %d"
+	subscribedFormat      = "subscribed to topics and partitions: %+v"
+	leavingFormat         = "Leaving group %s, member %s"
+)
+
+var (
+	rebalancesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_consumer_group_rebalances_total",
+			Help: "Total number of consumer group generations joined, the first join included",
+		},
+		[]string{"group"},
+	)
+
+	groupGeneration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_consumer_group_generation",
+			Help: "Current generation of the consumer group",
+		},
+		[]string{"group"},
+	)
+
+	assignedPartitions = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_consumer_assigned_partitions",
+			Help: "Number of partitions assigned to this consumer per topic",
+		},
+		[]string{"group", "topic"},
+	)
+
+	rebalanceDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kafka_consumer_group_rebalance_duration_seconds",
+			Help:    "Time from a generation ending until partitions of the next one are assigned, consumption stops meanwhile",
+			Buckets: []float64{.01, .05, .1, .5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{"group"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(rebalancesTotal)
+	prometheus.MustRegister(groupGeneration)
+	prometheus.MustRegister(assignedPartitions)
+	prometheus.MustRegister(rebalanceDuration)
+}
+
+// GroupObserver turns the consumer group lifecycle of a kafka.Reader into metrics, logs and
+// a span per rebalance. kafka-go has no rebalance callbacks, so it is installed as the reader's
+// Logger and matches the format strings of the lifecycle messages.
+type GroupObserver struct {
+	group  string
+	logger *logrus.Logger
+	tracer trace.Tracer
+
+	mu sync.Mutex
+	// Span and start of the rebalance in progress, nil between rebalances
+	span    trace.Span
+	started time.Time
+	topics  map[string]bool
+}
+
+// NewGroupObserver creates an observer for the consumer group group
+func NewGroupObserver(group string, logger *logrus.Logger, tracer trace.Tracer) *GroupObserver {
+	return &GroupObserver{group: group, logger: logger, tracer: tracer, topics: make(map[string]bool)}
+}
+
+// Printf implements kafka.Logger
+func (o *GroupObserver) Printf(format string, args ...interface{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	switch format {
+	case generationEndedFormat:
+		o.startRebalance()
+	case joinedFormat:
+		if len(args) < 3 {
+			return
+		}
+		generation := intArg(args[2])
+		o.startRebalance()
+		rebalancesTotal.WithLabelValues(o.group).Inc()
+		groupGeneration.WithLabelValues(o.group).Set(float64(generation))
+		o.span.AddEvent("joined group", trace.WithAttributes(
+			attribute.String("messaging.consumer.group.member", fmt.Sprint(args[1])),
+			attribute.Int("messaging.consumer.group.generation", int(generation)),
+		))
+		o.logger.WithFields(logrus.Fields{
+			"group":      o.group,
+			"member":     args[1],
+			"generation": generation,
+		}).Warn("Joined Kafka consumer group")
+	case subscribedFormat:
+		if len(args) < 1 {
+			return
+		}
+		o.assigned(partitionsByTopic(args[0]))
+	case leavingFormat:
+		for topic := range o.topics {
+			assignedPartitions.WithLabelValues(o.group, topic).Set(0)
+		}
+		o.logger.WithField("group", o.group).Info("Leaving Kafka consumer group")
+	}
+}
+
+// startRebalance opens the rebalance span unless one is open already
+func (o *GroupObserver) startRebalance() {
+	if o.span != nil {
+		return
+	}
+	o.started = time.Now()
+	_, o.span = o.tracer.Start(context.Background(), "Kafka consumer group rebalance",
+		trace.WithAttributes(attribute.String("messaging.consumer.group.name", o.group)),
+	)
+}
+
+// assigned records the partitions of the new generation and ends the rebalance
+func (o *GroupObserver) assigned(partitions map[string]int) {
+	// Topics no longer assigned drop to zero
+	for topic := range o.topics {
+		if _, ok := partitions[topic]; !ok {
+			assignedPartitions.WithLabelValues(o.group, topic).Set(0)
+		}
+	}
+	total := 0
+	for topic, n := range partitions {
+		o.topics[topic] = true
+		assignedPartitions.WithLabelValues(o.group, topic).Set(float64(n))
+		total += n
+	}
+
+	fields := logrus.Fields{"group": o.group, "partitions": total}
+	if o.span != nil {
+		elapsed := time.Since(o.started)
+		rebalanceDuration.WithLabelValues(o.group).Observe(elapsed.Seconds())
+		o.span.SetAttributes(attribute.Int("messaging.consumer.assigned_partitions", total))
+		o.span.AddEvent("partitions assigned")
+		o.span.End()
+		o.span = nil
+		fields["duration"] = elapsed.String()
+	}
+	o.logger.WithFields(fields).Warn("Kafka consumer group partitions assigned")
+}
+
+// partitionsByTopic counts the partitions per topic in the offsets map kafka-go logs on subscribe,
+// keyed by an unexported struct whose first field is the topic
+func partitionsByTopic(offsets interface{}) map[string]int {
+	partitions := make(map[string]int)
+	v := reflect.ValueOf(offsets)
+	if v.Kind() != reflect.Map {
+		return partitions
+	}
+	for _, key := range v.MapKeys() {
+		topic := "unknown"
+		if key.Kind() == reflect.Struct && key.NumField() > 0 && key.Field(0).Kind() == reflect.String {
+			topic = key.Field(0).String()
+		}
+		partitions[topic]++
+	}
+	return partitions
+}
+
+// intArg returns an integer log argument of any integer type, 0 for anything else
+func intArg(arg interface{}) int64 {
+	v := reflect.ValueOf(arg)
+	if v.CanInt() {
+		return v.Int()
+	}
+	return 0
+}
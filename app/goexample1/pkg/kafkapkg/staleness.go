@@ -0,0 +1,43 @@
+package kafkapkg
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// StalePolicy discards consumed messages older than TTL, a zero TTL keeps every message
+type StalePolicy struct {
+	TTL time.Duration
+}
+
+// StalePolicyFromEnv reads the TTL of a handler's messages from KAFKA_MESSAGE_TTL_<HANDLER>,
+// e.g. KAFKA_MESSAGE_TTL_HELLO=30s, unset or 0 keeps every message
+func StalePolicyFromEnv(handler string) (StalePolicy, error) {
+	name := "KAFKA_MESSAGE_TTL_" + strings.ToUpper(handler)
+	value := os.Getenv(name)
+	if value == "" {
+		return StalePolicy{}, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		return StalePolicy{}, fmt.Errorf("invalid %s: %q", name, value)
+	}
+	return StalePolicy{TTL: ttl}, nil
+}
+
+// Age returns how long before now m was produced, 0 when m carries no timestamp
+func Age(m kafka.Message, now time.Time) time.Duration {
+	if m.Time.IsZero() {
+		return 0
+	}
+	return max(now.Sub(m.Time), 0)
+}
+
+// Stale reports whether a message of the given age is to be discarded
+func (p StalePolicy) Stale(age time.Duration) bool {
+	return p.TTL > 0 && age > p.TTL
+}
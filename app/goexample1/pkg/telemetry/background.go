@@ -0,0 +1,40 @@
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Detach returns a context which keeps the values of ctx but is not cancelled with it.
+// The returned context carries a new root span linked to the span found in ctx, so
+// work outliving the request shows up as its own trace pointing back to the request.
+// If timeout is positive the returned context is cancelled after it elapses.
+func Detach(ctx context.Context, tracer trace.Tracer, name string, timeout time.Duration) (context.Context, trace.Span, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		detached, cancel = context.WithTimeout(detached, timeout)
+	}
+
+	detached, span := tracer.Start(detached, name,
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+	)
+	return detached, span, cancel
+}
+
+// Go runs fn in a new goroutine using a detached context (see Detach).
+// The span is ended and the context released once fn returns.
+func Go(ctx context.Context, tracer trace.Tracer, name string, timeout time.Duration, fn func(context.Context)) {
+	detached, span, cancel := Detach(ctx, tracer, name, timeout)
+
+	go func() {
+		defer cancel()
+		defer span.End()
+
+		fn(detached)
+	}()
+}
@@ -0,0 +1,38 @@
+package telemetry
+
+import (
+	"goexample/pkg/errfmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// clientAttemptsKey holds the connection attempts of a request sent with a WithClientTrace context
+type clientAttemptsKey struct{}
+
+// FinishClientSpan records the outcome of the outbound request req on the client span of its
+// context: the response status (4xx and 5xx are errors), error.type of failed requests and
+// responses, and http.request.resend_count when the transport sent the request more than once
+func FinishClientSpan(req *http.Request, res *http.Response, err error) {
+	span := trace.SpanFromContext(req.Context())
+	if attempts, ok := req.Context().Value(clientAttemptsKey{}).(*atomic.Int32); ok {
+		if resends := attempts.Load() - 1; resends > 0 {
+			span.SetAttributes(attribute.Int("http.request.resend_count", int(resends)))
+		}
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", errfmt.Category(err)))
+		span.SetStatus(codes.Error, "request failed")
+		return
+	}
+	SetHTTPStatus(span, res.StatusCode, trace.SpanKindClient)
+	if res.StatusCode >= 400 {
+		span.SetAttributes(attribute.String("error.type", strconv.Itoa(res.StatusCode)))
+	}
+}
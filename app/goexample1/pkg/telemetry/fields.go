@@ -0,0 +1,23 @@
+package telemetry
+
+import "github.com/sirupsen/logrus"
+
+// FieldsHook is a logrus hook adding a fixed set of fields to every entry
+type FieldsHook struct {
+	Fields logrus.Fields
+}
+
+// Levels implements logrus.Hook
+func (h FieldsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (h FieldsHook) Fire(entry *logrus.Entry) error {
+	for key, value := range h.Fields {
+		if _, ok := entry.Data[key]; !ok {
+			entry.Data[key] = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package telemetry
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// labeledGatherer adds constant labels to every metric of the wrapped gatherer
+type labeledGatherer struct {
+	gatherer prometheus.Gatherer
+	labels   []*dto.LabelPair
+}
+
+// WithConstLabels wraps g so that all gathered metrics carry the given labels.
+// Labels already present on a metric are left untouched.
+func WithConstLabels(g prometheus.Gatherer, labels prometheus.Labels) prometheus.Gatherer {
+	if len(labels) == 0 {
+		return g
+	}
+
+	pairs := make([]*dto.LabelPair, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, &dto.LabelPair{Name: &name, Value: &value})
+	}
+	return &labeledGatherer{gatherer: g, labels: pairs}
+}
+
+// Gather implements prometheus.Gatherer
+func (g *labeledGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			metric.Label = mergeLabels(metric.Label, g.labels)
+		}
+	}
+	return families, err
+}
+
+func mergeLabels(existing, extra []*dto.LabelPair) []*dto.LabelPair {
+	present := make(map[string]bool, len(existing))
+	for _, l := range existing {
+		present[l.GetName()] = true
+	}
+	for _, l := range extra {
+		if !present[l.GetName()] {
+			existing = append(existing, l)
+		}
+	}
+	// Exposition expects labels sorted by name
+	sort.Slice(existing, func(i, j int) bool { return existing[i].GetName() < existing[j].GetName() })
+	return existing
+}
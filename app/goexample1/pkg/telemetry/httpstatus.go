@@ -0,0 +1,94 @@
+package telemetry
+
+import (
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StatusClass normalizes an HTTP status code to its class ("2xx", "4xx", ...) for use as a metric label
+func StatusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// SpanStatus returns the span status for an HTTP response code following the OTel HTTP conventions:
+// 5xx is an error for every span, 4xx only for client spans (the server handled the request correctly).
+func SpanStatus(code int, kind trace.SpanKind) (codes.Code, string) {
+	switch {
+	case code >= 500:
+		return codes.Error, http.StatusText(code)
+	case code >= 400 && kind == trace.SpanKindClient:
+		return codes.Error, http.StatusText(code)
+	default:
+		return codes.Unset, ""
+	}
+}
+
+// SetHTTPStatus records the response code and the resulting status on span. rpc.grpc.status_code
+// is left to gRPC spans, the semantic conventions do not define it for HTTP.
+func SetHTTPStatus(span trace.Span, code int, kind trace.SpanKind) {
+	span.SetAttributes(attribute.Int("http.response.status_code", code))
+	if c, desc := SpanStatus(code, kind); c != codes.Unset {
+		span.SetStatus(c, desc)
+	}
+}
+
+// gRPC status codes, see https://grpc.github.io/grpc/core/md_doc_statuscodes.html
+const (
+	grpcOK                 = 0
+	grpcCanceled           = 1
+	grpcUnknown            = 2
+	grpcInvalidArgument    = 3
+	grpcDeadlineExceeded   = 4
+	grpcNotFound           = 5
+	grpcAlreadyExists      = 6
+	grpcPermissionDenied   = 7
+	grpcResourceExhausted  = 8
+	grpcFailedPrecondition = 9
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+	grpcUnavailable        = 14
+	grpcUnauthenticated    = 16
+)
+
+// GRPCStatus maps an HTTP status code to the closest gRPC status code
+func GRPCStatus(code int) int {
+	switch code {
+	case http.StatusBadRequest:
+		return grpcInvalidArgument
+	case http.StatusUnauthorized:
+		return grpcUnauthenticated
+	case http.StatusForbidden:
+		return grpcPermissionDenied
+	case http.StatusNotFound:
+		return grpcNotFound
+	case http.StatusConflict:
+		return grpcAlreadyExists
+	case http.StatusPreconditionFailed:
+		return grpcFailedPrecondition
+	case http.StatusTooManyRequests:
+		return grpcResourceExhausted
+	case 499: // client closed request
+		return grpcCanceled
+	case http.StatusNotImplemented:
+		return grpcUnimplemented
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		return grpcUnavailable
+	case http.StatusGatewayTimeout:
+		return grpcDeadlineExceeded
+	}
+	switch {
+	case code >= 200 && code < 400:
+		return grpcOK
+	case code >= 500:
+		return grpcInternal
+	default:
+		return grpcUnknown
+	}
+}
@@ -0,0 +1,73 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithClientTrace returns a context which makes outgoing requests record their DNS lookup,
+// connection, TLS handshake and time to first byte as events on the span found in ctx.
+// Connection attempts are also counted for FinishClientSpan.
+func WithClientTrace(ctx context.Context) context.Context {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return ctx
+	}
+	attempts := &atomic.Int32{}
+	ctx = context.WithValue(ctx, clientAttemptsKey{}, attempts)
+
+	event := func(name string, attrs ...attribute.KeyValue) {
+		span.AddEvent(name, trace.WithAttributes(attrs...))
+	}
+	// Errors are only noted on the event, a failed dial may still be followed by a successful one
+	done := func(name string, err error) {
+		if err != nil {
+			event(name, attribute.String("error", err.Error()))
+			return
+		}
+		event(name)
+	}
+
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			// The transport asks for a connection again when it resends the request
+			attempts.Add(1)
+			event("http.get_conn", attribute.String("net.peer.address", hostPort))
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			event("http.got_conn",
+				attribute.Bool("http.conn.reused", info.Reused),
+				attribute.Bool("http.conn.was_idle", info.WasIdle),
+			)
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			event("dns.start", attribute.String("dns.host", info.Host))
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			done("dns.done", info.Err)
+		},
+		ConnectStart: func(network, addr string) {
+			event("connect.start", attribute.String("net.peer.address", addr))
+		},
+		ConnectDone: func(network, addr string, err error) {
+			done("connect.done", err)
+		},
+		TLSHandshakeStart: func() {
+			event("tls.start")
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			done("tls.done", err)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			done("http.wrote_request", info.Err)
+		},
+		GotFirstResponseByte: func() {
+			event("http.first_response_byte")
+		},
+	})
+}
@@ -0,0 +1,16 @@
+package telemetry
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Replaces the default Go collector with one also exporting the scheduler and GC
+// histograms of runtime/metrics, e.g. go_sched_latencies_seconds (time goroutines wait
+// to run, rising when the CPU is saturated) and go_sched_pauses_total_gc_seconds
+func init() {
+	prometheus.Unregister(collectors.NewGoCollector())
+	prometheus.MustRegister(collectors.NewGoCollector(
+		collectors.WithGoCollectorRuntimeMetrics(collectors.MetricsScheduler, collectors.MetricsGC),
+	))
+}